@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Modes for importing a receipt whose id is already stored.
+const (
+	importSkip      = "skip"
+	importOverwrite = "overwrite"
+)
+
+// Struct for the outcome of importing a single line.
+type ImportResult struct {
+	Line   int          `json:"line"`
+	ID     string       `json:"id,omitempty"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Struct for returning the outcome of an import given as JSON.
+type ImportSummary struct {
+	Imported int            `json:"imported"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// Function to build middleware that only lets through requests carrying the admin token as a bearer token.
+func requireAdmin(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeProblem(w, http.StatusUnauthorized, codeUnauthorized, "a valid admin token is required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Struct for returning the outcome of a purge given as JSON.
+type PurgeResponse struct {
+	Removed int `json:"removed"`
+}
+
+// Function to handle requests to remove every stored receipt, which must carry confirm=true.
+// The ids are read first and each receipt is then removed under its own lock, so requests served meanwhile
+// see a receipt either as it was or as not found. Receipts submitted while the purge runs may be kept.
+// Duplicate detection and idempotency keys are reset, as the receipts they point at are gone.
+func (s *Server) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("confirm") != "true" {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, "purging every stored receipt requires confirm=true")
+		return
+	}
+
+	var ids []string
+	err := s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	response := PurgeResponse{}
+	for _, id := range ids {
+		unlock := s.locks.lock(id)
+		err := s.store.Delete(r.Context(), id)
+		unlock()
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		response.Removed++
+	}
+
+	s.hashes.reset()
+	s.idempotency.forgetStored()
+
+	log.Printf("purge: removed %d receipts", response.Removed)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Function to handle export requests, streaming every stored receipt as one JSON document per line.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	written := false
+	err := s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		written = true
+		return encoder.Encode(ReceiptDocument{ID: id, Receipt: receipt})
+	})
+	if err == nil {
+		return
+	}
+
+	//Once the first line is sent the status can't be changed, so a failure part way through cuts the export short.
+	if !written {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("export stopped early: %v", err)
+}
+
+// Function to handle import requests, storing each line of an export in turn.
+// Every line is checked like a submitted receipt and gets its own result, so one bad line
+// doesn't stop the rest. Ids already stored are skipped unless mode=overwrite is given.
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = importSkip
+	}
+	if mode != importSkip && mode != importOverwrite {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("invalid mode %q: expected %s or %s", mode, importSkip, importOverwrite))
+		return
+	}
+
+	//Each line may be as large as a submitted receipt.
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(s.config.MaxBodyBytes))
+
+	summary := ImportSummary{Results: []ImportResult{}}
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		result := s.importLine(r.Context(), scanner.Bytes(), mode)
+		result.Line = line
+		switch result.Status {
+		case "imported":
+			summary.Imported++
+		case "skipped":
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	//A line too long to read ends the import, the lines before it have already been stored.
+	if err := scanner.Err(); err != nil {
+		summary.Failed++
+		summary.Results = append(summary.Results, ImportResult{Line: line + 1, Status: "failed", Error: "Error reading line: " + err.Error()})
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// Function to import a single line of an export, returning its result without the line number.
+// The receipt is indexed for duplicate detection like one replaced through the API.
+// Amounts are read in the point format that exports are written in, whatever the server's number format.
+func (s *Server) importLine(ctx context.Context, data []byte, mode string) ImportResult {
+	var header struct {
+		ID          string     `json:"id"`
+		Points      *int       `json:"points"`
+		CreatedAt   *time.Time `json:"createdAt"`
+		Revision    int64      `json:"revision"`
+		RuleVersion string     `json:"ruleVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return ImportResult{Status: "failed", Error: "Error parsing JSON: " + err.Error()}
+	}
+
+	id, err := parseReceiptID(header.ID)
+	if err != nil {
+		return ImportResult{ID: header.ID, Status: "failed", Error: err.Error()}
+	}
+
+	receipt, err := decodeReceipt(bytes.NewReader(data), decodeOptions{})
+	var badAmounts *amountFormatError
+	if errors.As(err, &badAmounts) {
+		return ImportResult{ID: id, Status: "failed", Error: "invalid receipt", Errors: badAmounts.Errors}
+	}
+	if err != nil {
+		return ImportResult{ID: id, Status: "failed", Error: "Error parsing JSON: " + err.Error()}
+	}
+	if errs := receipt.Validate(s.config, s.clock.Now()); len(errs) > 0 {
+		return ImportResult{ID: id, Status: "failed", Error: "invalid receipt", Errors: errs}
+	}
+
+	//Keep the points the receipt was scored with, the rules that scored them, and the time it was submitted.
+	receipt.Points = header.Points
+	receipt.RuleVersion = header.RuleVersion
+	receipt.CreatedAt = header.CreatedAt
+	if receipt.Points == nil {
+		if err := scoreReceipt(receipt); err != nil {
+			return ImportResult{ID: id, Status: "failed", Error: "Error calculating points"}
+		}
+	}
+
+	//Keep the revision the receipt was exported with, unless it would not be past the revision it replaces.
+	unlock := s.locks.lock(id)
+	defer unlock()
+	stored, err := s.store.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("receipt store error: %v", err)
+		return ImportResult{ID: id, Status: "failed", Error: "Error accessing receipt store"}
+	}
+	if stored != nil && mode == importSkip {
+		return ImportResult{ID: id, Status: "skipped"}
+	}
+	receipt.Revision = max(header.Revision, 1)
+	if stored != nil && receipt.Revision <= stored.Revision {
+		receipt.Revision = stored.Revision + 1
+	}
+
+	if err := s.store.Save(ctx, id, receipt); err != nil {
+		log.Printf("receipt store error: %v", err)
+		return ImportResult{ID: id, Status: "failed", Error: "Error accessing receipt store"}
+	}
+	s.indexReplaced(id, receipt)
+	return ImportResult{ID: id, Status: "imported"}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Function to export every receipt from the server under test as NDJSON.
+func (ts *testServer) export(t *testing.T) string {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/admin/export", "", adminHeader...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/export: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Fatalf("GET /admin/export: got Content-Type %q, want application/x-ndjson", contentType)
+	}
+	return readBody(t, resp)
+}
+
+// Function to import NDJSON into the server under test with the given mode, returning the summary.
+func (ts *testServer) importLines(t *testing.T, lines string, mode string) ImportSummary {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/admin/import?mode="+mode, lines, adminHeader...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /admin/import: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var summary ImportSummary
+	decodeBody(t, resp, &summary)
+	return summary
+}
+
+func TestExportImportsIntoAFreshStoreUnchanged(t *testing.T) {
+	source := newTestServer(t, adminConfig())
+	for _, body := range []string{targetReceipt, cornerReceipt, receiptWithItems(3)} {
+		source.submit(t, body)
+	}
+	source.patch(t, source.submit(t, targetReceipt), `{"purchaseTime":"14:33"}`)
+	export := source.export(t)
+	if lines := strings.Count(export, "\n"); lines != 4 {
+		t.Fatalf("export has %d lines, want 4", lines)
+	}
+
+	fresh := newTestServer(t, adminConfig())
+	summary := fresh.importLines(t, export, importSkip)
+	if summary.Imported != 4 || summary.Skipped != 0 || summary.Failed != 0 {
+		t.Fatalf("import summary: got %+v, want 4 imported", summary)
+	}
+	if !sameContents(t, fresh.contents(t), source.contents(t)) {
+		t.Fatalf("imported store differs from the exported one:\n%v\n%v", fresh.contents(t), source.contents(t))
+	}
+	if exported := fresh.export(t); exported != export {
+		t.Fatalf("exporting the imported store: got\n%s\nwant\n%s", exported, export)
+	}
+}
+
+func TestImportSkipsOrOverwritesStoredIDs(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	id := ts.submit(t, targetReceipt)
+	export := ts.export(t)
+	ts.do(t, "PUT", "/receipts/"+id, cornerReceipt)
+
+	if summary := ts.importLines(t, export, importSkip); summary.Skipped != 1 || summary.Imported != 0 {
+		t.Fatalf("import with mode=skip: got %+v, want one skipped", summary)
+	}
+	if got := ts.points(t, id); got != 109 {
+		t.Fatalf("points after a skipped import: got %d, want 109", got)
+	}
+
+	if summary := ts.importLines(t, export, importOverwrite); summary.Imported != 1 {
+		t.Fatalf("import with mode=overwrite: got %+v, want one imported", summary)
+	}
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after an overwriting import: got %d, want 28", got)
+	}
+	//The overwritten receipt moves past the revision it replaced rather than going back to the exported one.
+	if revision := ts.stored(t, id).Revision; revision != 3 {
+		t.Fatalf("revision after an overwriting import: got %d, want 3", revision)
+	}
+
+	expectProblem(t, ts.do(t, "POST", "/admin/import?mode=merge", export, adminHeader...), http.StatusBadRequest, codeInvalidParameter)
+}
+
+func TestImportReportsEachBadLineAndKeepsTheRest(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	other := newTestServer(t, adminConfig())
+	other.submit(t, targetReceipt)
+	good := strings.TrimSuffix(other.export(t), "\n")
+
+	lines := strings.Join([]string{
+		good,
+		`not json`,
+		``,
+		`{"id":"not-an-id","retailer":"Target"}`,
+		`{"id":"` + newReceiptID() + `","retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[],"total":"0.00"}`,
+	}, "\n")
+	summary := ts.importLines(t, lines, importSkip)
+	if summary.Imported != 1 || summary.Failed != 3 {
+		t.Fatalf("import summary: got %+v, want one imported and three failed", summary)
+	}
+
+	want := []struct {
+		line   int
+		status string
+	}{{1, "imported"}, {2, "failed"}, {4, "failed"}, {5, "failed"}}
+	if len(summary.Results) != len(want) {
+		t.Fatalf("import results: got %+v, want %d", summary.Results, len(want))
+	}
+	for i, result := range summary.Results {
+		if result.Line != want[i].line || result.Status != want[i].status {
+			t.Errorf("result %d: got line %d %s, want line %d %s", i, result.Line, result.Status, want[i].line, want[i].status)
+		}
+	}
+	if errs := summary.Results[3].Errors; len(errs) != 1 || errs[0].Field != "items" {
+		t.Errorf("invalid receipt errors: got %v, want one for items", errs)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 1 {
+		t.Fatalf("store holds %v, want the one good receipt", ids)
+	}
+}
+
+// Function to purge the store of the server under test with the given query, returning the response.
+func (ts *testServer) purge(t *testing.T, query string, header ...string) *http.Response {
+	t.Helper()
+
+	return ts.do(t, "DELETE", "/admin/receipts"+query, "", header...)
+}
+
+func TestPurgeNeedsConfirmationAndTheAdminToken(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	ids := []string{ts.submit(t, targetReceipt), ts.submit(t, cornerReceipt)}
+	slices.Sort(ids)
+
+	for _, query := range []string{"", "?confirm=false", "?confirm=yes"} {
+		expectProblem(t, ts.purge(t, query, adminHeader...), http.StatusBadRequest, codeInvalidParameter)
+	}
+	for _, header := range [][]string{nil, {"Authorization", "Bearer wrong-token"}, {"Authorization", testAdminToken}} {
+		expectProblem(t, ts.purge(t, "?confirm=true", header...), http.StatusUnauthorized, codeUnauthorized)
+	}
+	if stored := storedIDs(t, ts.store); !equalIDs(stored, ids) {
+		t.Fatalf("store holds %v after refused purges, want %v", stored, ids)
+	}
+}
+
+func TestPurgeRemovesEveryReceiptAndWhatPointsAtThem(t *testing.T) {
+	cfg := adminConfig()
+	cfg.Dedupe = true
+	ts := newTestServer(t, cfg)
+
+	keyed := createdID(t, ts.submitWithKey(t, "purge-key", targetReceipt))
+	ids := []string{keyed, ts.submit(t, cornerReceipt), ts.submit(t, receiptWithItems(3))}
+
+	resp := ts.purge(t, "?confirm=true", adminHeader...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE /admin/receipts: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var purged PurgeResponse
+	decodeBody(t, resp, &purged)
+	if purged.Removed != len(ids) {
+		t.Fatalf("purge: got %d removed, want %d", purged.Removed, len(ids))
+	}
+
+	for _, id := range ids {
+		expectProblem(t, ts.do(t, "GET", "/receipts/"+id+"/points", ""), http.StatusNotFound, codeNotFound)
+	}
+	var listing ReceiptListResponse
+	decodeBody(t, ts.do(t, "GET", "/receipts", ""), &listing)
+	if len(listing.Receipts) != 0 {
+		t.Fatalf("listing after the purge: got %+v, want nothing", listing.Receipts)
+	}
+
+	//The idempotency key and the duplicate index no longer lead to the purged receipts.
+	again := createdID(t, ts.submitWithKey(t, "purge-key", targetReceipt))
+	fresh := createdID(t, ts.do(t, "POST", "/receipts/process", cornerReceipt))
+	if again == keyed || fresh == ids[1] {
+		t.Fatalf("resubmitting after the purge: got %s and %s, want new ids", again, fresh)
+	}
+	if ts.points(t, again) != 28 || ts.points(t, fresh) != 109 {
+		t.Fatal("receipts resubmitted after the purge were not stored afresh")
+	}
+
+	//Purging again removes only what was resubmitted, and then nothing is left to remove.
+	decodeBody(t, ts.purge(t, "?confirm=true", adminHeader...), &purged)
+	if purged.Removed != 2 {
+		t.Fatalf("second purge: got %d removed, want the 2 resubmitted", purged.Removed)
+	}
+	decodeBody(t, ts.purge(t, "?confirm=true", adminHeader...), &purged)
+	if purged.Removed != 0 {
+		t.Fatalf("purge of an empty store: got %d removed, want 0", purged.Removed)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Statuses reported for a receipt accepted for scoring in the background.
+const (
+	statusPending = "pending"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// Seconds clients are asked to wait before looking again at a receipt that is still pending.
+const pendingRetryAfter = "1"
+
+// Errors returned when a receipt can't be accepted for scoring in the background.
+var (
+	errQueueFull    = errors.New("the scoring queue is full, retry later")
+	errQueueStopped = errors.New("the server is shutting down")
+)
+
+// Struct for a receipt accepted for scoring in the background, under the id its submitter was given.
+type asyncJob struct {
+	id      string
+	receipt *Receipt
+}
+
+// Number of receipts that failed to be scored in the background that are remembered, the oldest being
+// forgotten first, so a failing store can't grow the record without bound.
+const maxAsyncFailures = 1024
+
+// Struct for a receipt accepted for scoring in the background that could not be scored or stored, with
+// the reason given to clients looking it up.
+type asyncFailure struct {
+	receipt *Receipt
+	reason  string
+}
+
+// Function to describe the failure to clients looking up the receipt under the given id.
+func (f asyncFailure) message(id string) string {
+	return "Receipt " + id + " could not be scored: " + f.reason
+}
+
+// Struct for the receipts accepted for scoring in the background and the workers scoring them.
+// An accepted receipt is kept here, where lookups by id find it, until it has been scored and stored,
+// so it is never missing from both. The queue is bounded, and a full queue turns new receipts away
+// rather than holding up the requests submitting them.
+// A receipt that fails is moved from pending to failed, so lookups report the failure instead of not finding it.
+type asyncScorer struct {
+	mu      sync.Mutex
+	pending map[string]*Receipt
+	failed  map[string]asyncFailure
+	order   []string
+	stopped bool
+
+	queue chan asyncJob
+	wg    sync.WaitGroup
+}
+
+// Function to start the given number of workers, each handing the receipts it takes from a queue of
+// the given size to process. An error returned by process marks the receipt as failed with the error as reason.
+func newAsyncScorer(workers int, size int, process func(asyncJob) error) *asyncScorer {
+	a := &asyncScorer{
+		pending: make(map[string]*Receipt),
+		failed:  make(map[string]asyncFailure),
+		queue:   make(chan asyncJob, size),
+	}
+	for i := 0; i < workers; i++ {
+		a.wg.Add(1)
+		go a.work(process)
+	}
+	return a
+}
+
+// Function to process queued receipts in turn until the queue is closed and empty.
+func (a *asyncScorer) work(process func(asyncJob) error) {
+	defer a.wg.Done()
+
+	for job := range a.queue {
+		err := process(job)
+
+		a.mu.Lock()
+		delete(a.pending, job.id)
+		if err != nil {
+			a.failLocked(job, err)
+		}
+		a.mu.Unlock()
+	}
+}
+
+// Function to record a receipt as failed, forgetting the oldest failure once too many are kept. The caller must hold mu.
+func (a *asyncScorer) failLocked(job asyncJob, err error) {
+	if len(a.order) == maxAsyncFailures {
+		delete(a.failed, a.order[0])
+		a.order = a.order[1:]
+	}
+	a.failed[job.id] = asyncFailure{receipt: job.receipt, reason: err.Error()}
+	a.order = append(a.order, job.id)
+}
+
+// Function to accept a receipt for scoring, without waiting for a worker.
+// Returns errQueueFull when the queue has no room, or errQueueStopped once the scorer is closed.
+func (a *asyncScorer) submit(id string, receipt *Receipt) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopped {
+		return errQueueStopped
+	}
+	select {
+	case a.queue <- asyncJob{id: id, receipt: receipt}:
+		a.pending[id] = receipt
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// Function to look up a receipt that has been accepted but not yet stored.
+func (a *asyncScorer) lookup(id string) (*Receipt, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	receipt, ok := a.pending[id]
+	return receipt, ok
+}
+
+// Function to look up a receipt that was accepted but could not be scored or stored.
+func (a *asyncScorer) failure(id string) (asyncFailure, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	failure, ok := a.failed[id]
+	return failure, ok
+}
+
+// Function to stop accepting receipts and wait until every one already accepted has been scored and stored.
+func (a *asyncScorer) Close() {
+	a.mu.Lock()
+	if !a.stopped {
+		a.stopped = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	a.wg.Wait()
+}
+
+// Function to score and store a receipt accepted for scoring in the background, under the id it was given.
+// There is no request left to answer, so failures are logged and returned with the reason clients looking
+// the receipt up are given. With duplicate detection enabled the receipt is indexed for later submissions,
+// but as its id was already handed out it is stored even when it duplicates an earlier one.
+func (s *Server) scoreAccepted(job asyncJob) error {
+	ctx := context.Background()
+
+	//Lookups keep being given the pending receipt as submitted until it is stored, so a copy is scored.
+	scored := *job.receipt
+	receipt := &scored
+	if err := scoreReceipt(receipt); err != nil {
+		log.Printf("async: scoring receipt %s: %v", job.id, err)
+		return errors.New("Error calculating points")
+	}
+	receipt.Revision = 1
+
+	if err := s.store.Save(ctx, job.id, receipt); err != nil {
+		log.Printf("async: storing receipt %s: %v", job.id, err)
+		return errors.New("Error accessing receipt store")
+	}
+	if s.config.Dedupe {
+		hash := receiptHash(receipt)
+		unlock := s.hashes.lock()
+		if _, exists := s.hashes.lookup(hash); !exists {
+			s.hashes.set(hash, job.id)
+		}
+		unlock()
+	}
+	s.receiptProcessed(job.id, receipt)
+	return nil
+}
+
+// Function to report whether a receipt submission should be scored in the background, either because
+// the server does so for every submission or because the request carries a Prefer: respond-async header.
+func (s *Server) wantsAsync(r *http.Request) bool {
+	return s.config.Async || hasPreference(r, "respond-async")
+}
+
+// Function to read a receipt from a request body in any of the accepted formats and validate it,
+// leaving it to be scored later. Receipts are rejected here exactly as when they are scored at once.
+// On failure the problem response is written and false is returned.
+func (s *Server) readUnscoredReceipt(w http.ResponseWriter, r *http.Request, body io.Reader) (*Receipt, bool) {
+	decode, invalidCode, invalidPrefix := decodeReceipt, codeInvalidJSON, "Error parsing JSON: "
+	if isXMLRequest(r) {
+		decode, invalidCode, invalidPrefix = decodeXMLReceipt, codeInvalidXML, "Error parsing XML: "
+	}
+	if isProtobufRequest(r) {
+		decode, invalidCode, invalidPrefix = decodeProtobufReceipt, codeInvalidProtobuf, "Error parsing protobuf: "
+	}
+
+	receipt, err := decode(body, s.config.decodeOptions())
+	var badAmounts *amountFormatError
+	if errors.As(err, &badAmounts) {
+		writeValidationProblem(w, badAmounts.Errors)
+		return nil, false
+	}
+	if err != nil {
+		writeDecodeError(w, err, invalidCode, invalidPrefix)
+		return nil, false
+	}
+
+	if errs := receipt.Validate(s.config, s.clock.Now()); len(errs) > 0 {
+		writeValidationProblem(w, errs)
+		return nil, false
+	}
+	return receipt, true
+}
+
+// Function to handle a receipt submission to be scored in the background, answering once the receipt is validated
+// and queued. A full queue is answered with a 503, as is a submission arriving while the server shuts down.
+// Any Idempotency-Key is finished with the id given, its release is left to the caller.
+func (s *Server) acceptReceipt(w http.ResponseWriter, r *http.Request, body io.Reader, key string) {
+	receipt, ok := s.readUnscoredReceipt(w, r, body)
+	if !ok {
+		return
+	}
+
+	//Record when the receipt was submitted, it is stored under this id once scored.
+	now := s.clock.Now().UTC()
+	receipt.CreatedAt = &now
+	id := newReceiptID()
+
+	if err := s.async.submit(id, receipt); err != nil {
+		w.Header().Set("Retry-After", pendingRetryAfter)
+		writeProblem(w, http.StatusServiceUnavailable, codeQueueFull, err.Error())
+		return
+	}
+	if key != "" {
+		s.idempotency.finish(key, id)
+	}
+	s.writeAccepted(w, r, id)
+}
+
+// Function to write the response to a receipt accepted for scoring in the background, a 202 pointing at
+// where its status can be followed. Retries of the submission get the same response while it is pending.
+func (s *Server) writeAccepted(w http.ResponseWriter, r *http.Request, id string) {
+	links := s.receiptLinks(r, id)
+	w.Header().Set("Location", links.Self)
+	w.Header().Set("Preference-Applied", "respond-async")
+	w.Header().Set("Retry-After", pendingRetryAfter)
+	writeResponse(w, r, http.StatusAccepted, ReceiptResponse{ID: id, Status: statusPending, Links: links})
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/receiptpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Struct for a store whose saves wait to be let through, so tests can hold receipts in the scoring queue.
+// Each save signals on entered before waiting for release to be closed.
+type gatedStore struct {
+	ReceiptStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+// Function to save a receipt once the gate is opened.
+func (s *gatedStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.ReceiptStore.Save(ctx, id, receipt)
+}
+
+// Function to let every save through, from now on.
+func (s *gatedStore) open() {
+	select {
+	case <-s.release:
+	default:
+		close(s.release)
+	}
+}
+
+// Function to start a server under test on a memory store behind a closed gate, returning the gate's store.
+// The gate is opened when the test ends, so the scorer can finish.
+func newGatedServer(t *testing.T, cfg Config) (*testServer, *gatedStore) {
+	t.Helper()
+
+	store := &gatedStore{
+		ReceiptStore: newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts),
+		entered:      make(chan struct{}, 16),
+		release:      make(chan struct{}),
+	}
+	ts := newTestServerWithStore(t, cfg, store)
+	t.Cleanup(func() { store.open() })
+	return ts, store
+}
+
+// Function to submit a receipt for scoring in the background, failing unless it is accepted, and return its id.
+func (ts *testServer) submitAsync(t *testing.T, body string) string {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/receipts/process", body, "Prefer", "respond-async")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST with respond-async: got %d, want 202: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var accepted ReceiptResponse
+	decodeBody(t, resp, &accepted)
+	if accepted.Status != statusPending || resp.Header.Get("Location") != accepted.Links.Self {
+		t.Fatalf("POST with respond-async: got %+v with Location %q, want it pending", accepted, resp.Header.Get("Location"))
+	}
+	return accepted.ID
+}
+
+func TestReceiptScoredInTheBackgroundGoesFromPendingToDone(t *testing.T) {
+	ts, store := newGatedServer(t, testConfig())
+	id := ts.submitAsync(t, targetReceipt)
+	<-store.entered
+
+	resp := ts.do(t, "GET", "/receipts/"+id+"/points", "")
+	expectProblem(t, resp, http.StatusConflict, codeReceiptPending)
+	if resp.Header.Get("Retry-After") != pendingRetryAfter {
+		t.Fatalf("GET points of a pending receipt: got Retry-After %q, want %s", resp.Header.Get("Retry-After"), pendingRetryAfter)
+	}
+	var document ReceiptDocument
+	decodeBody(t, ts.do(t, "GET", "/receipts/"+id, ""), &document)
+	if document.Status != statusPending || document.Retailer != "Target" {
+		t.Fatalf("GET a pending receipt: got %+v, want it pending", document)
+	}
+
+	//Closing the scorer waits for the receipt to be stored.
+	store.open()
+	ts.async.Close()
+
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points once scored: got %d, want 28", got)
+	}
+	document = ReceiptDocument{}
+	decodeBody(t, ts.do(t, "GET", "/receipts/"+id, ""), &document)
+	if document.Status != statusDone || document.Points == nil || *document.Points != 28 {
+		t.Fatalf("GET a scored receipt: got %+v, want it done", document)
+	}
+}
+
+func TestPendingReceiptIsGivenAsSubmittedWhileItIsScored(t *testing.T) {
+	cfg := testConfig()
+	cfg.AsyncWorkers = 4
+	ts, store := newGatedServer(t, cfg)
+
+	//The receipt is scored before it reaches the gate, yet lookups still find it as it was submitted.
+	id := ts.submitAsync(t, targetReceipt)
+	<-store.entered
+	var document ReceiptDocument
+	decodeBody(t, ts.do(t, "GET", "/receipts/"+id, ""), &document)
+	if document.Status != statusPending || document.Points != nil || document.RuleVersion != "" || document.Revision != 0 {
+		t.Fatalf("GET a receipt being scored: got %+v, want it pending as submitted", document)
+	}
+
+	//Receipts are looked up while the workers score them, which the race detector checks.
+	ids := []string{id}
+	for i := 0; i < 8; i++ {
+		ids = append(ids, ts.submitAsync(t, cornerReceipt))
+	}
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				resp, err := http.Get(ts.http.URL + "/receipts/" + id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+			}
+		}(id)
+	}
+	store.open()
+	wg.Wait()
+	ts.async.Close()
+
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points once scored: got %d, want 28", got)
+	}
+}
+
+func TestBreakdownOfAReceiptNotYetScoredIsAnsweredLikeItsPoints(t *testing.T) {
+	ts, store := newGatedServer(t, testConfig())
+	id := ts.submitAsync(t, targetReceipt)
+	<-store.entered
+
+	resp := ts.do(t, "GET", "/receipts/"+id+"/points/breakdown", "")
+	expectProblem(t, resp, http.StatusConflict, codeReceiptPending)
+	if resp.Header.Get("Retry-After") != pendingRetryAfter {
+		t.Fatalf("GET breakdown of a pending receipt: got Retry-After %q, want %s", resp.Header.Get("Retry-After"), pendingRetryAfter)
+	}
+
+	failing, stub := newStubbedServer(t, testConfig())
+	stub.fail(errors.New("disk full"))
+	var accepted ReceiptResponse
+	decodeBody(t, failing.do(t, "POST", "/receipts/process", targetReceipt, "Prefer", "respond-async"), &accepted)
+	failing.async.Close()
+	expectProblem(t, failing.do(t, "GET", "/receipts/"+accepted.ID+"/points/breakdown", ""), http.StatusInternalServerError, codeScoringFailed)
+}
+
+func TestFullScoringQueueTurnsSubmissionsAway(t *testing.T) {
+	cfg := testConfig()
+	cfg.AsyncWorkers = 1
+	cfg.AsyncQueueSize = 1
+	ts, store := newGatedServer(t, cfg)
+
+	//The worker holds the first receipt at the gate and the second fills the queue.
+	first := ts.submitAsync(t, targetReceipt)
+	<-store.entered
+	second := ts.submitAsync(t, cornerReceipt)
+
+	resp := ts.do(t, "POST", "/receipts/process", targetReceipt, "Prefer", "respond-async")
+	expectProblem(t, resp, http.StatusServiceUnavailable, codeQueueFull)
+	if resp.Header.Get("Retry-After") != pendingRetryAfter {
+		t.Fatalf("POST to a full queue: got Retry-After %q, want %s", resp.Header.Get("Retry-After"), pendingRetryAfter)
+	}
+
+	store.open()
+	ts.async.Close()
+	if ts.points(t, first) != 28 || ts.points(t, second) != 109 {
+		t.Fatal("the accepted receipts were not scored once the queue drained")
+	}
+}
+
+func TestReceiptFailingInTheBackgroundIsReportedAsFailed(t *testing.T) {
+	ts, store := newStubbedServer(t, testConfig())
+	store.fail(errors.New("disk full"))
+
+	resp := ts.do(t, "POST", "/receipts/process", targetReceipt, "Prefer", "respond-async")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST with respond-async: got %d, want 202", resp.StatusCode)
+	}
+	var accepted ReceiptResponse
+	decodeBody(t, resp, &accepted)
+
+	//Closing the scorer waits for the receipt to be taken off the queue and fail to be stored.
+	ts.async.Close()
+
+	resp = ts.do(t, "GET", "/receipts/"+accepted.ID+"/points", "")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GET points of a failed receipt: got %d, want 500", resp.StatusCode)
+	}
+	var problem Problem
+	decodeBody(t, resp, &problem)
+	if problem.Code != codeScoringFailed {
+		t.Fatalf("GET points of a failed receipt: got code %s, want %s", problem.Code, codeScoringFailed)
+	}
+
+	resp = ts.do(t, "GET", "/receipts/"+accepted.ID, "")
+	var document ReceiptDocument
+	decodeBody(t, resp, &document)
+	if resp.StatusCode != http.StatusOK || document.Status != statusFailed || document.Receipt == nil || document.Retailer != "Target" {
+		t.Fatalf("GET a failed receipt: got %d %+v, want it failed", resp.StatusCode, document)
+	}
+
+	_, err := ts.grpcClient(t).GetPoints(context.Background(), &receiptpb.GetPointsRequest{Id: accepted.ID})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("GetPoints of a failed receipt: got %v, want INTERNAL", err)
+	}
+}
+
+func TestAsyncScorerForgetsTheOldestFailures(t *testing.T) {
+	fail := errors.New("failed")
+	a := newAsyncScorer(1, maxAsyncFailures+1, func(asyncJob) error { return fail })
+
+	ids := make([]string, maxAsyncFailures+1)
+	for i := range ids {
+		ids[i] = newReceiptID()
+		if err := a.submit(ids[i], &Receipt{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Close()
+
+	if _, failed := a.failure(ids[0]); failed {
+		t.Error("the oldest failure was kept past the limit")
+	}
+	for _, id := range ids[1:] {
+		if failure, failed := a.failure(id); !failed || failure.reason != "failed" {
+			t.Fatalf("failure of %s: got %+v, %v, want it kept", id, failure, failed)
+		}
+	}
+}
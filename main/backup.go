@@ -0,0 +1,80 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Version of the backup format, recorded in every backup's manifest.
+const backupVersion = 1
+
+// Struct for the last line of a backup, recording what the lines before it should hold.
+// Checksum is the hex SHA-256 of every record line before it, newlines included, as uncompressed.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	Records   int       `json:"records"`
+	Checksum  string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Struct for the line a backup's manifest is written on, set apart from the receipt records by its key.
+type backupManifestLine struct {
+	Manifest *BackupManifest `json:"manifest"`
+}
+
+// Function to handle requests for a backup of every stored receipt, as gzip compressed NDJSON to save as a file.
+// Each line holds a receipt with its id, points, submission time, and revision, as in /admin/export, and a
+// manifest line after them gives the number of records and a checksum of them.
+// The store is read through Each as the backup is written, so no lock is held for the whole backup, and receipts
+// changed while it runs may or may not be included. A failure part way through leaves the backup without
+// its manifest, so it can't be mistaken for a complete one.
+func (s *Server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	now := s.clock.Now().UTC()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="receipts-`+now.Format("20060102T150405Z")+`.ndjson.gz"`)
+
+	compressed := gzip.NewWriter(w)
+	checksum := sha256.New()
+	records := newBackupEncoder(io.MultiWriter(compressed, checksum))
+
+	manifest := BackupManifest{Version: backupVersion, CreatedAt: now}
+	err := s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		manifest.Records++
+		return records.Encode(ReceiptDocument{ID: id, Receipt: receipt})
+	})
+	if err != nil {
+		if manifest.Records == 0 {
+			w.Header().Del("Content-Disposition")
+			w.Header().Del("Content-Type")
+			writeStoreError(w, err)
+			return
+		}
+		log.Printf("backup stopped early: %v", err)
+		return
+	}
+
+	manifest.Checksum = hex.EncodeToString(checksum.Sum(nil))
+	if err := newBackupEncoder(compressed).Encode(backupManifestLine{Manifest: &manifest}); err != nil {
+		log.Printf("backup stopped early: %v", err)
+		return
+	}
+	if err := compressed.Close(); err != nil {
+		log.Printf("backup stopped early: %v", err)
+		return
+	}
+	log.Printf("backup: wrote %d receipts", manifest.Records)
+}
+
+// Function to create an encoder writing one JSON document per line in the form backups are written in,
+// leaving characters such as & in retailer names as they were submitted.
+func newBackupEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder
+}
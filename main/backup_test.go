@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Function to check a backup downloaded from the server under test against its own manifest, returning the
+// ids of the receipts it holds in order.
+func (ts *testServer) checkBackup(t *testing.T) []string {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/admin/backup", "", adminHeader...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/backup: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/gzip" {
+		t.Fatalf("GET /admin/backup: got Content-Type %q, want application/gzip", contentType)
+	}
+	want := `attachment; filename="receipts-20240101T120000Z.ndjson.gz"`
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != want {
+		t.Fatalf("GET /admin/backup: got Content-Disposition %q, want %q", disposition, want)
+	}
+
+	decompressed, err := gzip.NewReader(bytes.NewReader([]byte(readBody(t, resp))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The manifest is on the last line, after the record lines it describes.
+	backup := string(data)
+	last := strings.LastIndex(strings.TrimSuffix(backup, "\n"), "\n") + 1
+	records, manifestLine := backup[:last], backup[last:]
+	var line backupManifestLine
+	if err := json.Unmarshal([]byte(manifestLine), &line); err != nil || line.Manifest == nil {
+		t.Fatalf("backup ends with %q, want its manifest: %v", manifestLine, err)
+	}
+	sum := sha256.Sum256([]byte(records))
+	want = hex.EncodeToString(sum[:])
+	manifest := *line.Manifest
+	if manifest.Version != backupVersion || manifest.Checksum != want || !manifest.CreatedAt.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("manifest: got %+v, want version %d and checksum %s", manifest, backupVersion, want)
+	}
+
+	var ids []string
+	for _, record := range strings.Split(strings.TrimSuffix(records, "\n"), "\n") {
+		if record == "" {
+			continue
+		}
+		var document ReceiptDocument
+		if err := json.Unmarshal([]byte(record), &document); err != nil {
+			t.Fatalf("record %q: %v", record, err)
+		}
+		ids = append(ids, document.ID)
+	}
+	if manifest.Records != len(ids) {
+		t.Fatalf("manifest: got %d records, want the %d in the backup", manifest.Records, len(ids))
+	}
+	return ids
+}
+
+func TestBackupHoldsEveryReceiptAndAManifestMatchingThem(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	ids := []string{ts.submit(t, targetReceipt), ts.submit(t, cornerReceipt), ts.submit(t, receiptWithItems(3))}
+	slices.Sort(ids)
+
+	if got := ts.checkBackup(t); !equalIDs(got, ids) {
+		t.Fatalf("backup holds %v, want %v", got, ids)
+	}
+}
+
+func TestBackupOfAnEmptyStoreIsJustItsManifest(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+
+	if got := ts.checkBackup(t); len(got) != 0 {
+		t.Fatalf("backup of an empty store holds %v, want nothing", got)
+	}
+}
+
+func TestBackupNeedsTheAdminToken(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	ts.submit(t, targetReceipt)
+
+	for _, header := range [][]string{nil, {"Authorization", "Bearer wrong-token"}} {
+		resp := ts.do(t, "GET", "/admin/backup", "", header...)
+		expectProblem(t, resp, http.StatusUnauthorized, codeUnauthorized)
+		if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+			t.Fatalf("GET /admin/backup without the token: got Content-Disposition %q, want none", disposition)
+		}
+	}
+
+	//Without an admin token configured there are no admin endpoints at all.
+	closed := newTestServer(t, testConfig())
+	expectProblem(t, closed.do(t, "GET", "/admin/backup", "", adminHeader...), http.StatusNotFound, codeNotFound)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Largest number of ids accepted by one batch points lookup.
+const maxBatchIDs = 100
+
+// Struct for incoming batch points lookups given as JSON.
+type BatchPointsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// Struct for an id in a batch lookup that could not be a receipt id.
+type InvalidID struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// Struct for returning the points of several receipts given as JSON.
+// Points holds every receipt found, Missing the well-formed ids with no receipt, and Invalid the malformed ids.
+type BatchPointsResponse struct {
+	Points  map[string]int `json:"points"`
+	Missing []string       `json:"missing"`
+	Invalid []InvalidID    `json:"invalid"`
+}
+
+// Function to handle requests for the points of several stored receipts at once.
+// Every id is checked and looked up on its own, so malformed and unknown ids are reported without
+// failing the rest. Ids given more than once are answered once.
+func (s *Server) batchPointsHandler(w http.ResponseWriter, r *http.Request) {
+	var request BatchPointsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeProblem(w, http.StatusBadRequest, codeInvalidJSON, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	switch {
+	case len(request.IDs) == 0:
+		writeValidationProblem(w, []FieldError{{Field: "ids", Code: fieldRequired, Message: "ids is required"}})
+		return
+	case len(request.IDs) > maxBatchIDs:
+		writeValidationProblem(w, []FieldError{{Field: "ids", Code: fieldTooMany, Message: fmt.Sprintf("ids has more than %d entries", maxBatchIDs)}})
+		return
+	}
+
+	response := BatchPointsResponse{Points: make(map[string]int), Missing: []string{}, Invalid: []InvalidID{}}
+	seen := make(map[string]bool)
+	for _, given := range request.IDs {
+		if seen[given] {
+			continue
+		}
+		seen[given] = true
+
+		id, err := parseReceiptID(given)
+		if err != nil {
+			response.Invalid = append(response.Invalid, InvalidID{ID: given, Error: err.Error()})
+			continue
+		}
+
+		receipt, err := s.store.Get(r.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			response.Missing = append(response.Missing, id)
+			continue
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		points, err := storedPoints(receipt)
+		if err != nil {
+			writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+			return
+		}
+		response.Points[id] = points
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Function to ask the server under test for the points of several receipts at once.
+func (ts *testServer) batchPoints(t *testing.T, ids ...string) BatchPointsResponse {
+	t.Helper()
+
+	body, err := json.Marshal(BatchPointsRequest{IDs: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := ts.do(t, "POST", "/receipts/points/batch", string(body))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /receipts/points/batch: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response BatchPointsResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestBatchPointsReportsFoundMissingAndMalformedIDs(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	target := ts.submit(t, targetReceipt)
+	corner := ts.submit(t, cornerReceipt)
+	missing := newReceiptID()
+
+	response := ts.batchPoints(t, target, "not-an-id", missing, strings.ToUpper(corner), target, "")
+	if want := map[string]int{target: 28, corner: 109}; !reflect.DeepEqual(response.Points, want) {
+		t.Errorf("points: got %v, want %v", response.Points, want)
+	}
+	if !equalIDs(response.Missing, []string{missing}) {
+		t.Errorf("missing: got %v, want [%s]", response.Missing, missing)
+	}
+	if len(response.Invalid) != 2 || response.Invalid[0].ID != "not-an-id" || response.Invalid[1].ID != "" {
+		t.Fatalf("invalid: got %+v, want not-an-id and the empty id", response.Invalid)
+	}
+	for _, invalid := range response.Invalid {
+		if invalid.Error == "" {
+			t.Errorf("invalid id %q given no error", invalid.ID)
+		}
+	}
+}
+
+func TestBatchPointsBoundsTheIDs(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	ids := make([]string, maxBatchIDs)
+	for i := range ids {
+		ids[i] = newReceiptID()
+	}
+	if response := ts.batchPoints(t, ids...); len(response.Missing) != maxBatchIDs {
+		t.Fatalf("a full batch: got %d missing, want %d", len(response.Missing), maxBatchIDs)
+	}
+
+	for _, body := range []string{`{"ids":[]}`, `{}`, `{"ids":["` + strings.Join(append(ids, newReceiptID()), `","`) + `"]}`} {
+		resp := ts.do(t, "POST", "/receipts/points/batch", body)
+		problem := expectProblem(t, resp, http.StatusUnprocessableEntity, codeValidationFailed)
+		if fields := errorFields(problem.Errors); !equalIDs(fields, []string{"ids"}) {
+			t.Errorf("errors: got %v, want one for ids", problem.Errors)
+		}
+	}
+	expectProblem(t, ts.do(t, "POST", "/receipts/points/batch", `{"ids":`), http.StatusBadRequest, codeInvalidJSON)
+}
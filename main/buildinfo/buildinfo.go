@@ -0,0 +1,42 @@
+// Package buildinfo identifies the build of the receipt processor that is running.
+// The version, commit, and build date are set when linking, for example:
+//
+//	go build -ldflags "-X github.com/HaysBr18/receipt-processor-challenge/main/buildinfo.Version=v1.4.0
+//		-X github.com/HaysBr18/receipt-processor-challenge/main/buildinfo.Commit=$(git rev-parse HEAD)
+//		-X github.com/HaysBr18/receipt-processor-challenge/main/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./main
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Values set when linking, dev for builds made without them.
+var (
+	Version = "dev"
+	Commit  = "dev"
+	Date    = "dev"
+)
+
+// Struct for the build information of the running binary.
+type Info struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+}
+
+// Function to return the build information of the running binary.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Function to describe the build on a single line, for logs.
+func (i Info) String() string {
+	return fmt.Sprintf("version %s, commit %s, built %s with %s", i.Version, i.Commit, i.Date, i.GoVersion)
+}
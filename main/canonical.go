@@ -0,0 +1,15 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Function to canonicalize an item description before it is scored.
+// The text is normalized to Unicode NFC, so composed and decomposed accents count the same,
+// then trimmed with every internal run of whitespace (tabs, non-breaking spaces, repeated spaces)
+// collapsed to a single space. The stored description is never modified.
+func canonicalDescription(description string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(description)), " ")
+}
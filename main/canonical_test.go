@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestCanonicalDescription(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		want        string
+	}{
+		{"Café", "Café"},
+		{"Cafe\u0301", "Café"},
+		{"Cafe\u0301 au lait", "Café au lait"},
+		{"Pepsi\u00a0Max", "Pepsi Max"},
+		{"Pepsi\tMax", "Pepsi Max"},
+		{"  Pepsi  \t\u00a0 Max  ", "Pepsi Max"},
+		{"   Klarbrunn 12-PK 12 FL OZ  ", "Klarbrunn 12-PK 12 FL OZ"},
+		{" \t\u00a0", ""},
+	} {
+		if got := canonicalDescription(test.description); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.description, got, test.want)
+		}
+	}
+}
+
+func TestDecomposedDescriptionsScoreAsComposed(t *testing.T) {
+	price := Amount(1000)
+	composed := scoreItem(Item{Description: "Café", Price: &price}, 20)
+	decomposed := scoreItem(Item{Description: "Cafe\u0301", Price: &price}, 20)
+	spaced := scoreItem(Item{Description: "Caf  é", Price: &price}, 20)
+	if composed.Length != 4 || decomposed.Length != 4 || spaced.Length != 5 {
+		t.Fatalf("lengths: got %d, %d, %d, want 4, 4, 5", composed.Length, decomposed.Length, spaced.Length)
+	}
+
+	//Scoring leaves the description as it was given.
+	if decomposed.Description != "Cafe\u0301" {
+		t.Fatalf("scored description: got %q, want it untouched", decomposed.Description)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// Interface for reading the current time, so that handlers can be run against a fixed clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// Struct for a clock that reads the system time.
+type systemClock struct{}
+
+// Function to return the current system time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
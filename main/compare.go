@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Struct for a receipt's side of a comparison given as JSON.
+type ComparedReceipt struct {
+	ID     string `json:"id"`
+	Points int    `json:"points"`
+}
+
+// Struct for what one rule contributed to each of two receipts, and the difference from the first to the second.
+type RuleDifference struct {
+	Rule        string `json:"rule"`
+	Points      int    `json:"points"`
+	OtherPoints int    `json:"otherPoints"`
+	Difference  int    `json:"difference"`
+}
+
+// Struct for returning the comparison of two receipts' scores given as JSON.
+// Changed names the rules whose contributions differ, in the order they are scored.
+type CompareResponse struct {
+	Receipt    ComparedReceipt  `json:"receipt"`
+	Other      ComparedReceipt  `json:"other"`
+	Difference int              `json:"difference"`
+	Rules      []RuleDifference `json:"rules"`
+	Changed    []string         `json:"changed"`
+}
+
+// Function to handle requests comparing how two stored receipts scored, rule by rule.
+// Both receipts are scored with the current rules. A rule only one of them has, such as the description of an
+// item the other has no counterpart for, counts as 0 for the other. Either unknown id is a 404 naming that id.
+func (s *Server) compareReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	breakdowns := make([]PointsBreakdownResponse, 2)
+	ids := make([]string, 2)
+	for i, given := range []string{vars["id"], vars["otherId"]} {
+		id, err := parseReceiptID(given)
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+			return
+		}
+
+		receipt, err := s.store.Get(r.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			writeProblem(w, http.StatusNotFound, codeNotFound, "Receipt "+id+" not found")
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		if breakdowns[i], err = pointsBreakdown(defaultRuleSet(), receipt); err != nil {
+			writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+			return
+		}
+		ids[i] = id
+	}
+
+	writeJSON(w, http.StatusOK, compareBreakdowns(ids[0], breakdowns[0], ids[1], breakdowns[1]))
+}
+
+// Function to compare two receipts' breakdowns rule by rule, listing the rules of the first receipt
+// followed by any only the second has.
+func compareBreakdowns(id string, breakdown PointsBreakdownResponse, otherID string, other PointsBreakdownResponse) CompareResponse {
+	response := CompareResponse{
+		Receipt:    ComparedReceipt{ID: id, Points: breakdown.Points},
+		Other:      ComparedReceipt{ID: otherID, Points: other.Points},
+		Difference: other.Points - breakdown.Points,
+		Rules:      []RuleDifference{},
+		Changed:    []string{},
+	}
+
+	index := make(map[string]int)
+	for _, contribution := range breakdown.Breakdown {
+		index[contribution.Rule] = len(response.Rules)
+		response.Rules = append(response.Rules, RuleDifference{Rule: contribution.Rule, Points: contribution.Points})
+	}
+	for _, contribution := range other.Breakdown {
+		i, ok := index[contribution.Rule]
+		if !ok {
+			i = len(response.Rules)
+			response.Rules = append(response.Rules, RuleDifference{Rule: contribution.Rule})
+		}
+		response.Rules[i].OtherPoints = contribution.Points
+	}
+
+	for i := range response.Rules {
+		rule := &response.Rules[i]
+		rule.Difference = rule.OtherPoints - rule.Points
+		if rule.Difference != 0 {
+			response.Changed = append(response.Changed, rule.Rule)
+		}
+	}
+	return response
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Function to compare two stored receipts on the server under test, failing unless it is a 200.
+func (ts *testServer) compare(t *testing.T, id string, otherID string) CompareResponse {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts/"+id+"/compare/"+otherID, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET compare: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response CompareResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestCompareGivesEachRulesDifference(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	target := ts.submit(t, targetReceipt)
+	corner := ts.submit(t, cornerReceipt)
+
+	got := ts.compare(t, target, corner)
+	want := CompareResponse{
+		Receipt:    ComparedReceipt{ID: target, Points: 28},
+		Other:      ComparedReceipt{ID: corner, Points: 109},
+		Difference: 81,
+		Rules: []RuleDifference{
+			{"retailerName", 6, 14, 8},
+			{"roundDollarTotal", 0, 50, 50},
+			{"quarterMultipleTotal", 0, 25, 25},
+			{"itemPairs", 10, 10, 0},
+			{"items[0].description", 0, 0, 0},
+			{"items[1].description", 3, 0, -3},
+			{"items[2].description", 0, 0, 0},
+			{"items[3].description", 0, 0, 0},
+			{"items[4].description", 3, 0, -3},
+			{"oddPurchaseDay", 6, 0, -6},
+			{"afternoonPurchase", 0, 10, 10},
+		},
+		Changed: []string{"retailerName", "roundDollarTotal", "quarterMultipleTotal", "items[1].description", "items[4].description", "oddPurchaseDay", "afternoonPurchase"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("compare:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	//The other way round, the receipt with fewer items comes first and the fifth item's rule is listed after its own.
+	reversed := ts.compare(t, corner, target)
+	if reversed.Difference != -81 || len(reversed.Rules) != len(want.Rules) {
+		t.Fatalf("compare reversed: got %+v", reversed)
+	}
+	for _, rule := range reversed.Rules {
+		i := slices.IndexFunc(want.Rules, func(r RuleDifference) bool { return r.Rule == rule.Rule })
+		if i < 0 || rule != (RuleDifference{rule.Rule, want.Rules[i].OtherPoints, want.Rules[i].Points, -want.Rules[i].Difference}) {
+			t.Errorf("compare reversed: got %+v", rule)
+		}
+	}
+	if last := reversed.Rules[len(reversed.Rules)-1]; last.Rule != "items[4].description" {
+		t.Errorf("compare reversed: got %s last, want the rule only the other receipt has", last.Rule)
+	}
+
+	if same := ts.compare(t, target, target); same.Difference != 0 || len(same.Changed) != 0 {
+		t.Fatalf("compare with itself: got %+v, want nothing changed", same)
+	}
+}
+
+func TestCompareRejectsInvalidAndUnknownIDs(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	target := ts.submit(t, targetReceipt)
+	unknown := newReceiptID()
+
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+target+"/compare/not-an-id", ""), http.StatusBadRequest, codeInvalidID)
+	expectProblem(t, ts.do(t, "GET", "/receipts/not-an-id/compare/"+target, ""), http.StatusBadRequest, codeInvalidID)
+
+	for _, path := range []string{"/receipts/" + target + "/compare/" + unknown, "/receipts/" + unknown + "/compare/" + target} {
+		problem := expectProblem(t, ts.do(t, "GET", path, ""), http.StatusNotFound, codeNotFound)
+		if !strings.Contains(problem.Detail, unknown) {
+			t.Errorf("GET %s: got detail %q, want the unknown id named", path, problem.Detail)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Struct for server settings that may be changed on the command line.
+type Config struct {
+	//Receipt store backend, memory, sqlite, postgres, redis, or bolt, the database file used by sqlite,
+	//the connection string used by postgres, and the data file used by bolt.
+	Store       string
+	DBPath      string
+	DatabaseURL string
+	DataFile    string
+
+	//File the memory store is saved to on shutdown and loaded from on startup, empty to keep nothing.
+	SnapshotFile string
+
+	//File every change to the memory store is appended to and replayed from on startup, empty to keep no journal,
+	//whether each append is fsynced, and the size in bytes past which the journal is compacted, zero for never.
+	JournalFile         string
+	JournalSync         bool
+	JournalCompactBytes int64
+
+	//How long the memory store keeps a receipt after it is submitted, zero for ever,
+	//and how often expired receipts are removed.
+	Retention       time.Duration
+	JanitorInterval time.Duration
+
+	//Number of independently locked shards the memory store is split into.
+	MemoryShards int
+
+	//Largest number of receipts the memory store keeps before evicting the least recently used, zero for no limit.
+	//The limit is split between the shards, so it is never exceeded but a receipt is evicted once its shard is full.
+	MaxReceipts int
+
+	//Address of the Redis server used by the redis store, and how long receipts are kept there, zero for ever.
+	RedisAddr string
+	RedisTTL  time.Duration
+
+	//Allowed difference between the receipt total and the sum of its item prices.
+	TotalTolerance Amount
+
+	//Skip the total against item prices check for deployments that accept partial receipts.
+	SkipTotalCheck bool
+
+	//Accept unknown fields and trailing data in receipt bodies.
+	LenientJSON bool
+
+	//Accept amounts with a currency symbol or code and thousands separators.
+	LenientAmounts bool
+
+	//Number format amounts are written in, either point (7.50) or comma (7,50).
+	NumberFormat string
+
+	//How far past the server clock a purchase date and time may be.
+	FutureSkew time.Duration
+
+	//Return the existing id when an identical receipt is submitted again.
+	Dedupe bool
+
+	//Reject updates of stored receipts that don't say which revision they change with If-Match.
+	RequireIfMatch bool
+
+	//Score every submitted receipt in the background, rather than only those asking for it,
+	//with the given number of workers taking receipts from a queue holding at most AsyncQueueSize.
+	Async          bool
+	AsyncWorkers   int
+	AsyncQueueSize int
+
+	//External URL the API is reached at, such as behind a reverse proxy, that links in responses are made
+	//absolute with, empty for links that are paths on the host a request was made to.
+	BaseURL string
+
+	//YAML or JSON file the points rule constants are read from, empty for the published rules.
+	RulesConfig string
+
+	//Version of the rule set submitted receipts are scored with and requests naming none are answered with.
+	RuleVersion string
+
+	//Address the gRPC service listens on alongside HTTP, empty to serve HTTP only.
+	GRPCAddr string
+
+	//URLs notified whenever a receipt is processed, the secret their notifications are signed with,
+	//and how long each delivery may take.
+	WebhookURLs    stringList
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+
+	//Bearer token required by the admin endpoints, which are disabled when it is empty.
+	AdminToken string
+
+	//How long an Idempotency-Key is remembered after the request that first used it.
+	IdempotencyWindow time.Duration
+
+	//Largest request body accepted, in bytes.
+	MaxBodyBytes int64
+
+	//Longest line accepted by the NDJSON import, in bytes.
+	MaxLineBytes int
+
+	//Largest backup accepted by a restore once decompressed, in bytes.
+	MaxRestoreBytes int64
+
+	//Largest number of items accepted on one receipt.
+	MaxItems int
+
+	//Longest retailer name and item description accepted, in characters.
+	MaxRetailerLength    int
+	MaxDescriptionLength int
+}
+
+// Function to return the default server configuration.
+func defaultConfig() Config {
+	return Config{
+		Store:       storeMemory,
+		DBPath:      "receipts.db",
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+		AdminToken:  os.Getenv("ADMIN_TOKEN"),
+		DataFile:    "receipts.bolt",
+		RedisAddr:   "localhost:6379",
+
+		WebhookSecret:  os.Getenv("WEBHOOK_SECRET"),
+		WebhookTimeout: 5 * time.Second,
+
+		JournalCompactBytes: 64 << 20,
+		JanitorInterval:     time.Minute,
+		MemoryShards:        16,
+
+		FutureSkew:   24 * time.Hour,
+		NumberFormat: numberFormatPoint,
+		MaxBodyBytes: 1 << 20,
+		MaxLineBytes: 1 << 20,
+
+		MaxRestoreBytes: 1 << 30,
+
+		RuleVersion: ruleVersionV1,
+
+		AsyncWorkers:   4,
+		AsyncQueueSize: 1000,
+
+		IdempotencyWindow: 24 * time.Hour,
+		MaxItems:          1000,
+
+		MaxRetailerLength:    256,
+		MaxDescriptionLength: 512,
+	}
+}
+
+// Function to register the command line flags that populate the configuration.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Store, "store", c.Store, "receipt store backend: memory, sqlite, postgres, redis, or bolt")
+	fs.StringVar(&c.DBPath, "db", c.DBPath, "database file used by the sqlite store")
+	fs.StringVar(&c.DatabaseURL, "database-url", c.DatabaseURL, "connection string used by the postgres store, defaults to $DATABASE_URL")
+	fs.StringVar(&c.DataFile, "data-file", c.DataFile, "data file used by the bolt store")
+	fs.StringVar(&c.SnapshotFile, "snapshot-file", c.SnapshotFile, "file the memory store is saved to on shutdown and reloaded from on startup")
+	fs.StringVar(&c.JournalFile, "journal-file", c.JournalFile, "file every change to the memory store is appended to and replayed from on startup")
+	fs.BoolVar(&c.JournalSync, "journal-sync", c.JournalSync, "fsync the journal after every write")
+	fs.Int64Var(&c.JournalCompactBytes, "journal-compact-bytes", c.JournalCompactBytes, "size in bytes past which the journal is rewritten from the stored receipts, 0 never compacts")
+	fs.DurationVar(&c.Retention, "retention", c.Retention, "how long the memory store keeps a receipt after it is submitted, 0 keeps them for ever")
+	fs.DurationVar(&c.JanitorInterval, "janitor-interval", c.JanitorInterval, "how often expired receipts are removed from the memory store")
+	fs.IntVar(&c.MemoryShards, "memory-shards", c.MemoryShards, "number of independently locked shards the memory store is split into")
+	fs.IntVar(&c.MaxReceipts, "max-receipts", c.MaxReceipts, "largest number of receipts the memory store keeps, 0 for no limit; the limit is split between the shards, each evicting its least recently used receipt, so eviction is only exact LRU with -memory-shards=1")
+	fs.StringVar(&c.RedisAddr, "redis-addr", c.RedisAddr, "address of the Redis server used by the redis store")
+	fs.DurationVar(&c.RedisTTL, "redis-ttl", c.RedisTTL, "how long the redis store keeps receipts, 0 keeps them until deleted")
+	fs.Var(&c.TotalTolerance, "total-tolerance", "allowed difference between the receipt total and the sum of item prices, e.g. 0.05")
+	fs.IntVar(&c.MaxRetailerLength, "max-retailer-length", c.MaxRetailerLength, "longest retailer name accepted, in characters")
+	fs.IntVar(&c.MaxDescriptionLength, "max-description-length", c.MaxDescriptionLength, "longest item description accepted, in characters")
+	fs.IntVar(&c.MaxItems, "max-items", c.MaxItems, "largest number of items accepted on one receipt")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "largest request body accepted, in bytes")
+	fs.IntVar(&c.MaxLineBytes, "max-line-bytes", c.MaxLineBytes, "longest line accepted by the NDJSON import, in bytes")
+	fs.Int64Var(&c.MaxRestoreBytes, "max-restore-bytes", c.MaxRestoreBytes, "largest backup accepted by a restore once decompressed, in bytes")
+	fs.BoolVar(&c.Dedupe, "dedupe", c.Dedupe, "return the existing id when an identical receipt is submitted again")
+	fs.BoolVar(&c.RequireIfMatch, "require-if-match", c.RequireIfMatch, "reject PUT and PATCH requests without an If-Match header with 428")
+	fs.BoolVar(&c.Async, "async", c.Async, "answer every receipt submission with 202 once it is validated and score it in the background, as Prefer: respond-async does for one request")
+	fs.IntVar(&c.AsyncWorkers, "async-workers", c.AsyncWorkers, "number of workers scoring receipts submitted for scoring in the background")
+	fs.IntVar(&c.AsyncQueueSize, "async-queue", c.AsyncQueueSize, "largest number of receipts waiting to be scored in the background before submissions get a 503")
+	fs.StringVar(&c.BaseURL, "base-url", c.BaseURL, "external URL the API is reached at, e.g. https://receipts.example.com, that links in responses are made absolute with")
+	fs.StringVar(&c.RulesConfig, "rules-config", c.RulesConfig, "YAML or JSON file the points rule constants are read from; settings left out keep the published values")
+	fs.StringVar(&c.RuleVersion, "rule-version", c.RuleVersion, "version of the rule set receipts are scored with by default: "+strings.Join(ruleVersions(), " or "))
+	fs.StringVar(&c.GRPCAddr, "grpc-addr", c.GRPCAddr, "address the gRPC service listens on, e.g. :50051; gRPC is disabled when empty")
+	fs.Var(&c.WebhookURLs, "webhook-url", "URL notified whenever a receipt is processed; may be repeated or given as a comma separated list")
+	fs.StringVar(&c.WebhookSecret, "webhook-secret", c.WebhookSecret, "secret webhook notifications are signed with, defaults to $WEBHOOK_SECRET")
+	fs.DurationVar(&c.WebhookTimeout, "webhook-timeout", c.WebhookTimeout, "how long each webhook delivery may take")
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "bearer token required by the admin endpoints, defaults to $ADMIN_TOKEN; admin endpoints are disabled without one")
+	fs.DurationVar(&c.IdempotencyWindow, "idempotency-window", c.IdempotencyWindow, "how long an Idempotency-Key is remembered")
+	fs.DurationVar(&c.FutureSkew, "future-skew", c.FutureSkew, "how far in the future a purchase date and time may be")
+	fs.BoolVar(&c.LenientJSON, "lenient-json", c.LenientJSON, "ignore unknown fields and trailing data in receipt JSON")
+	fs.BoolVar(&c.LenientAmounts, "lenient-amounts", c.LenientAmounts, "accept amounts with a currency symbol or code and thousands separators, e.g. $1,234.56 or 1,234.56 USD")
+	fs.StringVar(&c.NumberFormat, "number-format", c.NumberFormat, "number format of amounts, point (7.50) or comma (7,50)")
+	fs.BoolVar(&c.SkipTotalCheck, "skip-total-check", c.SkipTotalCheck, "accept receipts whose total does not match the sum of item prices")
+}
+
+// Function to check that the configuration holds usable values.
+func (c Config) Validate() error {
+	if c.NumberFormat != numberFormatPoint && c.NumberFormat != numberFormatComma {
+		return fmt.Errorf("invalid -number-format %q: expected %s or %s", c.NumberFormat, numberFormatPoint, numberFormatComma)
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("invalid -retention %s: must not be negative", c.Retention)
+	}
+	if c.Retention > 0 && c.JanitorInterval <= 0 {
+		return fmt.Errorf("invalid -janitor-interval %s: must be positive", c.JanitorInterval)
+	}
+	if c.IdempotencyWindow <= 0 {
+		return fmt.Errorf("invalid -idempotency-window %s: must be positive", c.IdempotencyWindow)
+	}
+	if c.MemoryShards < 1 {
+		return fmt.Errorf("invalid -memory-shards %d: must be at least 1", c.MemoryShards)
+	}
+	if c.MaxReceipts < 0 {
+		return fmt.Errorf("invalid -max-receipts %d: must not be negative", c.MaxReceipts)
+	}
+	if c.TotalTolerance < 0 {
+		return fmt.Errorf("invalid -total-tolerance %s: must not be negative", c.TotalTolerance)
+	}
+	if c.MaxReceipts > 0 && c.MaxReceipts < c.MemoryShards {
+		return fmt.Errorf("invalid -max-receipts %d: must be at least -memory-shards %d, so every shard can hold a receipt", c.MaxReceipts, c.MemoryShards)
+	}
+	if c.RedisTTL < 0 {
+		return fmt.Errorf("invalid -redis-ttl %s: must not be negative", c.RedisTTL)
+	}
+	for _, target := range c.WebhookURLs {
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid -webhook-url %q: expected an http or https URL", target)
+		}
+	}
+	if len(c.WebhookURLs) > 0 && c.WebhookSecret == "" {
+		return errors.New("-webhook-url needs a -webhook-secret to sign notifications with")
+	}
+	if c.MaxBodyBytes < 1 {
+		return fmt.Errorf("invalid -max-body-bytes %d: must be positive", c.MaxBodyBytes)
+	}
+	if c.MaxLineBytes < 1 {
+		return fmt.Errorf("invalid -max-line-bytes %d: must be positive", c.MaxLineBytes)
+	}
+	if c.MaxRestoreBytes < 1 {
+		return fmt.Errorf("invalid -max-restore-bytes %d: must be positive", c.MaxRestoreBytes)
+	}
+	if c.MaxItems < 1 {
+		return fmt.Errorf("invalid -max-items %d: must be positive", c.MaxItems)
+	}
+	if c.MaxRetailerLength < 1 {
+		return fmt.Errorf("invalid -max-retailer-length %d: must be positive", c.MaxRetailerLength)
+	}
+	if c.MaxDescriptionLength < 1 {
+		return fmt.Errorf("invalid -max-description-length %d: must be positive", c.MaxDescriptionLength)
+	}
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid -base-url %q: expected an http or https URL without a query", c.BaseURL)
+		}
+	}
+	if _, ok := ruleSets[c.RuleVersion]; !ok {
+		return fmt.Errorf("invalid -rule-version %q: expected one of %s", c.RuleVersion, strings.Join(ruleVersions(), ", "))
+	}
+	if c.AsyncWorkers < 1 {
+		return fmt.Errorf("invalid -async-workers %d: must be at least 1", c.AsyncWorkers)
+	}
+	if c.AsyncQueueSize < 1 {
+		return fmt.Errorf("invalid -async-queue %d: must be at least 1", c.AsyncQueueSize)
+	}
+	if c.WebhookTimeout <= 0 {
+		return fmt.Errorf("invalid -webhook-timeout %s: must be positive", c.WebhookTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConfigRejectsANegativeTotalTolerance(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		valid bool
+	}{
+		{"0", true},
+		{"0.05", true},
+		{"-0.01", false},
+		{"-1.00", false},
+	} {
+		cfg := testConfig()
+		fs := flag.NewFlagSet("receipt-processor", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		cfg.RegisterFlags(fs)
+		if err := fs.Parse([]string{"-total-tolerance=" + test.value}); err != nil {
+			t.Fatalf("-total-tolerance=%s: %v", test.value, err)
+		}
+
+		err := cfg.Validate()
+		if test.valid && err != nil {
+			t.Errorf("-total-tolerance=%s: %v", test.value, err)
+		}
+		if !test.valid && (err == nil || !strings.Contains(err.Error(), "invalid -total-tolerance "+test.value+": must not be negative")) {
+			t.Errorf("-total-tolerance=%s: got %v, want it rejected as negative", test.value, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Regular expression for the shape of an amount on the wire, with exactly two decimal places.
+// A leading minus sign is allowed here so negative amounts are reported as negative rather than malformed.
+var amountRegex = regexp.MustCompile(`^-?[0-9]+\.[0-9]{2}$`)
+
+// Regular expressions for amounts written with thousands separators, e.g. 1,234.56 or, in the comma number format, 1.234,56.
+var (
+	groupedAmountRegex      = regexp.MustCompile(`^-?[0-9]{1,3}(,[0-9]{3})+\.[0-9]{2}$`)
+	groupedCommaAmountRegex = regexp.MustCompile(`^-?[0-9]{1,3}(\.[0-9]{3})+,[0-9]{2}$`)
+)
+
+// Number formats that amounts may be written in. The point format, 1234.56, is the default;
+// the comma format, 1234,56, uses a comma as the decimal separator and a point to group thousands.
+const (
+	numberFormatPoint = "point"
+	numberFormatComma = "comma"
+)
+
+// Struct for options controlling how receipt bodies are decoded.
+type decodeOptions struct {
+	//Reject unknown fields and any data after the receipt object.
+	Strict bool
+
+	//Accept amounts with a currency symbol or code and thousands separators, e.g. "$1,234.56" or "1,234.56 USD".
+	LenientAmounts bool
+
+	//Read amounts with a comma as the decimal separator, e.g. "7,50".
+	DecimalComma bool
+}
+
+// Function to return the decode options selected by the server configuration.
+func (c Config) decodeOptions() decodeOptions {
+	return decodeOptions{
+		Strict:         !c.LenientJSON,
+		LenientAmounts: c.LenientAmounts,
+		DecimalComma:   c.NumberFormat == numberFormatComma,
+	}
+}
+
+// Struct for a receipt as it arrives on the wire, with amounts kept raw until they are parsed.
+type wireReceipt struct {
+	Retailer     string          `json:"retailer"`
+	Total        json.RawMessage `json:"total"`
+	PurchaseDate string          `json:"purchaseDate"`
+	PurchaseTime string          `json:"purchaseTime"`
+	Items        []wireItem      `json:"items"`
+}
+
+// Struct for a receipt item as it arrives on the wire.
+type wireItem struct {
+	Description string          `json:"shortDescription"`
+	Price       json.RawMessage `json:"price"`
+}
+
+// Struct for an error listing amount fields that could not be parsed.
+type amountFormatError struct {
+	Errors []FieldError
+}
+
+// Function to describe the malformed amount fields.
+func (e *amountFormatError) Error() string {
+	fields := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		fields[i] = fieldErr.Field
+	}
+	return "malformed amounts: " + strings.Join(fields, ", ")
+}
+
+// Function to decode a single receipt from a request body.
+// In strict mode unknown fields and any data after the receipt object are rejected.
+// Amounts that cannot be parsed produce an *amountFormatError naming every bad field.
+func decodeReceipt(body io.Reader, opts decodeOptions) (*Receipt, error) {
+	decoder := json.NewDecoder(body)
+	if opts.Strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	var wire wireReceipt
+	if err := decoder.Decode(&wire); err != nil {
+		return nil, err
+	}
+
+	//The body must hold exactly one JSON value.
+	if opts.Strict {
+		var extra json.RawMessage
+		err := decoder.Decode(&extra)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		if !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("unexpected data after receipt at offset %d", decoder.InputOffset()-int64(len(extra)))
+		}
+	}
+
+	return wire.receipt(opts)
+}
+
+// Function to convert a wire receipt into a Receipt, parsing every amount from its raw form.
+func (wire *wireReceipt) receipt(opts decodeOptions) (*Receipt, error) {
+	var errs []FieldError
+	parse := func(field string, raw json.RawMessage) *Amount {
+		amount, err := parseWireAmount(raw, opts)
+		if err != nil {
+			errs = append(errs, FieldError{Field: field, Code: fieldInvalid, Message: field + " " + err.Error()})
+		}
+		return amount
+	}
+
+	receipt := &Receipt{
+		Retailer:     wire.Retailer,
+		Total:        parse("total", wire.Total),
+		PurchaseDate: wire.PurchaseDate,
+		PurchaseTime: wire.PurchaseTime,
+	}
+
+	if wire.Items != nil {
+		receipt.Items = make([]Item, len(wire.Items))
+		for i, item := range wire.Items {
+			receipt.Items[i] = Item{
+				Description: item.Description,
+				Price:       parse(fmt.Sprintf("items[%d].price", i), item.Price),
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &amountFormatError{Errors: errs}
+	}
+	return receipt, nil
+}
+
+// Function to parse a raw JSON amount, given as a string or a bare number, into an Amount.
+// The raw text is checked before conversion so "9.999999" can't round its way through.
+// Missing and null amounts return nil and are reported as missing by validation.
+func parseWireAmount(raw json.RawMessage, opts decodeOptions) (*Amount, error) {
+	if raw == nil || string(raw) == "null" {
+		return nil, nil
+	}
+
+	text, err := rawAmountText(raw)
+	if err != nil {
+		return nil, errors.New("must be a string or a number")
+	}
+
+	//Bare JSON numbers always use a point as the decimal separator, whatever the number format.
+	if raw[0] != '"' {
+		opts.DecimalComma = false
+	}
+
+	canonical, err := canonicalAmountText(text, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !amountRegex.MatchString(canonical) {
+		if unexpected := unexpectedAmountChars(canonical); unexpected != "" {
+			return nil, fmt.Errorf("%q contains unexpected characters %q", text, unexpected)
+		}
+		return nil, fmt.Errorf("%q must have exactly two decimal places, e.g. %q", text, exampleAmount(opts))
+	}
+
+	amount, err := parseAmount(canonical)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
+
+// Function to rewrite an amount in the canonical point format, e.g. "1234.56".
+// In lenient mode a currency symbol or code before or after the amount is stripped, see stripCurrency, and
+// thousands separators are removed when they
+// group the dollars in threes, so a value like "1.234,56" in the point format is left as is and rejected.
+// In the comma format a point can only be a thousands separator, so any point left over is ambiguous.
+func canonicalAmountText(text string, opts decodeOptions) (string, error) {
+	grouped := groupedAmountRegex
+	group := ","
+	if opts.DecimalComma {
+		grouped = groupedCommaAmountRegex
+		group = "."
+	}
+
+	if opts.LenientAmounts {
+		text = stripCurrency(strings.TrimSpace(text))
+
+		if grouped.MatchString(text) {
+			text = strings.ReplaceAll(text, group, "")
+		}
+	}
+
+	if opts.DecimalComma {
+		if strings.Contains(text, ".") {
+			return "", fmt.Errorf("%q is ambiguous in the comma number format, which writes amounts as \"7,50\"", text)
+		}
+		text = strings.Replace(text, ",", ".", 1)
+	}
+
+	return text, nil
+}
+
+// Function to strip one currency marker from either end of an amount, e.g. "$6.49", "6,49 €", "USD 6.49" or
+// "6.49 USD". A marker is a currency symbol or a three letter ISO 4217 code in capitals; only one is taken, so
+// "$6.49 USD" keeps its code and is rejected.
+func stripCurrency(text string) string {
+	if r, size := utf8.DecodeRuneInString(text); unicode.Is(unicode.Sc, r) {
+		return strings.TrimSpace(text[size:])
+	}
+	if r, size := utf8.DecodeLastRuneInString(text); unicode.Is(unicode.Sc, r) {
+		return strings.TrimSpace(text[:len(text)-size])
+	}
+	if len(text) > 3 && isCurrencyCode(text[:3]) {
+		return strings.TrimSpace(text[3:])
+	}
+	if len(text) > 3 && isCurrencyCode(text[len(text)-3:]) {
+		return strings.TrimSpace(text[:len(text)-3])
+	}
+	return text
+}
+
+// Function to report whether text is written like an ISO 4217 currency code, three capital letters.
+func isCurrencyCode(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] < 'A' || text[i] > 'Z' {
+			return false
+		}
+	}
+	return len(text) == 3
+}
+
+// Function to return an example of a well-formed amount in the selected number format.
+func exampleAmount(opts decodeOptions) string {
+	if opts.DecimalComma {
+		return "9,00"
+	}
+	return "9.00"
+}
+
+// Function to list the characters in a canonical amount that can never appear in a well-formed amount.
+func unexpectedAmountChars(text string) string {
+	var unexpected strings.Builder
+	for _, r := range text {
+		if (r < '0' || r > '9') && r != '.' && r != '-' && !strings.ContainsRune(unexpected.String(), r) {
+			unexpected.WriteRune(r)
+		}
+	}
+	return unexpected.String()
+}
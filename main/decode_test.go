@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLenientAmountsTakeACurrencyMarkerAtEitherEnd(t *testing.T) {
+	lenient := decodeOptions{LenientAmounts: true}
+	comma := decodeOptions{LenientAmounts: true, DecimalComma: true}
+
+	for _, test := range []struct {
+		text string
+		opts decodeOptions
+		want string
+	}{
+		{"6.49", lenient, "6.49"},
+		{"$6.49", lenient, "6.49"},
+		{"$ 6.49", lenient, "6.49"},
+		{"6.49$", lenient, "6.49"},
+		{"6.49 USD", lenient, "6.49"},
+		{"USD 6.49", lenient, "6.49"},
+		{"6.49USD", lenient, "6.49"},
+		{" $1,234.56 ", lenient, "1234.56"},
+		{"1,234.56 USD", lenient, "1234.56"},
+		{"6,49 €", comma, "6.49"},
+		{"1.234,56 EUR", comma, "1234.56"},
+		{"€1.234,56", comma, "1234.56"},
+	} {
+		amount, err := parseWireAmount(json.RawMessage(`"`+test.text+`"`), test.opts)
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		if got := amount.String(); got != test.want {
+			t.Errorf("%q: got %s, want %s", test.text, got, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		text string
+		opts decodeOptions
+	}{
+		{"$6.49 USD", lenient},
+		{"$$6.49", lenient},
+		{"6.49 usd", lenient},
+		{"6.49 US", lenient},
+		{"6.49 USDT", lenient},
+		{"6.49 USD", decodeOptions{}},
+		{"6.49$", decodeOptions{}},
+	} {
+		if _, err := parseWireAmount(json.RawMessage(`"`+test.text+`"`), test.opts); err == nil {
+			t.Errorf("%q with %+v: accepted, want an error", test.text, test.opts)
+		}
+	}
+}
+
+func TestStrictDecodingRejectsUnknownFieldsAndTrailingData(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		body string
+		want string
+	}{
+		{"extra top-level field", strings.Replace(targetReceipt, `"retailer"`, `"purchseDate":"2022-01-01","retailer"`, 1), `"purchseDate"`},
+		{"unknown item field", strings.Replace(targetReceipt, `"price":"6.49"`, `"price":"6.49","qty":2`, 1), `"qty"`},
+		{"concatenated objects", targetReceipt + cornerReceipt, "offset " + strconv.Itoa(len(targetReceipt))},
+	} {
+		_, err := decodeReceipt(strings.NewReader(test.body), decodeOptions{Strict: true})
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want an error naming %s", test.name, err, test.want)
+		}
+		if _, err := decodeReceipt(strings.NewReader(test.body), decodeOptions{}); err != nil {
+			t.Errorf("%s decoded leniently: %v", test.name, err)
+		}
+	}
+}
+
+func TestStrictDecodingIsAServerOption(t *testing.T) {
+	body := strings.Replace(targetReceipt, `"retailer"`, `"purchseDate":"2022-01-01","retailer"`, 1)
+
+	ts := newTestServer(t, testConfig())
+	resp := ts.do(t, "POST", "/receipts/process", body)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST with an unknown field: got %d, want 400", resp.StatusCode)
+	}
+	var problem Problem
+	decodeBody(t, resp, &problem)
+	if problem.Code != codeInvalidJSON || !strings.Contains(problem.Detail, "purchseDate") {
+		t.Fatalf("POST with an unknown field: got %+v, want invalid_json naming the field", problem)
+	}
+
+	cfg := testConfig()
+	cfg.LenientJSON = true
+	lenient := newTestServer(t, cfg)
+	if got := lenient.points(t, lenient.submit(t, body)); got != 28 {
+		t.Fatalf("points of a leniently decoded receipt: got %d, want 28", got)
+	}
+}
+
+func TestAmountsNeedExactlyTwoDecimalPlaces(t *testing.T) {
+	for _, test := range []struct {
+		text  string
+		valid bool
+	}{
+		{"9", false},
+		{"9.0", false},
+		{"9.00", true},
+		{"09.00", true},
+		{"9.005", false},
+		{"9.999999999999", false},
+	} {
+		body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"` + test.text + `"}],"total":"` + test.text + `"}`
+		_, err := decodeReceipt(strings.NewReader(body), decodeOptions{Strict: true})
+		if test.valid {
+			if err != nil {
+				t.Errorf("%q: %v", test.text, err)
+			}
+			continue
+		}
+		var badAmounts *amountFormatError
+		if !errors.As(err, &badAmounts) || !equalIDs(errorFields(badAmounts.Errors), []string{"total", "items[0].price"}) {
+			t.Errorf("%q: got %v, want total and items[0].price named", test.text, err)
+		}
+	}
+
+	ts := newTestServer(t, testConfig())
+	errs := ts.reject(t, strings.Replace(targetReceipt, `"total":"35.35"`, `"total":"35.3"`, 1))
+	if len(errs) != 1 || errs[0].Field != "total" {
+		t.Fatalf("errors: got %v, want total named", errs)
+	}
+}
+
+func TestAmountsMayBeNumbersOrStrings(t *testing.T) {
+	receipt, err := decodeReceipt(strings.NewReader(`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":2.25},{"shortDescription":"Pepsi","price":"1.75"}],"total":4.00}`), decodeOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Total.String() != "4.00" || receipt.Items[0].Price.String() != "2.25" || receipt.Items[1].Price.String() != "1.75" {
+		t.Fatalf("amounts decoded as %s, %s, %s", receipt.Total, receipt.Items[0].Price, receipt.Items[1].Price)
+	}
+
+	//Amounts are still written as strings.
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"total":"4.00"`) || !strings.Contains(string(data), `"price":"2.25"`) {
+		t.Fatalf("encoded as %s, want string amounts", data)
+	}
+
+	//Null is missing, left for validation to report, and anything else names the field.
+	receipt, err = decodeReceipt(strings.NewReader(`{"retailer":"Target","items":[{"shortDescription":"Gatorade","price":null}],"total":null}`), decodeOptions{Strict: true})
+	if err != nil || receipt.Total != nil || receipt.Items[0].Price != nil {
+		t.Fatalf("null amounts: got %+v, %v, want them missing", receipt, err)
+	}
+	_, err = decodeReceipt(strings.NewReader(`{"retailer":"Target","items":[{"shortDescription":"Gatorade","price":true}],"total":"abc"}`), decodeOptions{Strict: true})
+	var badAmounts *amountFormatError
+	if !errors.As(err, &badAmounts) || !equalIDs(errorFields(badAmounts.Errors), []string{"total", "items[0].price"}) {
+		t.Fatalf("bad amounts: got %v, want total and items[0].price named", err)
+	}
+}
+
+func TestStrictAmountsNameTheUnexpectedCharacters(t *testing.T) {
+	for _, test := range []struct {
+		text       string
+		unexpected string
+	}{
+		{"$6.49", "$"},
+		{"6.49 USD", " USD"},
+		{"1,234.56", ","},
+	} {
+		_, err := parseWireAmount(json.RawMessage(`"`+test.text+`"`), decodeOptions{})
+		if err == nil || !strings.Contains(err.Error(), "unexpected characters "+strconv.Quote(test.unexpected)) {
+			t.Errorf("%q: got %v, want %q named", test.text, err, test.unexpected)
+		}
+	}
+
+	//Grouping with points is not the point format, even leniently.
+	if amount, err := parseWireAmount(json.RawMessage(`"1.234,56"`), decodeOptions{LenientAmounts: true}); err == nil {
+		t.Fatalf("1.234,56 in the lenient point format: accepted as %s", amount)
+	}
+}
+
+func TestLenientAmountsAreStoredCanonically(t *testing.T) {
+	cfg := testConfig()
+	cfg.LenientAmounts = true
+	ts := newTestServer(t, cfg)
+
+	id := ts.submit(t, `{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"$1,000.00"}],"total":"1,000.00 USD"}`)
+	resp := ts.do(t, "GET", "/receipts/"+id, "")
+	var document ReceiptDocument
+	decodeBody(t, resp, &document)
+	if document.Total.String() != "1000.00" || document.Items[0].Price.String() != "1000.00" {
+		t.Fatalf("stored amounts: got %s and %s, want 1000.00", document.Total, document.Items[0].Price)
+	}
+
+	//6 for the retailer, 50 for a round dollar total and 25 for a multiple of 0.25.
+	if got := ts.points(t, id); got != 81 {
+		t.Fatalf("points: got %d, want 81", got)
+	}
+}
+
+func TestAmountsUnderBothNumberFormats(t *testing.T) {
+	if defaultConfig().decodeOptions().DecimalComma {
+		t.Fatal("the comma format is on by default")
+	}
+	point := decodeOptions{}
+	comma := decodeOptions{DecimalComma: true}
+
+	for _, test := range []struct {
+		text string
+		opts decodeOptions
+		want string
+	}{
+		{"7.50", point, "7.50"},
+		{"7,50", point, ""},
+		{"1.000,00", point, ""},
+		{"7,50", comma, "7.50"},
+		{"1.000,00", comma, ""},
+		{"7.50", comma, ""},
+	} {
+		amount, err := parseWireAmount(json.RawMessage(`"`+test.text+`"`), test.opts)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("%q with %+v: accepted as %s, want an error", test.text, test.opts, amount)
+		case test.want != "" && (err != nil || amount.String() != test.want):
+			t.Errorf("%q with %+v: got %v, %v, want %s", test.text, test.opts, amount, err, test.want)
+		}
+	}
+
+	//Thousands grouped with points are only read leniently, and a lone point is ambiguous in the comma format.
+	amount, err := parseWireAmount(json.RawMessage(`"1.000,00"`), decodeOptions{DecimalComma: true, LenientAmounts: true})
+	if err != nil || amount.String() != "1000.00" {
+		t.Fatalf("1.000,00 in the lenient comma format: got %v, %v, want 1000.00", amount, err)
+	}
+	if _, err := parseWireAmount(json.RawMessage(`"7.50"`), comma); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("7.50 in the comma format: got %v, want it called ambiguous", err)
+	}
+
+	//Bare numbers always use a point.
+	amount, err = parseWireAmount(json.RawMessage(`7.50`), comma)
+	if err != nil || amount.String() != "7.50" {
+		t.Fatalf("bare 7.50 in the comma format: got %v, %v, want 7.50", amount, err)
+	}
+}
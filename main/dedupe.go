@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// Function to compute a canonical hash of the receipt contents.
+// Items are sorted so that the same receipt hashes identically regardless of item order,
+// and the fields are JSON encoded so one field can never run into the next.
+func receiptHash(receipt *Receipt) string {
+	items := make([]Item, len(receipt.Items))
+	copy(items, receipt.Items)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Description != items[j].Description {
+			return items[i].Description < items[j].Description
+		}
+		return *items[i].Price < *items[j].Price
+	})
+
+	canonical, _ := json.Marshal([]interface{}{
+		receipt.Retailer,
+		receipt.PurchaseDate,
+		receipt.PurchaseTime,
+		receipt.Total,
+		items,
+	})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// Struct for the index from receipt content hash to the id it was stored under, used when duplicates are detected,
+// with the hash each id is indexed under so the entry can be pruned when the receipt goes.
+type hashIndex struct {
+	mu     sync.Mutex
+	ids    map[string]string
+	hashes map[string]string
+
+	//Ids the store removed by itself, pruned the next time the index is locked. They have their own mutex,
+	//as the store reports evictions while a receipt is saved, which happens with mu held.
+	removedMu sync.Mutex
+	removed   []string
+}
+
+// Function to lock the index, first pruning the receipts the store has removed since it was last locked.
+// Returns the function that unlocks it.
+func (x *hashIndex) lock() func() {
+	x.mu.Lock()
+
+	x.removedMu.Lock()
+	removed := x.removed
+	x.removed = nil
+	x.removedMu.Unlock()
+	for _, id := range removed {
+		x.forgetLocked(id)
+	}
+	return x.mu.Unlock
+}
+
+// Function to look up the id a receipt with the given hash was stored under. Must be called with the index locked.
+func (x *hashIndex) lookup(hash string) (string, bool) {
+	id, exists := x.ids[hash]
+	return id, exists
+}
+
+// Function to index a receipt's hash under its id, replacing whatever the id was indexed under before.
+// Must be called with the index locked.
+func (x *hashIndex) set(hash string, id string) {
+	if x.ids == nil {
+		x.ids = make(map[string]string)
+		x.hashes = make(map[string]string)
+	}
+	x.forgetLocked(id)
+	x.ids[hash] = id
+	x.hashes[id] = hash
+}
+
+// Function to remove a receipt from the index. Must be called with the index locked.
+func (x *hashIndex) forgetLocked(id string) {
+	hash, exists := x.hashes[id]
+	if !exists {
+		return
+	}
+	delete(x.hashes, id)
+	if x.ids[hash] == id {
+		delete(x.ids, hash)
+	}
+}
+
+// Function to remove a receipt deleted or replaced through the API from the index.
+func (x *hashIndex) forget(id string) {
+	defer x.lock()()
+	x.forgetLocked(id)
+}
+
+// Function to note receipts the store removed by itself, to be pruned from the index the next time it is locked.
+func (x *hashIndex) removedByStore(ids ...string) {
+	x.removedMu.Lock()
+	defer x.removedMu.Unlock()
+
+	x.removed = append(x.removed, ids...)
+}
+
+// Function to index a receipt replaced or imported through the API under the hash of its new contents, so duplicates
+// of the new contents find it and duplicates of the old ones no longer do. If the new contents duplicate another
+// stored receipt, that receipt stays the one duplicates are answered with.
+func (s *Server) indexReplaced(id string, receipt *Receipt) {
+	if !s.config.Dedupe {
+		return
+	}
+	hash := receiptHash(receipt)
+	defer s.hashes.lock()()
+
+	if other, exists := s.hashes.lookup(hash); exists && other != id {
+		s.hashes.forgetLocked(id)
+		return
+	}
+	s.hashes.set(hash, id)
+}
+
+// Function to index every receipt already in the store, so receipts stored before the server started are found
+// as duplicates. Where stored receipts duplicate each other, the first in id order is the one duplicates are
+// answered with.
+func (s *Server) seedDuplicateIndex(ctx context.Context) error {
+	defer s.hashes.lock()()
+
+	return s.store.Each(ctx, "", func(id string, receipt *Receipt) error {
+		hash := receiptHash(receipt)
+		if _, exists := s.hashes.lookup(hash); !exists {
+			s.hashes.set(hash, id)
+		}
+		return nil
+	})
+}
+
+// Function to empty the index.
+func (x *hashIndex) reset() {
+	defer x.lock()()
+	x.ids = nil
+	x.hashes = nil
+}
+
+// Function to count the receipts in the index.
+func (x *hashIndex) len() int {
+	defer x.lock()()
+	return len(x.ids)
+}
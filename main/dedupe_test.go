@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Function to return the test configuration with duplicate detection on.
+func dedupeConfig() Config {
+	cfg := testConfig()
+	cfg.Dedupe = true
+	return cfg
+}
+
+// Function to submit a receipt expected to duplicate a stored one, returning the id it was answered with.
+func (ts *testServer) resubmit(t *testing.T, body string) string {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/receipts/process?includePoints=true", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST duplicate: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		t.Fatalf("POST duplicate: got Location %q, want none", location)
+	}
+	var response ReceiptResponse
+	decodeBody(t, resp, &response)
+	if response.Points == nil {
+		t.Fatal("POST duplicate: no points given with includePoints=true")
+	}
+	return response.ID
+}
+
+func TestDuplicateSubmissionIsAnsweredWithTheStoredID(t *testing.T) {
+	ts := newTestServer(t, dedupeConfig())
+
+	id := ts.submit(t, targetReceipt)
+	if again := ts.resubmit(t, targetReceipt); again != id {
+		t.Fatalf("duplicate answered with %s, want %s", again, id)
+	}
+	if other := ts.submit(t, cornerReceipt); other == id {
+		t.Fatal("a different receipt was answered with the first receipt's id")
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 2 {
+		t.Fatalf("store holds %v, want two receipts", ids)
+	}
+}
+
+func TestDeletedReceiptIsStoredAfreshWhenResubmitted(t *testing.T) {
+	ts := newTestServer(t, dedupeConfig())
+
+	id := ts.submit(t, targetReceipt)
+	if resp := ts.do(t, "DELETE", "/receipts/"+id, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: got %d, want 204", resp.StatusCode)
+	}
+	if ts.hashes.len() != 0 {
+		t.Fatal("deleted receipt left in the duplicate index")
+	}
+	if again := ts.submit(t, targetReceipt); again == id {
+		t.Fatal("resubmitted receipt was given the deleted receipt's id")
+	}
+}
+
+func TestEvictedReceiptIsPrunedFromTheDuplicateIndex(t *testing.T) {
+	cfg := dedupeConfig()
+	cfg.MemoryShards = 1
+	cfg.MaxReceipts = 1
+	ts := newTestServer(t, cfg)
+
+	first := ts.submit(t, targetReceipt)
+	ts.submit(t, cornerReceipt)
+	if n := ts.hashes.len(); n != 1 {
+		t.Fatalf("duplicate index holds %d receipts after an eviction, want 1", n)
+	}
+	if again := ts.submit(t, targetReceipt); again == first {
+		t.Fatal("resubmitted receipt was given the evicted receipt's id")
+	}
+}
+
+func TestReceiptsSharingAPrefixAreNotDuplicates(t *testing.T) {
+	ts := newTestServer(t, dedupeConfig())
+	item := func(description string) string {
+		return `{"shortDescription":"` + description + `","price":"1.00"}`
+	}
+	receipt := func(retailer string, items ...string) string {
+		return `{"retailer":"` + retailer + `","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[` + strings.Join(items, ",") + `],"total":"` + fmt.Sprintf("%d.00", len(items)) + `"}`
+	}
+
+	//Each pair would run together into the same text if the fields were simply joined.
+	pairs := [][2]string{
+		{receipt("Target", item("AB"), item("C")), receipt("Target", item("A"), item("BC"))},
+		{receipt("Tar", item("getX")), receipt("Target", item("X"))},
+	}
+	for _, pair := range pairs {
+		first := ts.submit(t, pair[0])
+		if second := ts.submit(t, pair[1]); second == first {
+			t.Errorf("%s was answered as a duplicate of %s", pair[1], pair[0])
+		}
+	}
+
+	//Items in another order are the same receipt.
+	id := ts.submit(t, receipt("Walgreens", item("Pepsi"), item("Dasani")))
+	if again := ts.resubmit(t, receipt("Walgreens", item("Dasani"), item("Pepsi"))); again != id {
+		t.Fatalf("reordered items answered with %s, want %s", again, id)
+	}
+}
+
+func TestReceiptsStoredBeforeARestartAreFoundAsDuplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	first := newTestServerWithStore(t, dedupeConfig(), openTestSQLiteStore(t, path))
+	id := first.submit(t, targetReceipt)
+	first.http.Close()
+	if err := first.store.(*sqliteStore).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestServerWithStore(t, dedupeConfig(), openTestSQLiteStore(t, path))
+	if again := restarted.resubmit(t, targetReceipt); again != id {
+		t.Fatalf("duplicate after a restart answered with %s, want %s", again, id)
+	}
+	if ids := storedIDs(t, restarted.store); len(ids) != 1 {
+		t.Fatalf("store holds %v, want the one receipt", ids)
+	}
+}
+
+func TestImportedAndRestoredReceiptsAreFoundAsDuplicates(t *testing.T) {
+	source := newTestServer(t, adminConfig())
+	target := source.submit(t, targetReceipt)
+	corner := source.submit(t, cornerReceipt)
+	export := source.export(t)
+	backup := source.backup(t)
+
+	cfg := adminConfig()
+	cfg.Dedupe = true
+	imported := newTestServer(t, cfg)
+	if summary := imported.importLines(t, export, importSkip); summary.Imported != 2 {
+		t.Fatalf("import: got %+v, want two receipts imported", summary)
+	}
+	if again := imported.resubmit(t, targetReceipt); again != target {
+		t.Fatalf("duplicate of an imported receipt answered with %s, want %s", again, target)
+	}
+
+	restored := newTestServer(t, cfg)
+	if resp := restored.restore(t, backup, restoreMerge); resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if again := restored.resubmit(t, cornerReceipt); again != corner {
+		t.Fatalf("duplicate of a restored receipt answered with %s, want %s", again, corner)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Function to compute a strong entity tag for a receipt's points response from the id, the points, the version of
+// the rules they were scored with if known, and the format of the body, so any change to the score and each
+// representation gets a different tag.
+func pointsETag(id string, points int, ruleVersion string, format string) string {
+	key := fmt.Sprintf("%s:%d:%s", id, points, format)
+	if ruleVersion != "" {
+		key += ":" + ruleVersion
+	}
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Function to report whether an If-None-Match header matches the given entity tag.
+// The header may list several tags or be *, and weak tags match by their opaque value as RFC 9110 requires.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to return the entity tag of a stored receipt's revision. The tag is the same in every format the
+// receipt is sent in, so it can be given back in If-Match whichever one a client read.
+func revisionETag(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// Function to report whether an If-Match header matches the given entity tag.
+// The header may list several tags or be *, and weak tags never match, as If-Match compares tags strongly.
+func ifMatches(ifMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to check a request changing a stored receipt against the revision it would change, so two clients
+// editing the same receipt can't overwrite each other's changes unseen. An If-Match header that doesn't match
+// the stored revision is a 412, and a missing one is allowed unless -require-if-match is set, when it is a 428.
+// Must be called while the receipt's lock is held. On failure the problem response is written and false is returned.
+func (s *Server) checkIfMatch(w http.ResponseWriter, r *http.Request, stored *Receipt) bool {
+	etag := revisionETag(stored.Revision)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		if s.config.RequireIfMatch {
+			writeProblem(w, http.StatusPreconditionRequired, codePreconditionRequired, "an If-Match header giving the ETag of the receipt being changed is required")
+			return false
+		}
+		return true
+	}
+	if !ifMatches(ifMatch, etag) {
+		w.Header().Set("ETag", etag)
+		writeProblem(w, http.StatusPreconditionFailed, codePreconditionFailed, "the receipt has changed since it was read, its current ETag is "+etag)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Function to fetch the points of a stored receipt with the given If-None-Match header, empty for none.
+func (ts *testServer) pointsIfNoneMatch(t *testing.T, id string, ifNoneMatch string) *http.Response {
+	t.Helper()
+
+	var header []string
+	if ifNoneMatch != "" {
+		header = []string{"If-None-Match", ifNoneMatch}
+	}
+	return ts.do(t, "GET", "/receipts/"+id+"/points", "", header...)
+}
+
+func TestPointsETagAnswersMatchingRequestsWithNotModified(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	resp := ts.pointsIfNoneMatch(t, id, "")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || len(etag) < 3 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		t.Fatalf("first GET: got %d with ETag %q, want 200 with a strong tag", resp.StatusCode, etag)
+	}
+	if again := ts.pointsIfNoneMatch(t, id, "").Header.Get("ETag"); again != etag {
+		t.Fatalf("second GET: got ETag %q, want the same %q", again, etag)
+	}
+
+	for _, test := range []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{etag, http.StatusNotModified},
+		{`"stale"`, http.StatusOK},
+		{`"stale", ` + etag, http.StatusNotModified},
+		{`"stale","other"`, http.StatusOK},
+		{"W/" + etag, http.StatusNotModified},
+		{`W/"stale", W/` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+	} {
+		resp := ts.pointsIfNoneMatch(t, id, test.ifNoneMatch)
+		if resp.StatusCode != test.status {
+			t.Errorf("If-None-Match %s: got %d, want %d", test.ifNoneMatch, resp.StatusCode, test.status)
+			continue
+		}
+		if resp.Header.Get("ETag") != etag {
+			t.Errorf("If-None-Match %s: got ETag %q, want %q", test.ifNoneMatch, resp.Header.Get("ETag"), etag)
+		}
+		if body := readBody(t, resp); test.status == http.StatusNotModified && body != "" {
+			t.Errorf("If-None-Match %s: 304 with body %q", test.ifNoneMatch, body)
+		}
+	}
+}
+
+func TestPointsETagChangesWithTheScoreAndFormat(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	etag := ts.pointsIfNoneMatch(t, id, "").Header.Get("ETag")
+
+	if xml := ts.do(t, "GET", "/receipts/"+id+"/points", "", "Accept", "application/xml").Header.Get("ETag"); xml == etag {
+		t.Fatal("points as XML tagged the same as points as JSON")
+	}
+
+	if resp := ts.do(t, "PUT", "/receipts/"+id, cornerReceipt); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp := ts.pointsIfNoneMatch(t, id, etag)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Fatalf("GET after the score changed: got %d with ETag %q, want 200 with a new tag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
+
+// Function to read the ETag a stored receipt is served with.
+func (ts *testServer) receiptETag(t *testing.T, id string) string {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts/"+id, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /receipts/%s: got %d, want 200", id, resp.StatusCode)
+	}
+	return resp.Header.Get("ETag")
+}
+
+func TestUpdatesMatchingTheStoredRevisionGoAheadAndBumpIt(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	etag := ts.receiptETag(t, id)
+	if etag != revisionETag(1) {
+		t.Fatalf("ETag of a new receipt: got %s, want %s", etag, revisionETag(1))
+	}
+
+	for i, update := range []struct {
+		method, body, ifMatch string
+	}{
+		{"PUT", cornerReceipt, etag},
+		{"PATCH", `{"purchaseTime":"13:01"}`, `"stale", ` + revisionETag(2)},
+		{"PUT", targetReceipt, "*"},
+	} {
+		resp := ts.do(t, update.method, "/receipts/"+id, update.body, "If-Match", update.ifMatch)
+		want := revisionETag(int64(i + 2))
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != want {
+			t.Fatalf("%s with If-Match %s: got %d with ETag %q, want 200 with %s: %s", update.method, update.ifMatch, resp.StatusCode, resp.Header.Get("ETag"), want, readBody(t, resp))
+		}
+		if got := ts.receiptETag(t, id); got != want {
+			t.Fatalf("ETag after %s: got %s, want %s", update.method, got, want)
+		}
+	}
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after the updates: got %d, want 28", got)
+	}
+}
+
+func TestUpdatesOfAStaleRevisionAreRefused(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	stale := ts.receiptETag(t, id)
+	if resp := ts.do(t, "PUT", "/receipts/"+id, cornerReceipt, "If-Match", stale); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first PUT: got %d, want 200", resp.StatusCode)
+	}
+	current := ts.receiptETag(t, id)
+
+	for _, update := range []struct {
+		method, body, ifMatch string
+	}{
+		{"PUT", targetReceipt, stale},
+		{"PATCH", `{"purchaseTime":"13:01"}`, stale},
+		{"PUT", targetReceipt, "W/" + current},
+		{"PUT", targetReceipt, `"stale", "other"`},
+	} {
+		resp := ts.do(t, update.method, "/receipts/"+id, update.body, "If-Match", update.ifMatch)
+		expectProblem(t, resp, http.StatusPreconditionFailed, codePreconditionFailed)
+		if resp.Header.Get("ETag") != current {
+			t.Errorf("%s with If-Match %s: got ETag %q, want the current %s", update.method, update.ifMatch, resp.Header.Get("ETag"), current)
+		}
+	}
+	if got := ts.points(t, id); got != 109 || ts.receiptETag(t, id) != current {
+		t.Fatalf("receipt after the refused updates: got %d points, want the 109 of the first PUT unchanged", got)
+	}
+}
+
+func TestUpdatesWithoutIfMatchNeedItWhenRequired(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequireIfMatch = true
+	ts := newTestServer(t, cfg)
+	id := ts.submit(t, targetReceipt)
+
+	expectProblem(t, ts.do(t, "PUT", "/receipts/"+id, cornerReceipt), http.StatusPreconditionRequired, codePreconditionRequired)
+	expectProblem(t, ts.do(t, "PATCH", "/receipts/"+id, `{"purchaseTime":"14:33"}`), http.StatusPreconditionRequired, codePreconditionRequired)
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after the refused updates: got %d, want 28", got)
+	}
+
+	if resp := ts.do(t, "PUT", "/receipts/"+id, cornerReceipt, "If-Match", ts.receiptETag(t, id)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT with If-Match: got %d, want 200", resp.StatusCode)
+	}
+
+	//Without the flag a missing If-Match goes ahead.
+	lenient := newTestServer(t, testConfig())
+	other := lenient.submit(t, targetReceipt)
+	if resp := lenient.do(t, "PUT", "/receipts/"+other, cornerReceipt); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT without If-Match: got %d, want 200", resp.StatusCode)
+	}
+}
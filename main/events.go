@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Number of events buffered for each subscriber before it is considered stuck and disconnected.
+const eventBufferSize = 64
+
+// How often an idle event stream is sent a comment, so proxies don't close it.
+const eventHeartbeatInterval = 15 * time.Second
+
+// Struct for an in-process hub passing receipt events from the handlers to every subscriber.
+// Publishing never waits: a subscriber whose buffer is full is disconnected instead, so one stuck
+// client can't hold up receipt submissions.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan ReceiptEvent]struct{}
+	closed      bool
+}
+
+// Function to create an event hub with no subscribers.
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan ReceiptEvent]struct{})}
+}
+
+// Function to subscribe to every event published from now on. The channel is closed when the subscriber
+// falls too far behind or the hub is closed; the returned function unsubscribes and must be called when done.
+func (h *eventHub) subscribe() (<-chan ReceiptEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan ReceiptEvent, eventBufferSize)
+	if h.closed {
+		close(events)
+		return events, func() {}
+	}
+	h.subscribers[events] = struct{}{}
+
+	return events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.drop(events)
+	}
+}
+
+// Function to remove a subscriber and close its channel, if it is still subscribed.
+func (h *eventHub) drop(events chan ReceiptEvent) {
+	if _, ok := h.subscribers[events]; ok {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// Function to pass an event to every subscriber, disconnecting any whose buffer is full.
+func (h *eventHub) publish(event ReceiptEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			h.drop(events)
+		}
+	}
+}
+
+// Function to disconnect every subscriber and refuse new ones, used when the server shuts down.
+func (h *eventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for events := range h.subscribers {
+		h.drop(events)
+	}
+}
+
+// Function to handle requests for a stream of receipt events as Server-Sent Events.
+// Every processed receipt is sent as a receipt event with its id, and an idle stream gets a heartbeat comment.
+// The stream ends when the client disconnects, falls too far behind, or the server shuts down.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	controller := http.NewResponseController(w)
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			//Leave characters such as & in retailer names as they were submitted.
+			var data bytes.Buffer
+			encoder := json.NewEncoder(&data)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(event)
+			fmt.Fprintf(w, "id: %s\nevent: receipt\ndata: %s\n", event.ID, data.Bytes())
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
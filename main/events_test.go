@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Function to count the subscribers of an event hub.
+func (h *eventHub) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
+
+// Function to wait for the event hub of the server under test to have the given number of subscribers.
+func (ts *testServer) waitForSubscribers(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ts.events.len() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("event hub has %d subscribers, want %d", ts.events.len(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Function to open the event stream of the server under test, returning its lines and the function disconnecting it.
+func (ts *testServer) streamEvents(t *testing.T) (*bufio.Scanner, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.http.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events: got %d with Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewScanner(resp.Body), cancel
+}
+
+// Function to read the next event from a stream, skipping heartbeats, returning its fields by name.
+func nextEvent(t *testing.T, lines *bufio.Scanner) map[string]string {
+	t.Helper()
+
+	fields := make(map[string]string)
+	for lines.Scan() {
+		line := lines.Text()
+		if line == "" && len(fields) > 0 {
+			return fields
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok && name != "" {
+			fields[name] = value
+		}
+	}
+	t.Fatalf("event stream ended: %v", lines.Err())
+	return nil
+}
+
+func TestEventStreamSendsProcessedReceiptsAndLetsGoOnDisconnect(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	lines, disconnect := ts.streamEvents(t)
+	ts.waitForSubscribers(t, 1)
+
+	id := ts.submit(t, cornerReceipt)
+	fields := nextEvent(t, lines)
+	if fields["id"] != id || fields["event"] != "receipt" {
+		t.Fatalf("event: got %v, want a receipt event for %s", fields, id)
+	}
+	var event ReceiptEvent
+	if err := json.Unmarshal([]byte(fields["data"]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != id || event.Retailer != "M&M Corner Market" || event.Points != 109 || event.Total.String() != "9.00" {
+		t.Fatalf("event data: got %+v", event)
+	}
+
+	disconnect()
+	ts.waitForSubscribers(t, 0)
+
+	//Receipts processed with nobody listening are not held for anyone.
+	ts.submit(t, targetReceipt)
+	if n := ts.events.len(); n != 0 {
+		t.Fatalf("event hub has %d subscribers after a submission, want 0", n)
+	}
+}
+
+func TestEventStreamEndsWhenTheHubCloses(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	lines, disconnect := ts.streamEvents(t)
+	defer disconnect()
+	ts.waitForSubscribers(t, 1)
+
+	ts.events.Close()
+	for lines.Scan() {
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatalf("stream ended with %v, want a clean end", err)
+	}
+	ts.waitForSubscribers(t, 0)
+}
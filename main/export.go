@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Number of rows written between flushes of a streamed export.
+const exportFlushRows = 100
+
+// Columns of the CSV export, with one row per receipt or, in items mode, one row per item.
+var (
+	csvReceiptColumns = []string{"id", "retailer", "purchaseDate", "purchaseTime", "total", "itemCount", "points"}
+	csvItemColumns    = []string{"id", "retailer", "purchaseDate", "purchaseTime", "total", "item", "shortDescription", "price"}
+)
+
+// Function to handle requests for every stored receipt as CSV, one row per receipt.
+// With items=true there is one row per item instead, giving the receipt columns again on each.
+// Rows are written as the store is read and flushed every so often, so the export is never held in memory.
+func (s *Server) exportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	items := false
+	if value := r.URL.Query().Get("items"); value != "" {
+		var err error
+		if items, err = strconv.ParseBool(value); err != nil {
+			writeProblem(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("invalid items %q: expected true or false", value))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="receipts.csv"`)
+	writer := csv.NewWriter(w)
+	controller := http.NewResponseController(w)
+
+	columns := csvReceiptColumns
+	if items {
+		columns = csvItemColumns
+	}
+	writer.Write(columns)
+
+	rows := 0
+	write := func(record []string) error {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			writer.Flush()
+			controller.Flush()
+		}
+		return writer.Error()
+	}
+
+	err := s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		total := ""
+		if receipt.Total != nil {
+			total = receipt.Total.String()
+		}
+
+		if !items {
+			points, err := storedPoints(receipt)
+			if err != nil {
+				return err
+			}
+			return write([]string{id, receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, total, strconv.Itoa(len(receipt.Items)), strconv.Itoa(points)})
+		}
+
+		for i, item := range receipt.Items {
+			price := ""
+			if item.Price != nil {
+				price = item.Price.String()
+			}
+			if err := write([]string{id, receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, total, strconv.Itoa(i), item.Description, price}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	writer.Flush()
+
+	//The header row has already been sent, so a failure part way through cuts the export short.
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		log.Printf("CSV export stopped early: %v", err)
+	}
+}
+
+// Function to handle requests for the stored receipts as one JSON document per line, with their id and points.
+// Receipts can be filtered by retailer and purchase date range like the listing. Ids are read from the store
+// a batch at a time and each receipt is fetched on its own, so no lock is held while lines are written, and
+// receipts changed during the export are written as they are when reached, or left out if deleted by then.
+func (s *Server) exportNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r.URL.Query())
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	controller := http.NewResponseController(w)
+
+	rows := 0
+	err = s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		if !filter.match(receipt) {
+			return nil
+		}
+
+		//Receipts stored before points were kept are scored on the way out, without changing the stored copy.
+		if receipt.Points == nil {
+			points, err := calculatePoints(receipt)
+			if err != nil {
+				return err
+			}
+			scored := *receipt
+			scored.Points = &points
+			receipt = &scored
+		}
+
+		if err := encoder.Encode(ReceiptDocument{ID: id, Receipt: receipt}); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			controller.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		return
+	}
+
+	//Once the first line is sent the status can't be changed, so a failure part way through cuts the export short.
+	if rows == 0 {
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("NDJSON export stopped early: %v", err)
+}
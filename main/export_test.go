@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// Function to fetch the CSV export of the server under test with the given query, parsed into records.
+func (ts *testServer) exportCSV(t *testing.T, query string) [][]string {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts/export.csv"+query, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /receipts/export.csv%s: got %d, want 200: %s", query, resp.StatusCode, readBody(t, resp))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+		t.Fatalf("GET /receipts/export.csv: got Content-Type %q", contentType)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing the CSV export: %v", err)
+	}
+	return records
+}
+
+// Function to store receipts for a CSV export, including retailer names only a CSV writer's quoting keeps whole.
+func seedCSVReceipts(t *testing.T, ts *testServer) {
+	t.Helper()
+
+	ts.submit(t, targetReceipt)
+	ts.submit(t, cornerReceipt)
+	for _, retailer := range []string{`Smith, Jones & Co`, `The "Best" Deli`, "Line\nBreak"} {
+		receipt := exampleReceipt(t, cornerReceipt)
+		receipt.Retailer = retailer
+		if err := ts.store.Save(context.Background(), newReceiptID(), receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//Enough receipts that the export is flushed part way through.
+	for i := 0; i < exportFlushRows; i++ {
+		ts.submit(t, receiptWithItems(1+i%3))
+	}
+}
+
+func TestCSVExportMatchesTheStore(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	seedCSVReceipts(t, ts)
+
+	records := ts.exportCSV(t, "")
+	if !equalIDs(records[0], csvReceiptColumns) {
+		t.Fatalf("header: got %v, want %v", records[0], csvReceiptColumns)
+	}
+	contents := ts.contents(t)
+	if len(records)-1 != len(contents) {
+		t.Fatalf("export has %d rows, the store holds %d receipts", len(records)-1, len(contents))
+	}
+	for _, record := range records[1:] {
+		receipt, ok := contents[record[0]]
+		if !ok {
+			t.Fatalf("exported %s, which is not stored or was exported already", record[0])
+		}
+		points, err := storedPoints(&receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{record[0], receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total.String(), strconv.Itoa(len(receipt.Items)), strconv.Itoa(points)}
+		if !equalIDs(record, want) {
+			t.Errorf("row: got %q, want %q", record, want)
+		}
+		delete(contents, record[0])
+	}
+}
+
+func TestCSVExportGivesARowPerItem(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	seedCSVReceipts(t, ts)
+
+	records := ts.exportCSV(t, "?items=true")
+	if !equalIDs(records[0], csvItemColumns) {
+		t.Fatalf("header: got %v, want %v", records[0], csvItemColumns)
+	}
+	contents := ts.contents(t)
+	items := 0
+	for _, receipt := range contents {
+		items += len(receipt.Items)
+	}
+	if len(records)-1 != items {
+		t.Fatalf("export has %d rows, the store holds %d items", len(records)-1, items)
+	}
+	for _, record := range records[1:] {
+		receipt := contents[record[0]]
+		i, err := strconv.Atoi(record[5])
+		if err != nil || i >= len(receipt.Items) {
+			t.Fatalf("row %q: no item %s on the stored receipt", record, record[5])
+		}
+		item := receipt.Items[i]
+		want := []string{record[0], receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total.String(), record[5], item.Description, item.Price.String()}
+		if !equalIDs(record, want) {
+			t.Errorf("row: got %q, want %q", record, want)
+		}
+	}
+
+	expectProblem(t, ts.do(t, "GET", "/receipts/export.csv?items=maybe", ""), http.StatusBadRequest, codeInvalidParameter)
+}
+
+// Function to fetch the NDJSON export of the server under test with the given query, parsing each line on its own.
+func (ts *testServer) exportNDJSON(t *testing.T, query string) []ReceiptDocument {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts/export.ndjson"+query, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /receipts/export.ndjson%s: got %d, want 200: %s", query, resp.StatusCode, readBody(t, resp))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Fatalf("GET /receipts/export.ndjson: got Content-Type %q", contentType)
+	}
+	var documents []ReceiptDocument
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var document ReceiptDocument
+		if err := json.Unmarshal(scanner.Bytes(), &document); err != nil {
+			t.Fatalf("line %d %q: %v", len(documents)+1, scanner.Text(), err)
+		}
+		documents = append(documents, document)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return documents
+}
+
+func TestNDJSONExportGivesEveryReceiptWithItsPoints(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	want := map[string]int{ts.submit(t, targetReceipt): 28, ts.submit(t, cornerReceipt): 109}
+	legacy := newReceiptID()
+	if err := ts.store.Save(context.Background(), legacy, exampleReceipt(t, cornerReceipt)); err != nil {
+		t.Fatal(err)
+	}
+	want[legacy] = 109
+
+	documents := ts.exportNDJSON(t, "")
+	if len(documents) != len(want) {
+		t.Fatalf("export has %d lines, want %d", len(documents), len(want))
+	}
+	for _, document := range documents {
+		if document.Receipt == nil || document.Points == nil || *document.Points != want[document.ID] {
+			t.Errorf("%s: got %+v, want %d points", document.ID, document.Receipt, want[document.ID])
+		}
+	}
+	if stored := ts.stored(t, legacy); stored.Points != nil {
+		t.Error("exporting scored the stored copy of a legacy receipt")
+	}
+}
+
+func TestNDJSONExportFilters(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	january := ts.submit(t, datedReceipt("Target", "2022-01-15"))
+	ts.submit(t, datedReceipt("Target", "2022-02-15"))
+	ts.submit(t, datedReceipt("Walgreens", "2022-01-20"))
+
+	documents := ts.exportNDJSON(t, "?retailer=TARGET&from=2022-01-01&to=2022-01-31")
+	if len(documents) != 1 || documents[0].ID != january {
+		t.Fatalf("filtered export: got %+v, want only %s", documents, january)
+	}
+	expectProblem(t, ts.do(t, "GET", "/receipts/export.ndjson?from=2022-02-01&to=2022-01-01", ""), http.StatusBadRequest, codeInvalidParameter)
+}
+
+func TestNDJSONExportWhileTheStoreChanges(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	var ids []string
+	for i := 0; i < 3*indexEachBatch; i++ {
+		ids = append(ids, ts.submit(t, []string{targetReceipt, cornerReceipt}[i%2]))
+	}
+
+	//Receipts are saved, replaced, and deleted from another goroutine for as long as the exports run.
+	ctx := context.Background()
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			receipt := exampleReceipt(t, cornerReceipt)
+			scoreReceipt(receipt)
+			ts.store.Save(ctx, newReceiptID(), receipt)
+			ts.store.Save(ctx, ids[i%len(ids)], receipt)
+			ts.store.Delete(ctx, ids[(i*7)%len(ids)])
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		seen := map[string]bool{}
+		for _, document := range ts.exportNDJSON(t, "") {
+			if seen[document.ID] {
+				t.Errorf("%s exported twice", document.ID)
+			}
+			seen[document.ID] = true
+			if document.Receipt == nil || document.Points == nil || (*document.Points != 28 && *document.Points != 109) {
+				t.Errorf("%s: exported %+v", document.ID, document.Receipt)
+			}
+		}
+	}
+	close(stop)
+	<-done
+}
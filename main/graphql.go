@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// GraphQL schema served on /graphql. Amounts are exposed as the Money scalar, written as a decimal string
+// with two decimal places, e.g. "6.49", and read like the amounts of a JSON receipt.
+const graphQLSchema = `
+	scalar Money
+
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	type Query {
+		receipt(id: ID!): Receipt
+		receipts(filter: ReceiptFilter, limit: Int = 50, after: ID): ReceiptPage!
+	}
+
+	type Mutation {
+		processReceipt(input: ReceiptInput!): ProcessReceiptPayload!
+	}
+
+	type Receipt {
+		id: ID!
+		retailer: String!
+		purchaseDate: String!
+		purchaseTime: String!
+		total: Money
+		items: [Item!]!
+		points: Int!
+		createdAt: String
+	}
+
+	type Item {
+		shortDescription: String!
+		price: Money
+	}
+
+	type ReceiptPage {
+		receipts: [Receipt!]!
+		nextCursor: ID
+	}
+
+	input ReceiptFilter {
+		retailer: String
+		retailerPrefix: String
+		from: String
+		to: String
+	}
+
+	input ReceiptInput {
+		retailer: String!
+		purchaseDate: String!
+		purchaseTime: String!
+		total: Money!
+		items: [ItemInput!]!
+	}
+
+	input ItemInput {
+		shortDescription: String!
+		price: Money!
+	}
+
+	type ProcessReceiptPayload {
+		id: ID!
+	}
+`
+
+// Type for the Money scalar, holding an amount as text so it is parsed with the server's number format.
+type Money string
+
+// Function to name the GraphQL scalar the type implements.
+func (Money) ImplementsGraphQLType(name string) bool {
+	return name == "Money"
+}
+
+// Function to read a Money value given in a query or its variables, which must be a string.
+func (m *Money) UnmarshalGraphQL(input interface{}) error {
+	text, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("Money must be given as a string, e.g. %q", "6.49")
+	}
+	*m = Money(text)
+	return nil
+}
+
+// Function to write a Money value as a JSON string.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(m))
+}
+
+// Function to convert a stored amount into a Money value, nil for a missing amount.
+func moneyOf(amount *Amount) *Money {
+	if amount == nil {
+		return nil
+	}
+	m := Money(amount.String())
+	return &m
+}
+
+// Struct for an error returned by a GraphQL resolver, carrying a machine-readable code and any
+// invalid fields in the error's extensions.
+type graphQLError struct {
+	message string
+	code    string
+	fields  []FieldError
+}
+
+// Function to return the error message.
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+// Function to return the extensions reported alongside the error.
+func (e *graphQLError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	if len(e.fields) > 0 {
+		extensions["errors"] = e.fields
+	}
+	return extensions
+}
+
+// Function to convert a receipt store error into a GraphQL error, logging failures of the store itself.
+func graphQLStoreError(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return &graphQLError{message: "Receipt not found", code: codeNotFound}
+	}
+	log.Printf("receipt store error: %v", err)
+	return &graphQLError{message: "Error accessing receipt store", code: codeInternal}
+}
+
+// Struct for the root resolver of the GraphQL schema, backed by the server's store.
+type graphQLResolver struct {
+	server *Server
+}
+
+// Struct for resolving a stored receipt.
+type receiptResolver struct {
+	id      string
+	receipt *Receipt
+}
+
+// Function to resolve the receipt id.
+func (r *receiptResolver) ID() graphql.ID {
+	return graphql.ID(r.id)
+}
+
+// Function to resolve the retailer name.
+func (r *receiptResolver) Retailer() string {
+	return r.receipt.Retailer
+}
+
+// Function to resolve the purchase date.
+func (r *receiptResolver) PurchaseDate() string {
+	return r.receipt.PurchaseDate
+}
+
+// Function to resolve the purchase time.
+func (r *receiptResolver) PurchaseTime() string {
+	return r.receipt.PurchaseTime
+}
+
+// Function to resolve the total.
+func (r *receiptResolver) Total() *Money {
+	return moneyOf(r.receipt.Total)
+}
+
+// Function to resolve the items.
+func (r *receiptResolver) Items() []*itemResolver {
+	items := make([]*itemResolver, len(r.receipt.Items))
+	for i := range r.receipt.Items {
+		items[i] = &itemResolver{item: r.receipt.Items[i]}
+	}
+	return items
+}
+
+// Function to resolve the points scored when the receipt was submitted.
+func (r *receiptResolver) Points() (int32, error) {
+	points, err := storedPoints(r.receipt)
+	if err != nil {
+		return 0, &graphQLError{message: "Error calculating points", code: codeInternal}
+	}
+	return int32(points), nil
+}
+
+// Function to resolve when the receipt was submitted, in RFC 3339 form.
+func (r *receiptResolver) CreatedAt() *string {
+	if r.receipt.CreatedAt == nil {
+		return nil
+	}
+	text := r.receipt.CreatedAt.Format(time.RFC3339Nano)
+	return &text
+}
+
+// Struct for resolving an item of a stored receipt.
+type itemResolver struct {
+	item Item
+}
+
+// Function to resolve the item description.
+func (r *itemResolver) ShortDescription() string {
+	return r.item.Description
+}
+
+// Function to resolve the item price.
+func (r *itemResolver) Price() *Money {
+	return moneyOf(r.item.Price)
+}
+
+// Struct for resolving a page of receipts.
+type receiptPageResolver struct {
+	receipts   []*receiptResolver
+	nextCursor *graphql.ID
+}
+
+// Function to resolve the receipts on the page.
+func (r *receiptPageResolver) Receipts() []*receiptResolver {
+	return r.receipts
+}
+
+// Function to resolve the cursor fetching the next page, null on the last page.
+func (r *receiptPageResolver) NextCursor() *graphql.ID {
+	return r.nextCursor
+}
+
+// Function to resolve a stored receipt by id, null when no receipt is stored under it.
+func (g *graphQLResolver) Receipt(ctx context.Context, args struct{ ID graphql.ID }) (*receiptResolver, error) {
+	id, err := parseReceiptID(string(args.ID))
+	if err != nil {
+		return nil, &graphQLError{message: err.Error(), code: codeInvalidID}
+	}
+
+	receipt, err := g.server.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	return &receiptResolver{id: id, receipt: receipt}, nil
+}
+
+// Function to resolve a page of stored receipts in id order, starting after the given id.
+// The filter matches receipts like the query parameters of the receipts listing.
+func (g *graphQLResolver) Receipts(ctx context.Context, args struct {
+	Filter *struct {
+		Retailer       *string
+		RetailerPrefix *string
+		From           *string
+		To             *string
+	}
+	Limit int32
+	After *graphql.ID
+}) (*receiptPageResolver, error) {
+	if args.Limit < 1 || args.Limit > maxListLimit {
+		return nil, &graphQLError{message: fmt.Sprintf("invalid limit %d: expected a number from 1 to %d", args.Limit, maxListLimit), code: codeInvalidParameter}
+	}
+
+	query := make(map[string][]string)
+	if f := args.Filter; f != nil {
+		for name, value := range map[string]*string{"retailer": f.Retailer, "retailerPrefix": f.RetailerPrefix, "from": f.From, "to": f.To} {
+			if value != nil {
+				query[name] = []string{*value}
+			}
+		}
+	}
+	filter, err := parseListFilter(query)
+	if err != nil {
+		return nil, &graphQLError{message: err.Error(), code: codeInvalidParameter}
+	}
+
+	after := ""
+	if args.After != nil {
+		after = string(*args.After)
+	}
+
+	//Read one receipt past the page to know whether there is another page.
+	page := &receiptPageResolver{receipts: []*receiptResolver{}}
+	more := false
+	err = g.server.store.Each(ctx, after, func(id string, receipt *Receipt) error {
+		if !filter.match(receipt) {
+			return nil
+		}
+		if len(page.receipts) == int(args.Limit) {
+			more = true
+			return errStopEach
+		}
+		page.receipts = append(page.receipts, &receiptResolver{id: id, receipt: receipt})
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopEach) {
+		return nil, graphQLStoreError(err)
+	}
+
+	if more {
+		cursor := graphql.ID(page.receipts[len(page.receipts)-1].id)
+		page.nextCursor = &cursor
+	}
+	return page, nil
+}
+
+// Struct for the input of the processReceipt mutation.
+type receiptInput struct {
+	Retailer     string
+	PurchaseDate string
+	PurchaseTime string
+	Total        Money
+	Items        []struct {
+		ShortDescription string
+		Price            Money
+	}
+}
+
+// Struct for resolving the result of the processReceipt mutation.
+type processReceiptPayload struct {
+	id string
+}
+
+// Function to resolve the id the receipt was stored under.
+func (p *processReceiptPayload) ID() graphql.ID {
+	return graphql.ID(p.id)
+}
+
+// Function to validate, score, and store a receipt submitted through GraphQL.
+// Invalid receipts fail with a validation_failed error listing every field at fault in its extensions.
+func (g *graphQLResolver) ProcessReceipt(ctx context.Context, args struct{ Input receiptInput }) (*processReceiptPayload, error) {
+	input := args.Input
+	wire := wireReceipt{
+		Retailer:     input.Retailer,
+		Total:        textAmount(string(input.Total)),
+		PurchaseDate: input.PurchaseDate,
+		PurchaseTime: input.PurchaseTime,
+		Items:        make([]wireItem, len(input.Items)),
+	}
+	for i, item := range input.Items {
+		wire.Items[i] = wireItem{Description: item.ShortDescription, Price: textAmount(string(item.Price))}
+	}
+
+	id, errs, err := g.server.submitReceipt(ctx, &wire)
+	if len(errs) > 0 {
+		return nil, &graphQLError{message: "invalid receipt", code: codeValidationFailed, fields: errs}
+	}
+	if err != nil {
+		return nil, graphQLStoreError(err)
+	}
+	return &processReceiptPayload{id: id}, nil
+}
+
+// Struct for a GraphQL request given as JSON.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Function to build the handler executing GraphQL requests against the server's store.
+// Every request that can be read gets a 200 response, with any errors reported in its errors array.
+func (s *Server) graphQLHandler() http.Handler {
+	schema := graphql.MustParseSchema(graphQLSchema, &graphQLResolver{server: s})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"errors": []map[string]interface{}{{"message": "Error parsing JSON: " + err.Error(), "extensions": map[string]string{"code": codeInvalidJSON}}},
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, schema.Exec(r.Context(), request.Query, request.OperationName, request.Variables))
+	})
+}
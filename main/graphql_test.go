@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// Struct for a GraphQL response, with the data left raw for each test to decode.
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code   string       `json:"code"`
+			Errors []FieldError `json:"errors"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// Function to run a GraphQL request against the server under test, decoding its data into v.
+func (ts *testServer) graphQL(t *testing.T, query string, variables map[string]any, v any) graphQLResponse {
+	t.Helper()
+
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := ts.do(t, "POST", "/graphql", string(body))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /graphql: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response graphQLResponse
+	decodeBody(t, resp, &response)
+	if v != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, v); err != nil {
+			t.Fatalf("decoding data %s: %v", response.Data, err)
+		}
+	}
+	return response
+}
+
+// Mutation submitting a receipt given in the input variable.
+const processReceiptMutation = `mutation($input: ReceiptInput!) { processReceipt(input: $input) { id } }`
+
+// Function to return the challenge's Target receipt as a GraphQL ReceiptInput.
+func targetReceiptInput(t *testing.T) map[string]any {
+	t.Helper()
+
+	var input map[string]any
+	if err := json.Unmarshal([]byte(targetReceipt), &input); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestGraphQLSubmitsAndQueriesAReceipt(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	var submitted struct {
+		ProcessReceipt struct{ ID string }
+	}
+	response := ts.graphQL(t, processReceiptMutation, map[string]any{"input": targetReceiptInput(t)}, &submitted)
+	if len(response.Errors) > 0 {
+		t.Fatalf("processReceipt: %+v", response.Errors)
+	}
+	id := submitted.ProcessReceipt.ID
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points of the receipt submitted through GraphQL: got %d, want 28", got)
+	}
+
+	var queried struct {
+		Receipt struct {
+			ID       string
+			Retailer string
+			Total    string
+			Points   int
+			Items    []struct {
+				ShortDescription string
+				Price            string
+			}
+		}
+	}
+	response = ts.graphQL(t, `query($id: ID!) { receipt(id: $id) { id retailer total points items { shortDescription price } } }`, map[string]any{"id": id}, &queried)
+	if len(response.Errors) > 0 {
+		t.Fatalf("receipt: %+v", response.Errors)
+	}
+	got := queried.Receipt
+	if got.ID != id || got.Retailer != "Target" || got.Total != "35.35" || got.Points != 28 || len(got.Items) != 5 || got.Items[0].Price != "6.49" {
+		t.Fatalf("receipt: got %+v", got)
+	}
+
+	//An unknown receipt is null rather than an error.
+	var missing struct{ Receipt *struct{ ID string } }
+	response = ts.graphQL(t, `query($id: ID!) { receipt(id: $id) { id } }`, map[string]any{"id": newReceiptID()}, &missing)
+	if len(response.Errors) > 0 || missing.Receipt != nil {
+		t.Fatalf("unknown receipt: got %+v, errors %+v", missing.Receipt, response.Errors)
+	}
+}
+
+func TestGraphQLReportsAnInvalidReceiptWithItsFields(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	input := targetReceiptInput(t)
+	input["purchaseTime"] = "25:00"
+
+	response := ts.graphQL(t, processReceiptMutation, map[string]any{"input": input}, nil)
+	if len(response.Errors) != 1 {
+		t.Fatalf("errors: got %+v, want one", response.Errors)
+	}
+	extensions := response.Errors[0].Extensions
+	if extensions.Code != codeValidationFailed || len(extensions.Errors) != 1 || extensions.Errors[0].Field != "purchaseTime" {
+		t.Fatalf("extensions: got %+v, want purchaseTime invalid", extensions)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("store holds %v, want nothing", ids)
+	}
+}
+
+func TestGraphQLPagesThroughFilteredReceipts(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	for _, retailer := range []string{"Target", "Walgreens", "Target", "Target"} {
+		ts.submit(t, datedReceipt(retailer, "2022-01-15"))
+	}
+
+	query := `query($after: ID) { receipts(filter: {retailer: "target"}, limit: 2, after: $after) { receipts { id retailer } nextCursor } }`
+	var ids []string
+	var after any
+	for pages := 0; ; pages++ {
+		var page struct {
+			Receipts struct {
+				Receipts   []struct{ ID, Retailer string }
+				NextCursor *string
+			}
+		}
+		response := ts.graphQL(t, query, map[string]any{"after": after}, &page)
+		if len(response.Errors) > 0 || pages > 2 {
+			t.Fatalf("receipts page %d: %+v", pages, response.Errors)
+		}
+		for _, receipt := range page.Receipts.Receipts {
+			if receipt.Retailer != "Target" {
+				t.Fatalf("filtered page holds %+v", receipt)
+			}
+			ids = append(ids, receipt.ID)
+		}
+		if page.Receipts.NextCursor == nil {
+			break
+		}
+		after = *page.Receipts.NextCursor
+	}
+	if len(ids) != 3 {
+		t.Fatalf("paged through %v, want the three Target receipts", ids)
+	}
+}
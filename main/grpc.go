@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/receiptpb"
+)
+
+// Struct for the gRPC receipt processor service, backed by the same store and scoring as the HTTP API.
+type grpcService struct {
+	receiptpb.UnimplementedReceiptProcessorServer
+	server *Server
+}
+
+// Function to create a gRPC server serving the receipt processor service from the given server's store.
+func (s *Server) GRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer()
+	receiptpb.RegisterReceiptProcessorServer(grpcServer, &grpcService{server: s})
+	return grpcServer
+}
+
+// Function to validate, score, and store a receipt submitted over gRPC, returning its id.
+func (g *grpcService) ProcessReceipt(ctx context.Context, message *receiptpb.Receipt) (*receiptpb.ProcessReceiptResponse, error) {
+	//Amounts are read like JSON string amounts, so they are checked exactly as on the HTTP API.
+	id, errs, err := g.server.submitReceipt(ctx, protoWireReceipt(message))
+	if len(errs) > 0 {
+		return nil, invalidReceiptStatus(errs)
+	}
+	if err != nil {
+		return nil, storeStatus(err)
+	}
+
+	return &receiptpb.ProcessReceiptResponse{Id: id}, nil
+}
+
+// Function to return the points a stored receipt scored given its id.
+// A receipt still being scored in the background is UNAVAILABLE, with how long to wait before asking again,
+// and one that failed to be scored there is INTERNAL.
+func (g *grpcService) GetPoints(ctx context.Context, request *receiptpb.GetPointsRequest) (*receiptpb.PointsResponse, error) {
+	id, err := parseReceiptID(request.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if _, pending := g.server.async.lookup(id); pending {
+		return nil, pendingStatus(id)
+	}
+	if failure, failed := g.server.async.failure(id); failed {
+		return nil, status.Error(codes.Internal, failure.message(id))
+	}
+
+	receipt, err := g.server.store.Get(ctx, id)
+	if err != nil {
+		return nil, storeStatus(err)
+	}
+
+	points, err := storedPoints(receipt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error calculating points")
+	}
+
+	//Receipts stored without their points are scored now, under the default rules, as over HTTP.
+	version := receipt.RuleVersion
+	if receipt.Points == nil {
+		version = defaultRuleVersion
+	}
+	return &receiptpb.PointsResponse{Points: int64(points), RuleVersion: version}, nil
+}
+
+// Function to build an UNAVAILABLE status for a receipt still being scored, asking to retry after the
+// same delay as the Retry-After header of the HTTP API.
+func pendingStatus(id string) error {
+	st := status.New(codes.Unavailable, "Receipt "+id+" is still being scored")
+	seconds, _ := strconv.ParseInt(pendingRetryAfter, 10, 64)
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(seconds) * time.Second)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// Function to build an INVALID_ARGUMENT status listing every receipt field that failed validation.
+func invalidReceiptStatus(errs []FieldError) error {
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(errs))
+	for i, e := range errs {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: e.Field, Description: e.Message}
+	}
+
+	st, err := status.New(codes.InvalidArgument, "invalid receipt").WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid receipt")
+	}
+	return st.Err()
+}
+
+// Function to convert a receipt store error into a gRPC status, NOT_FOUND for unknown ids.
+// Other failures are logged and reported without their details, as on the HTTP API.
+func storeStatus(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return status.Error(codes.NotFound, "Receipt not found")
+	}
+
+	log.Printf("receipt store error: %v", err)
+	return status.Error(codes.Internal, "Error accessing receipt store")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/receiptpb"
+)
+
+// Function to serve the gRPC service of a server under test over an in-memory connection and return a client for it.
+func (ts *testServer) grpcClient(t *testing.T) receiptpb.ReceiptProcessorClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := ts.GRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return receiptpb.NewReceiptProcessorClient(conn)
+}
+
+// Function to return the example target receipt as a protocol buffers message.
+func targetReceiptMessage() *receiptpb.Receipt {
+	return &receiptpb.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []*receiptpb.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+}
+
+func TestReceiptSubmittedOverGRPCScoresOverHTTP(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	client := ts.grpcClient(t)
+	ctx := context.Background()
+
+	response, err := client.ProcessReceipt(ctx, targetReceiptMessage())
+	if err != nil {
+		t.Fatalf("ProcessReceipt: %v", err)
+	}
+	if got := ts.points(t, response.GetId()); got != 28 {
+		t.Fatalf("points over HTTP: got %d, want 28", got)
+	}
+
+	points, err := client.GetPoints(ctx, &receiptpb.GetPointsRequest{Id: response.GetId()})
+	if err != nil || points.GetPoints() != 28 || points.GetRuleVersion() != defaultRuleVersion {
+		t.Fatalf("GetPoints: got %v, %v, want 28 under %s", points, err, defaultRuleVersion)
+	}
+}
+
+func TestGRPCGetPointsReportsPendingReceipts(t *testing.T) {
+	//With no workers, receipts accepted for scoring in the background stay pending.
+	cfg := testConfig()
+	cfg.AsyncWorkers = 0
+	ts := newTestServer(t, cfg)
+	client := ts.grpcClient(t)
+
+	resp := ts.do(t, "POST", "/receipts/process", targetReceipt, "Prefer", "respond-async")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST with respond-async: got %d, want 202", resp.StatusCode)
+	}
+	var accepted ReceiptResponse
+	decodeBody(t, resp, &accepted)
+
+	_, err := client.GetPoints(context.Background(), &receiptpb.GetPointsRequest{Id: accepted.ID})
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable {
+		t.Fatalf("GetPoints of a pending receipt: got %v, want UNAVAILABLE", err)
+	}
+	var delay time.Duration
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			delay = info.GetRetryDelay().AsDuration()
+		}
+	}
+	if delay != time.Second {
+		t.Fatalf("GetPoints of a pending receipt: retry delay %v, want 1s", delay)
+	}
+
+	_, err = client.GetPoints(context.Background(), &receiptpb.GetPointsRequest{Id: newReceiptID()})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("GetPoints of an unknown receipt: got %v, want NOT_FOUND", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Longest a single readiness check may take before it counts as failed.
+const readinessCheckTimeout = 2 * time.Second
+
+// Interface for a receipt store that can report whether its backing service is answering.
+// Stores that implement it are checked by /readyz.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Struct for a named check that must pass for the server to be ready.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Struct for the checks run by /readyz, which may be added to at any time.
+type readinessChecks struct {
+	mu     sync.RWMutex
+	checks []readinessCheck
+
+	//Set once the router has been built.
+	routed atomic.Bool
+}
+
+// Struct for the outcome of a single readiness check given as JSON.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Struct for returning the outcome of a health or readiness probe given as JSON.
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Function to add a check that must pass for the server to be ready, e.g. a ping of a backing store.
+func (s *Server) AddReadinessCheck(name string, check func(ctx context.Context) error) {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+
+	s.readiness.checks = append(s.readiness.checks, readinessCheck{name: name, check: check})
+}
+
+// Function to handle liveness probes, answering as long as the process is serving requests.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Function to handle readiness probes, running every readiness check in turn.
+// Answers 200 only once the router is built and every check passes, and 503 otherwise.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	s.readiness.mu.RLock()
+	checks := append([]readinessCheck{{name: "router", check: s.readiness.routerCheck}}, s.readiness.checks...)
+	s.readiness.mu.RUnlock()
+
+	response := HealthResponse{Status: "ok", Checks: make([]CheckResult, 0, len(checks))}
+	status := http.StatusOK
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		err := c.check(ctx)
+		cancel()
+
+		result := CheckResult{Name: c.name, Status: "ok"}
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			response.Status, status = "unavailable", http.StatusServiceUnavailable
+		}
+		response.Checks = append(response.Checks, result)
+	}
+
+	writeJSON(w, status, response)
+}
+
+// Function to check that the router has been built.
+func (c *readinessChecks) routerCheck(ctx context.Context) error {
+	if !c.routed.Load() {
+		return errors.New("router is not ready")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Struct for a stub store whose backing service can be pinged, failing like its other methods.
+type pingingStore struct {
+	*stubStore
+}
+
+// Function to ping the store, failing if it was told to fail.
+func (s pingingStore) Ping(ctx context.Context) error {
+	return s.failure()
+}
+
+// Function to probe the readiness of the server under test, returning the status and the checks it reported.
+func (ts *testServer) ready(t *testing.T) (int, HealthResponse) {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/readyz", "")
+	var response HealthResponse
+	decodeBody(t, resp, &response)
+	return resp.StatusCode, response
+}
+
+// Function to return the status a probe reported for the named check.
+func checkStatus(response HealthResponse, name string) string {
+	for _, check := range response.Checks {
+		if check.Name == name {
+			return check.Status
+		}
+	}
+	return ""
+}
+
+func TestReadyzFollowsTheStoreWhileHealthzStaysUp(t *testing.T) {
+	cfg := testConfig()
+	store := pingingStore{&stubStore{ReceiptStore: newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts)}}
+	ts := newTestServerWithStore(t, cfg, store)
+
+	status, response := ts.ready(t)
+	if status != http.StatusOK || response.Status != "ok" || checkStatus(response, "router") != "ok" || checkStatus(response, "store") != "ok" {
+		t.Fatalf("readyz with the store up: got %d %+v, want 200 with the router and store ok", status, response)
+	}
+
+	store.fail(errors.New("connection refused"))
+	status, response = ts.ready(t)
+	if status != http.StatusServiceUnavailable || response.Status != "unavailable" || checkStatus(response, "store") != "failed" {
+		t.Fatalf("readyz with the store down: got %d %+v, want 503 with the store failed", status, response)
+	}
+	if checkStatus(response, "router") != "ok" {
+		t.Errorf("readyz with the store down reported the router %s", checkStatus(response, "router"))
+	}
+	if resp := ts.do(t, "GET", "/healthz", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz with the store down: got %d, want 200", resp.StatusCode)
+	}
+
+	store.fail(nil)
+	if status, _ := ts.ready(t); status != http.StatusOK {
+		t.Fatalf("readyz once the store recovers: got %d, want 200", status)
+	}
+}
+
+func TestReadyzRunsAddedChecks(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	var err error
+	ts.AddReadinessCheck("cache", func(ctx context.Context) error { return err })
+
+	if status, response := ts.ready(t); status != http.StatusOK || checkStatus(response, "cache") != "ok" {
+		t.Fatalf("readyz with the check passing: got %d %+v", status, response)
+	}
+	err = errors.New("cache is warming up")
+	status, response := ts.ready(t)
+	if status != http.StatusServiceUnavailable || checkStatus(response, "cache") != "failed" {
+		t.Fatalf("readyz with the check failing: got %d %+v, want 503", status, response)
+	}
+	if response.Checks[len(response.Checks)-1].Error != err.Error() {
+		t.Errorf("failed check error: got %q, want %q", response.Checks[len(response.Checks)-1].Error, err)
+	}
+}
+
+func TestReadyzWaitsForTheRouter(t *testing.T) {
+	cfg := testConfig()
+	server := NewServer(cfg, newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts))
+	t.Cleanup(func() {
+		server.sockets.Close()
+		server.async.Close()
+	})
+
+	rec := httptest.NewRecorder()
+	server.readyzHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz before the router is built: got %d, want 503", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("readyz once the router is built: got %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/twinj/uuid"
+)
+
+// Regular expression for the shape of a receipt id, a hyphenated UUID.
+var receiptIDRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Function to generate a new unique receipt id.
+func newReceiptID() string {
+	return uuid.NewV4().String()
+}
+
+// Function to check the shape of a receipt id given in a request and return it in canonical form.
+// Ids are generated in lowercase; uppercase hex digits are accepted and lowercased, since UUIDs are case-insensitive.
+func parseReceiptID(value string) (string, error) {
+	id := strings.ToLower(value)
+	if !receiptIDRegex.MatchString(id) {
+		return "", fmt.Errorf("invalid receipt id %q: expected a UUID such as 7fb1377b-b223-49d9-a31a-5a02701dd310", value)
+	}
+	return id, nil
+}
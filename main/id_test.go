@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseReceiptID(t *testing.T) {
+	id := newReceiptID()
+	for _, test := range []struct {
+		value string
+		want  string
+	}{
+		{id, id},
+		{strings.ToUpper(id), id},
+		{"", ""},
+		{id[:len(id)-1], ""},
+		{strings.ReplaceAll(id, "-", ""), ""},
+		{"../points", ""},
+		{"\x00", ""},
+		{id + "0", ""},
+	} {
+		got, err := parseReceiptID(test.value)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: accepted as %s, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%q: got %q, %v, want %s", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestPointsTellMalformedIDsFromUnknownOnes(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id[:len(id)-1]+"/points", ""), http.StatusBadRequest, codeInvalidID)
+	expectProblem(t, ts.do(t, "GET", "/receipts/%00/points", ""), http.StatusBadRequest, codeInvalidID)
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+newReceiptID()+"/points", ""), http.StatusNotFound, codeNotFound)
+	if got := ts.points(t, strings.ToUpper(id)); got != 28 {
+		t.Fatalf("points of the uppercased id: got %d, want 28", got)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Header clients send to make retrying a receipt submission safe.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Errors returned when an idempotency key can't be used for a request.
+var (
+	errIdempotencyMismatch   = errors.New("the Idempotency-Key was already used with a different request body")
+	errIdempotencyInProgress = errors.New("a request with this Idempotency-Key is still being processed")
+)
+
+// Struct for what is remembered about a request made with an idempotency key.
+// The id is empty while the first request is still being processed.
+type idempotencyEntry struct {
+	bodyHash [sha256.Size]byte
+	id       string
+	expires  time.Time
+}
+
+// Struct for the idempotency keys seen within the window, and the receipt id each one produced.
+type idempotencyKeys struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	window    time.Duration
+	lastSweep time.Time
+}
+
+// Function to create an empty set of idempotency keys that are forgotten after the given window.
+func newIdempotencyKeys(window time.Duration) *idempotencyKeys {
+	return &idempotencyKeys{entries: make(map[string]*idempotencyEntry), window: window}
+}
+
+// Function to claim an idempotency key for a request body.
+// Returns the stored receipt id if the key was already used with the same body, or an empty id if
+// the caller now holds the key and must either finish or release it.
+func (k *idempotencyKeys) begin(key string, body []byte, now time.Time) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.sweep(now)
+
+	hash := sha256.Sum256(body)
+	if entry, exists := k.entries[key]; exists && now.Before(entry.expires) {
+		switch {
+		case entry.bodyHash != hash:
+			return "", errIdempotencyMismatch
+		case entry.id == "":
+			return "", errIdempotencyInProgress
+		default:
+			return entry.id, nil
+		}
+	}
+
+	k.entries[key] = &idempotencyEntry{bodyHash: hash, expires: now.Add(k.window)}
+	return "", nil
+}
+
+// Function to record the receipt id stored by the request holding the key.
+func (k *idempotencyKeys) finish(key string, id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if entry, exists := k.entries[key]; exists {
+		entry.id = id
+	}
+}
+
+// Function to release a key whose request failed, so a retry is processed afresh.
+func (k *idempotencyKeys) release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if entry, exists := k.entries[key]; exists && entry.id == "" {
+		delete(k.entries, key)
+	}
+}
+
+// Function to forget expired keys, at most once a minute. Must be called with k.mu held.
+func (k *idempotencyKeys) sweep(now time.Time) {
+	if now.Sub(k.lastSweep) < time.Minute {
+		return
+	}
+	k.lastSweep = now
+
+	for key, entry := range k.entries {
+		if !now.Before(entry.expires) {
+			delete(k.entries, key)
+		}
+	}
+}
+
+// Function to forget every key whose request stored a receipt, for when the store has been emptied.
+// Keys still being processed are kept for the request holding them.
+func (k *idempotencyKeys) forgetStored() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for key, entry := range k.entries {
+		if entry.id != "" {
+			delete(k.entries, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Function to submit a receipt with an idempotency key, returning the response.
+func (ts *testServer) submitWithKey(t *testing.T, key string, body string) *http.Response {
+	t.Helper()
+
+	return ts.do(t, "POST", "/receipts/process", body, idempotencyKeyHeader, key)
+}
+
+// Function to read the id from a created response, failing unless the receipt was created.
+func createdID(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: got %d, want 201: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response ReceiptResponse
+	decodeBody(t, resp, &response)
+	return response.ID
+}
+
+func TestRetryWithTheSameBodyGetsTheOriginalID(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	first := ts.submitWithKey(t, "key-1", targetReceipt)
+	location := first.Header.Get("Location")
+	id := createdID(t, first)
+
+	retry := ts.submitWithKey(t, "key-1", targetReceipt)
+	if got := retry.Header.Get("Location"); got != location {
+		t.Errorf("retry Location: got %q, want %q", got, location)
+	}
+	if again := createdID(t, retry); again != id {
+		t.Fatalf("retry answered with %s, want %s", again, id)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 1 {
+		t.Fatalf("store holds %v, want one receipt", ids)
+	}
+
+	//The key belongs to its first request, another key is a new submission.
+	if other := createdID(t, ts.submitWithKey(t, "key-2", targetReceipt)); other == id {
+		t.Fatal("a different key was answered with the first key's id")
+	}
+}
+
+func TestRetryWithADifferentBodyConflicts(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := createdID(t, ts.submitWithKey(t, "key-1", targetReceipt))
+
+	expectProblem(t, ts.submitWithKey(t, "key-1", cornerReceipt), http.StatusConflict, codeIdempotencyConflict)
+	if ids := storedIDs(t, ts.store); !equalIDs(ids, []string{id}) {
+		t.Fatalf("store holds %v, want [%s]", ids, id)
+	}
+}
+
+func TestExpiredKeyIsANewSubmission(t *testing.T) {
+	cfg := testConfig()
+	cfg.IdempotencyWindow = time.Hour
+	ts := newTestServer(t, cfg)
+	id := createdID(t, ts.submitWithKey(t, "key-1", targetReceipt))
+
+	ts.clock.Advance(time.Hour - time.Second)
+	if again := createdID(t, ts.submitWithKey(t, "key-1", targetReceipt)); again != id {
+		t.Fatalf("retry within the window answered with %s, want %s", again, id)
+	}
+
+	ts.clock.Advance(time.Second)
+	if again := createdID(t, ts.submitWithKey(t, "key-1", targetReceipt)); again == id {
+		t.Fatal("a retry after the window was answered with the original id")
+	}
+
+	//Once expired the key is free for any body.
+	ts.clock.Advance(time.Hour)
+	createdID(t, ts.submitWithKey(t, "key-1", cornerReceipt))
+}
+
+func TestFailedRequestReleasesItsKey(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	resp := ts.submitWithKey(t, "key-1", `{"retailer":"Target"}`)
+	expectProblem(t, resp, http.StatusUnprocessableEntity, codeValidationFailed)
+
+	//The same key can be retried with the receipt corrected.
+	createdID(t, ts.submitWithKey(t, "key-1", targetReceipt))
+}
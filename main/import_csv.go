@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Columns every CSV upload must have, in any order. Rows sharing a receipt value are the items of one receipt,
+// which takes its retailer, total, purchase date and time from its first row; a row with neither an item
+// description nor a price adds no item. Later rows may leave the receipt columns blank but must not contradict them.
+var csvImportColumns = []string{"receipt", "retailer", "total", "purchaseDate", "purchaseTime", "itemDescription", "itemPrice"}
+
+// Columns of a CSV upload given once per receipt rather than once per item.
+var csvReceiptFields = []string{"retailer", "total", "purchaseDate", "purchaseTime"}
+
+// Regular expression for the item index at the start of a validation field name, e.g. items[2].price.
+var itemFieldRegex = regexp.MustCompile(`^items\[([0-9]+)\]`)
+
+// Struct for a problem with one row of a CSV upload given as JSON.
+type CSVRowError struct {
+	Line    int    `json:"line"`
+	Receipt string `json:"receipt"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// Struct for returning the outcome of a CSV upload given as JSON.
+// IDs holds the id of every stored receipt in the order the receipts first appear in the file.
+type CSVImportResponse struct {
+	IDs      []string      `json:"ids"`
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+	Errors   []CSVRowError `json:"errors"`
+}
+
+// Struct for the rows of a CSV upload belonging to one receipt.
+type csvReceipt struct {
+	key  string
+	line int
+	wire wireReceipt
+
+	//Receipt columns as given on the first row.
+	first map[string]string
+
+	//Line of the row each item came from.
+	itemLines []int
+
+	//Rows that contradict the first row of the receipt.
+	conflicts []CSVRowError
+}
+
+// Function to handle uploads of receipts as CSV, given as the raw body or as the first file of a multipart form.
+// The whole file is parsed before anything is stored, so a malformed file is rejected with nothing stored.
+// Each receipt is then checked and stored like a submitted one, and invalid receipts are reported by line
+// without stopping the rest. A leading byte order mark is ignored.
+func (s *Server) importCSVHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := csvUploadBody(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidCSV, err.Error())
+		return
+	}
+
+	receipts, err := readCSVReceipts(body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidCSV, err.Error())
+		return
+	}
+
+	response := CSVImportResponse{IDs: []string{}, Errors: []CSVRowError{}}
+	for _, c := range receipts {
+		id, errs := s.importCSVReceipt(r, c)
+		if len(errs) > 0 {
+			response.Failed++
+			response.Errors = append(response.Errors, errs...)
+			continue
+		}
+		response.Imported++
+		response.IDs = append(response.IDs, id)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Function to return the CSV file of an upload, the body itself or the first file of a multipart form.
+func csvUploadBody(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading multipart form: %v", err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("the multipart form holds no file")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading multipart form: %v", err)
+		}
+		if part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// Function to read every row of a CSV upload, grouping the rows into receipts in the order they first appear.
+// Fails if the file is not well-formed CSV or lacks a required column.
+func readCSVReceipts(body io.Reader) ([]*csvReceipt, error) {
+	buffered := bufio.NewReader(body)
+	if bom, err := buffered.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		buffered.Discard(3)
+	}
+
+	reader := csv.NewReader(buffered)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing CSV: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvImportColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the CSV header has no %s column, expected %s", name, strings.Join(csvImportColumns, ","))
+		}
+	}
+
+	var receipts []*csvReceipt
+	byKey := make(map[string]*csvReceipt)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return receipts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string { return record[columns[name]] }
+
+		key := field("receipt")
+		c, ok := byKey[key]
+		if !ok {
+			c = &csvReceipt{key: key, line: line, wire: wireReceipt{
+				Retailer:     field("retailer"),
+				Total:        textAmount(field("total")),
+				PurchaseDate: field("purchaseDate"),
+				PurchaseTime: field("purchaseTime"),
+				Items:        []wireItem{},
+			}}
+			c.first = make(map[string]string)
+			for _, name := range csvReceiptFields {
+				c.first[name] = field(name)
+			}
+			byKey[key] = c
+			receipts = append(receipts, c)
+		} else {
+			c.checkConsistent(line, field)
+		}
+
+		description, price := field("itemDescription"), field("itemPrice")
+		if description != "" || price != "" {
+			c.wire.Items = append(c.wire.Items, wireItem{Description: description, Price: textAmount(price)})
+			c.itemLines = append(c.itemLines, line)
+		}
+	}
+}
+
+// Function to check that a later row of a receipt leaves its receipt columns blank or repeats the first row.
+func (c *csvReceipt) checkConsistent(line int, field func(name string) string) {
+	for _, name := range csvReceiptFields {
+		if value := field(name); value != "" && value != c.first[name] {
+			c.conflicts = append(c.conflicts, CSVRowError{
+				Line: line, Receipt: c.key, Field: name, Code: fieldMismatch,
+				Message: fmt.Sprintf("%s %q differs from %q on line %d", name, value, c.first[name], c.line),
+			})
+		}
+	}
+}
+
+// Function to convert amount text, such as a CSV cell, into a raw JSON string for the wire decoder, nil when blank.
+func textAmount(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	raw, _ := json.Marshal(value)
+	return raw
+}
+
+// Function to check, score, and store one receipt of a CSV upload, returning its id.
+// Problems are returned against the line of the row they came from, items by their own row.
+func (s *Server) importCSVReceipt(r *http.Request, c *csvReceipt) (string, []CSVRowError) {
+	if len(c.conflicts) > 0 {
+		return "", c.conflicts
+	}
+
+	rowErrors := func(errs []FieldError) []CSVRowError {
+		rows := make([]CSVRowError, len(errs))
+		for i, e := range errs {
+			line := c.line
+			if match := itemFieldRegex.FindStringSubmatch(e.Field); match != nil {
+				if item, err := strconv.Atoi(match[1]); err == nil && item < len(c.itemLines) {
+					line = c.itemLines[item]
+				}
+			}
+			rows[i] = CSVRowError{Line: line, Receipt: c.key, Field: e.Field, Code: e.Code, Message: e.Message}
+		}
+		return rows
+	}
+
+	receipt, err := c.wire.receipt(s.config.decodeOptions())
+	var badAmounts *amountFormatError
+	if errors.As(err, &badAmounts) {
+		return "", rowErrors(badAmounts.Errors)
+	}
+	if err != nil {
+		return "", []CSVRowError{{Line: c.line, Receipt: c.key, Message: err.Error()}}
+	}
+	errs, err := s.validateAndScore(receipt)
+	if len(errs) > 0 {
+		return "", rowErrors(errs)
+	}
+	if err != nil {
+		return "", []CSVRowError{{Line: c.line, Receipt: c.key, Message: "Error calculating points"}}
+	}
+	now := s.clock.Now().UTC()
+	receipt.CreatedAt = &now
+
+	id, _, err := s.saveReceipt(r.Context(), receipt)
+	if err != nil {
+		log.Printf("receipt store error: %v", err)
+		return "", []CSVRowError{{Line: c.line, Receipt: c.key, Message: "Error accessing receipt store"}}
+	}
+	return id, nil
+}
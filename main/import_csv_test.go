@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Header row of the CSV uploads in these tests.
+const csvUploadHeader = "receipt,retailer,total,purchaseDate,purchaseTime,itemDescription,itemPrice\n"
+
+// Function to upload a CSV file to the server under test, returning the outcome.
+func (ts *testServer) importCSV(t *testing.T, body string) CSVImportResponse {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/receipts/import.csv", body, "Content-Type", "text/csv")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /receipts/import.csv: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response CSVImportResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestCSVImportReadsQuotedFieldsWithCommas(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	response := ts.importCSV(t, csvUploadHeader+
+		`"order 1, corner",M&M Corner Market,9.00,2022-03-20,14:33,Gatorade,2.25`+"\n"+
+		`"order 1, corner",,,,,"Gatorade",2.25`+"\n"+
+		`"order 1, corner",,,,,Gatorade,"2.25"`+"\n"+
+		`"order 1, corner",,,,,Gatorade,2.25`+"\n")
+	if response.Imported != 1 || response.Failed != 0 || len(response.IDs) != 1 {
+		t.Fatalf("import: got %+v, want one receipt imported", response)
+	}
+	if got := ts.points(t, response.IDs[0]); got != 109 {
+		t.Fatalf("points of the imported receipt: got %d, want 109", got)
+	}
+
+	//Amounts in the comma number format are quoted, as the decimal separator is the CSV delimiter.
+	cfg := testConfig()
+	cfg.NumberFormat = numberFormatComma
+	comma := newTestServer(t, cfg)
+	response = comma.importCSV(t, csvUploadHeader+
+		`a,Walgreens,"3,50",2022-01-02,08:13,Pepsi 12PK,"1,25"`+"\n"+
+		`a,,,,,Dasani,"2,25"`+"\n")
+	if response.Imported != 1 {
+		t.Fatalf("import in the comma format: got %+v, want one receipt imported", response)
+	}
+	if stored := comma.stored(t, response.IDs[0]); stored.Total.String() != "3.50" || len(stored.Items) != 2 {
+		t.Fatalf("stored receipt: got total %s and %d items, want 3.50 and 2", stored.Total, len(stored.Items))
+	}
+}
+
+func TestCSVImportIgnoresAByteOrderMark(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	response := ts.importCSV(t, "\xef\xbb\xbf"+csvUploadHeader+"a,Target,1.25,2022-01-01,13:01,Pepsi 12PK,1.25\n")
+	if response.Imported != 1 {
+		t.Fatalf("import with a byte order mark: got %+v, want one receipt imported", response)
+	}
+}
+
+func TestCSVImportReportsABadPriceAndImportsTheRest(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	response := ts.importCSV(t, csvUploadHeader+
+		"good,Target,1.25,2022-01-01,13:01,Pepsi 12PK,1.25\n"+
+		"bad,Walgreens,3.50,2022-01-02,08:13,Pepsi 12PK,1.25\n"+
+		"bad,,,,,Dasani,2.2x\n"+
+		"also good,Walgreens,2.25,2022-01-02,08:13,Dasani,2.25\n")
+	if response.Imported != 2 || response.Failed != 1 || len(response.IDs) != 2 {
+		t.Fatalf("import: got %+v, want two receipts imported and one failed", response)
+	}
+	if len(response.Errors) != 1 {
+		t.Fatalf("errors: got %+v, want the one bad price", response.Errors)
+	}
+	if got := response.Errors[0]; got.Line != 4 || got.Receipt != "bad" || got.Field != "items[1].price" || got.Code != fieldInvalid {
+		t.Fatalf("error: got %+v, want the price on line 4 of receipt bad", got)
+	}
+	imported := append([]string(nil), response.IDs...)
+	sort.Strings(imported)
+	if ids := storedIDs(t, ts.store); !equalIDs(ids, imported) {
+		t.Fatalf("store holds %v, want the imported %v", ids, imported)
+	}
+}
+
+func TestCSVImportRejectsAFileWithoutTheColumns(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	resp := ts.do(t, "POST", "/receipts/import.csv", "receipt,retailer\na,Target\n", "Content-Type", "text/csv")
+	problem := expectProblem(t, resp, http.StatusBadRequest, codeInvalidCSV)
+	if !strings.Contains(problem.Detail, "total") {
+		t.Fatalf("detail: got %q, want the missing column named", problem.Detail)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("store holds %v, want nothing", ids)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Struct for the outcome of importing one line of an NDJSON upload, written back as a line of its own.
+type NDJSONImportResult struct {
+	Line   int          `json:"line"`
+	ID     string       `json:"id,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Function to handle uploads of receipts as one JSON receipt per line, as submitted to /receipts/process.
+// Each line is read, checked, scored, and stored in turn, and its result is written back as soon as it is
+// known, so neither the upload nor the response is ever held in memory. Blank lines are skipped without a
+// result. The body as a whole is not limited in size, each line is limited to -max-line-bytes instead, and
+// a longer line ends the import with a final result for it. Lines before a bad one are stored regardless.
+func (s *Server) importNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	//Results are written while the body is still being read.
+	controller := http.NewResponseController(w)
+	controller.EnableFullDuplex()
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, min(64*1024, s.config.MaxLineBytes)), s.config.MaxLineBytes)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		submitted := s.submitJSON(r.Context(), scanner.Bytes())
+		result := NDJSONImportResult{Line: line, ID: submitted.ID, Error: submitted.Error, Errors: submitted.Errors}
+		if err := encoder.Encode(result); err != nil {
+			return
+		}
+		controller.Flush()
+	}
+
+	if err := scanner.Err(); err != nil {
+		message := "Error reading line: " + err.Error()
+		if errors.Is(err, bufio.ErrTooLong) {
+			message = "line is longer than the largest accepted"
+		}
+		encoder.Encode(NDJSONImportResult{Line: line + 1, Error: message})
+	}
+}
+
+// Struct for the outcome of a receipt submitted as a JSON document on a stream, such as a line of an NDJSON
+// upload or a websocket message: its id and points once stored, or why it wasn't.
+type streamSubmission struct {
+	ID     string
+	Points int
+	Error  string
+	Errors []FieldError
+}
+
+// Function to check, score, and store a receipt given as a JSON document on a stream.
+func (s *Server) submitJSON(ctx context.Context, data []byte) streamSubmission {
+	receipt, err := decodeReceipt(bytes.NewReader(data), s.config.decodeOptions())
+	errs, err := s.checkDecoded(receipt, err)
+	switch {
+	case errors.Is(err, errScoring):
+		return streamSubmission{Error: "Error calculating points"}
+	case err != nil:
+		return streamSubmission{Error: "Error parsing JSON: " + err.Error()}
+	case len(errs) > 0:
+		return streamSubmission{Error: "invalid receipt", Errors: errs}
+	}
+
+	id, _, err := s.storeNewReceipt(ctx, receipt)
+	if err != nil {
+		log.Printf("receipt store error: %v", err)
+		return streamSubmission{Error: "Error accessing receipt store"}
+	}
+	return streamSubmission{ID: id, Points: *receipt.Points}
+}
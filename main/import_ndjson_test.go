@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Function to upload receipts as NDJSON to the server under test, returning the result written for each line.
+func (ts *testServer) importNDJSON(t *testing.T, body string) []NDJSONImportResult {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/receipts/import.ndjson", body, "Content-Type", "application/x-ndjson")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("POST /receipts/import.ndjson: got %d with Content-Type %q: %s", resp.StatusCode, resp.Header.Get("Content-Type"), readBody(t, resp))
+	}
+	var results []NDJSONImportResult
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		var result NDJSONImportResult
+		if err := json.Unmarshal(lines.Bytes(), &result); err != nil {
+			t.Fatalf("result line %q: %v", lines.Text(), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestNDJSONImportReportsEachLineAndStoresTheGoodOnes(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	results := ts.importNDJSON(t, strings.Join([]string{
+		targetReceipt,
+		`{"retailer":`,
+		"",
+		strings.Replace(cornerReceipt, `"14:33"`, `"25:00"`, 1),
+		"  ",
+		cornerReceipt,
+	}, "\n")+"\n")
+
+	if len(results) != 4 {
+		t.Fatalf("results: got %+v, want one for each of the 4 receipt lines", results)
+	}
+	if got := results[0]; got.Line != 1 || got.ID == "" || got.Error != "" || ts.points(t, got.ID) != 28 {
+		t.Errorf("line 1: got %+v, want the Target receipt stored", got)
+	}
+	if got := results[1]; got.Line != 2 || got.ID != "" || !strings.HasPrefix(got.Error, "Error parsing JSON: ") {
+		t.Errorf("line 2: got %+v, want it reported as malformed", got)
+	}
+	if got := results[2]; got.Line != 4 || got.ID != "" || len(got.Errors) != 1 || got.Errors[0].Field != "purchaseTime" {
+		t.Errorf("line 4: got %+v, want purchaseTime invalid", got)
+	}
+	if got := results[3]; got.Line != 6 || got.ID == "" || ts.points(t, got.ID) != 109 {
+		t.Errorf("line 6: got %+v, want the corner receipt stored", got)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 2 {
+		t.Fatalf("store holds %v, want the 2 good receipts", ids)
+	}
+}
+
+func TestNDJSONImportLimitsEachLineRatherThanTheBody(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBodyBytes = int64(len(targetReceipt)) + 1
+	cfg.MaxLineBytes = len(targetReceipt) + 1
+	ts := newTestServer(t, cfg)
+
+	//Three receipts are well over the body limit, but each line is within the line limit.
+	results := ts.importNDJSON(t, strings.Repeat(targetReceipt+"\n", 3))
+	if len(results) != 3 || results[2].ID == "" {
+		t.Fatalf("import over the body limit: got %+v, want 3 receipts stored", results)
+	}
+
+	//A line over the limit ends the import with a result for it.
+	long := strings.Replace(targetReceipt, `"Target"`, `"Targets"`, 1)
+	results = ts.importNDJSON(t, targetReceipt+"\n"+long+"\n"+cornerReceipt+"\n")
+	if len(results) != 2 || results[0].ID == "" || results[1].Line != 2 || results[1].Error != "line is longer than the largest accepted" {
+		t.Fatalf("import with a long line: got %+v, want the first stored and the second too long", results)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 4 {
+		t.Fatalf("store holds %d receipts, want the 4 before the long line", len(ids))
+	}
+}
+
+func BenchmarkNDJSONImport(b *testing.B) {
+	cfg := testConfig()
+	server := NewServer(cfg, newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts))
+	handler := server.Handler()
+	b.Cleanup(func() {
+		server.events.Close()
+		server.sockets.Close()
+		server.async.Close()
+	})
+
+	const lines = 100
+	body := strings.Repeat(targetReceipt+"\n", lines)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/receipts/import.ndjson", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-ndjson")
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != lines {
+			b.Fatalf("import: got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+}
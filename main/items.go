@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Struct for returning how each item of a stored receipt was scored given as JSON.
+// Points totals the items' points, and matches what the description rule adds to the receipt's breakdown.
+// With the description rule disabled the items score nothing, so none are listed.
+type ItemScoresResponse struct {
+	Items       []ItemScore `json:"items"`
+	Points      int         `json:"points"`
+	RuleVersion string      `json:"ruleVersion"`
+}
+
+// Function to handle requests for how each item of a stored receipt was scored given a receipt id.
+// Items are scored by the description rule of the current rules, or the rule set the ruleVersion parameter names,
+// in the order they appear on the receipt, as the points breakdown scores them.
+func (s *Server) getItemScoresHandler(w http.ResponseWriter, r *http.Request) {
+
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(mux.Vars(r)["id"])
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
+	}
+
+	set, err := lookupRuleSet(r.URL.Query().Get("ruleVersion"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	receipt, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	response := ItemScoresResponse{Items: []ItemScore{}, RuleVersion: set.Version}
+	rule, enabled := descriptionRule(set)
+	if !enabled {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	for _, item := range receipt.Items {
+		score := scoreItem(item, rule.Multiplier)
+		response.Items = append(response.Items, score)
+		response.Points += score.Points
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Function to find the item description rule of a rule set, reporting false if the set leaves it out.
+func descriptionRule(set RuleSet) (ItemDescriptionRule, bool) {
+	for _, rule := range set.Rules {
+		if description, ok := rule.(ItemDescriptionRule); ok {
+			return description, true
+		}
+	}
+	return ItemDescriptionRule{}, false
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestItemScoresMatchTheBreakdown(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, body := range []string{targetReceipt, cornerReceipt} {
+		id := ts.submit(t, body)
+		for _, version := range ruleVersions() {
+			resp := ts.do(t, "GET", "/receipts/"+id+"/items?ruleVersion="+version, "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET items under %s: got %d, want 200", version, resp.StatusCode)
+			}
+			var items ItemScoresResponse
+			decodeBody(t, resp, &items)
+
+			resp = ts.do(t, "GET", "/receipts/"+id+"/points/breakdown?ruleVersion="+version, "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET breakdown under %s: got %d, want 200", version, resp.StatusCode)
+			}
+			var breakdown PointsBreakdownResponse
+			decodeBody(t, resp, &breakdown)
+
+			if items.RuleVersion != version || breakdown.RuleVersion != version {
+				t.Fatalf("scored under %s and %s, want %s", items.RuleVersion, breakdown.RuleVersion, version)
+			}
+			want := 0
+			for _, contribution := range breakdown.Breakdown {
+				if contributedBy(contribution, "itemDescription") {
+					want += contribution.Points
+				}
+			}
+			sum := 0
+			for _, item := range items.Items {
+				sum += item.Points
+			}
+			if sum != want || items.Points != want {
+				t.Errorf("%s under %s: items score %d, totalled %d, breakdown gives %d", id, version, sum, items.Points, want)
+			}
+		}
+	}
+}
+
+func TestItemScoresUnderTheTrialRules(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	//Under v2 a scoring item earns a quarter of its price: ceil(12.25×0.25)=4 and ceil(12.00×0.25)=3.
+	resp := ts.do(t, "GET", "/receipts/"+id+"/items?ruleVersion="+ruleVersionV2, "")
+	var items ItemScoresResponse
+	decodeBody(t, resp, &items)
+	if items.Points != 7 {
+		t.Fatalf("items under v2: got %d points, want 7", items.Points)
+	}
+
+	if resp := ts.do(t, "GET", "/receipts/"+id+"/items?ruleVersion=v0", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET items under an unknown version: got %d, want 400", resp.StatusCode)
+	}
+}
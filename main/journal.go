@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Operations recorded in the journal.
+const (
+	journalSave   = "save"
+	journalDelete = "delete"
+)
+
+// Struct for a single line of the journal.
+type journalRecord struct {
+	Op      string   `json:"op"`
+	ID      string   `json:"id"`
+	Receipt *Receipt `json:"receipt,omitempty"`
+}
+
+// Struct for a ReceiptStore that keeps receipts in memory and appends every change to a journal file,
+// so the receipts accepted before a crash can be rebuilt by replaying the journal on startup.
+// A change is written to the journal before it is applied to memory, and both happen under the
+// journal's mutex so compaction always sees the two agree. Receipts the store removes by itself are
+// journaled as deletes too, those evicted for -max-receipts as they are evicted and those removed by the
+// janitor once it has removed them, so replaying the journal doesn't bring them back.
+type journaledStore struct {
+	*shardedStore
+
+	mu           sync.Mutex
+	path         string
+	file         *os.File
+	size         int64
+	sync         bool
+	compactBytes int64
+
+	//Size of the journal after the last compaction, so a journal of live receipts is not rewritten on every append.
+	compactedSize int64
+}
+
+// Function to replay the journal at the given path into the store and open it for appending.
+// A torn final line left by a crash is truncated away. Every write is fsynced if sync is set,
+// and the journal is compacted once it grows past compactBytes, or never if compactBytes is zero.
+func openJournaledStore(store *shardedStore, path string, sync bool, compactBytes int64) (*journaledStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal %s: %w", path, err)
+	}
+
+	size, err := replayJournal(store, file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replaying journal %s: %w", path, err)
+	}
+
+	//Drop anything after the last complete record and append from there.
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s := &journaledStore{
+		shardedStore: store,
+		path:         path,
+		file:         file,
+		size:         size,
+		sync:         sync,
+		compactBytes: compactBytes,
+	}
+
+	//Replay doesn't evict, so a store whose limit was lowered since is brought within it here.
+	if err := s.appendDeletes(store.trim()); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("journaling evictions: %w", err)
+	}
+
+	//Journal the receipts the store removes by itself from now on.
+	store.reportRemovals(s.evicted, s.expired)
+	return s, nil
+}
+
+// Function to apply every complete record in the journal to the store.
+// Replayed receipts count as saved when they were created, so those past their retention stay expired,
+// and none are evicted while replaying, as the journal records the evictions made when they were saved.
+// Returns the offset just past the last complete record; a final line that is missing its newline
+// or does not decode is treated as torn by a crash and logged.
+func replayJournal(store *shardedStore, r io.Reader) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("warning: dropping torn journal record of %d bytes at offset %d", len(line), offset)
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			//Only the last line can be torn, anything earlier is real corruption.
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				log.Printf("warning: dropping torn journal record of %d bytes at offset %d", len(line), offset)
+				return offset, nil
+			}
+			return 0, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		switch record.Op {
+		case journalSave:
+			store.restore(record.ID, record.Receipt)
+		case journalDelete:
+			store.forget(record.ID)
+		default:
+			return 0, fmt.Errorf("record at offset %d has unknown op %q", offset, record.Op)
+		}
+		offset += int64(len(line))
+	}
+}
+
+// Function to store a receipt under the given id, recording it in the journal first.
+func (s *journaledStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(journalRecord{Op: journalSave, ID: id, Receipt: receipt}); err != nil {
+		return err
+	}
+	return s.shardedStore.Save(ctx, id, receipt)
+}
+
+// Function to remove a stored receipt by id, recording the removal in the journal first.
+func (s *journaledStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.shardedStore.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.append(journalRecord{Op: journalDelete, ID: id}); err != nil {
+		return err
+	}
+	return s.shardedStore.Delete(ctx, id)
+}
+
+// Function to record the eviction of a receipt to make room for another.
+// Evictions only happen while a receipt is saved, so this is called with s.mu and the shard's lock held,
+// and the record is written without compacting, which reads the shards.
+func (s *journaledStore) evicted(id string) {
+	if err := s.write(journalRecord{Op: journalDelete, ID: id}); err != nil {
+		log.Printf("warning: journaling eviction of %s: %v", id, err)
+	}
+}
+
+// Function to record the removal of receipts by the janitor.
+func (s *journaledStore) expired(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.appendDeletes(ids); err != nil {
+		log.Printf("warning: journaling expired receipts: %v", err)
+	}
+}
+
+// Function to write a delete record for each of the given ids. Must be called with s.mu held, or before the
+// store is shared.
+func (s *journaledStore) appendDeletes(ids []string) error {
+	for _, id := range ids {
+		if err := s.append(journalRecord{Op: journalDelete, ID: id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to write a record to the end of the journal, compacting it first if it has grown too large.
+// Must be called with s.mu held.
+func (s *journaledStore) append(record journalRecord) error {
+	if s.compactBytes > 0 && s.size >= s.compactBytes && s.size >= 2*s.compactedSize {
+		if err := s.compact(); err != nil {
+			return fmt.Errorf("compacting journal: %w", err)
+		}
+	}
+	return s.write(record)
+}
+
+// Function to write a record to the end of the journal. Must be called with s.mu held.
+func (s *journaledStore) write(record journalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// Function to rewrite the journal with a single save record for each stored receipt.
+// The new journal is written beside the old one and renamed over it, so a crash leaves one or the other.
+// Must be called with s.mu held.
+func (s *journaledStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for id, receipt := range s.shardedStore.receipts() {
+		if err = encoder.Encode(journalRecord{Op: journalSave, ID: id, Receipt: receipt}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	//Carry on appending to the compacted journal.
+	s.file.Close()
+	s.file = tmp
+	s.size = info.Size()
+	s.compactedSize = s.size
+	return nil
+}
+
+// Function to flush and close the journal file.
+func (s *journaledStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
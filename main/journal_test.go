@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Function to open a journaled store on a fresh sharded store, failing the test on error.
+func openTestJournal(t *testing.T, path string, maxReceipts int, ttl time.Duration) *journaledStore {
+	t.Helper()
+
+	store, err := openJournaledStore(newShardedStore(2, ttl, maxReceipts), path, false, 0)
+	if err != nil {
+		t.Fatalf("openJournaledStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// Function to list the ids held by a sharded store, in order.
+func storedIDs(t *testing.T, store ReceiptStore) []string {
+	t.Helper()
+
+	var ids []string
+	err := store.Each(context.Background(), "", func(id string, receipt *Receipt) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestJournalReplaysSavesAndDeletes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal")
+
+	store := openTestJournal(t, path, 0, 0)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Save(ctx, id, &Receipt{Retailer: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Save(ctx, "b", &Receipt{Retailer: "b2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	reopened := openTestJournal(t, path, 0, 0)
+	if ids := storedIDs(t, reopened); len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Fatalf("replayed ids: got %v, want [b c]", ids)
+	}
+	receipt, err := reopened.Get(ctx, "b")
+	if err != nil || receipt.Retailer != "b2" {
+		t.Fatalf("replayed b: got %+v, %v, want the replacement", receipt, err)
+	}
+}
+
+func TestJournalSurvivesBeingCutAtAnyOffset(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal")
+
+	//Journal a few saves, a replacement, and a delete, keeping the ids held after each record.
+	store := openTestJournal(t, path, 0, 0)
+	held := map[string]bool{}
+	var states [][]string
+	snapshot := func() {
+		ids := make([]string, 0, len(held))
+		for id := range held {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		states = append(states, ids)
+	}
+	for i, id := range []string{"a", "b", "c", "b", "d"} {
+		if err := store.Save(ctx, id, &Receipt{Retailer: "Retailer " + id, PurchaseDate: "2022-01-01"}); err != nil {
+			t.Fatal(err)
+		}
+		held[id] = true
+		snapshot()
+		if i == 2 {
+			if err := store.Delete(ctx, "a"); err != nil {
+				t.Fatal(err)
+			}
+			delete(held, "a")
+			snapshot()
+		}
+	}
+	store.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ends []int
+	for i, b := range data {
+		if b == '\n' {
+			ends = append(ends, i+1)
+		}
+	}
+	if len(ends) != len(states) {
+		t.Fatalf("journal has %d records, want %d", len(ends), len(states))
+	}
+
+	for offset := 0; offset <= len(data); offset++ {
+		cut := filepath.Join(dir, "cut")
+		if err := os.WriteFile(cut, data[:offset], 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		//The store holds what it held after the last record complete at the cut.
+		complete := sort.SearchInts(ends, offset+1)
+		var want []string
+		if complete > 0 {
+			want = states[complete-1]
+		}
+
+		replayed, err := openJournaledStore(newShardedStore(2, 0, 0), cut, false, 0)
+		if err != nil {
+			t.Fatalf("cut at %d: %v", offset, err)
+		}
+		got := storedIDs(t, replayed)
+		replayed.Close()
+		if !equalIDs(got, want) {
+			t.Fatalf("cut at %d: got %v, want %v", offset, got, want)
+		}
+
+		//The torn tail is truncated away, so the journal can be appended to.
+		info, err := os.Stat(cut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantSize := 0
+		if complete > 0 {
+			wantSize = ends[complete-1]
+		}
+		if info.Size() != int64(wantSize) {
+			t.Fatalf("cut at %d: journal is %d bytes after replay, want %d", offset, info.Size(), wantSize)
+		}
+	}
+}
+
+// Function to report whether two lists of ids are the same.
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestJournalRejectsCorruptionBeforeTheLastRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	data := []byte("{\"op\":\"save\",\"id\":\"a\",\"receipt\":{}}\nnot json\n{\"op\":\"save\",\"id\":\"b\",\"receipt\":{}}\n")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openJournaledStore(newShardedStore(1, 0, 0), path, false, 0); err == nil {
+		t.Fatal("openJournaledStore: corrupt record accepted")
+	}
+}
+
+func TestJournalDoesNotResurrectEvictedReceipts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal")
+
+	store, err := openJournaledStore(newShardedStore(1, 0, 2), path, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Save(ctx, id, &Receipt{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	//Replayed without a limit, the receipt evicted to make room for c stays gone.
+	reopened := openTestJournal(t, path, 0, 0)
+	if ids := storedIDs(t, reopened); !equalIDs(ids, []string{"b", "c"}) {
+		t.Fatalf("replayed ids: got %v, want [b c]", ids)
+	}
+	if !bytes.Contains(mustRead(t, path), []byte(`{"op":"delete","id":"a"}`)) {
+		t.Fatal("journal has no delete record for the evicted receipt")
+	}
+}
+
+func TestJournalTrimsToALoweredLimit(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal")
+
+	store := openTestJournal(t, path, 0, 0)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Save(ctx, id, &Receipt{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	lowered, err := openJournaledStore(newShardedStore(1, 0, 1), path, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := storedIDs(t, lowered); !equalIDs(ids, []string{"c"}) {
+		t.Fatalf("ids under a limit of 1: got %v, want [c]", ids)
+	}
+	lowered.Close()
+
+	//The evictions made to fit the lower limit are journaled, so raising it again doesn't bring them back.
+	raised := openTestJournal(t, path, 0, 0)
+	if ids := storedIDs(t, raised); !equalIDs(ids, []string{"c"}) {
+		t.Fatalf("ids after raising the limit: got %v, want [c]", ids)
+	}
+}
+
+func TestJournalDoesNotResurrectExpiredReceipts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal")
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now()
+
+	store := openTestJournal(t, path, 0, time.Hour)
+	if err := store.Save(ctx, "old", &Receipt{CreatedAt: &old}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "recent", &Receipt{CreatedAt: &recent}); err != nil {
+		t.Fatal(err)
+	}
+
+	//The janitor's removal is journaled.
+	var removed []string
+	for _, shard := range store.shards {
+		removed = append(removed, shard.removeExpired()...)
+	}
+	store.expired(removed)
+	store.Close()
+	if !bytes.Contains(mustRead(t, path), []byte(`{"op":"delete","id":"old"}`)) {
+		t.Fatal("journal has no delete record for the expired receipt")
+	}
+
+	reopened := openTestJournal(t, path, 0, time.Hour)
+	if _, err := reopened.Get(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get expired receipt after replay: got %v, want ErrNotFound", err)
+	}
+	if _, err := reopened.Get(ctx, "recent"); err != nil {
+		t.Fatalf("Get recent receipt after replay: %v", err)
+	}
+}
+
+func TestJournalReplayKeepsReceiptsExpiredWithoutADeleteRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal")
+	old := time.Now().Add(-2 * time.Hour)
+
+	//A crash before the janitor ran leaves only the save, but the receipt is still past its retention.
+	store := openTestJournal(t, path, 0, time.Hour)
+	if err := store.Save(ctx, "old", &Receipt{CreatedAt: &old}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	reopened := openTestJournal(t, path, 0, time.Hour)
+	if _, err := reopened.Get(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after replay: got %v, want ErrNotFound", err)
+	}
+}
+
+// Function to read a whole file, failing the test on error.
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
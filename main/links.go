@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Names of the routes links to a receipt are generated from, each registered once for every version prefix.
+const (
+	routeReceipt   = "receipt"
+	routePoints    = "points"
+	routeBreakdown = "breakdown"
+)
+
+// Function to return the name a route is registered under for the given version prefix.
+func routeName(prefix string, name string) string {
+	return prefix + ":" + name
+}
+
+// Struct for the links to a stored receipt and its points given as JSON or XML.
+type ReceiptLinks struct {
+	Self      string `json:"self" xml:"self"`
+	Points    string `json:"points" xml:"points"`
+	Breakdown string `json:"breakdown" xml:"breakdown"`
+}
+
+// Function to build the links to a receipt for the response to a request, from the routes serving them under
+// the version prefix the request was made under, so links can't drift from the router when routes move.
+// With -base-url set the links are absolute URLs under it, otherwise paths on the host the request was made to.
+func (s *Server) receiptLinks(r *http.Request, id string) *ReceiptLinks {
+	prefix := ""
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		prefix = "/v1"
+	}
+
+	link := func(name string) string {
+		route := s.router.Get(routeName(prefix, name))
+		if route == nil {
+			return ""
+		}
+		u, err := route.URL("id", id)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(s.config.BaseURL, "/") + u.String()
+	}
+	return &ReceiptLinks{
+		Self:      link(routeReceipt),
+		Points:    link(routePoints),
+		Breakdown: link(routeBreakdown),
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Function to fetch every link of a receipt, failing unless each is under the given prefix and answers 200.
+func (ts *testServer) followLinks(t *testing.T, links *ReceiptLinks, prefix string) {
+	t.Helper()
+
+	if links == nil {
+		t.Fatal("no links in the response")
+	}
+	for name, link := range map[string]string{"self": links.Self, "points": links.Points, "breakdown": links.Breakdown} {
+		if !strings.HasPrefix(link, prefix+"/receipts/") {
+			t.Errorf("%s link %q: want it under %s/receipts/", name, link, prefix)
+			continue
+		}
+		if resp := ts.do(t, "GET", link, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s link %s: got %d, want 200: %s", name, link, resp.StatusCode, readBody(t, resp))
+		}
+	}
+}
+
+func TestEveryLinkAnswersUnderTheVersionItWasGivenIn(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, prefix := range []string{"", "/v1"} {
+		resp := ts.do(t, "POST", prefix+"/receipts/process", targetReceipt)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s/receipts/process: got %d, want 201", prefix, resp.StatusCode)
+		}
+		var created ReceiptResponse
+		decodeBody(t, resp, &created)
+		ts.followLinks(t, created.Links, prefix)
+		if location := resp.Header.Get("Location"); location != created.Links.Self {
+			t.Errorf("POST %s/receipts/process: got Location %q, want the self link %q", prefix, location, created.Links.Self)
+		}
+
+		for _, path := range []string{"/receipts", "/receipts/search?q=pizza", "/retailers/Target/receipts"} {
+			var listing ReceiptListResponse
+			decodeBody(t, ts.do(t, "GET", prefix+path, ""), &listing)
+			if len(listing.Receipts) == 0 {
+				t.Fatalf("GET %s%s: no receipts listed", prefix, path)
+			}
+			for _, summary := range listing.Receipts {
+				ts.followLinks(t, summary.Links, prefix)
+			}
+		}
+	}
+}
+
+func TestLinksAreAbsoluteUnderTheBaseURL(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ts.config.BaseURL = ts.http.URL + "/"
+
+	for _, prefix := range []string{"", "/v1"} {
+		var created ReceiptResponse
+		decodeBody(t, ts.do(t, "POST", prefix+"/receipts/process", targetReceipt), &created)
+		for _, link := range []string{created.Links.Self, created.Links.Points, created.Links.Breakdown} {
+			if !strings.HasPrefix(link, ts.http.URL+prefix+"/receipts/"+created.ID) {
+				t.Errorf("link %q: want it under %s%s", link, ts.http.URL, prefix)
+				continue
+			}
+			resp, err := http.Get(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET %s: got %d, want 200", link, resp.StatusCode)
+			}
+		}
+	}
+}
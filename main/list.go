@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of receipts returned by a listing when no limit is given, and the largest limit accepted.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// Struct for a stored receipt as summarised in a listing.
+type ReceiptSummary struct {
+	ID           string  `json:"id"`
+	Retailer     string  `json:"retailer"`
+	PurchaseDate string  `json:"purchaseDate"`
+	Total        *Amount `json:"total"`
+	Points       int     `json:"points"`
+
+	CreatedAt *time.Time    `json:"createdAt,omitempty"`
+	Links     *ReceiptLinks `json:"links,omitempty"`
+}
+
+// Struct for returning a page of the receipts listing given as JSON.
+// NextCursor is given when there are more receipts after this page.
+type ReceiptListResponse struct {
+	Receipts   []ReceiptSummary `json:"receipts"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// Struct for the conditions a receipt must meet to be included in a listing.
+type listFilter struct {
+	//Retailer name, matched exactly, and retailer name prefix, both ignoring case.
+	retailer       string
+	retailerPrefix string
+
+	//Retailer name as normalised by retailerKey, matched against receipts' normalised retailer names.
+	retailerKey string
+
+	//First and last purchase dates included, as YYYY-MM-DD. Dates in this form sort as strings
+	//in date order, so stored purchase dates are compared without being parsed.
+	from string
+	to   string
+}
+
+// Function to read the number of receipts a page should hold from the limit parameter.
+func parseListLimit(query url.Values) (int, error) {
+	value := query.Get("limit")
+	if value == "" {
+		return defaultListLimit, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxListLimit {
+		return 0, fmt.Errorf("invalid limit %q: expected a number from 1 to %d", value, maxListLimit)
+	}
+	return n, nil
+}
+
+// Function to summarise a stored receipt for a listing.
+func receiptSummary(id string, receipt *Receipt) (ReceiptSummary, error) {
+	points, err := storedPoints(receipt)
+	if err != nil {
+		return ReceiptSummary{}, err
+	}
+	return ReceiptSummary{
+		ID:           id,
+		Retailer:     receipt.Retailer,
+		PurchaseDate: receipt.PurchaseDate,
+		Total:        receipt.Total,
+		Points:       points,
+		CreatedAt:    receipt.CreatedAt,
+	}, nil
+}
+
+// Function to read the listing filters from the query parameters.
+// Purchase dates must be real dates, with from no later than to.
+func parseListFilter(query url.Values) (listFilter, error) {
+	filter := listFilter{
+		retailer:       query.Get("retailer"),
+		retailerPrefix: strings.ToLower(query.Get("retailerPrefix")),
+		from:           query.Get("from"),
+		to:             query.Get("to"),
+	}
+
+	for _, param := range []struct{ name, value string }{{"from", filter.from}, {"to", filter.to}} {
+		if param.value == "" {
+			continue
+		}
+		if _, err := time.Parse(dateFormat, param.value); err != nil {
+			return listFilter{}, fmt.Errorf("invalid %s %q: expected a date as YYYY-MM-DD", param.name, param.value)
+		}
+	}
+	if filter.from != "" && filter.to != "" && filter.from > filter.to {
+		return listFilter{}, fmt.Errorf("invalid date range: from %s is after to %s", filter.from, filter.to)
+	}
+
+	return filter, nil
+}
+
+// Function to report whether a receipt meets every condition of the filter.
+func (f listFilter) match(receipt *Receipt) bool {
+	if f.retailer != "" && !strings.EqualFold(receipt.Retailer, f.retailer) {
+		return false
+	}
+	if f.retailerPrefix != "" && !strings.HasPrefix(strings.ToLower(receipt.Retailer), f.retailerPrefix) {
+		return false
+	}
+	if f.retailerKey != "" && retailerKey(receipt.Retailer) != f.retailerKey {
+		return false
+	}
+	if f.from != "" && receipt.PurchaseDate < f.from {
+		return false
+	}
+	if f.to != "" && receipt.PurchaseDate > f.to {
+		return false
+	}
+	return true
+}
+
+// Keys the receipts listing can be sorted by.
+const (
+	sortPurchaseDate = "purchaseDate"
+	sortTotal        = "total"
+	sortPoints       = "points"
+	sortCreatedAt    = "createdAt"
+)
+
+// Struct for the value a receipt is sorted by in a listing. Purchase dates are compared as text,
+// which puts YYYY-MM-DD dates in date order, and every other key as a number.
+type listKey struct {
+	Number int64  `json:"n,omitempty"`
+	Text   string `json:"t,omitempty"`
+}
+
+// Function to compare two sort keys, returning a negative number, zero, or a positive number.
+func (k listKey) compare(other listKey) int {
+	switch {
+	case k.Number < other.Number:
+		return -1
+	case k.Number > other.Number:
+		return 1
+	}
+	return strings.Compare(k.Text, other.Text)
+}
+
+// Function to return the key a receipt is sorted by. Receipts stored without a submission time sort as the oldest,
+// and any without a total as totalling nothing.
+func sortKey(by string, receipt *Receipt, points int) listKey {
+	switch by {
+	case sortPurchaseDate:
+		return listKey{Text: receipt.PurchaseDate}
+	case sortTotal:
+		if receipt.Total == nil {
+			return listKey{}
+		}
+		return listKey{Number: receipt.Total.Cents()}
+	case sortPoints:
+		return listKey{Number: int64(points)}
+	default:
+		if receipt.CreatedAt == nil {
+			return listKey{}
+		}
+		return listKey{Number: receipt.CreatedAt.UnixNano()}
+	}
+}
+
+// Struct for the position a listing page ended at, given to clients as an opaque cursor.
+// The sort it was made with is kept so it can't be used with a different one.
+type listCursor struct {
+	Sort  string  `json:"s"`
+	Order string  `json:"o"`
+	Key   listKey `json:"k"`
+	ID    string  `json:"id"`
+}
+
+// Function to return the key a receipt is held under in a listIndex for the given sort, which orders as the
+// listing does: by sort key, then by id. Numbers are written as fixed width hex with the sign bit flipped, so
+// they order as text in numeric order, and the id follows a NUL, which sorts before anything in the key.
+func listIndexKey(by string, id string, receipt *Receipt) string {
+	//Receipts stored without points, from before points were stored, are scored, unless they have no total to
+	//score, which only a receipt that was never validated lacks. One that can't be scored sorts as scoring none,
+	//and fails the listing that reads it.
+	points := 0
+	if by == sortPoints && (receipt.Points != nil || receipt.Total != nil) {
+		points, _ = storedPoints(receipt)
+	}
+	return sortKey(by, receipt, points).indexKey(id)
+}
+
+// Function to write a sort key and id as a key in a listIndex, see listIndexKey.
+func (k listKey) indexKey(id string) string {
+	//Written out by hand rather than with fmt, as every save makes a key for each sort.
+	key := make([]byte, 16, 16+len(k.Text)+1+len(id))
+	n := uint64(k.Number) ^ (1 << 63)
+	for i := 15; i >= 0; i-- {
+		key[i] = "0123456789abcdef"[n&15]
+		n >>= 4
+	}
+	key = append(key, k.Text...)
+	key = append(key, 0)
+	key = append(key, id...)
+	return string(key)
+}
+
+// Function to return the id a listIndex key was made with.
+func listIndexID(key string) string {
+	return key[strings.LastIndexByte(key, 0)+1:]
+}
+
+// Interface for stores keeping their receipts in the order of every listing sort key, so a page of the listing
+// is read from where the last one ended rather than by sorting every receipt.
+type sortedLister interface {
+	//Call fn for each stored receipt in the order of the given sort key, descending if desc is set, starting after
+	//the receipt held under the given listIndexKey, or from the first receipt if it is empty. Stops early if fn
+	//returns an error, which is returned.
+	eachSorted(ctx context.Context, by string, desc bool, after string, fn func(id string, receipt *Receipt) error) error
+}
+
+// Struct for a receipt matched by a listing, along with the key it is sorted by.
+type listEntry struct {
+	key     listKey
+	summary ReceiptSummary
+}
+
+// Struct for the listing parameters of a request.
+type listQuery struct {
+	limit  int
+	by     string
+	order  string
+	cursor *listCursor
+	filter listFilter
+}
+
+// Function to handle requests listing the stored receipts a page at a time.
+// Receipts are sorted by the sort parameter, purchaseDate, total, points, or createdAt, in the order given by
+// the order parameter, asc or desc, newest submitted first by default. Ties are broken by id in the same order,
+// so the order is total and the cursor from one page fetches the next, starting after its last receipt,
+// without repeating or skipping receipts. Receipts can be filtered by retailer and by purchase date range,
+// inclusive at both ends; a cursor is only meaningful with the filters it was given with.
+// The memory store keeps an index for each sort, so a page only reads the receipts from its cursor on until it
+// is full; other stores have every matching receipt read and sorted on each request.
+func (s *Server) listReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	response, ok := s.listReceipts(w, r, listFilter{})
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Function to read a page of the stored receipts as described by the request's listing parameters.
+// Conditions set in base are added to the filters given in the request.
+// On failure the problem response is written and false is returned.
+func (s *Server) listReceipts(w http.ResponseWriter, r *http.Request, base listFilter) (ReceiptListResponse, bool) {
+	query, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return ReceiptListResponse{}, false
+	}
+	query.filter.retailerKey = base.retailerKey
+
+	//Read one receipt past the page, to know whether there is another page after it.
+	readPage := s.scanListPage
+	if _, ok := s.store.(sortedLister); ok {
+		readPage = s.indexListPage
+	}
+	entries, err := readPage(r.Context(), query)
+	if err != nil {
+		writeStoreError(w, err)
+		return ReceiptListResponse{}, false
+	}
+
+	end := min(query.limit, len(entries))
+	response := ReceiptListResponse{Receipts: make([]ReceiptSummary, 0, end)}
+	for _, entry := range entries[:end] {
+		entry.summary.Links = s.receiptLinks(r, entry.summary.ID)
+		response.Receipts = append(response.Receipts, entry.summary)
+	}
+	if end < len(entries) {
+		last := entries[end-1]
+		response.NextCursor = encodeCursor(listCursor{Sort: query.by, Order: query.order, Key: last.key, ID: last.summary.ID})
+	}
+	return response, true
+}
+
+// Function to read the listing parameters from the query parameters.
+func parseListQuery(values url.Values) (listQuery, error) {
+	limit, err := parseListLimit(values)
+	if err != nil {
+		return listQuery{}, err
+	}
+
+	by := values.Get("sort")
+	switch by {
+	case "":
+		by = sortCreatedAt
+	case sortPurchaseDate, sortTotal, sortPoints, sortCreatedAt:
+	default:
+		return listQuery{}, fmt.Errorf("invalid sort %q: expected one of %s, %s, %s, %s", by, sortPurchaseDate, sortTotal, sortPoints, sortCreatedAt)
+	}
+
+	order := values.Get("order")
+	switch order {
+	case "":
+		order = "asc"
+		if by == sortCreatedAt {
+			order = "desc"
+		}
+	case "asc", "desc":
+	default:
+		return listQuery{}, fmt.Errorf("invalid order %q: expected asc or desc", order)
+	}
+
+	cursor, err := decodeCursor(values.Get("cursor"), by, order)
+	if err != nil {
+		return listQuery{}, err
+	}
+
+	filter, err := parseListFilter(values)
+	if err != nil {
+		return listQuery{}, err
+	}
+	return listQuery{limit: limit, by: by, order: order, cursor: cursor, filter: filter}, nil
+}
+
+// Function to read up to one more than a page of matching receipts after the cursor from a store's sort index.
+func (s *Server) indexListPage(ctx context.Context, query listQuery) ([]listEntry, error) {
+	after := ""
+	if query.cursor != nil {
+		after = query.cursor.Key.indexKey(query.cursor.ID)
+	}
+
+	var entries []listEntry
+	err := s.store.(sortedLister).eachSorted(ctx, query.by, query.order == "desc", after, func(id string, receipt *Receipt) error {
+		if !query.filter.match(receipt) {
+			return nil
+		}
+		summary, err := receiptSummary(id, receipt)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, listEntry{key: sortKey(query.by, receipt, summary.Points), summary: summary})
+		if len(entries) > query.limit {
+			return errStopEach
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopEach) {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Function to read up to one more than a page of matching receipts after the cursor by reading every
+// stored receipt and sorting those that match.
+func (s *Server) scanListPage(ctx context.Context, query listQuery) ([]listEntry, error) {
+	entries, err := s.matchingReceipts(ctx, query.by, query.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	//Compare by key, then by id, reversing both for a descending order.
+	compare := func(key listKey, id string, other listKey, otherID string) int {
+		c := key.compare(other)
+		if c == 0 {
+			c = strings.Compare(id, otherID)
+		}
+		if query.order == "desc" {
+			c = -c
+		}
+		return c
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return compare(entries[i].key, entries[i].summary.ID, entries[j].key, entries[j].summary.ID) < 0
+	})
+
+	//Start after the receipt the previous page ended at.
+	start := 0
+	if query.cursor != nil {
+		start = sort.Search(len(entries), func(i int) bool {
+			return compare(entries[i].key, entries[i].summary.ID, query.cursor.Key, query.cursor.ID) > 0
+		})
+	}
+	end := min(start+query.limit+1, len(entries))
+	return entries[start:end], nil
+}
+
+// Function to read every stored receipt matching the filter, in no particular order, with the key it is sorted by.
+func (s *Server) matchingReceipts(ctx context.Context, by string, filter listFilter) ([]listEntry, error) {
+	var entries []listEntry
+	err := s.store.Each(ctx, "", func(id string, receipt *Receipt) error {
+		if !filter.match(receipt) {
+			return nil
+		}
+
+		summary, err := receiptSummary(id, receipt)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, listEntry{key: sortKey(by, receipt, summary.Points), summary: summary})
+		return nil
+	})
+	return entries, err
+}
+
+// Function to encode the position a listing page ended at as an opaque cursor.
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Function to decode a listing cursor made with the given sort and order.
+// An empty cursor starts from the beginning and returns nil.
+func decodeCursor(value string, by string, order string) (*listCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", value)
+	}
+	if cursor.Sort != by || cursor.Order != order {
+		return nil, fmt.Errorf("invalid cursor %q: it was made for sort=%s&order=%s", value, cursor.Sort, cursor.Order)
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Function to fetch a page of the receipts listing from the server under test, failing unless it is a 200.
+func (ts *testServer) list(t *testing.T, query url.Values) ReceiptListResponse {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts?"+query.Encode(), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /receipts?%s: got %d, want 200: %s", query.Encode(), resp.StatusCode, readBody(t, resp))
+	}
+	var response ReceiptListResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+// Function to fetch every page of the receipts listing, following nextCursor, and return the ids in order.
+// Before each page after the first, between is called so the test can change the store.
+func (ts *testServer) listAll(t *testing.T, query url.Values, between func()) []string {
+	t.Helper()
+
+	var ids []string
+	for page := 0; ; page++ {
+		if page > 0 && between != nil {
+			between()
+		}
+		response := ts.list(t, query)
+		for _, summary := range response.Receipts {
+			ids = append(ids, summary.ID)
+		}
+		if response.NextCursor == "" {
+			return ids
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+}
+
+func TestListEmptyStore(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	response := ts.list(t, url.Values{})
+	if response.Receipts == nil || len(response.Receipts) != 0 || response.NextCursor != "" {
+		t.Fatalf("empty store: got %+v, want an empty page with no cursor", response)
+	}
+}
+
+func TestListExactlyOnePage(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	for i := 0; i < 3; i++ {
+		ts.submit(t, targetReceipt)
+		ts.clock.Advance(time.Second)
+	}
+
+	response := ts.list(t, url.Values{"limit": {"3"}})
+	if len(response.Receipts) != 3 || response.NextCursor != "" {
+		t.Fatalf("three receipts, limit 3: got %d receipts and cursor %q, want 3 and none", len(response.Receipts), response.NextCursor)
+	}
+	if summary := response.Receipts[0]; summary.Retailer != "Target" || summary.Points != 28 || summary.Total.String() != "35.35" {
+		t.Fatalf("summary: got %+v", summary)
+	}
+}
+
+func TestListCursorContinuesAcrossInserts(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	var submitted []string
+	for i := 0; i < 5; i++ {
+		submitted = append(submitted, ts.submit(t, targetReceipt))
+		ts.clock.Advance(time.Second)
+	}
+
+	//Newest first, receipts submitted while paging sort before the cursor and aren't seen.
+	ids := ts.listAll(t, url.Values{"limit": {"2"}}, func() {
+		ts.submit(t, cornerReceipt)
+		ts.clock.Advance(time.Second)
+	})
+	want := []string{submitted[4], submitted[3], submitted[2], submitted[1], submitted[0]}
+	if len(ids) != len(want) {
+		t.Fatalf("newest first: got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("newest first: got %v, want %v", ids, want)
+		}
+	}
+
+	//Oldest first, receipts submitted while paging sort after the cursor and are all seen once.
+	all := ts.listAll(t, url.Values{"limit": {"2"}, "order": {"asc"}}, func() {
+		ts.submit(t, cornerReceipt)
+		ts.clock.Advance(time.Second)
+	})
+	seen := map[string]bool{}
+	for _, id := range all {
+		if seen[id] {
+			t.Fatalf("oldest first: %s listed twice", id)
+		}
+		seen[id] = true
+	}
+	count, err := ts.store.(*shardedStore).Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != count {
+		t.Fatalf("oldest first: listed %d receipts, the store holds %d", len(all), count)
+	}
+}
+
+func TestListPagesThroughTheIndexAsAFullSortWould(t *testing.T) {
+	indexed := newTestServer(t, testConfig())
+	scanned := newTestServerWithStore(t, testConfig(), &syncMapStore{})
+	if _, ok := indexed.store.(sortedLister); !ok {
+		t.Fatal("the memory store keeps no sort index")
+	}
+
+	//Receipts with equal totals, points, and dates, so pages break ties by id.
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 25; i++ {
+		receipt := exampleReceipt(t, []string{targetReceipt, cornerReceipt}[i%2])
+		if i%3 == 0 {
+			receipt.PurchaseDate = "2022-02-02"
+		}
+		points, err := calculatePoints(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt.Points = &points
+		at := created.Add(time.Duration(i%4) * time.Minute)
+		receipt.CreatedAt = &at
+
+		id := newReceiptID()
+		for _, ts := range []*testServer{indexed, scanned} {
+			if err := ts.store.Save(context.Background(), id, receipt); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, by := range listSorts {
+		for _, order := range []string{"asc", "desc"} {
+			for _, query := range []url.Values{
+				{"sort": {by}, "order": {order}, "limit": {"4"}},
+				{"sort": {by}, "order": {order}, "limit": {"3"}, "retailer": {"target"}},
+			} {
+				want := scanned.listAll(t, url.Values{"sort": query["sort"], "order": query["order"], "limit": {"1000"}, "retailer": query["retailer"]}, nil)
+				got := indexed.listAll(t, query, nil)
+				if !equalIDs(got, want) {
+					t.Fatalf("%s: index gives %v, a full sort %v", query.Encode(), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestListSeesAReplacedReceiptAtItsNewPlace(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		receipt := exampleReceipt(t, targetReceipt)
+		if err := ts.store.Save(ctx, id, receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//Raising a's total moves it from the first receipt by total to the last.
+	replaced := exampleReceipt(t, targetReceipt)
+	more := Amount(9999)
+	replaced.Total = &more
+	if err := ts.store.Save(ctx, "a", replaced); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	err := ts.store.(sortedLister).eachSorted(ctx, sortTotal, false, "", func(id string, receipt *Receipt) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalIDs(ids, []string{"b", "c", "a"}) {
+		t.Fatalf("by total after replacing a: got %v, want [b c a]", ids)
+	}
+}
+
+// Function to return a valid single item receipt with the given retailer and purchase date.
+func datedReceipt(retailer string, date string) string {
+	name, _ := json.Marshal(retailer)
+	return `{"retailer":` + string(name) + `,"purchaseDate":"` + date + `","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"2.25"}],"total":"2.25"}`
+}
+
+// Function to submit receipts from each of the given retailers in turn, returning their ids by retailer.
+func (ts *testServer) submitRetailers(t *testing.T, retailers ...string) map[string][]string {
+	t.Helper()
+
+	ids := make(map[string][]string)
+	for _, retailer := range retailers {
+		ids[retailer] = append(ids[retailer], ts.submit(t, datedReceipt(retailer, "2022-01-01")))
+		ts.clock.Advance(time.Second)
+	}
+	return ids
+}
+
+func TestListFiltersByRetailerIgnoringCase(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ids := ts.submitRetailers(t, "Target", "TARGET", "target", "Target Express", "M&M Corner Market", "m&m CORNER market", "Walgreens")
+
+	for _, test := range []struct {
+		query url.Values
+		want  []string
+	}{
+		{url.Values{"retailer": {"tArGeT"}}, []string{ids["target"][0], ids["TARGET"][0], ids["Target"][0]}},
+		{url.Values{"retailerPrefix": {"TARGET"}}, []string{ids["Target Express"][0], ids["target"][0], ids["TARGET"][0], ids["Target"][0]}},
+		{url.Values{"retailerPrefix": {"target "}}, []string{ids["Target Express"][0]}},
+		{url.Values{"retailer": {"M&M Corner Market"}}, []string{ids["m&m CORNER market"][0], ids["M&M Corner Market"][0]}},
+		{url.Values{"retailer": {"m&m"}}, nil},
+		{url.Values{"retailerPrefix": {"m&m c"}}, []string{ids["m&m CORNER market"][0], ids["M&M Corner Market"][0]}},
+		{url.Values{"retailer": {"Costco"}}, nil},
+	} {
+		if got := ts.listAll(t, test.query, nil); !equalIDs(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.query.Encode(), got, test.want)
+		}
+	}
+
+	empty := ts.list(t, url.Values{"retailer": {"Costco"}})
+	if empty.Receipts == nil || len(empty.Receipts) != 0 || empty.NextCursor != "" {
+		t.Fatalf("a filter matching nothing: got %+v, want an empty page with no cursor", empty)
+	}
+}
+
+func TestListRetailerFilterPagesWithItsCursor(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ts.submitRetailers(t, "Target", "Walgreens", "TARGET", "Walgreens", "target", "Walgreens", "Target")
+
+	want := ts.listAll(t, url.Values{"retailer": {"target"}}, nil)
+	if len(want) != 4 {
+		t.Fatalf("one page: got %v, want four receipts", want)
+	}
+	for _, order := range []string{"asc", "desc"} {
+		got := ts.listAll(t, url.Values{"retailer": {"target"}, "limit": {"1"}, "order": {order}}, func() {
+			ts.submit(t, datedReceipt("Walgreens", "2022-01-01"))
+			ts.clock.Advance(time.Second)
+		})
+		if order == "asc" {
+			slices.Reverse(got)
+		}
+		if !equalIDs(got, want) {
+			t.Errorf("a page at a time %s: got %v, want %v", order, got, want)
+		}
+	}
+}
+
+func TestListFiltersByPurchaseDateRange(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ids := make(map[string]string)
+	for _, date := range []string{"2022-01-30", "2022-01-31", "2022-02-01", "2022-02-28", "2022-03-01"} {
+		ids[date] = ts.submit(t, datedReceipt("Target", date))
+		ts.clock.Advance(time.Second)
+	}
+
+	for _, test := range []struct {
+		query url.Values
+		want  []string
+	}{
+		{url.Values{"from": {"2022-01-31"}, "to": {"2022-02-28"}}, []string{ids["2022-02-28"], ids["2022-02-01"], ids["2022-01-31"]}},
+		{url.Values{"from": {"2022-02-01"}, "to": {"2022-02-01"}}, []string{ids["2022-02-01"]}},
+		{url.Values{"from": {"2022-02-28"}}, []string{ids["2022-03-01"], ids["2022-02-28"]}},
+		{url.Values{"to": {"2022-01-31"}}, []string{ids["2022-01-31"], ids["2022-01-30"]}},
+		{url.Values{"from": {"2022-02-02"}, "to": {"2022-02-27"}}, nil},
+	} {
+		if got := ts.listAll(t, test.query, nil); !equalIDs(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.query.Encode(), got, test.want)
+		}
+	}
+}
+
+func TestListRejectsInvalidDateRanges(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, query := range []url.Values{
+		{"from": {"2022-02-01"}, "to": {"2022-01-31"}},
+		{"from": {"2022-1-5"}},
+		{"to": {"02/01/2022"}},
+		{"from": {"2022-02-30"}},
+		{"to": {"2022-13-01"}},
+	} {
+		expectProblem(t, ts.do(t, "GET", "/receipts?"+query.Encode(), ""), http.StatusBadRequest, codeInvalidParameter)
+	}
+}
+
+func TestListDateRangeRetailerAndPaginationTogether(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	var want []string
+	for i, date := range []string{"2022-01-31", "2022-02-01", "2022-02-14", "2022-02-28", "2022-03-01"} {
+		for _, retailer := range []string{"Target", "Walgreens", "TARGET"} {
+			id := ts.submit(t, datedReceipt(retailer, date))
+			ts.clock.Advance(time.Second)
+			if i > 0 && i < 4 && retailer != "Walgreens" {
+				want = append(want, id)
+			}
+		}
+	}
+	slices.Reverse(want)
+
+	query := url.Values{"retailer": {"target"}, "from": {"2022-02-01"}, "to": {"2022-02-28"}, "limit": {"2"}}
+	if got := ts.listAll(t, query, nil); !equalIDs(got, want) {
+		t.Fatalf("%s: got %v, want %v", query.Encode(), got, want)
+	}
+
+	query.Del("cursor")
+	query.Set("sort", "purchaseDate")
+	query.Set("order", "asc")
+	got := ts.listAll(t, query, nil)
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %d receipts", query.Encode(), got, len(want))
+	}
+	for i := 1; i < len(got); i++ {
+		if ts.stored(t, got[i-1]).PurchaseDate > ts.stored(t, got[i]).PurchaseDate {
+			t.Fatalf("%s: %v is not in purchase date order", query.Encode(), got)
+		}
+	}
+}
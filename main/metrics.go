@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, registered with the default registry and served on /metrics.
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "receipt_processor_http_requests_total",
+		Help: "HTTP requests handled, by route, method, and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "receipt_processor_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route, method, and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	receiptsProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receipt_processor_receipts_processed_total",
+		Help: "Receipts accepted for processing, over HTTP, gRPC, or GraphQL.",
+	})
+
+	pointsAwarded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "receipt_processor_points_awarded_total",
+		Help: "Points awarded to receipts accepted for processing.",
+	})
+)
+
+// Interface for a receipt store that can count the receipts it holds.
+type receiptCounter interface {
+	Count(ctx context.Context) (int, error)
+}
+
+// Function to register a gauge of the number of receipts held by the store, counted on every scrape.
+// Stores that can't count their receipts get no gauge.
+func registerStoreMetrics(store ReceiptStore) {
+	counter, ok := store.(receiptCounter)
+	if !ok {
+		return
+	}
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "receipt_processor_receipts_stored",
+		Help: "Receipts currently held by the receipt store.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), readinessCheckTimeout)
+		defer cancel()
+
+		n, err := counter.Count(ctx)
+		if err != nil {
+			log.Printf("counting stored receipts: %v", err)
+			return 0
+		}
+		return float64(n)
+	}))
+}
+
+// Struct for a response writer that remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// Function to record the status code before writing it.
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Function to write the body, recording an implicit 200 status.
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Function to return the wrapped response writer, so http.ResponseController can reach it.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Function to take over the connection for a websocket, recording the switch of protocols as its status.
+// Upgraders look for http.Hijacker on the writer itself rather than unwrapping it.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Function to count and time every request routed by the router, labelled by the route's path template
+// rather than the path, so receipt ids don't each get their own series.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		code := strconv.Itoa(recorder.status)
+		requestsTotal.WithLabelValues(route, r.Method, code).Inc()
+		requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
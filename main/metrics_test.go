@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Function to scrape /metrics from the server under test, returning each sample by its name and labels.
+func (ts *testServer) scrape(t *testing.T) map[string]float64 {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/metrics", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics: got %d, want 200", resp.StatusCode)
+	}
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestMetricsCountRequestsReceiptsAndPoints(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	before := ts.scrape(t)
+
+	id := ts.submit(t, targetReceipt)
+	ts.submit(t, cornerReceipt)
+	ts.points(t, id)
+	ts.points(t, id)
+	ts.points(t, id)
+	ts.do(t, "GET", "/receipts/"+newReceiptID()+"/points", "")
+	after := ts.scrape(t)
+
+	for _, test := range []struct {
+		sample string
+		added  float64
+	}{
+		{`receipt_processor_http_requests_total{code="201",method="POST",route="/receipts/process"}`, 2},
+		{`receipt_processor_http_requests_total{code="200",method="GET",route="/receipts/{id}/points"}`, 3},
+		{`receipt_processor_http_requests_total{code="404",method="GET",route="/receipts/{id}/points"}`, 1},
+		{`receipt_processor_http_request_duration_seconds_count{code="200",method="GET",route="/receipts/{id}/points"}`, 3},
+		{`receipt_processor_http_request_duration_seconds_bucket{code="200",method="GET",route="/receipts/{id}/points",le="+Inf"}`, 3},
+		{`receipt_processor_receipts_processed_total`, 2},
+		{`receipt_processor_points_awarded_total`, 28 + 109},
+	} {
+		value, ok := after[test.sample]
+		if !ok {
+			t.Errorf("%s not scraped", test.sample)
+			continue
+		}
+		if added := value - before[test.sample]; added != test.added {
+			t.Errorf("%s: went up by %v, want %v", test.sample, added, test.added)
+		}
+	}
+
+	//Every default bucket is exposed for each route, and ids never become labels.
+	for _, le := range []string{"0.005", "0.01", "0.1", "1", "10"} {
+		sample := `receipt_processor_http_request_duration_seconds_bucket{code="201",method="POST",route="/receipts/process",le="` + le + `"}`
+		if _, ok := after[sample]; !ok {
+			t.Errorf("%s not scraped", sample)
+		}
+	}
+	for sample := range after {
+		if strings.Contains(sample, id) {
+			t.Errorf("%s is labelled with a receipt id", sample)
+		}
+	}
+}
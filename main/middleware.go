@@ -0,0 +1,41 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Function to build middleware that caps the size of request bodies at limit bytes.
+// Reads past the limit fail with an *http.MaxBytesError.
+func maxBodyMiddleware(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Function to build middleware that rejects requests whose Content-Type is not one of the supported media types.
+// Parameters such as charset are ignored when comparing. Rejected requests get a 415 listing the supported types.
+func requireContentType(supported ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err == nil {
+				for _, s := range supported {
+					if strings.EqualFold(mediaType, s) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			w.Header().Set("Accept-Post", strings.Join(supported, ", "))
+			writeProblem(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "supported content types: "+strings.Join(supported, ", "))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBodiesOverTheLimitAreRejected(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBodyBytes = int64(len(targetReceipt))
+	ts := newTestServer(t, cfg)
+	over := strings.Replace(targetReceipt, `"Target"`, `"Targets"`, 1)
+
+	id := ts.submit(t, targetReceipt)
+
+	for _, request := range []struct{ method, path string }{
+		{"POST", "/receipts/process"},
+		{"PUT", "/receipts/" + id},
+	} {
+		resp := ts.do(t, request.method, request.path, over)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s %s a byte over the limit: got %d, want 413", request.method, request.path, resp.StatusCode)
+		}
+		var problem Problem
+		decodeBody(t, resp, &problem)
+		if problem.Code != codeBodyTooLarge {
+			t.Fatalf("%s %s a byte over the limit: got code %s, want %s", request.method, request.path, problem.Code, codeBodyTooLarge)
+		}
+	}
+
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after a rejected replacement: got %d, want 28", got)
+	}
+}
+
+func TestProcessRequiresAJSONContentType(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, test := range []struct {
+		contentType string
+		status      int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"application/json", http.StatusCreated},
+		{"application/json; charset=utf-8", http.StatusCreated},
+		{"Application/JSON", http.StatusCreated},
+	} {
+		resp := ts.do(t, "POST", "/receipts/process", targetReceipt, "Content-Type", test.contentType)
+		if test.status == http.StatusCreated {
+			if resp.StatusCode != http.StatusCreated {
+				t.Errorf("Content-Type %q: got %d, want 201", test.contentType, resp.StatusCode)
+			}
+			continue
+		}
+		problem := expectProblem(t, resp, http.StatusUnsupportedMediaType, codeUnsupportedMediaType)
+		if !strings.Contains(problem.Detail, "application/json") || !strings.Contains(resp.Header.Get("Accept-Post"), "application/json") {
+			t.Errorf("Content-Type %q: got %q and Accept-Post %q, want the supported types listed", test.contentType, problem.Detail, resp.Header.Get("Accept-Post"))
+		}
+	}
+}
@@ -0,0 +1,15 @@
+CREATE TABLE receipts (
+	id            TEXT PRIMARY KEY,
+	retailer      TEXT NOT NULL,
+	total_cents   BIGINT NOT NULL,
+	purchase_date TEXT NOT NULL,
+	purchase_time TEXT NOT NULL
+);
+
+CREATE TABLE items (
+	receipt_id        TEXT NOT NULL REFERENCES receipts (id) ON DELETE CASCADE,
+	position          INTEGER NOT NULL,
+	short_description TEXT NOT NULL,
+	price_cents       BIGINT NOT NULL,
+	PRIMARY KEY (receipt_id, position)
+);
@@ -0,0 +1 @@
+ALTER TABLE receipts ADD COLUMN created_at TIMESTAMPTZ;
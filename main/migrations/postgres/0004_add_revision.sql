@@ -0,0 +1 @@
+ALTER TABLE receipts ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
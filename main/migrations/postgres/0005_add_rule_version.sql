@@ -0,0 +1 @@
+ALTER TABLE receipts ADD COLUMN rule_version TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type for a monetary amount stored as a whole number of cents.
+// On the wire amounts are carried as decimal strings such as "9.00". Amounts are never held as floating point,
+// so checks on them, such as whether a total is a round dollar amount, are exact integer arithmetic on cents.
+type Amount int64
+
+// Function to parse a decimal string such as "35.35" into an Amount.
+func parseAmount(s string) (Amount, error) {
+	str := s
+	negative := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(str, "-")
+
+	dollars, cents, hasCents := strings.Cut(str, ".")
+	if dollars == "" || !isDigits(dollars) || (hasCents && (len(cents) == 0 || len(cents) > 2 || !isDigits(cents))) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	//Pad the cents portion so "9.5" is read as 9 dollars and 50 cents.
+	cents = (cents + "00")[:2]
+
+	value, err := strconv.ParseInt(dollars+cents, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	if negative {
+		value = -value
+	}
+
+	return Amount(value), nil
+}
+
+// Function to report whether a string is non-empty and made up only of ASCII digits.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Function to return the number of whole cents in the amount.
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Function to report whether the amount is a whole number of dollars with no cents.
+func (a Amount) IsRoundDollar() bool {
+	return a%100 == 0
+}
+
+// Function to report whether the amount is an exact multiple of 0.25.
+func (a Amount) IsQuarterMultiple() bool {
+	return a%25 == 0
+}
+
+// Function to format the amount as a decimal string with two decimal places.
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Function to decode an amount from either its JSON string form "9.00" or a bare JSON number 9.00.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s, err := rawAmountText(data)
+	if err != nil {
+		return err
+	}
+
+	amount, err := parseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = amount
+	return nil
+}
+
+// Function to encode an amount in its JSON string form.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// Function to encode an amount as text, used for XML elements.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// Function to return the text of a raw JSON amount, which may be a string or a bare number.
+func rawAmountText(data []byte) (string, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("amount must be a string or a number, got %s", data)
+	}
+}
+
+// Function to set the amount from a command line flag value.
+func (a *Amount) Set(s string) error {
+	amount, err := parseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = amount
+	return nil
+}
+
+// Function to return a pointer to a copy of the amount, for building receipts in code.
+func amountPtr(a Amount) *Amount {
+	return &a
+}
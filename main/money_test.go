@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAmountChecksAreExact(t *testing.T) {
+	for _, test := range []struct {
+		text            string
+		roundDollar     bool
+		quarterMultiple bool
+	}{
+		{"0.00", true, true},
+		{"0.25", false, true},
+		{"0.50", false, true},
+		{"0.75", false, true},
+		{"0.01", false, false},
+		{"0.24", false, false},
+		{"0.26", false, false},
+		{"1.00", true, true},
+		{"9.00", true, true},
+		{"35.35", false, false},
+
+		//Sums such as 0.1+0.2 that floating point gets wrong, as 0.30000000000000004, or as 0.29 when truncated.
+		{"0.30", false, false},
+		{"0.3", false, false},
+		{"1.10", false, false},
+		{"2.2", false, false},
+		{"0.7", false, false},
+
+		//Totals too large for a float64 to hold every cent of.
+		{"92233720368547758.00", true, true},
+		{"92233720368547758.07", false, false},
+		{"90071992547409.93", false, false},
+		{"90071992547409.75", false, true},
+		{"90071992547410.00", true, true},
+		{"-9007199254740993.25", false, true},
+	} {
+		amount, err := parseAmount(test.text)
+		if err != nil {
+			t.Fatalf("parseAmount(%q): %v", test.text, err)
+		}
+		if got := amount.IsRoundDollar(); got != test.roundDollar {
+			t.Errorf("%s IsRoundDollar: got %v, want %v", test.text, got, test.roundDollar)
+		}
+		if got := amount.IsQuarterMultiple(); got != test.quarterMultiple {
+			t.Errorf("%s IsQuarterMultiple: got %v, want %v", test.text, got, test.quarterMultiple)
+		}
+	}
+}
+
+func TestAmountRoundTripsEveryCent(t *testing.T) {
+	for _, text := range []string{"0.30", "1.10", "35.35", "90071992547409.93", "92233720368547758.07", "-0.01"} {
+		amount, err := parseAmount(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if amount.String() != text {
+			t.Errorf("%s formats as %s", text, amount.String())
+		}
+
+		var decoded Amount
+		data, _ := json.Marshal(amount)
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != amount {
+			t.Errorf("%s through JSON: got %v, %v", text, decoded, err)
+		}
+	}
+}
+
+func TestParseAmountRejectsOutOfRangeTotals(t *testing.T) {
+	for _, text := range []string{"92233720368547758.08", "100000000000000000000.00", "0.001", "1.", ".5", "1e3"} {
+		if amount, err := parseAmount(text); err == nil {
+			t.Errorf("parseAmount(%q): got %v, want an error", text, amount)
+		}
+	}
+}
+
+func TestDollarRulesAreExactOnFloatingPointTotals(t *testing.T) {
+	for _, test := range []struct {
+		total  string
+		points int
+	}{
+		{"35.35", 0},
+		{"0.30", 0},
+		{"1.10", 0},
+		{"0.10", 0},
+		{"9.00", 75},
+		{"100.00", 75},
+		{"4.75", 25},
+		{"0.75", 25},
+		{"1000000.75", 25},
+		{"90071992547409.75", 25},
+		{"90071992547409.93", 0},
+	} {
+		receipt := exampleReceipt(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"`+test.total+`"}],"total":"`+test.total+`"}`)
+		points := 0
+		for _, rule := range []Rule{RoundDollarRule{Points: 50}, QuarterMultipleRule{Points: 25}} {
+			parts, err := rule.Apply(receipt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, part := range parts {
+				points += part.Points
+			}
+		}
+		if points != test.points {
+			t.Errorf("%s: dollar rules award %d, want %d", test.total, points, test.points)
+		}
+
+		//The wire form is unchanged, amounts are still written as strings with two decimal places.
+		data, err := json.Marshal(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `"total":"` + test.total + `"`; !strings.Contains(string(data), want) {
+			t.Errorf("%s: encoded as %s, want it to contain %s", test.total, data, want)
+		}
+	}
+}
+
+func TestQuarterMultipleVerdicts(t *testing.T) {
+	for _, test := range []struct {
+		total    string
+		multiple bool
+	}{
+		{"0.00", true},
+		{"0.25", true},
+		{"0.10", false},
+		{"8.75", true},
+		{"35.35", false},
+		{"1000000.75", true},
+		{"1000000.76", false},
+	} {
+		total, err := parseAmount(test.total)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt := &Receipt{Total: &total}
+
+		want := 0
+		if test.multiple {
+			want = 25
+		}
+		if got := rulePoints(t, QuarterMultipleRule{Points: 25}, receipt); got != want {
+			t.Errorf("%s: got %d points, want %d", test.total, got, want)
+		}
+	}
+}
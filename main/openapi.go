@@ -0,0 +1,18 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI 3 document describing every endpoint, kept beside the handlers in openapi.json and built into the binary.
+// It must be updated along with any change to a route, a request or response body, or a parameter.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Function to handle requests for the OpenAPI document.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
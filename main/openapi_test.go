@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Go types the schemas of the OpenAPI document describe, for decoding the document's examples.
+var schemaTypes = map[string]func() any{
+	"ReceiptResponse":     func() any { return &ReceiptResponse{} },
+	"PointsResponse":      func() any { return &PointsResponse{} },
+	"ValidationResponse":  func() any { return &ValidationResponse{} },
+	"BatchPointsRequest":  func() any { return &BatchPointsRequest{} },
+	"NDJSONImportResult":  func() any { return &NDJSONImportResult{} },
+	"RecalculateResponse": func() any { return &RecalculateResponse{} },
+	"PurgeResponse":       func() any { return &PurgeResponse{} },
+}
+
+// Struct for an example given in the OpenAPI document, with where it was found and the schema it is of.
+type specExample struct {
+	where  string
+	schema string
+	value  json.RawMessage
+}
+
+// Struct for the parts of a media type in the OpenAPI document that hold examples.
+type specMediaType struct {
+	Schema struct {
+		Ref string `json:"$ref"`
+	} `json:"schema"`
+	Example  json.RawMessage `json:"example"`
+	Examples map[string]struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"examples"`
+}
+
+// Function to collect the JSON and NDJSON examples of request and response bodies in the OpenAPI document
+// whose schema is one of the document's components.
+func specExamples(t *testing.T) []specExample {
+	t.Helper()
+
+	var document struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Example json.RawMessage `json:"example"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPIDocument, &document); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+
+	var examples []specExample
+	collect := func(where string, content map[string]specMediaType) {
+		//An NDJSON example is a single line, itself a JSON document.
+		media, ok := content["application/json"]
+		if !ok {
+			media, ok = content["application/x-ndjson"]
+		}
+		if !ok || media.Schema.Ref == "" {
+			return
+		}
+		schema := strings.TrimPrefix(media.Schema.Ref, "#/components/schemas/")
+		if media.Example != nil {
+			examples = append(examples, specExample{where, schema, media.Example})
+		}
+		for name, example := range media.Examples {
+			examples = append(examples, specExample{where + " " + name, schema, example.Value})
+		}
+	}
+	for path, operations := range document.Paths {
+		for method, raw := range operations {
+			var operation struct {
+				RequestBody struct {
+					Content map[string]specMediaType `json:"content"`
+				} `json:"requestBody"`
+				Responses map[string]struct {
+					Content map[string]specMediaType `json:"content"`
+				} `json:"responses"`
+			}
+			if method == "parameters" || json.Unmarshal(raw, &operation) != nil {
+				continue
+			}
+			where := strings.ToUpper(method) + " " + path
+			collect(where+" request", operation.RequestBody.Content)
+			for status, response := range operation.Responses {
+				collect(where+" "+status, response.Content)
+			}
+		}
+	}
+	for name, schema := range document.Components.Schemas {
+		if schema.Example != nil && bytes.HasPrefix(schema.Example, []byte("{")) {
+			examples = append(examples, specExample{"schema " + name, name, schema.Example})
+		}
+	}
+	return examples
+}
+
+func TestSpecReceiptExamplesDecodeAndValidate(t *testing.T) {
+	found := 0
+	for _, example := range specExamples(t) {
+		if example.schema != "Receipt" {
+			continue
+		}
+		found++
+		receipt, err := decodeReceipt(bytes.NewReader(example.value), decodeOptions{Strict: true})
+		if err != nil {
+			t.Errorf("%s: decoding: %v", example.where, err)
+			continue
+		}
+		if errs := receipt.Validate(testConfig(), validationNow); len(errs) > 0 {
+			t.Errorf("%s: invalid: %v", example.where, errs)
+		}
+		if _, err := calculatePoints(receipt); err != nil {
+			t.Errorf("%s: scoring: %v", example.where, err)
+		}
+	}
+	if found == 0 {
+		t.Fatal("the spec gives no receipt examples")
+	}
+}
+
+func TestSpecExamplesDecodeIntoTheirTypes(t *testing.T) {
+	seen := map[string]bool{}
+	for _, example := range specExamples(t) {
+		newValue, ok := schemaTypes[example.schema]
+		if !ok {
+			continue
+		}
+		seen[example.schema] = true
+		decoder := json.NewDecoder(bytes.NewReader(example.value))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(newValue()); err != nil {
+			t.Errorf("%s: decoding as %s: %v", example.where, example.schema, err)
+		}
+	}
+	for schema := range schemaTypes {
+		if !seen[schema] {
+			t.Errorf("the spec gives no example of %s", schema)
+		}
+	}
+}
+
+func TestSpecExamplesAreAcceptedByTheServer(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	//The example receipts are the published ones, and score as published.
+	scores := map[string]int{"target": 28, "cornerMarket": 109}
+	for _, example := range specExamples(t) {
+		name, isExample := strings.CutPrefix(example.where, "POST /receipts/process request ")
+		if !isExample {
+			continue
+		}
+		id := ts.submit(t, string(example.value))
+		if want, ok := scores[name]; ok {
+			if got := ts.points(t, id); got != want {
+				t.Errorf("%s: got %d points, want %d", example.where, got, want)
+			}
+		}
+	}
+
+	var document map[string]any
+	resp := ts.do(t, "GET", "/openapi.json", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /openapi.json: got %d, want 200", resp.StatusCode)
+	}
+	decodeBody(t, resp, &document)
+	if document["openapi"] == nil {
+		t.Fatal("GET /openapi.json: no openapi version")
+	}
+}
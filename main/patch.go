@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Function to handle requests to partially update a stored receipt given a receipt id.
+// The body is a JSON merge patch (RFC 7396): fields it gives replace the stored ones, including the items
+// array as a whole, and null removes a field. The merged receipt is validated and scored like a newly
+// submitted one, though under the rules the stored receipt was scored with, and the stored receipt is left
+// untouched if it is not valid.
+// An If-Match header must match the stored revision, see checkIfMatch.
+func (s *Server) patchReceiptHandler(w http.ResponseWriter, r *http.Request) {
+
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(mux.Vars(r)["id"])
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
+	}
+
+	//Parse the patch before looking at the store, keeping numbers as written so amounts are checked as given.
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var patch interface{}
+	if err := decoder.Decode(&patch); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeProblem(w, http.StatusBadRequest, codeInvalidJSON, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	//See if the receipt exists in the store, holding it until the merged receipt is saved.
+	unlock := s.locks.lock(id)
+	defer unlock()
+	stored, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !s.checkIfMatch(w, r, stored) {
+		return
+	}
+
+	//Apply the patch to the receipt as it would have been submitted, then read the result like a new submission.
+	merged, err := json.Marshal(mergePatch(wireDocument(stored, s.config.decodeOptions()), patch))
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error applying patch")
+		return
+	}
+	receipt, ok := s.readReceipt(w, bytes.NewReader(merged))
+	if !ok {
+		return
+	}
+	if err := keepRuleVersion(stored, receipt); err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+		return
+	}
+	receipt.CreatedAt = stored.CreatedAt
+	receipt.Revision = stored.Revision + 1
+
+	if err := s.store.Save(r.Context(), id, receipt); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.indexReplaced(id, receipt)
+
+	w.Header().Set("ETag", revisionETag(receipt.Revision))
+	writeJSON(w, http.StatusOK, ReceiptResponse{ID: id, Links: s.receiptLinks(r, id)})
+}
+
+// Function to score a receipt replacing a stored one under the rule set the stored receipt was scored with, so
+// editing a receipt doesn't move it to other rules. Receipts stored before rule versions were kept, or under a
+// version no longer registered, keep the default rules they were read with.
+func keepRuleVersion(stored *Receipt, receipt *Receipt) error {
+	build, ok := ruleSets[stored.RuleVersion]
+	if !ok || stored.RuleVersion == receipt.RuleVersion {
+		return nil
+	}
+	set := build()
+	points, err := set.Score(receipt)
+	if err != nil {
+		return err
+	}
+	receipt.Points = &points
+	receipt.RuleVersion = set.Version
+	return nil
+}
+
+// Function to write a receipt as a generic JSON document in the form it is submitted in,
+// with amounts in the configured number format so the merged document decodes like a request body.
+func wireDocument(receipt *Receipt, opts decodeOptions) map[string]interface{} {
+	doc := map[string]interface{}{
+		"retailer":     receipt.Retailer,
+		"purchaseDate": receipt.PurchaseDate,
+		"purchaseTime": receipt.PurchaseTime,
+	}
+	if receipt.Total != nil {
+		doc["total"] = formatAmount(*receipt.Total, opts)
+	}
+
+	items := make([]interface{}, len(receipt.Items))
+	for i, item := range receipt.Items {
+		wire := map[string]interface{}{"shortDescription": item.Description}
+		if item.Price != nil {
+			wire["price"] = formatAmount(*item.Price, opts)
+		}
+		items[i] = wire
+	}
+	doc["items"] = items
+
+	return doc
+}
+
+// Function to write an amount in the number format selected by the decode options.
+func formatAmount(amount Amount, opts decodeOptions) string {
+	text := amount.String()
+	if opts.DecimalComma {
+		text = strings.Replace(text, ".", ",", 1)
+	}
+	return text
+}
+
+// Function to apply a JSON merge patch to a target document, as described in RFC 7396.
+// A patch that is not an object replaces the target entirely.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Function to patch a stored receipt on the server under test, returning the response.
+func (ts *testServer) patch(t *testing.T, id string, patch string) *http.Response {
+	t.Helper()
+
+	return ts.do(t, "PATCH", "/receipts/"+id, patch, "Content-Type", "application/merge-patch+json")
+}
+
+// Function to read a stored receipt straight from the store of the server under test.
+func (ts *testServer) stored(t *testing.T, id string) *Receipt {
+	t.Helper()
+
+	receipt, err := ts.store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestPatchingAFieldRescoresTheReceipt(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	before := ts.stored(t, id)
+
+	//Buying at 14:33 falls in the afternoon window, worth another 10 points.
+	resp := ts.patch(t, id, `{"purchaseTime":"14:33"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if got := ts.points(t, id); got != 38 {
+		t.Fatalf("points after the patch: got %d, want 38", got)
+	}
+
+	after := ts.stored(t, id)
+	if after.PurchaseTime != "14:33" || after.Retailer != before.Retailer || len(after.Items) != len(before.Items) {
+		t.Fatalf("patched receipt: got %+v", after)
+	}
+	if after.Revision != before.Revision+1 {
+		t.Errorf("revision after the patch: got %d, want %d", after.Revision, before.Revision+1)
+	}
+	if etag := resp.Header.Get("ETag"); etag != revisionETag(after.Revision) {
+		t.Errorf("ETag after the patch: got %s, want %s", etag, revisionETag(after.Revision))
+	}
+	if after.CreatedAt == nil || !after.CreatedAt.Equal(*before.CreatedAt) {
+		t.Errorf("createdAt after the patch: got %v, want %v", after.CreatedAt, before.CreatedAt)
+	}
+}
+
+func TestPatchingTheItemsReplacesThemWhole(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	items := `[{"shortDescription":"Gatorade","price":"35.35"}]`
+	resp := ts.patch(t, id, `{"items":`+items+`}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+
+	after := ts.stored(t, id)
+	if len(after.Items) != 1 || after.Items[0].Description != "Gatorade" {
+		t.Fatalf("patched items: got %+v, want the one item given", after.Items)
+	}
+	patched := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":` + items + `,"total":"35.35"}`
+	want, err := defaultRuleSet().Score(exampleReceipt(t, patched))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ts.points(t, id); got != want {
+		t.Fatalf("points after the patch: got %d, want %d", got, want)
+	}
+}
+
+func TestInvalidPatchLeavesTheReceiptUntouched(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	before := ts.contents(t)
+
+	resp := ts.patch(t, id, `{"total":"-1.00"}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("PATCH with a negative total: got %d, want 422: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if !sameContents(t, ts.contents(t), before) {
+		t.Fatal("an invalid patch changed the store")
+	}
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after an invalid patch: got %d, want 28", got)
+	}
+}
+
+func TestEditedReceiptMovesInTheDuplicateIndex(t *testing.T) {
+	for _, method := range []string{"PATCH", "PUT"} {
+		t.Run(method, func(t *testing.T) {
+			ts := newTestServer(t, dedupeConfig())
+			id := ts.submit(t, targetReceipt)
+
+			var resp *http.Response
+			if method == "PATCH" {
+				resp = ts.patch(t, id, cornerReceipt)
+			} else {
+				resp = ts.do(t, "PUT", "/receipts/"+id, cornerReceipt)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s: got %d, want 200: %s", method, resp.StatusCode, readBody(t, resp))
+			}
+
+			if again := ts.resubmit(t, cornerReceipt); again != id {
+				t.Fatalf("the edited receipt's content was answered with %s, want %s", again, id)
+			}
+			if other := ts.submit(t, targetReceipt); other == id {
+				t.Fatal("the receipt's old content was still answered with its id")
+			}
+		})
+	}
+}
+
+func TestPatchKeepsTheStoredRuleVersion(t *testing.T) {
+	saved := defaultRuleVersion
+	t.Cleanup(func() { defaultRuleVersion = saved })
+
+	ts := newTestServer(t, testConfig())
+	defaultRuleVersion = ruleVersionV2
+	id := ts.submit(t, targetReceipt)
+	defaultRuleVersion = ruleVersionV1
+
+	if resp := ts.patch(t, id, `{"purchaseTime":"14:33"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+
+	want, err := ruleSets[ruleVersionV2]().Score(exampleReceipt(t, strings.Replace(targetReceipt, "13:01", "14:33", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := ts.do(t, "GET", "/receipts/"+id+"/points", "")
+	var response PointsResponse
+	decodeBody(t, resp, &response)
+	if response.RuleVersion != ruleVersionV2 || response.Points != want {
+		t.Fatalf("points after the patch: got %d under %s, want %d under %s", response.Points, response.RuleVersion, want, ruleVersionV2)
+	}
+}
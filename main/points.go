@@ -0,0 +1,175 @@
+package main
+
+import (
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// Struct for the configurable constants used by the points rules.
+type PointsConfig struct {
+	//Points for a round dollar total, for a total that is a multiple of 0.25, and for every two items.
+	RoundDollarPoints     int
+	QuarterMultiplePoints int
+	ItemPairPoints        int
+
+	//Multiplier applied to the price of each item whose trimmed description length is a multiple of 3, to the cent.
+	DescriptionMultiplier Amount
+
+	//Points for an odd purchase day and for a purchase inside the afternoon window.
+	OddDayPoints    int
+	AfternoonPoints int
+
+	//Points for a purchase on a Saturday or Sunday, for promotions turning on the weekend bonus rule.
+	WeekendBonusPoints int
+
+	//Names of the rules left out of scoring, which score nothing and aren't listed in breakdowns.
+	//The weekend bonus is left out unless turned on.
+	DisabledRules map[string]bool
+
+	//Promotions multiplying the points of receipts from particular retailers, the first matching a receipt applying.
+	RetailerMultipliers []RetailerMultiplier
+
+	//Most and fewest points a receipt can score once every rule and promotion is applied, nil for no limit.
+	PointsCap   *int
+	PointsFloor *int
+
+	//Start and end of the afternoon bonus window as offsets from midnight. The start is inclusive and the end
+	//exclusive, and a window ending before it starts, such as 22:00 to 02:00, wraps past midnight.
+	//Purchase times are whole minutes, so the published window, after 2:00pm and before 4:00pm, starts at 14:01.
+	AfternoonStart time.Duration
+	AfternoonEnd   time.Duration
+}
+
+// Function to return the points configuration matching the published rules.
+func defaultPointsConfig() PointsConfig {
+	return PointsConfig{
+		RoundDollarPoints:     50,
+		QuarterMultiplePoints: 25,
+		ItemPairPoints:        5,
+		DescriptionMultiplier: 20,
+		OddDayPoints:          6,
+		AfternoonPoints:       10,
+		WeekendBonusPoints:    15,
+		DisabledRules:         map[string]bool{weekendBonusRule: true},
+		AfternoonStart:        14*time.Hour + time.Minute,
+		AfternoonEnd:          16 * time.Hour,
+	}
+}
+
+// Function to report whether a purchase time falls inside the afternoon bonus window, from its start up to
+// but not including its end, wrapping past midnight when the window ends before it starts.
+func (c PointsConfig) inAfternoonWindow(purchaseTime time.Time) bool {
+	offset := time.Duration(purchaseTime.Hour())*time.Hour + time.Duration(purchaseTime.Minute())*time.Minute
+	if c.AfternoonStart > c.AfternoonEnd {
+		return offset >= c.AfternoonStart || offset < c.AfternoonEnd
+	}
+	return offset >= c.AfternoonStart && offset < c.AfternoonEnd
+}
+
+var pointsConfig = defaultPointsConfig()
+
+// Regular expressions for retailer names and item descriptions, kept together so validation and scoring agree on what they may contain.
+var (
+	//Pattern a retailer name must match. The published pattern is ^[\w\s\-&]+$, with \w widened to
+	//Unicode letters and digits since the points rules count retailer characters as runes.
+	retailerRegex = regexp.MustCompile(`^[\p{L}\p{N}_\s\-&]+$`)
+
+	//Pattern an item description must match. The published pattern is ^[\w\s\-]+$, widened in the same way.
+	descriptionRegex = regexp.MustCompile(`^[\p{L}\p{N}_\s\-]+$`)
+
+	//Regular expression to trim non-alphanumeric characters from retailer string.
+	nonAlphanumericRegex = regexp.MustCompile(`[^\p{L}\p{N} ]+`)
+)
+
+// Struct for the points one rule contributed to a receipt's score given as JSON.
+type PointsContribution struct {
+	Rule        string `json:"rule"`
+	Points      int    `json:"points"`
+	Explanation string `json:"explanation"`
+}
+
+// Function to calculate the points given a receipt, with the default rule set.
+// Returns an error if the purchase date or time cannot be parsed.
+func calculatePoints(receipt *Receipt) (int, error) {
+	return defaultRuleSet().Score(receipt)
+}
+
+// Function to score a receipt with the rule set submitted receipts are scored with, recording the points on it
+// along with the version of the rules that scored them.
+func scoreReceipt(receipt *Receipt) error {
+	set := defaultRuleSet()
+	points, err := set.Score(receipt)
+	if err != nil {
+		return err
+	}
+	receipt.Points = &points
+	receipt.RuleVersion = set.Version
+	return nil
+}
+
+// Function to score a receipt rule by rule with the given rule set and total the contributions.
+// Every rule's contribution is included, even when it scored nothing, and each item's description gets its own.
+// Returns an error if the purchase date or time cannot be parsed.
+func pointsBreakdown(set RuleSet, receipt *Receipt) (PointsBreakdownResponse, error) {
+	contributions, err := set.Breakdown(receipt)
+	if err != nil {
+		return PointsBreakdownResponse{}, err
+	}
+
+	response := PointsBreakdownResponse{RuleVersion: set.Version, Breakdown: contributions}
+	for _, contribution := range contributions {
+		response.Points += contribution.Points
+	}
+	return response, nil
+}
+
+// Function to return the points scored when a receipt was submitted, calculating them if none were stored.
+func storedPoints(receipt *Receipt) (int, error) {
+	if receipt.Points != nil {
+		return *receipt.Points, nil
+	}
+	return calculatePoints(receipt)
+}
+
+// Struct for how a single item was scored given as JSON.
+// Length is the number of characters in the canonical description, and MultipleOfThree reports whether
+// the description rule applied to it.
+type ItemScore struct {
+	Description     string  `json:"description"`
+	Length          int     `json:"length"`
+	Price           *Amount `json:"price"`
+	MultipleOfThree bool    `json:"multipleOfThree"`
+	Points          int     `json:"points"`
+}
+
+// Function to score a single item.
+// If the trimmed length of the canonical item description is a multiple of 3, multiply the price by the multiplier, 0.2 by default,
+// and round up to the nearest integer.
+// The result is the number of points earned. Length is measured in characters, not bytes.
+func scoreItem(item Item, multiplier Amount) ItemScore {
+	score := ItemScore{
+		Description: item.Description,
+		Length:      utf8.RuneCountInString(canonicalDescription(item.Description)),
+		Price:       item.Price,
+	}
+
+	//A blank description has length 0, which must not count as a multiple of 3.
+	if score.Length == 0 || score.Length%3 != 0 {
+		return score
+	}
+	score.MultipleOfThree = true
+
+	//Both the price and the multiplier are in hundredths, so their product is rounded up to whole points by dividing by 10000.
+	score.Points = int(ceilDiv(item.Price.Cents()*multiplier.Cents(), 10000))
+	return score
+}
+
+// Function to divide a by b, rounding the result up towards positive infinity.
+func ceilDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) == (b < 0) {
+		q++
+	}
+	return q
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// Receipts whose points under the default rules have been worked out by hand.
+var goldenReceipts = []struct {
+	name   string
+	body   string
+	points int
+}{
+	{"target", targetReceipt, 28},
+	{"corner market", cornerReceipt, 109},
+	{"round dollar", receiptWithItems(3), 92},
+	{"walgreens", `{"retailer":"Walgreens","purchaseDate":"2022-01-02","purchaseTime":"08:13","items":[{"shortDescription":"Pepsi","price":"1.25"},{"shortDescription":"Dasani","price":"1.40"}],"total":"2.65"}`, 15},
+}
+
+func TestCalculatePointsRejectsUnparseableDates(t *testing.T) {
+	for _, test := range []struct {
+		date string
+		time string
+	}{
+		{"2024-13-45", "13:01"},
+		{"2022-01-01", "25:99"},
+		{"2022-01-01", "banana"},
+		{"", ""},
+	} {
+		receipt := exampleReceipt(t, targetReceipt)
+		receipt.PurchaseDate = test.date
+		receipt.PurchaseTime = test.time
+		if points, err := calculatePoints(receipt); err == nil {
+			t.Errorf("%q %q: scored %d points, want an error", test.date, test.time, points)
+		}
+	}
+}
+
+func TestScoreItemCountsCharactersNotBytes(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		price       string
+		points      int
+	}{
+		//Byte lengths that are multiples of 3 when the character count is not, and the other way round.
+		{"Käse 200g", "5.00", 1},
+		{"Crème", "3.00", 0},
+		{"Müsli!", "12.25", 3},
+		{"寿司", "8.00", 0},
+		{"寿司セット", "10.00", 0},
+		{"寿司大", "8.00", 2},
+
+		//The example fixtures keep their scores.
+		{"Emils Cheese Pizza", "12.25", 3},
+		{"   Klarbrunn 12-PK 12 FL OZ  ", "12.00", 3},
+		{"Mountain Dew 12PK", "6.49", 0},
+	} {
+		price, err := parseAmount(test.price)
+		if err != nil {
+			t.Fatal(err)
+		}
+		score := scoreItem(Item{Description: test.description, Price: &price}, pointsConfig.DescriptionMultiplier)
+		if score.Points != test.points {
+			t.Errorf("%q at %s: got %d points, want %d", test.description, test.price, score.Points, test.points)
+		}
+	}
+}
+
+func TestScoreItemRoundsThePriceShareUp(t *testing.T) {
+	for _, test := range []struct {
+		price  string
+		points int
+	}{
+		{"0.00", 0},
+		{"0.01", 1},
+		{"5.00", 1},
+		{"5.01", 2},
+		{"12.25", 3},
+		{"12.00", 3},
+		{"15.00", 3},
+	} {
+		price, err := parseAmount(test.price)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := scoreItem(Item{Description: "abc", Price: &price}, 20).Points; got != test.points {
+			t.Errorf("%s: got %d points, want %d", test.price, got, test.points)
+		}
+	}
+}
+
+func TestBreakdownSumsToThePoints(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, golden := range goldenReceipts {
+		id := ts.submit(t, golden.body)
+		resp := ts.do(t, "GET", "/receipts/"+id+"/points/breakdown", "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: GET breakdown: got %d, want 200", golden.name, resp.StatusCode)
+		}
+		var breakdown PointsBreakdownResponse
+		decodeBody(t, resp, &breakdown)
+
+		sum := 0
+		rules := map[string]bool{}
+		for _, contribution := range breakdown.Breakdown {
+			if contribution.Explanation == "" {
+				t.Errorf("%s: %s has no explanation", golden.name, contribution.Rule)
+			}
+			sum += contribution.Points
+			rules[contribution.Rule] = true
+		}
+		if sum != golden.points || breakdown.Points != golden.points {
+			t.Errorf("%s: breakdown sums to %d and totals %d, want %d", golden.name, sum, breakdown.Points, golden.points)
+		}
+		if got := ts.points(t, id); got != golden.points {
+			t.Errorf("%s: points: got %d, want %d", golden.name, got, golden.points)
+		}
+
+		//Every active rule is listed, the description rule once per item.
+		for _, name := range ruleNames() {
+			if name == weekendBonusRule || name == (ItemDescriptionRule{}).Name() {
+				continue
+			}
+			if !rules[name] {
+				t.Errorf("%s: breakdown does not list %s", golden.name, name)
+			}
+		}
+		receipt := exampleReceipt(t, golden.body)
+		for i := range receipt.Items {
+			if rule := fmt.Sprintf("items[%d].description", i); !rules[rule] {
+				t.Errorf("%s: breakdown does not list %s", golden.name, rule)
+			}
+		}
+	}
+}
+
+func TestBreakdownExplainsEachRule(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, test := range []struct {
+		name string
+		body string
+		want []PointsContribution
+	}{
+		{"target", targetReceipt, []PointsContribution{
+			{"retailerName", 6, "retailer 'Target' has 6 alphanumeric characters → 6 points"},
+			{"roundDollarTotal", 0, "total 35.35 is not a round dollar amount → 0 points"},
+			{"quarterMultipleTotal", 0, "total 35.35 is not a multiple of 0.25 → 0 points"},
+			{"itemPairs", 10, "5 items → 2 pairs → 10 points"},
+			{"items[0].description", 0, "item 'Mountain Dew 12PK' trimmed length 17 is not a multiple of 3 → 0 points"},
+			{"items[1].description", 3, "item 'Emils Cheese Pizza' trimmed length 18 is a multiple of 3 → ceil(12.25×0.2)=3"},
+			{"items[2].description", 0, "item 'Knorr Creamy Chicken' trimmed length 20 is not a multiple of 3 → 0 points"},
+			{"items[3].description", 0, "item 'Doritos Nacho Cheese' trimmed length 20 is not a multiple of 3 → 0 points"},
+			{"items[4].description", 3, "item '   Klarbrunn 12-PK 12 FL OZ  ' trimmed length 24 is a multiple of 3 → ceil(12.00×0.2)=3"},
+			{"oddPurchaseDay", 6, "purchase day 1 is odd → 6 points"},
+			{"afternoonPurchase", 0, "purchase time 13:01 is not in the window from 14:01 to 16:00 → 0 points"},
+		}},
+		{"corner market", cornerReceipt, []PointsContribution{
+			{"retailerName", 14, "retailer 'M&M Corner Market' has 14 alphanumeric characters → 14 points"},
+			{"roundDollarTotal", 50, "total 9.00 is a round dollar amount → 50 points"},
+			{"quarterMultipleTotal", 25, "total 9.00 is a multiple of 0.25 → 25 points"},
+			{"itemPairs", 10, "4 items → 2 pairs → 10 points"},
+			{"items[0].description", 0, "item 'Gatorade' trimmed length 8 is not a multiple of 3 → 0 points"},
+			{"items[1].description", 0, "item 'Gatorade' trimmed length 8 is not a multiple of 3 → 0 points"},
+			{"items[2].description", 0, "item 'Gatorade' trimmed length 8 is not a multiple of 3 → 0 points"},
+			{"items[3].description", 0, "item 'Gatorade' trimmed length 8 is not a multiple of 3 → 0 points"},
+			{"oddPurchaseDay", 0, "purchase day 20 is even → 0 points"},
+			{"afternoonPurchase", 10, "purchase time 14:33 is in the window from 14:01 to 16:00 → 10 points"},
+		}},
+	} {
+		id := ts.submit(t, test.body)
+		var breakdown PointsBreakdownResponse
+		decodeBody(t, ts.do(t, "GET", "/receipts/"+id+"/points/breakdown", ""), &breakdown)
+		if !slices.Equal(breakdown.Breakdown, test.want) {
+			t.Errorf("%s: breakdown:\ngot  %+v\nwant %+v", test.name, breakdown.Breakdown, test.want)
+		}
+	}
+}
+
+// Function to return a pointer to a copy of a whole number, for optional settings such as the points cap.
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestBreakdownShowsThePointsBeingLimited(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		cap    *int
+		floor  *int
+		body   string
+		points int
+		limit  *PointsContribution
+	}{
+		{"capped", intPtr(100), nil, cornerReceipt, 100, &PointsContribution{"pointsLimit", -9, "109 points is over the cap of 100 → -9 points"}},
+		{"floored", nil, intPtr(50), targetReceipt, 50, &PointsContribution{"pointsLimit", 22, "28 points is under the floor of 50 → 22 points"}},
+		{"at the cap", intPtr(109), intPtr(50), cornerReceipt, 109, nil},
+		{"at the floor", intPtr(109), intPtr(28), targetReceipt, 28, nil},
+	} {
+		withPointsConfig(t, func(c *PointsConfig) {
+			c.PointsCap = test.cap
+			c.PointsFloor = test.floor
+		})
+		ts := newTestServer(t, testConfig())
+		id := ts.submit(t, test.body)
+
+		var breakdown PointsBreakdownResponse
+		decodeBody(t, ts.do(t, "GET", "/receipts/"+id+"/points/breakdown", ""), &breakdown)
+		last := breakdown.Breakdown[len(breakdown.Breakdown)-1]
+		switch {
+		case test.limit != nil && last != *test.limit:
+			t.Errorf("%s: last contribution: got %+v, want %+v", test.name, last, *test.limit)
+		case test.limit == nil && last.Rule == "pointsLimit":
+			t.Errorf("%s: got %+v, want the points left as they are", test.name, last)
+		}
+		if got := ts.points(t, id); got != test.points || breakdown.Points != test.points {
+			t.Errorf("%s: got %d points and a breakdown totalling %d, want %d", test.name, got, breakdown.Points, test.points)
+		}
+	}
+}
+
+func TestScoringWithoutStoringMatchesSubmitting(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, golden := range goldenReceipts {
+		resp := ts.do(t, "POST", "/receipts/points", golden.body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: POST /receipts/points: got %d, want 200: %s", golden.name, resp.StatusCode, readBody(t, resp))
+		}
+		if location := resp.Header.Get("Location"); location != "" {
+			t.Errorf("%s: POST /receipts/points: got Location %q, want none", golden.name, location)
+		}
+		var preview PointsResponse
+		decodeBody(t, resp, &preview)
+		if ids := storedIDs(t, ts.store); len(ids) != 0 {
+			t.Fatalf("%s: scoring stored %v", golden.name, ids)
+		}
+
+		resp = ts.do(t, "POST", "/receipts/points?breakdown=true", golden.body)
+		var breakdown PointsBreakdownResponse
+		decodeBody(t, resp, &breakdown)
+
+		id := ts.submit(t, golden.body)
+		if got := ts.points(t, id); preview.Points != got || breakdown.Points != got {
+			t.Errorf("%s: scored %d and %d with a breakdown, submitted %d", golden.name, preview.Points, breakdown.Points, got)
+		}
+		if resp := ts.do(t, "DELETE", "/receipts/"+id, ""); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s: DELETE: got %d, want 204", golden.name, resp.StatusCode)
+		}
+	}
+}
+
+func TestScoringWithoutStoringIsValidatedLikeSubmitting(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	invalid := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[],"total":"1.00"}`
+	submitted := ts.reject(t, invalid)
+	problem := expectProblem(t, ts.do(t, "POST", "/receipts/points", invalid), http.StatusUnprocessableEntity, codeValidationFailed)
+	if !equalIDs(errorFields(problem.Errors), errorFields(submitted)) {
+		t.Fatalf("scoring errors: got %v, submitting gave %v", problem.Errors, submitted)
+	}
+	expectProblem(t, ts.do(t, "POST", "/receipts/points", `{"retailer":`), http.StatusBadRequest, codeInvalidJSON)
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("store holds %v, want none", ids)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Struct for an RFC 7807 problem details error response.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	//Stable machine-readable error code, e.g. invalid_json or validation_failed.
+	Code string `json:"code"`
+
+	//Every receipt field that failed validation, when there are any.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Machine-readable error codes carried in problem responses.
+// Bodies that cannot be decoded at all are invalid_json (400), while well-formed
+// receipts that fail validation are validation_failed (422).
+const (
+	codeInvalidJSON          = "invalid_json"
+	codeInvalidXML           = "invalid_xml"
+	codeInvalidCSV           = "invalid_csv"
+	codeInvalidProtobuf      = "invalid_protobuf"
+	codeInvalidBackup        = "invalid_backup"
+	codeValidationFailed     = "validation_failed"
+	codeBodyTooLarge         = "body_too_large"
+	codeInvalidID            = "invalid_id"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeIdempotencyConflict  = "idempotency_conflict"
+	codeInvalidParameter     = "invalid_parameter"
+	codeUnauthorized         = "unauthorized"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeReceiptPending       = "receipt_pending"
+	codeScoringFailed        = "scoring_failed"
+	codeQueueFull            = "queue_full"
+	codeInternal             = "internal_error"
+)
+
+// Function to write an application/problem+json error response with the given status, code, and detail.
+func writeProblem(w http.ResponseWriter, status int, code string, detail string) {
+	encodeProblem(w, Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	})
+}
+
+// Function to write a 422 validation_failed problem response listing every invalid field.
+func writeValidationProblem(w http.ResponseWriter, errs []FieldError) {
+	encodeProblem(w, Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusUnprocessableEntity),
+		Status: http.StatusUnprocessableEntity,
+		Detail: "invalid receipt",
+		Code:   codeValidationFailed,
+		Errors: errs,
+	})
+}
+
+// Function to encode a problem as an application/problem+json response.
+func encodeProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+
+	//Leave characters such as & unescaped so details echoing patterns and values stay readable.
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(problem)
+}
+
+// Function to handle requests for routes that do not exist.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, http.StatusNotFound, codeNotFound, "no route for "+r.URL.Path)
+}
+
+// Methods a route can be registered for, in the order they are listed in an Allow header.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Function to build the handler for requests to known routes made with a method the route doesn't serve.
+// The response lists the methods the path does serve in an Allow header, found by matching the path
+// against the router with each method in turn. OPTIONS is answered with that header and no body.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := []string{}
+		for _, method := range routeMethods {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			var match mux.RouteMatch
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+		allowed = append(allowed, http.MethodOptions)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeProblem(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method "+r.Method+" is not allowed for "+r.URL.Path)
+	})
+}
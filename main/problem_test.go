@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Function to decode a problem response, failing unless it has the given status and code and is a well-formed
+// application/problem+json document.
+func expectProblem(t *testing.T, resp *http.Response, status int, code string) Problem {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: got %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, readBody(t, resp))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("%s %s: got Content-Type %q, want application/problem+json", resp.Request.Method, resp.Request.URL.Path, contentType)
+	}
+	var problem Problem
+	decodeBody(t, resp, &problem)
+	if problem.Type == "" || problem.Title != http.StatusText(status) || problem.Status != status || problem.Detail == "" {
+		t.Fatalf("%s %s: got problem %+v, want type, title, status, and detail", resp.Request.Method, resp.Request.URL.Path, problem)
+	}
+	if problem.Code != code {
+		t.Fatalf("%s %s: got code %s, want %s", resp.Request.Method, resp.Request.URL.Path, problem.Code, code)
+	}
+	return problem
+}
+
+func TestEveryFailureClassIsAProblem(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	expectProblem(t, ts.do(t, "POST", "/receipts/process", `{"retailer":`), http.StatusBadRequest, codeInvalidJSON)
+	expectProblem(t, ts.do(t, "POST", "/receipts/process", `{}`), http.StatusUnprocessableEntity, codeValidationFailed)
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+newReceiptID()+"/points", ""), http.StatusNotFound, codeNotFound)
+	expectProblem(t, ts.do(t, "GET", "/receipts/not-an-id/points", ""), http.StatusBadRequest, codeInvalidID)
+	expectProblem(t, ts.do(t, "GET", "/receipts/process", ""), http.StatusMethodNotAllowed, codeMethodNotAllowed)
+	expectProblem(t, ts.do(t, "GET", "/no/such/route", ""), http.StatusNotFound, codeNotFound)
+}
+
+func TestWrongMethodsListTheAllowedOnes(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := newReceiptID()
+
+	for _, test := range []struct {
+		method, path, allow string
+	}{
+		{"GET", "/receipts/process", "POST, OPTIONS"},
+		{"DELETE", "/receipts/" + id + "/points", "GET, OPTIONS"},
+		{"POST", "/receipts/" + id, "GET, PUT, PATCH, DELETE, OPTIONS"},
+		{"PUT", "/v1/receipts", "GET, OPTIONS"},
+		{"GET", "/receipts/import.ndjson", "POST, OPTIONS"},
+		{"PUT", "/v1/receipts/import.ndjson", "POST, OPTIONS"},
+	} {
+		resp := ts.do(t, test.method, test.path, "")
+		expectProblem(t, resp, http.StatusMethodNotAllowed, codeMethodNotAllowed)
+		if allow := resp.Header.Get("Allow"); allow != test.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", test.method, test.path, allow, test.allow)
+		}
+	}
+}
+
+func TestOptionsListsTheAllowedMethods(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, test := range []struct {
+		path, allow string
+	}{
+		{"/receipts/process", "POST, OPTIONS"},
+		{"/receipts", "GET, OPTIONS"},
+		{"/v1/receipts/" + newReceiptID(), "GET, PUT, PATCH, DELETE, OPTIONS"},
+	} {
+		resp := ts.do(t, "OPTIONS", test.path, "")
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("OPTIONS %s: got %d, want 204", test.path, resp.StatusCode)
+		}
+		if allow := resp.Header.Get("Allow"); allow != test.allow {
+			t.Errorf("OPTIONS %s: got Allow %q, want %q", test.path, allow, test.allow)
+		}
+		if body := readBody(t, resp); body != "" {
+			t.Errorf("OPTIONS %s: got body %q, want none", test.path, body)
+		}
+	}
+
+	expectProblem(t, ts.do(t, "OPTIONS", "/no/such/route", ""), http.StatusNotFound, codeNotFound)
+}
+
+func TestMalformedAndInvalidReceiptsGetDistinctStatuses(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, body := range []string{
+		`{"retailer":`,
+		`not json`,
+		`[]`,
+	} {
+		expectProblem(t, ts.do(t, "POST", "/receipts/process", body), http.StatusBadRequest, codeInvalidJSON)
+	}
+	for _, body := range []string{
+		strings.Replace(targetReceipt, "2022-01-01", "2022-02-30", 1),
+		strings.Replace(targetReceipt, `"price":"6.49"`, `"price":"-6.49"`, 1),
+		`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[],"total":"0.00"}`,
+		`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"1.00"}],"total":{}}`,
+	} {
+		expectProblem(t, ts.do(t, "POST", "/receipts/process", body), http.StatusUnprocessableEntity, codeValidationFailed)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Struct for a promotion multiplying the points of a retailer's receipts, optionally only for purchases
+// from From to To, inclusive dates as YYYY-MM-DD, empty for no limit.
+// Retailer names are matched by retailerKey, so case and runs of whitespace don't matter.
+type RetailerMultiplier struct {
+	Retailer   string
+	Multiplier Amount
+	From       string
+	To         string
+}
+
+// Function to report whether a promotion applies to a receipt, by its retailer and purchase date.
+// Purchase dates as YYYY-MM-DD sort as strings in date order, so they are compared without being parsed.
+func (m RetailerMultiplier) matches(receipt *Receipt) bool {
+	if retailerKey(receipt.Retailer) != retailerKey(m.Retailer) {
+		return false
+	}
+	if m.From != "" && receipt.PurchaseDate < m.From {
+		return false
+	}
+	if m.To != "" && receipt.PurchaseDate > m.To {
+		return false
+	}
+	return true
+}
+
+// Function to check that a promotion names a retailer, has a multiplier that isn't negative, and, if limited
+// to purchase dates, gives real dates with From no later than To.
+func (m RetailerMultiplier) validate() error {
+	if retailerKey(m.Retailer) == "" {
+		return fmt.Errorf("invalid retailer multiplier: retailer is required")
+	}
+	if m.Multiplier < 0 {
+		return fmt.Errorf("invalid retailer multiplier for %q: multiplier %s must not be negative", m.Retailer, m.Multiplier)
+	}
+	for _, date := range []struct{ name, value string }{{"from", m.From}, {"to", m.To}} {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse(dateFormat, date.value); err != nil {
+			return fmt.Errorf("invalid retailer multiplier for %q: %s %q is not a date as YYYY-MM-DD", m.Retailer, date.name, date.value)
+		}
+	}
+	if m.From != "" && m.To != "" && m.From > m.To {
+		return fmt.Errorf("invalid retailer multiplier for %q: from %s is after to %s", m.Retailer, m.From, m.To)
+	}
+	return nil
+}
+
+// Type for the adjustment multiplying the points of receipts from retailers with a promotion running on their
+// purchase date. The multiplied points are rounded half up to a whole number, and the first promotion matching
+// a receipt is the only one applied.
+type RetailerMultiplierAdjustment struct {
+	Multipliers []RetailerMultiplier
+}
+
+// Function to return the name of the retailer multiplier adjustment.
+func (RetailerMultiplierAdjustment) Name() string { return "retailerMultiplier" }
+
+// Function to multiply the points by the first promotion matching the receipt, giving the points it adds as a
+// single part. Receipts no promotion matches are left as they are.
+func (a RetailerMultiplierAdjustment) Adjust(receipt *Receipt, points int) ([]PointsContribution, error) {
+	for _, m := range a.Multipliers {
+		if !m.matches(receipt) {
+			continue
+		}
+
+		//The multiplier is in hundredths, so adding 50 before dividing by 100 rounds half up.
+		multiplied := int((int64(points)*m.Multiplier.Cents() + 50) / 100)
+		return contribution(a, multiplied-points, "retailer '%s' promotion ×%s on %s: %d×%s rounded half up to %d", receipt.Retailer, decimalString(m.Multiplier), receipt.PurchaseDate, points, decimalString(m.Multiplier), multiplied), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+)
+
+// Function to score one of the example receipts under the default rules with the given promotions running,
+// changing its purchase date and time first when they aren't empty.
+func promotedPoints(t *testing.T, body string, date string, clock string, promotions ...RetailerMultiplier) int {
+	t.Helper()
+
+	withPointsConfig(t, func(c *PointsConfig) { c.RetailerMultipliers = promotions })
+	receipt := exampleReceipt(t, body)
+	if date != "" {
+		receipt.PurchaseDate = date
+	}
+	if clock != "" {
+		receipt.PurchaseTime = clock
+	}
+	points, err := defaultRuleSet().Score(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return points
+}
+
+func TestRetailerMultiplierAppliesWithinItsDates(t *testing.T) {
+	march := RetailerMultiplier{Retailer: "m&m  corner market", Multiplier: amount(t, "2"), From: "2022-03-01", To: "2022-03-31"}
+
+	//The corner receipt scores 109 at 14:33 on an even day, 6 more on an odd day and 10 fewer outside the afternoon.
+	for _, test := range []struct {
+		date   string
+		clock  string
+		points int
+	}{
+		{"", "", 109 * 2},
+		{"2022-03-01", "00:00", (109 + 6 - 10) * 2},
+		{"2022-03-31", "23:59", (109 + 6 - 10) * 2},
+		{"2022-02-28", "23:59", 109 - 10},
+		{"2022-04-01", "00:00", 109 + 6 - 10},
+		{"2023-03-20", "", 109},
+	} {
+		if got := promotedPoints(t, cornerReceipt, test.date, test.clock, march); got != test.points {
+			t.Errorf("%s %s: got %d points, want %d", test.date, test.clock, got, test.points)
+		}
+	}
+
+	//Other retailers' receipts aren't multiplied, and a promotion with no dates always runs.
+	if got := promotedPoints(t, targetReceipt, "2022-03-20", "", march); got != 22 {
+		t.Errorf("another retailer: got %d points, want 22", got)
+	}
+	if got := promotedPoints(t, cornerReceipt, "", "", RetailerMultiplier{Retailer: "M&M Corner Market", Multiplier: amount(t, "3")}); got != 327 {
+		t.Errorf("promotion with no dates: got %d points, want 327", got)
+	}
+}
+
+func TestRetailerMultiplierRoundsHalfUp(t *testing.T) {
+	for _, test := range []struct {
+		body       string
+		retailer   string
+		multiplier string
+		points     int
+	}{
+		//The target receipt's odd-cent total of 35.35 scores 28, the pizza's 2.45 for its description rounded up to 3.
+		{targetReceipt, "Target", "1.5", 42},
+		{targetReceipt, "Target", "1.1", 31},
+		{targetReceipt, "Target", "1.01", 28},
+		{targetReceipt, "Target", "0.99", 28},
+		{cornerReceipt, "M&M Corner Market", "1.5", 164},
+		{cornerReceipt, "M&M Corner Market", "0.5", 55},
+		{cornerReceipt, "M&M Corner Market", "0", 0},
+	} {
+		promotion := RetailerMultiplier{Retailer: test.retailer, Multiplier: amount(t, test.multiplier)}
+		if got := promotedPoints(t, test.body, "", "", promotion); got != test.points {
+			t.Errorf("%s ×%s: got %d points, want %d", test.retailer, test.multiplier, got, test.points)
+		}
+	}
+}
+
+func TestOnlyTheFirstMatchingRetailerMultiplierApplies(t *testing.T) {
+	promotions := []RetailerMultiplier{
+		{Retailer: "M&M Corner Market", Multiplier: amount(t, "2"), From: "2022-04-01"},
+		{Retailer: "M&M Corner Market", Multiplier: amount(t, "3"), To: "2022-03-31"},
+		{Retailer: "M&M Corner Market", Multiplier: amount(t, "4")},
+	}
+
+	withPointsConfig(t, func(c *PointsConfig) { c.RetailerMultipliers = promotions })
+	contributions, err := defaultRuleSet().Breakdown(exampleReceipt(t, cornerReceipt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := contributions[len(contributions)-1]
+	want := PointsContribution{"retailerMultiplier", 218, "retailer 'M&M Corner Market' promotion ×3 on 2022-03-20: 109×3 rounded half up to 327 → 218 points"}
+	if last != want {
+		t.Fatalf("last contribution: got %+v, want %+v", last, want)
+	}
+}
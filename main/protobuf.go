@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/receiptpb"
+)
+
+// Media type of receipt bodies and responses given as protocol buffers, using the messages of the gRPC service.
+const protobufMediaType = "application/x-protobuf"
+
+// Interface for response bodies that can also be written as a protocol buffer message.
+type protoResponse interface {
+	protoMessage() proto.Message
+}
+
+// Function to return the id response as its protocol buffer message.
+func (r ReceiptResponse) protoMessage() proto.Message {
+	message := &receiptpb.ProcessReceiptResponse{Id: r.ID}
+	if r.Points != nil {
+		points := int64(*r.Points)
+		message.Points = &points
+	}
+	return message
+}
+
+// Function to return the points response as its protocol buffer message.
+func (r PointsResponse) protoMessage() proto.Message {
+	return &receiptpb.PointsResponse{Points: int64(r.Points), RuleVersion: r.RuleVersion}
+}
+
+// Function to report whether a request body is given as protocol buffers.
+func isProtobufRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == protobufMediaType
+}
+
+// Function to convert a receipt message into the form receipts are decoded from.
+// Amounts are read like JSON string amounts, so they are checked exactly as in a JSON body.
+func protoWireReceipt(message *receiptpb.Receipt) *wireReceipt {
+	wire := &wireReceipt{
+		Retailer:     message.GetRetailer(),
+		Total:        textAmount(message.GetTotal()),
+		PurchaseDate: message.GetPurchaseDate(),
+		PurchaseTime: message.GetPurchaseTime(),
+		Items:        make([]wireItem, len(message.GetItems())),
+	}
+	for i, item := range message.GetItems() {
+		wire.Items[i] = wireItem{Description: item.GetShortDescription(), Price: textAmount(item.GetPrice())}
+	}
+	return wire
+}
+
+// Function to read a receipt from a protocol buffer request body, then validate and score it like a JSON one.
+func (s *Server) readProtobufReceipt(w http.ResponseWriter, body io.Reader) (*Receipt, bool) {
+	receipt, err := decodeProtobufReceipt(body, s.config.decodeOptions())
+	return s.checkReceipt(w, receipt, err, codeInvalidProtobuf, "Error parsing protobuf: ")
+}
+
+// Function to decode a receipt from a protocol buffer body holding a single Receipt message.
+func decodeProtobufReceipt(body io.Reader, opts decodeOptions) (*Receipt, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty body")
+	}
+
+	var message receiptpb.Receipt
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return protoWireReceipt(&message).receipt(opts)
+}
+
+// Function to write a protocol buffer response with the given HTTP status.
+func writeProtobuf(w http.ResponseWriter, status int, message proto.Message) {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error encoding response")
+		return
+	}
+
+	w.Header().Set("Content-Type", protobufMediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/receiptpb"
+)
+
+// Function to encode a protocol buffer message as a request body.
+func protobufBody(t testing.TB, message proto.Message) string {
+	t.Helper()
+
+	data, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Function to decode a protocol buffer response body into message, failing unless it is given as protocol buffers.
+func decodeProtobufBody(t *testing.T, resp *http.Response, message proto.Message) {
+	t.Helper()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != protobufMediaType {
+		t.Fatalf("%s %s: got Content-Type %q, want %s", resp.Request.Method, resp.Request.URL.Path, contentType, protobufMediaType)
+	}
+	if err := proto.Unmarshal([]byte(readBody(t, resp)), message); err != nil {
+		t.Fatalf("decoding %s %s response: %v", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+}
+
+func TestProtobufReceiptIsScoredAndAnsweredInProtobuf(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	resp := ts.do(t, "POST", "/receipts/process?includePoints=true", protobufBody(t, targetReceiptMessage()), "Content-Type", protobufMediaType, "Accept", protobufMediaType)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST protobuf: got %d, want 201: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var created receiptpb.ProcessReceiptResponse
+	decodeProtobufBody(t, resp, &created)
+	if created.GetId() == "" || created.Points == nil || created.GetPoints() != 28 {
+		t.Fatalf("POST protobuf: got %v, want an id and 28 points", &created)
+	}
+
+	resp = ts.do(t, "GET", "/receipts/"+created.GetId()+"/points", "", "Accept", protobufMediaType)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET points as protobuf: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var points receiptpb.PointsResponse
+	decodeProtobufBody(t, resp, &points)
+	if points.GetPoints() != 28 || points.GetRuleVersion() != defaultRuleVersion {
+		t.Fatalf("points as protobuf: got %v, want 28 under %s", &points, defaultRuleVersion)
+	}
+
+	//The receipt is stored as if it had been submitted as JSON.
+	asJSON := ts.submit(t, targetReceipt)
+	if got, want := ts.stored(t, created.GetId()), ts.stored(t, asJSON); !reflect.DeepEqual(receiptJSON(t, got), receiptJSON(t, want)) {
+		t.Fatalf("receipt submitted as protobuf stored as %+v, as JSON as %+v", got, want)
+	}
+}
+
+func TestProtobufPointsGiveTheRuleVersionAskedFor(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	for _, version := range []string{ruleVersionV1, ruleVersionV2} {
+		resp := ts.do(t, "GET", "/receipts/"+id+"/points?ruleVersion="+version, "", "Accept", protobufMediaType)
+		var points receiptpb.PointsResponse
+		decodeProtobufBody(t, resp, &points)
+		if points.GetRuleVersion() != version {
+			t.Errorf("points under %s: got %v", version, &points)
+		}
+	}
+}
+
+func TestProtobufMalformedReceiptsAreRejected(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	header := []string{"Content-Type", protobufMediaType}
+
+	for _, body := range []string{"", "\xff\xff\xff"} {
+		expectProblem(t, ts.do(t, "POST", "/receipts/process", body, header...), http.StatusBadRequest, codeInvalidProtobuf)
+	}
+
+	//A malformed amount is reported as in a JSON body.
+	message := targetReceiptMessage()
+	message.Items[2].Price = "1.2x"
+	fromProtobuf := expectProblem(t, ts.do(t, "POST", "/receipts/process", protobufBody(t, message), header...), http.StatusUnprocessableEntity, codeValidationFailed).Errors
+	fromJSON := ts.reject(t, strings.Replace(targetReceipt, `"1.26"`, `"1.2x"`, 1))
+	if len(fromJSON) != 1 || !reflect.DeepEqual(fromProtobuf, fromJSON) {
+		t.Fatalf("errors for a malformed price: got %+v as protobuf, %+v as JSON", fromProtobuf, fromJSON)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("store holds %v, want nothing", ids)
+	}
+}
+
+func BenchmarkDecodeReceipt(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		body   string
+		decode func(body *bytes.Reader) (*Receipt, error)
+	}{
+		{"json", targetReceipt, func(body *bytes.Reader) (*Receipt, error) { return decodeReceipt(body, decodeOptions{}) }},
+		{"protobuf", protobufBody(b, targetReceiptMessage()), func(body *bytes.Reader) (*Receipt, error) { return decodeProtobufReceipt(body, decodeOptions{}) }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			body := bytes.NewReader([]byte(bench.body))
+			for i := 0; i < b.N; i++ {
+				body.Seek(0, io.SeekStart)
+				if _, err := bench.decode(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Number of locks the receipt ids are spread over by receiptLocks.
+const receiptLockStripes = 64
+
+// Struct for locks held while a stored receipt is read, changed, and saved again, so two updates of
+// the same receipt can't interleave. Ids share a fixed set of locks by a hash of the id, so the locks
+// never need cleaning up and updates of different receipts rarely wait on each other.
+type receiptLocks struct {
+	stripes [receiptLockStripes]sync.Mutex
+}
+
+// Function to lock the given receipt id, returning the function that unlocks it.
+func (l *receiptLocks) lock(id string) func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	mu := &l.stripes[hash.Sum32()%receiptLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Struct for returning the outcome of recalculating the stored points given as JSON.
+type RecalculateResponse struct {
+	Processed  int   `json:"processed"`
+	Changed    int   `json:"changed"`
+	DurationMs int64 `json:"durationMs"`
+}
+
+// Function to handle requests to score every stored receipt again and store the points that changed,
+// for use after the rules have changed. Only receipts from the retailer given by the retailer parameter
+// are scored when it is given, matched as in a listing. The ids are read first and each receipt is then
+// read, scored, and saved under its own lock, so submissions carry on while it runs. Receipts removed
+// in the meantime are skipped.
+func (s *Server) recalculateHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	filter := listFilter{retailer: r.URL.Query().Get("retailer")}
+
+	var ids []string
+	err := s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		if filter.match(receipt) {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	response := RecalculateResponse{}
+	for _, id := range ids {
+		changed, err := s.recalculate(r.Context(), id, filter)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		response.Processed++
+		if changed {
+			response.Changed++
+		}
+	}
+
+	response.DurationMs = time.Since(start).Milliseconds()
+	log.Printf("recalculate: %d receipts scored, %d changed", response.Processed, response.Changed)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Function to score a stored receipt again, saving it when its points, or the rules that scored them, have changed.
+// Returns whether they changed. A receipt no longer meeting the filter is left as it is.
+func (s *Server) recalculate(ctx context.Context, id string, filter listFilter) (bool, error) {
+	unlock := s.locks.lock(id)
+	defer unlock()
+
+	stored, err := s.store.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if !filter.match(stored) {
+		return false, nil
+	}
+
+	//Stores may hand out the receipt they hold, so the update is scored and saved as a copy.
+	updated := *stored
+	if err := scoreReceipt(&updated); err != nil {
+		return false, fmt.Errorf("error calculating points for receipt %s: %w", id, err)
+	}
+	if stored.Points != nil && *stored.Points == *updated.Points && stored.RuleVersion == updated.RuleVersion {
+		return false, nil
+	}
+	updated.Revision++
+	return true, s.store.Save(ctx, id, &updated)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Function to recalculate the stored points on the server under test, with the given query, returning the outcome.
+func (ts *testServer) recalculate(t *testing.T, query string) RecalculateResponse {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/admin/recalculate"+query, "", adminHeader...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /admin/recalculate%s: got %d, want 200: %s", query, resp.StatusCode, readBody(t, resp))
+	}
+	var response RecalculateResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestRecalculateStoresPointsUnderTheChangedRules(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	corner := ts.submit(t, cornerReceipt)
+	target := ts.submit(t, targetReceipt)
+
+	//Changed rules leave the points scored on submission alone until the receipts are recalculated.
+	withPointsConfig(t, func(c *PointsConfig) { c.RoundDollarPoints = 100 })
+	if got := ts.points(t, corner); got != 109 {
+		t.Fatalf("points before recalculating: got %d, want the stored 109", got)
+	}
+	revision := ts.stored(t, corner).Revision
+
+	if got := ts.recalculate(t, ""); got.Processed != 2 || got.Changed != 1 {
+		t.Fatalf("recalculate: got %+v, want 2 processed and 1 changed", got)
+	}
+	if got := ts.points(t, corner); got != 159 {
+		t.Fatalf("points of the round dollar total: got %d, want 159", got)
+	}
+	if got := ts.points(t, target); got != 28 {
+		t.Fatalf("points of the receipt the change doesn't touch: got %d, want 28", got)
+	}
+	if got := ts.stored(t, corner).Revision; got != revision+1 {
+		t.Fatalf("revision after recalculating: got %d, want %d", got, revision+1)
+	}
+
+	//Nothing changes when the rules are the same as when the points were stored.
+	if got := ts.recalculate(t, ""); got.Processed != 2 || got.Changed != 0 {
+		t.Fatalf("recalculate again: got %+v, want 2 processed and nothing changed", got)
+	}
+}
+
+func TestRecalculateOnlyScoresTheGivenRetailer(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	corner := ts.submit(t, cornerReceipt)
+	other := ts.submit(t, datedReceipt("Walgreens", "2022-01-15"))
+	before := ts.points(t, other)
+
+	withPointsConfig(t, func(c *PointsConfig) { c.OddDayPoints = 60 })
+	if got := ts.recalculate(t, "?retailer=m%26m+corner+market"); got.Processed != 1 || got.Changed != 0 {
+		t.Fatalf("recalculate M&M Corner Market: got %+v, want 1 processed and nothing changed", got)
+	}
+	if got := ts.points(t, other); got != before {
+		t.Fatalf("points of another retailer's receipt: got %d, want the stored %d", got, before)
+	}
+	if got := ts.points(t, corner); got != 109 {
+		t.Fatalf("points of the even day receipt: got %d, want 109", got)
+	}
+}
+
+func TestRecalculateNeedsTheAdminToken(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	ts.submit(t, cornerReceipt)
+
+	withPointsConfig(t, func(c *PointsConfig) { c.RoundDollarPoints = 100 })
+	if resp := ts.do(t, "POST", "/admin/recalculate", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("POST without the token: got %d, want 401", resp.StatusCode)
+	}
+}
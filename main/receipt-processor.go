@@ -1,172 +1,738 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"math"
+	"io"
+	"log"
+	"net"
 	"net/http"
-	"regexp"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/HaysBr18/receipt-processor-challenge/main/buildinfo"
 	"github.com/gorilla/mux"
-	"github.com/twinj/uuid"
+	"google.golang.org/grpc"
 )
 
 // Struct for incoming recipt requests given as a JSON.
 type Receipt struct {
-	Retailer     string  `json:"retailer"`
-	Total        float64 `json:"total,string"`
-	PurchaseDate string  `json:"purchaseDate"`
-	PurchaseTime string  `json:"purchaseTime"`
-	Items        []Item  `json:"items,omitempty"`
+	Retailer     string  `json:"retailer" xml:"retailer"`
+	Total        *Amount `json:"total" xml:"total"`
+	PurchaseDate string  `json:"purchaseDate" xml:"purchaseDate"`
+	PurchaseTime string  `json:"purchaseTime" xml:"purchaseTime"`
+	Items        []Item  `json:"items" xml:"items>item"`
+
+	//Points scored when the receipt was submitted, nil for receipts stored before scores were kept.
+	//Never read from request bodies, which are decoded through wireReceipt.
+	Points *int `json:"points,omitempty" xml:"points,omitempty"`
+
+	//When the receipt was first submitted, nil for receipts stored before submission times were kept.
+	CreatedAt *time.Time `json:"createdAt,omitempty" xml:"createdAt,omitempty"`
+
+	//Revision of the stored receipt, 1 when first stored and increased by every change to it,
+	//0 for receipts stored before revisions were kept.
+	Revision int64 `json:"revision,omitempty" xml:"revision,omitempty"`
+
+	//Version of the rule set Points were scored with, empty for receipts stored before rule versions were kept.
+	RuleVersion string `json:"ruleVersion,omitempty" xml:"ruleVersion,omitempty"`
 }
 
 // Struct for list items from receipt processing requests given as JSON.
 type Item struct {
-	Description string  `json:"shortDescription"`
-	Price       float64 `json:"price,string"`
+	Description string  `json:"shortDescription" xml:"shortDescription"`
+	Price       *Amount `json:"price" xml:"price"`
 }
 
-// Struct for returning a newly generated receipt id given as JSON.
+// Struct for returning a newly generated receipt id given as JSON or XML.
+// Points are only given to clients that ask for them when submitting a receipt.
 type ReceiptResponse struct {
-	ID string `json:"id"`
+	XMLName xml.Name `json:"-" xml:"receiptResponse"`
+	ID      string   `json:"id" xml:"id"`
+	Points  *int     `json:"points,omitempty" xml:"points,omitempty"`
+
+	//Given as pending when the receipt was accepted to be scored in the background.
+	Status string `json:"status,omitempty" xml:"status,omitempty"`
+
+	Links *ReceiptLinks `json:"links,omitempty" xml:"links,omitempty"`
 }
 
-// Struct for returning the calculated points given a receipt object.
+// Struct for returning a stored receipt along with its id given as JSON or XML.
+type ReceiptDocument struct {
+	XMLName xml.Name `json:"-" xml:"receipt"`
+	ID      string   `json:"id" xml:"id"`
+
+	//Whether the receipt is still pending, waiting to be scored in the background, failed to be scored there,
+	//or done, given when the receipt is looked up on its own.
+	Status string `json:"status,omitempty" xml:"status,omitempty"`
+	*Receipt
+}
+
+// Struct for returning the calculated points given a receipt object, as JSON or XML.
+// RuleVersion is the version of the rule set the points were scored with, given whenever it is known.
 type PointsResponse struct {
-	Points int `json:"points"`
+	XMLName     xml.Name `json:"-" xml:"pointsResponse"`
+	Points      int      `json:"points" xml:"points"`
+	RuleVersion string   `json:"ruleVersion,omitempty" xml:"ruleVersion,omitempty"`
+}
+
+// Struct for returning the calculated points along with what each rule contributed, under the rule set version given.
+type PointsBreakdownResponse struct {
+	Points      int                  `json:"points"`
+	RuleVersion string               `json:"ruleVersion"`
+	Breakdown   []PointsContribution `json:"breakdown"`
 }
 
-var receipts = make(map[string]*Receipt)
+// Layouts for the purchase date and time given on a receipt.
+const (
+	dateFormat = "2006-01-02"
+	timeFormat = "15:04"
+)
+
+// How long the server waits for requests in flight to finish when shutting down.
+const shutdownTimeout = 5 * time.Second
 
 // Function to handle receipt requests.
-func processReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+// With includePoints=true or a Prefer: return=points header the response also gives the points the receipt scored.
+// When the server runs with -async or the request carries Prefer: respond-async, the receipt is only validated
+// before a 202 gives its id with the status pending, and it is scored and stored in the background.
+func (s *Server) processReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	includePoints, err := wantsPoints(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	//Retries carrying an Idempotency-Key get the id from the first request with that key and body.
+	body := io.Reader(r.Body)
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key != "" {
+		data, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, codeInvalidJSON, "Error reading request body: "+err.Error())
+			return
+		}
+
+		id, err := s.idempotency.begin(key, data, s.clock.Now())
+		if err != nil {
+			writeProblem(w, http.StatusConflict, codeIdempotencyConflict, err.Error())
+			return
+		}
+		if id != "" {
+			if _, pending := s.async.lookup(id); pending {
+				s.writeAccepted(w, r, id)
+				return
+			}
+			if failure, failed := s.async.failure(id); failed {
+				writeProblem(w, http.StatusInternalServerError, codeScoringFailed, failure.message(id))
+				return
+			}
+			var points *int
+			if includePoints {
+				points = s.pointsOf(r.Context(), id)
+			}
+			s.writeCreated(w, r, id, points)
+			return
+		}
+
+		//Release the key unless a receipt is stored under it, so a failed request can be retried.
+		defer s.idempotency.release(key)
+		body = bytes.NewReader(data)
+	}
+
+	if s.wantsAsync(r) {
+		s.acceptReceipt(w, r, body, key)
+		return
+	}
+
+	//Parse, validate, and score the receipt given in the request, as JSON, XML, or protocol buffers.
+	readReceipt := s.readReceipt
+	if isXMLRequest(r) {
+		readReceipt = s.readXMLReceipt
+	}
+	if isProtobufRequest(r) {
+		readReceipt = s.readProtobufReceipt
+	}
+	receipt, ok := readReceipt(w, body)
+	if !ok {
+		return
+	}
+
+	//Store the receipt object under a newly generated id, recording when it was submitted.
+	id, created, err := s.storeNewReceipt(r.Context(), receipt)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if key != "" {
+		s.idempotency.finish(key, id)
+	}
+
+	//A duplicate of a stored receipt created nothing, so it is answered with the stored receipt's id and points.
+	if !created {
+		var points *int
+		if includePoints {
+			points = s.pointsOf(r.Context(), id)
+		}
+		s.writeExisting(w, r, id, points)
+		return
+	}
+
+	//Send the response, with the points scored above when they were asked for.
+	var points *int
+	if includePoints {
+		points = receipt.Points
+	}
+	s.writeCreated(w, r, id, points)
+}
+
+// Function to report whether a receipt submission asks for the points in the response,
+// with the includePoints parameter or a Prefer: return=points header.
+func wantsPoints(r *http.Request) (bool, error) {
+	if value := r.URL.Query().Get("includePoints"); value != "" {
+		include, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid includePoints %q: expected true or false", value)
+		}
+		return include, nil
+	}
+	return hasPreference(r, "return=points"), nil
+}
+
+// Function to report whether a request's Prefer headers include the given preference, ignoring case.
+func hasPreference(r *http.Request, preference string) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, given := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(given), preference) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Function to look up the points a stored receipt scored, or nil if they can't be found,
+// for responses where points are a convenience rather than the point of the request.
+func (s *Server) pointsOf(ctx context.Context, id string) *int {
+	receipt, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil
+	}
+	points, err := storedPoints(receipt)
+	if err != nil {
+		return nil
+	}
+	return &points
+}
+
+// Function to write the response to a receipt submission, a 201 pointing at the stored receipt with its id in the body.
+// Retries with an Idempotency-Key get the same response as the first submission.
+// The location keeps any version prefix the receipt was submitted under.
+func (s *Server) writeCreated(w http.ResponseWriter, r *http.Request, id string, points *int) {
+	links := s.receiptLinks(r, id)
+	w.Header().Set("Location", links.Self)
+	writeResponse(w, r, http.StatusCreated, ReceiptResponse{ID: id, Points: points, Links: links})
+}
+
+// Function to write the response to a submission duplicating a stored receipt, a 200 with the stored receipt's id.
+func (s *Server) writeExisting(w http.ResponseWriter, r *http.Request, id string, points *int) {
+	writeResponse(w, r, http.StatusOK, ReceiptResponse{ID: id, Points: points, Links: s.receiptLinks(r, id)})
+}
+
+// Function to read a receipt from a JSON request body, then validate and score it.
+// On failure the problem response is written and false is returned.
+func (s *Server) readReceipt(w http.ResponseWriter, body io.Reader) (*Receipt, bool) {
 
 	//Parse given JSON from the request.
-	var receipt Receipt
-	err := json.NewDecoder(r.Body).Decode(&receipt)
+	receipt, err := decodeReceipt(body, s.config.decodeOptions())
+	return s.checkReceipt(w, receipt, err, codeInvalidJSON, "Error parsing JSON: ")
+}
+
+// Function to read a receipt from an XML request body, then validate and score it like a JSON one.
+func (s *Server) readXMLReceipt(w http.ResponseWriter, body io.Reader) (*Receipt, bool) {
+	receipt, err := decodeXMLReceipt(body, s.config.decodeOptions())
+	return s.checkReceipt(w, receipt, err, codeInvalidXML, "Error parsing XML: ")
+}
+
+// Function to check the outcome of decoding a receipt, then validate and score it. Bodies that could not
+// be parsed at all are reported with the given code and message prefix.
+// On failure the problem response is written and false is returned.
+func (s *Server) checkReceipt(w http.ResponseWriter, receipt *Receipt, err error, invalidCode string, invalidPrefix string) (*Receipt, bool) {
+	errs, err := s.checkDecoded(receipt, err)
+	if err != nil {
+		writeDecodeError(w, err, invalidCode, invalidPrefix)
+		return nil, false
+	}
+
+	//Reject the receipt with every problem found if it is not valid.
+	if len(errs) > 0 {
+		writeValidationProblem(w, errs)
+		return nil, false
+	}
+
+	return receipt, true
+}
+
+// Error wrapped around any failure to score a receipt that passed validation.
+var errScoring = errors.New("error calculating points")
+
+// Function to check the outcome of decoding a receipt, then validate and score it, for every endpoint that reads receipts.
+// Returns every field at fault, or the decoding error if the body could not be read or parsed at all,
+// or errScoring if a valid receipt could not be scored.
+func (s *Server) checkDecoded(receipt *Receipt, err error) ([]FieldError, error) {
+	var badAmounts *amountFormatError
+	if errors.As(err, &badAmounts) {
+		return badAmounts.Errors, nil
+	}
 	if err != nil {
-		http.Error(w, "Error parsing JSON", http.StatusBadRequest)
+		return nil, err
+	}
+
+	errs, err := s.validateAndScore(receipt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errScoring, err)
+	}
+	return errs, nil
+}
+
+// Function to write the problem response for a receipt body that could not be checked.
+// Bodies that could not be parsed at all are reported with the given code and message prefix.
+func writeDecodeError(w http.ResponseWriter, err error, invalidCode string, invalidPrefix string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeProblem(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+	case errors.Is(err, errScoring):
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+	default:
+		writeProblem(w, http.StatusBadRequest, invalidCode, invalidPrefix+err.Error())
+	}
+}
+
+// Function to validate a decoded receipt and score it, setting its points, for every way receipts are submitted.
+// Returns every validation problem found, or an error if a valid receipt could not be scored.
+func (s *Server) validateAndScore(receipt *Receipt) ([]FieldError, error) {
+	if errs := receipt.Validate(s.config, s.clock.Now()); len(errs) > 0 {
+		return errs, nil
+	}
+
+	//Score the receipt once now, it is scored again whenever it is replaced.
+	return nil, scoreReceipt(receipt)
+}
+
+// Struct for returning whether a receipt is valid given as JSON or XML, with every field at fault when it is not.
+type ValidationResponse struct {
+	XMLName xml.Name     `json:"-" xml:"validationResponse"`
+	Valid   bool         `json:"valid" xml:"valid"`
+	Errors  []FieldError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// Function to handle requests to check a receipt without storing it, given as a JSON or XML.
+// The receipt goes through the same decoding and validation as a submitted one, so a receipt found valid here
+// is accepted when submitted. Invalid receipts still get a 200, listing every field at fault; only bodies
+// that can't be parsed at all get a problem response. No id is made and the store is not touched.
+func (s *Server) validateReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	decode, invalidCode, invalidPrefix := decodeReceipt, codeInvalidJSON, "Error parsing JSON: "
+	if isXMLRequest(r) {
+		decode, invalidCode, invalidPrefix = decodeXMLReceipt, codeInvalidXML, "Error parsing XML: "
+	}
+
+	receipt, err := decode(r.Body, s.config.decodeOptions())
+	errs, err := s.checkDecoded(receipt, err)
+	if err != nil {
+		writeDecodeError(w, err, invalidCode, invalidPrefix)
+		return
+	}
+	writeResponse(w, r, http.StatusOK, ValidationResponse{Valid: len(errs) == 0, Errors: errs})
+}
+
+// Function to handle requests to score a receipt without storing it, given as a JSON.
+// The receipt is read, validated, and scored exactly as a submitted one, but no id is made and the store is
+// not touched. With breakdown=true the response also gives what each rule contributed. The ruleVersion
+// parameter picks the rule set it is scored with, the one submitted receipts are scored with by default.
+func (s *Server) scoreReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	set, err := lookupRuleSet(r.URL.Query().Get("ruleVersion"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
 		return
 	}
 
-	// Generate a unique ID.
-	id := uuid.NewV4().String()
+	breakdown := false
+	if value := r.URL.Query().Get("breakdown"); value != "" {
+		var err error
+		if breakdown, err = strconv.ParseBool(value); err != nil {
+			writeProblem(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("invalid breakdown %q: expected true or false", value))
+			return
+		}
+	}
 
-	//generate a response JSON body.
-	response := ReceiptResponse{ID: id}
+	receipt, ok := s.readReceipt(w, r.Body)
+	if !ok {
+		return
+	}
 
-	//Store the receipt object in the receipts map using the generated id as the key.
-	receipts[id] = &receipt
+	if !breakdown {
+		points := *receipt.Points
+		if set.Version != defaultRuleVersion {
+			if points, err = set.Score(receipt); err != nil {
+				writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, PointsResponse{Points: points, RuleVersion: set.Version})
+		return
+	}
 
-	//Send the response.
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	response, err := pointsBreakdown(set, receipt)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 // Function to handle points response given a receipt id.
-func getPointsHandler(w http.ResponseWriter, r *http.Request) {
+// The points scored when the receipt was submitted are returned, unless the ruleVersion parameter names a rule set
+// to score it with again. The response says which version the points were scored with, unless they were stored
+// before rule versions were kept.
+func (s *Server) getPointsHandler(w http.ResponseWriter, r *http.Request) {
 
 	//Parameters for request r.
 	params := mux.Vars(r)
 
-	//Extract the id from the request parameters.
-	id := params["id"]
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(params["id"])
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
+	}
+
+	ruleVersion := r.URL.Query().Get("ruleVersion")
+	set, err := lookupRuleSet(ruleVersion)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
 
-	//See if the receipt exists in the receipts map.
-	receipt, exists := receipts[id]
-	if !exists {
-		http.Error(w, "Receipt not found", http.StatusNotFound)
+	if s.writeUnscored(w, id) {
 		return
 	}
 
-	//Calculate points based on established rules.
-	points := calculatePoints(receipt)
+	//See if the receipt exists in the store.
+	receipt, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	//Use the points scored on submission, calculating them only for receipts stored without a score
+	//or when a rule set is asked for.
+	points, err := storedPoints(receipt)
+	version := receipt.RuleVersion
+	if receipt.Points == nil {
+		version = defaultRuleVersion
+	}
+	if ruleVersion != "" {
+		points, err = set.Score(receipt)
+		version = set.Version
+	}
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+		return
+	}
+
+	//Clients polling with the tag of the points they already have get an empty 304.
+	etag := pointsETag(id, points, version, responseFormat(r))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Add("Vary", "Accept")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
 	//Spin up a response body in JSON.
-	response := PointsResponse{Points: points}
+	response := PointsResponse{Points: points, RuleVersion: version}
 
 	//Send the response.
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, r, http.StatusOK, response)
 }
 
-// Function to calculate the points given a receipt.
-func calculatePoints(receipt *Receipt) int {
-	//Regular expression to trim non-alphanumeric characters from retailer string.
-	var nonAlphanumericRegex = regexp.MustCompile(`[^\p{L}\p{N} ]+`)
+// Function to handle requests for a stored receipt given a receipt id.
+func (s *Server) getReceiptHandler(w http.ResponseWriter, r *http.Request) {
 
-	//Trim all non-alphanumeric characters from retailer string and trim all whitespace.
-	var length = strings.TrimSpace(nonAlphanumericRegex.ReplaceAllString(receipt.Retailer, ""))
-	length = strings.Replace(length, " ", "", -1)
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(mux.Vars(r)["id"])
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
+	}
 
-	//Calculate points based on length of trimmed retailer name string.
-	var points = len(length)
+	//Receipts still waiting to be scored in the background are sent as they were submitted.
+	if receipt, pending := s.async.lookup(id); pending {
+		w.Header().Set("Retry-After", pendingRetryAfter)
+		writeResponse(w, r, http.StatusOK, ReceiptDocument{ID: id, Status: statusPending, Receipt: receipt})
+		return
+	}
+	if failure, failed := s.async.failure(id); failed {
+		writeResponse(w, r, http.StatusOK, ReceiptDocument{ID: id, Status: statusFailed, Receipt: failure.receipt})
+		return
+	}
 
-	//If the total purchase amount is an even dollar ammount, add 50 points.
-	if receipt.Total == math.Trunc(receipt.Total) {
-		points += 50
+	//See if the receipt exists in the store.
+	receipt, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
 
-	//If the total purchase amount is a factor of 0.25, add 25 points.
-	if math.Mod(receipt.Total, 0.25) == 0 {
-		points += 25
+	//Send the receipt as it is stored and scored, tagged with its revision for updates to give back in If-Match.
+	w.Header().Set("ETag", revisionETag(receipt.Revision))
+	writeResponse(w, r, http.StatusOK, ReceiptDocument{ID: id, Status: statusDone, Receipt: receipt})
+}
+
+// Function to handle requests to replace a stored receipt given a receipt id.
+// The new receipt is validated and scored like a newly submitted one, though under the rules the stored receipt
+// was scored with. Unknown ids are not created.
+// An If-Match header must match the stored revision, see checkIfMatch.
+func (s *Server) putReceiptHandler(w http.ResponseWriter, r *http.Request) {
+
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(mux.Vars(r)["id"])
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
 	}
 
-	//5 points for every two items on the receipt.
-	points += (len(receipt.Items) / 2) * 5
+	//Parse, validate, and score the replacement receipt.
+	receipt, ok := s.readReceipt(w, r.Body)
+	if !ok {
+		return
+	}
 
-	//If the trimmed length of the item description is a multiple of 3, multiply the price by 0.2 and round up to the nearest integer
-	// The result is the number of points earned.
-	for i := 0; i < len(receipt.Items); i++ {
-		if len(strings.TrimSpace(receipt.Items[i].Description))%3 == 0 {
-			points += int(math.Ceil(receipt.Items[i].Price * 0.2))
-		}
+	//Only receipts that exist can be replaced, and they keep the time they were first submitted.
+	unlock := s.locks.lock(id)
+	defer unlock()
+	stored, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !s.checkIfMatch(w, r, stored) {
+		return
 	}
+	if err := keepRuleVersion(stored, receipt); err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+		return
+	}
+	receipt.CreatedAt = stored.CreatedAt
+	receipt.Revision = stored.Revision + 1
 
-	//Date format.
-	format := "2006-01-02"
+	//Replace the stored receipt and the points stored with it.
+	if err := s.store.Save(r.Context(), id, receipt); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.indexReplaced(id, receipt)
 
-	after, err := time.Parse("15:04", "14:00")
-	before, err := time.Parse("15:04", "16:00")
+	w.Header().Set("ETag", revisionETag(receipt.Revision))
+	writeJSON(w, http.StatusOK, ReceiptResponse{ID: id, Links: s.receiptLinks(r, id)})
+}
 
-	purchaseTime, err := time.Parse("15:04", receipt.PurchaseTime)
-	purchaseDate, err := time.Parse(format, receipt.PurchaseDate)
-	fmt.Println(purchaseDate)
+// Function to handle requests to remove a stored receipt given a receipt id.
+func (s *Server) deleteReceiptHandler(w http.ResponseWriter, r *http.Request) {
 
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(mux.Vars(r)["id"])
 	if err != nil {
-		fmt.Println(err)
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
 	}
 
-	//6 points if the day in the purchase date is odd.
-	if purchaseDate.Day()%2 != 0 {
-		points += 6
+	//Remove the receipt, and the points stored with it, from the store, so resubmitting it stores it afresh.
+	if err := s.store.Delete(r.Context(), id); err != nil {
+		writeStoreError(w, err)
+		return
 	}
+	s.hashes.forget(id)
 
-	// 10 points if the time of purchase is after 2:00pm and before 4:00pm.
-	if purchaseTime.After(after) && purchaseTime.Before(before) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Function to handle requests for how the points of a stored receipt were scored given a receipt id.
+// The receipt is scored again rule by rule under the current rules, or the rule set the ruleVersion parameter
+// names, and the total is the sum of the rules. Receipts accepted for scoring in the background have no breakdown
+// until they are stored, and are answered like their points, see writeUnscored.
+func (s *Server) getPointsBreakdownHandler(w http.ResponseWriter, r *http.Request) {
+
+	//Extract the id from the request parameters, rejecting anything that could not be a receipt id.
+	id, err := parseReceiptID(mux.Vars(r)["id"])
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidID, err.Error())
+		return
+	}
+
+	set, err := lookupRuleSet(r.URL.Query().Get("ruleVersion"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	if s.writeUnscored(w, id) {
+		return
+	}
+
+	//See if the receipt exists in the store.
+	receipt, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	breakdown, err := pointsBreakdown(set, receipt)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error calculating points")
+		return
+	}
+	writeJSON(w, http.StatusOK, breakdown)
+}
 
-		points += 10
+// Function to answer for a receipt accepted for scoring in the background that has no points to give,
+// returning whether it did. Receipts still waiting to be scored get a 409 with a Retry-After, and receipts
+// that failed to be scored, which never will be and are never stored, get a 500 saying why.
+func (s *Server) writeUnscored(w http.ResponseWriter, id string) bool {
+	if _, pending := s.async.lookup(id); pending {
+		w.Header().Set("Retry-After", pendingRetryAfter)
+		writeProblem(w, http.StatusConflict, codeReceiptPending, "Receipt "+id+" is still being scored")
+		return true
+	}
+	if failure, failed := s.async.failure(id); failed {
+		writeProblem(w, http.StatusInternalServerError, codeScoringFailed, failure.message(id))
+		return true
 	}
+	return false
+}
+
+// Function to write a JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 
-	return points
+	//Leave characters such as & in retailer names as they were submitted.
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
 }
 
 func main() {
 
-	//Implement a new HTTP request router r.
-	r := mux.NewRouter()
+	//Parse the server configuration from the command line.
+	config := defaultConfig()
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if config.RulesConfig != "" {
+		loaded, err := loadPointsConfig(config.RulesConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pointsConfig = loaded
+	}
+	if err := pointsConfig.applyEnv(); err != nil {
+		log.Fatal(err)
+	}
+	defaultRuleVersion = config.RuleVersion
 
-	//Handle any new receipt request (POST) given as a JSON.
-	r.HandleFunc("/receipts/process", processReceiptsHandler).Methods("POST")
+	log.Printf("receipt processor %s, %s store", buildinfo.Get(), config.Store)
 
-	//Handle any new points request given a valid receipt id.
-	r.HandleFunc("/receipts/{id}/points", getPointsHandler).Methods("GET")
+	//Open the configured receipt store.
+	store, closeStore, err := openStore(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := closeStore(); err != nil {
+			log.Printf("closing store: %v", err)
+		}
+	}()
+
+	//Serve every endpoint from the receipt store.
+	registerStoreMetrics(store)
+	server := NewServer(config, store)
+	httpServer := &http.Server{Addr: ":3000", Handler: server.Handler()}
+
+	//End event streams on shutdown, they would otherwise hold it up until the timeout.
+	httpServer.RegisterOnShutdown(server.events.Close)
 
-	http.Handle("/", r)
+	//Stop accepting requests on SIGINT or SIGTERM, so the store is closed cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	//Listen and service any request on port 3000.
-	fmt.Println("Server listening on port 3000...")
-	http.ListenAndServe(":3000", nil)
+	go func() {
+		fmt.Println("Server listening on port 3000...")
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Print(err)
+			stop()
+		}
+	}()
+
+	//Serve the gRPC service from the same store when it is enabled.
+	var grpcServer *grpc.Server
+	if config.GRPCAddr != "" {
+		listener, err := net.Listen("tcp", config.GRPCAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer = server.GRPCServer()
+		go func() {
+			log.Printf("gRPC listening on %s", listener.Addr())
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Print(err)
+				stop()
+			}
+		}()
+	}
+	<-ctx.Done()
+
+	//Give requests in flight a few seconds to finish before the store is closed.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if grpcServer != nil {
+		go func() {
+			<-shutdownCtx.Done()
+			grpcServer.Stop()
+		}()
+		grpcServer.GracefulStop()
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Print(err)
+	}
+
+	//Shutting down leaves websocket sessions open, so tell their clients the server is going away.
+	server.sockets.Close()
+
+	//Score and store every receipt already accepted before the store is closed, no more can be accepted now.
+	server.async.Close()
+
+	//Deliver the notifications already queued while the rest of the shutdown allows.
+	if server.webhooks != nil {
+		deadline, _ := shutdownCtx.Deadline()
+		server.webhooks.Close(time.Until(deadline))
+	}
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Fields of a submitted receipt that its stored document must give back unchanged.
+var semanticFields = []string{"retailer", "purchaseDate", "purchaseTime", "items", "total"}
+
+func TestGetReceiptGivesBackTheSubmittedFields(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, body := range []string{targetReceipt, cornerReceipt} {
+		id := ts.submit(t, body)
+		resp := ts.do(t, "GET", "/receipts/"+id, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /receipts/%s: got %d, want 200", id, resp.StatusCode)
+		}
+		var submitted, document map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(body), &submitted); err != nil {
+			t.Fatal(err)
+		}
+		decodeBody(t, resp, &document)
+
+		var documentID string
+		if err := json.Unmarshal(document["id"], &documentID); err != nil || documentID != id {
+			t.Fatalf("document id: got %s, want %q", document["id"], id)
+		}
+		for _, field := range semanticFields {
+			if string(document[field]) != string(submitted[field]) {
+				t.Errorf("%s: got %s, want %s", field, document[field], submitted[field])
+			}
+		}
+	}
+}
+
+func TestGetReceiptRejectsUnknownAndMalformedIDs(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+newReceiptID(), ""), http.StatusNotFound, codeNotFound)
+	expectProblem(t, ts.do(t, "GET", "/receipts/not-a-receipt-id", ""), http.StatusBadRequest, codeInvalidID)
+	expectProblem(t, ts.do(t, "GET", "/receipts/not-a-receipt-id/points", ""), http.StatusBadRequest, codeInvalidID)
+}
+
+func TestDeletedReceiptIsNotFound(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	kept := ts.submit(t, cornerReceipt)
+
+	if resp := ts.do(t, "DELETE", "/receipts/"+id, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: got %d, want 204: %s", resp.StatusCode, readBody(t, resp))
+	}
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id+"/points", ""), http.StatusNotFound, codeNotFound)
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id, ""), http.StatusNotFound, codeNotFound)
+	expectProblem(t, ts.do(t, "DELETE", "/receipts/"+id, ""), http.StatusNotFound, codeNotFound)
+
+	if got := ts.points(t, kept); got != 109 {
+		t.Fatalf("points of the receipt not deleted: got %d, want 109", got)
+	}
+	expectProblem(t, ts.do(t, "DELETE", "/receipts/"+newReceiptID(), ""), http.StatusNotFound, codeNotFound)
+}
+
+func TestPutIsReflectedInThePoints(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points before the PUT: got %d, want 28", got)
+	}
+
+	resp := ts.do(t, "PUT", "/receipts/"+id, cornerReceipt)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response ReceiptResponse
+	decodeBody(t, resp, &response)
+	if response.ID != id {
+		t.Fatalf("PUT answered with %s, want %s", response.ID, id)
+	}
+	if got := ts.points(t, id); got != 109 {
+		t.Fatalf("points after the PUT: got %d, want 109", got)
+	}
+	if stored := ts.stored(t, id); stored.Retailer != "M&M Corner Market" {
+		t.Fatalf("stored retailer after the PUT: got %q", stored.Retailer)
+	}
+}
+
+func TestPutIsValidatedLikeASubmission(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	invalid := strings.Replace(targetReceipt, `"total":"35.35"`, `"total":"-35.35"`, 1)
+	expectProblem(t, ts.do(t, "PUT", "/receipts/"+id, invalid), http.StatusUnprocessableEntity, codeValidationFailed)
+	expectProblem(t, ts.do(t, "PUT", "/receipts/"+id, `{"retailer":`), http.StatusBadRequest, codeInvalidJSON)
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after rejected PUTs: got %d, want 28", got)
+	}
+
+	//PUT replaces receipts, it doesn't create them.
+	unknown := newReceiptID()
+	expectProblem(t, ts.do(t, "PUT", "/receipts/"+unknown, cornerReceipt), http.StatusNotFound, codeNotFound)
+	if ids := storedIDs(t, ts.store); !equalIDs(ids, []string{id}) {
+		t.Fatalf("store holds %v, want [%s]", ids, id)
+	}
+}
+
+func TestProcessGivesPointsOnlyWhenAskedAndStoresTheSame(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	//By default the response gives the id, and the links added since, but no points.
+	resp := ts.do(t, "POST", "/receipts/process", targetReceipt)
+	body := readBody(t, resp)
+	var plain ReceiptResponse
+	if err := json.Unmarshal([]byte(body), &plain); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"` + plain.ID + `","links":{"self":"/receipts/` + plain.ID + `","points":"/receipts/` + plain.ID + `/points","breakdown":"/receipts/` + plain.ID + `/points/breakdown"}}` + "\n"
+	if resp.StatusCode != http.StatusCreated || body != want {
+		t.Fatalf("POST without includePoints: got %d %s, want 201 %s", resp.StatusCode, body, want)
+	}
+
+	ids := []string{plain.ID}
+	for _, request := range []struct {
+		path   string
+		header []string
+	}{
+		{"/receipts/process?includePoints=true", nil},
+		{"/receipts/process", []string{"Prefer", "return=points"}},
+		{"/receipts/process?includePoints=false", []string{"Prefer", "return=points"}},
+	} {
+		resp := ts.do(t, "POST", request.path, targetReceipt, request.header...)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s %v: got %d, want 201", request.path, request.header, resp.StatusCode)
+		}
+		var created ReceiptResponse
+		decodeBody(t, resp, &created)
+		asked := !strings.Contains(request.path, "false")
+		switch {
+		case asked && (created.Points == nil || *created.Points != ts.points(t, created.ID)):
+			t.Errorf("POST %s %v: got points %v, want those GET points gives", request.path, request.header, created.Points)
+		case !asked && created.Points != nil:
+			t.Errorf("POST %s %v: got points %d, want none as includePoints=false wins", request.path, request.header, *created.Points)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	//Asking for the points changes nothing stored.
+	stored := make([]string, len(ids))
+	for i, id := range ids {
+		receipt, err := ts.store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored[i] = string(data)
+		if stored[i] != stored[0] {
+			t.Errorf("stored receipt %s: got %s, want %s as stored without points asked for", id, stored[i], stored[0])
+		}
+	}
+}
+
+func TestProcessAnswersCreatedWithTheReceiptsLocation(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, prefix := range []string{"", "/v1"} {
+		resp := ts.do(t, "POST", prefix+"/receipts/process", targetReceipt)
+		var created ReceiptResponse
+		decodeBody(t, resp, &created)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s/receipts/process: got %d, want 201", prefix, resp.StatusCode)
+		}
+		if location := resp.Header.Get("Location"); created.ID == "" || location != prefix+"/receipts/"+created.ID {
+			t.Fatalf("POST %s/receipts/process: got Location %q for id %q, want %s/receipts/ and the id", prefix, location, created.ID, prefix)
+		}
+
+		var document ReceiptDocument
+		decodeBody(t, ts.do(t, "GET", resp.Header.Get("Location"), ""), &document)
+		if document.ID != created.ID || document.Retailer != "Target" {
+			t.Fatalf("GET %s: got %+v, want the receipt created", resp.Header.Get("Location"), document)
+		}
+	}
+}
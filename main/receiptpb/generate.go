@@ -0,0 +1,5 @@
+// Package receiptpb holds the protocol buffer messages and gRPC service of the receipt processor,
+// generated from receipt.proto.
+package receiptpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative receipt.proto
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Modes for restoring a backup, keeping the stored receipts it doesn't hold or removing them.
+const (
+	restoreMerge   = "merge"
+	restoreReplace = "replace"
+)
+
+// Struct for returning the outcome of a restore given as JSON.
+// Failures lists every record that could not be restored, with its line in the backup.
+type RestoreResponse struct {
+	Restored int            `json:"restored"`
+	Failed   int            `json:"failed"`
+	Removed  int            `json:"removed"`
+	Failures []ImportResult `json:"failures"`
+}
+
+// Function to handle requests to restore a backup made by /admin/backup, given as the gzip compressed file.
+// The backup is decoded as it is read, never held whole: its records are spooled to a temporary file while their
+// count and checksum are taken, and nothing is restored unless every line was read and the manifest matches,
+// so a damaged or cut short backup leaves the store as it was. The spooled records are then each checked and
+// stored under their own lock like an imported line, replacing any receipt stored under its id, so requests
+// served meanwhile see each receipt either as it was or as restored. With mode=replace the stored receipts
+// the backup doesn't hold are removed too once every record has been restored.
+func (s *Server) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = restoreMerge
+	}
+	if mode != restoreMerge && mode != restoreReplace {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("invalid mode %q: expected %s or %s", mode, restoreMerge, restoreReplace))
+		return
+	}
+
+	//The compressed body is not limited, the backup is limited to -max-restore-bytes once decompressed instead,
+	//so a small body can't expand without bound.
+	decompressed, err := gzip.NewReader(r.Body)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidBackup, "Error reading backup: "+err.Error())
+		return
+	}
+	backup := http.MaxBytesReader(w, decompressed, s.config.MaxRestoreBytes)
+
+	spool, err := os.CreateTemp("", "restore-*.ndjson")
+	if err != nil {
+		log.Printf("restore: creating spool file: %v", err)
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error spooling backup")
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	var tooLarge *http.MaxBytesError
+	if reason, err := spoolBackup(backup, spool, int(s.config.MaxBodyBytes)); errors.As(err, &tooLarge) {
+		log.Printf("restore: nothing restored: %v", err)
+		writeProblem(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("backup exceeds %d bytes once decompressed; nothing was restored", tooLarge.Limit))
+		return
+	} else if err != nil {
+		log.Printf("restore: spooling backup: %v", err)
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error spooling backup")
+		return
+	} else if reason != "" {
+		log.Printf("restore: nothing restored: %s", reason)
+		writeProblem(w, http.StatusUnprocessableEntity, codeInvalidBackup, reason+"; nothing was restored")
+		return
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		log.Printf("restore: rewinding spool file: %v", err)
+		writeProblem(w, http.StatusInternalServerError, codeInternal, "Error spooling backup")
+		return
+	}
+
+	//Every record line was read back once already, so lines fit the buffer.
+	scanner := bufio.NewScanner(spool)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(s.config.MaxBodyBytes))
+
+	response := RestoreResponse{Failures: []ImportResult{}}
+	inBackup := make(map[string]bool)
+	line := 0
+	for scanner.Scan() {
+		line++
+		result := s.importLine(r.Context(), scanner.Bytes(), importOverwrite)
+		result.Line = line
+		if result.ID != "" {
+			inBackup[result.ID] = true
+		}
+		if result.Status != "imported" {
+			response.Failed++
+			response.Failures = append(response.Failures, result)
+			continue
+		}
+		response.Restored++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("restore: reading spool file: %v", err)
+		writeProblem(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Error reading spooled backup after restoring %d receipts", response.Restored))
+		return
+	}
+
+	if mode == restoreReplace {
+		removed, err := s.removeReceiptsNotIn(r, inBackup)
+		response.Removed = removed
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	log.Printf("restore: %d receipts restored, %d failed, %d removed", response.Restored, response.Failed, response.Removed)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Function to copy the record lines of a decompressed backup to the spool, checking them against the manifest
+// on the last line. Returns why the backup can't be restored, or an empty reason if it matches its manifest;
+// the error is only for failures writing the spool and for a backup over the limit of the reader it is read from.
+func spoolBackup(backup io.Reader, spool io.Writer, maxLine int) (string, error) {
+	scanner := bufio.NewScanner(backup)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+
+	writer := bufio.NewWriter(spool)
+	checksum := sha256.New()
+	records := io.MultiWriter(writer, checksum)
+
+	var manifest *BackupManifest
+	line, count := 0, 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if manifest != nil {
+			return fmt.Sprintf("line %d follows the manifest", line), nil
+		}
+
+		var entry backupManifestLine
+		if err := json.Unmarshal(data, &entry); err == nil && entry.Manifest != nil {
+			manifest = entry.Manifest
+			continue
+		}
+		if _, err := records.Write(data); err != nil {
+			return "", err
+		}
+		if _, err := records.Write([]byte("\n")); err != nil {
+			return "", err
+		}
+		count++
+	}
+
+	//A line too long to read, or a damaged archive, ends the restore.
+	var tooLarge *http.MaxBytesError
+	if err := scanner.Err(); errors.As(err, &tooLarge) {
+		return "", err
+	} else if err != nil {
+		return fmt.Sprintf("Error reading line %d: %v", line+1, err), nil
+	}
+	switch {
+	case manifest == nil:
+		return "the backup has no manifest, it may have been cut short", nil
+	case manifest.Records != count:
+		return fmt.Sprintf("the manifest records %d receipts but the backup holds %d", manifest.Records, count), nil
+	case manifest.Checksum != hex.EncodeToString(checksum.Sum(nil)):
+		return "the backup does not match the checksum in its manifest", nil
+	}
+	return "", writer.Flush()
+}
+
+// Function to remove every stored receipt whose id is not in the given set, each under its own lock as in a purge.
+// Idempotency keys are reset if any receipt was removed, as some may point at it.
+func (s *Server) removeReceiptsNotIn(r *http.Request, keep map[string]bool) (int, error) {
+	var ids []string
+	err := s.store.Each(r.Context(), "", func(id string, receipt *Receipt) error {
+		if !keep[id] {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		unlock := s.locks.lock(id)
+		err := s.store.Delete(r.Context(), id)
+		unlock()
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		s.hashes.forget(id)
+		removed++
+	}
+	if removed > 0 {
+		s.idempotency.forgetStored()
+	}
+	return removed, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Function to download a backup from the server under test, returning it decompressed.
+func (ts *testServer) backup(t *testing.T) string {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/admin/backup", "", adminHeader...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/backup: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	decompressed, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Function to restore a backup, given decompressed, into the server under test.
+func (ts *testServer) restore(t *testing.T, backup string, mode string) *http.Response {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(backup))
+	writer.Close()
+	return ts.do(t, "POST", "/admin/restore?mode="+mode, compressed.String(), append([]string{"Content-Type", "application/gzip"}, adminHeader...)...)
+}
+
+// Function to copy every receipt out of the store of the server under test.
+func (ts *testServer) contents(t *testing.T) map[string]Receipt {
+	t.Helper()
+
+	contents := make(map[string]Receipt)
+	err := ts.store.Each(context.Background(), "", func(id string, receipt *Receipt) error {
+		contents[id] = *receipt
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// Function to compare the contents of two stores by their receipts as JSON documents.
+func sameContents(t *testing.T, got, want map[string]Receipt) bool {
+	t.Helper()
+
+	if len(got) != len(want) {
+		return false
+	}
+	for id, receipt := range want {
+		stored, ok := got[id]
+		if !ok {
+			return false
+		}
+		if !reflect.DeepEqual(receiptJSON(t, &stored), receiptJSON(t, &receipt)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRestoreRoundTripsABackupAfterAPurge(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	ts.submit(t, targetReceipt)
+	ts.submit(t, cornerReceipt)
+	before := ts.contents(t)
+	backup := ts.backup(t)
+
+	if resp := ts.do(t, "DELETE", "/admin/receipts?confirm=true", "", adminHeader...); resp.StatusCode != http.StatusOK {
+		t.Fatalf("purge: got %d, want 200", resp.StatusCode)
+	}
+	if len(ts.contents(t)) != 0 {
+		t.Fatal("purge left receipts behind")
+	}
+
+	resp := ts.restore(t, backup, restoreReplace)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response RestoreResponse
+	decodeBody(t, resp, &response)
+	if response.Restored != 2 || response.Failed != 0 {
+		t.Fatalf("restore: got %+v, want 2 restored", response)
+	}
+
+	after := ts.contents(t)
+	for id, receipt := range after {
+		//Restoring over nothing keeps the revision the backup recorded.
+		if receipt.Revision != before[id].Revision {
+			t.Errorf("%s: revision %d, backed up at %d", id, receipt.Revision, before[id].Revision)
+		}
+	}
+	if !sameContents(t, after, before) {
+		t.Fatalf("restored store differs from the one backed up:\ngot  %v\nwant %v", after, before)
+	}
+}
+
+func TestRestoreReplaceRemovesReceiptsNotInTheBackup(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	kept := ts.submit(t, targetReceipt)
+	backup := ts.backup(t)
+	extra := ts.submit(t, cornerReceipt)
+
+	resp := ts.restore(t, backup, restoreReplace)
+	var response RestoreResponse
+	decodeBody(t, resp, &response)
+	if response.Removed != 1 {
+		t.Fatalf("restore: got %+v, want 1 removed", response)
+	}
+	contents := ts.contents(t)
+	if _, ok := contents[extra]; ok {
+		t.Fatalf("receipt %s not in the backup was kept", extra)
+	}
+	if _, ok := contents[kept]; !ok {
+		t.Fatalf("receipt %s in the backup was removed", kept)
+	}
+}
+
+func TestRestoreRejectsABackupNotMatchingItsManifestWithoutChangingTheStore(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	id := ts.submit(t, targetReceipt)
+	ts.submit(t, cornerReceipt)
+	backup := ts.backup(t)
+
+	//Change the stored receipt so a restore applying any record would show.
+	if resp := ts.do(t, "DELETE", "/receipts/"+id, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: got %d, want 204", resp.StatusCode)
+	}
+	before := ts.contents(t)
+
+	lines := strings.SplitAfter(backup, "\n")
+	for name, damaged := range map[string]string{
+		"tampered record": strings.Replace(backup, `"Target"`, `"Tarjay"`, 1),
+		"missing record":  lines[1] + lines[2],
+		"no manifest":     lines[0] + lines[1],
+		"extra line":      backup + lines[0],
+	} {
+		resp := ts.restore(t, damaged, restoreReplace)
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got %d, want 422: %s", name, resp.StatusCode, readBody(t, resp))
+			continue
+		}
+		if after := ts.contents(t); !sameContents(t, after, before) {
+			t.Errorf("%s: the store changed:\ngot  %v\nwant %v", name, after, before)
+		}
+	}
+}
+
+func TestRestoreReportsInvalidRecordsByLine(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	ts.submit(t, targetReceipt)
+	ts.submit(t, cornerReceipt)
+	backup := ts.backup(t)
+
+	//A record the checksum covers but that doesn't validate, as a backup from a laxer server might hold.
+	lines := strings.SplitAfter(backup, "\n")
+	invalid := strings.Replace(lines[1], `"purchaseDate":"`, `"purchaseDate":"x`, 1)
+	records := lines[0] + invalid
+	resp := ts.restore(t, records+manifestFor(t, records), restoreMerge)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response RestoreResponse
+	decodeBody(t, resp, &response)
+	if response.Restored != 1 || response.Failed != 1 || len(response.Failures) != 1 || response.Failures[0].Line != 2 {
+		t.Fatalf("restore: got %+v, want line 2 failed", response)
+	}
+}
+
+// Function to write the manifest line of a backup holding the given record lines.
+func manifestFor(t *testing.T, records string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	sum := sha256.Sum256([]byte(records))
+	checksum := hex.EncodeToString(sum[:])
+	manifest := BackupManifest{Version: backupVersion, Records: strings.Count(records, "\n"), Checksum: checksum}
+	if err := newBackupEncoder(&buf).Encode(backupManifestLine{Manifest: &manifest}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// Function to encode a receipt as JSON and decode it again into generic values, for comparing receipts.
+func receiptJSON(t *testing.T, receipt *Receipt) map[string]any {
+	t.Helper()
+
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestRestoreRefusesABackupOverTheLimitOnceDecompressed(t *testing.T) {
+	cfg := adminConfig()
+	cfg.MaxRestoreBytes = 1 << 20
+	ts := newTestServer(t, cfg)
+	ts.submit(t, targetReceipt)
+	before := ts.contents(t)
+
+	//Blank lines compress to next to nothing, so the body is small however far it expands.
+	resp := ts.restore(t, strings.Repeat("\n", 64<<20), restoreReplace)
+	expectProblem(t, resp, http.StatusRequestEntityTooLarge, codeBodyTooLarge)
+	if after := ts.contents(t); !sameContents(t, after, before) {
+		t.Fatalf("the store changed:\ngot  %v\nwant %v", after, before)
+	}
+
+	//A backup is restored up to the limit exactly.
+	backup := ts.backup(t)
+	ts.config.MaxRestoreBytes = int64(len(backup)) - 1
+	expectProblem(t, ts.restore(t, backup, restoreMerge), http.StatusRequestEntityTooLarge, codeBodyTooLarge)
+	ts.config.MaxRestoreBytes = int64(len(backup))
+	if resp := ts.restore(t, backup, restoreMerge); resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore at the limit: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+}
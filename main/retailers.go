@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Struct for returning a page of one retailer's receipts given as JSON, headed by the retailer's numbers
+// over all of its receipts, not only those on the page.
+type RetailerReceiptsResponse struct {
+	Retailer   RetailerStats    `json:"retailer"`
+	Receipts   []ReceiptSummary `json:"receipts"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// Function to handle requests listing the receipts of a single retailer a page at a time.
+// The retailer is matched by retailerKey, so case and extra whitespace in the name don't matter, and the
+// listing takes the same parameters as the receipts listing. A retailer with no receipts gets an empty page.
+func (s *Server) retailerReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Join(strings.Fields(mux.Vars(r)["name"]), " ")
+	if name == "" {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, "a retailer name is required")
+		return
+	}
+
+	page, ok := s.listReceipts(w, r, listFilter{retailerKey: retailerKey(name)})
+	if !ok {
+		return
+	}
+
+	//The retailer's numbers are over every receipt the listing matches, so the store is read in full for them.
+	filter, _ := parseListFilter(r.URL.Query())
+	filter.retailerKey = retailerKey(name)
+	entries, err := s.matchingReceipts(r.Context(), sortCreatedAt, filter)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	//Name the retailer by its most common spelling, the alphabetically first on a tie, or as given if it has no receipts.
+	response := RetailerReceiptsResponse{Retailer: RetailerStats{Name: name}, Receipts: page.Receipts, NextCursor: page.NextCursor}
+	spellings := make(map[string]int)
+	best := 0
+	for _, entry := range entries {
+		response.Retailer.Receipts++
+		response.Retailer.TotalPoints += entry.summary.Points
+
+		spelling := strings.TrimSpace(entry.summary.Retailer)
+		spellings[spelling]++
+		if n := spellings[spelling]; n > best || (n == best && spelling < response.Retailer.Name) {
+			response.Retailer.Name = spelling
+			best = n
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
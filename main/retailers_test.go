@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// Function to fetch a page of a retailer's receipts from the server under test, with the name given as it goes in the path.
+func (ts *testServer) retailerReceipts(t *testing.T, escapedName string, query url.Values) RetailerReceiptsResponse {
+	t.Helper()
+
+	path := "/retailers/" + escapedName + "/receipts?" + query.Encode()
+	resp := ts.do(t, "GET", path, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: got %d, want 200: %s", path, resp.StatusCode, readBody(t, resp))
+	}
+	var response RetailerReceiptsResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestRetailerReceiptsMatchAnEscapedName(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	corner := ts.submit(t, cornerReceipt)
+	cafe := ts.submit(t, datedReceipt("Café Olé", "2022-01-15"))
+	ts.submit(t, targetReceipt)
+
+	for _, test := range []struct {
+		escapedName string
+		name        string
+		want        string
+	}{
+		{"M%26M%20Corner%20Market", "M&M Corner Market", corner},
+		{url.PathEscape("m&m  corner market "), "M&M Corner Market", corner},
+		{"Caf%C3%A9%20Ol%C3%A9", "Café Olé", cafe},
+		{url.PathEscape("CAFÉ OLÉ"), "Café Olé", cafe},
+	} {
+		response := ts.retailerReceipts(t, test.escapedName, nil)
+		if response.Retailer.Name != test.name || response.Retailer.Receipts != 1 || len(response.Receipts) != 1 || response.Receipts[0].ID != test.want {
+			t.Errorf("retailer %s: got %+v, want %s with its one receipt", test.escapedName, response, test.name)
+		}
+	}
+}
+
+func TestRetailerReceiptsOfAnUnknownRetailerAreEmpty(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ts.submit(t, targetReceipt)
+
+	response := ts.retailerReceipts(t, "Walgreens", nil)
+	if response.Retailer != (RetailerStats{Name: "Walgreens"}) || len(response.Receipts) != 0 || response.NextCursor != "" {
+		t.Fatalf("unknown retailer: got %+v, want an empty page named as given", response)
+	}
+
+	expectProblem(t, ts.do(t, "GET", "/retailers/%20/receipts", ""), http.StatusBadRequest, codeInvalidParameter)
+	expectProblem(t, ts.do(t, "GET", "/retailers/Target/receipts?limit=0", ""), http.StatusBadRequest, codeInvalidParameter)
+}
+
+func TestRetailerReceiptsPageWithTheRetailersTotals(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ids := ts.submitRetailers(t, "Target", "Walgreens", "target", "Target", "TARGET", "Walgreens")
+
+	var got []string
+	query := url.Values{"limit": {"2"}}
+	for pages := 0; ; pages++ {
+		response := ts.retailerReceipts(t, "Target", query)
+		if pages > 3 {
+			t.Fatalf("still paging after %d pages", pages)
+		}
+		if response.Retailer != (RetailerStats{Name: "Target", Receipts: 4, TotalPoints: 4 * ts.points(t, ids["Target"][0])}) {
+			t.Fatalf("page %d: got retailer %+v, want Target's numbers over all four receipts", pages, response.Retailer)
+		}
+		if len(response.Receipts) > 2 {
+			t.Fatalf("page %d: got %d receipts, want at most 2", pages, len(response.Receipts))
+		}
+		for _, summary := range response.Receipts {
+			got = append(got, summary.ID)
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+
+	want := append(append(append([]string(nil), ids["Target"]...), ids["target"]...), ids["TARGET"]...)
+	slices.Sort(want)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Fatalf("paged through %v, want %v", got, want)
+	}
+}
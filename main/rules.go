@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Interface for a single points rule, scoring one aspect of a receipt.
+type Rule interface {
+	//Name the rule is known by, such as roundDollarTotal.
+	Name() string
+
+	//What the rule awards the receipt, in one or more parts each explaining its points, or an error
+	//if the receipt can't be scored by it. Rules scoring nothing still give a part saying why.
+	Apply(receipt *Receipt) ([]PointsContribution, error)
+}
+
+// Interface for a stage applied once the rules are added up, adjusting the receipt's points as a whole.
+type Adjustment interface {
+	//Name the adjustment is known by, such as retailerMultiplier.
+	Name() string
+
+	//What the adjustment adds to the points scored so far, negative to take points away, explained in one or more
+	//parts. Adjustments that leave the points as they are give no parts, so they aren't listed in breakdowns.
+	Adjust(receipt *Receipt, points int) ([]PointsContribution, error)
+}
+
+// Struct for an ordered set of rules whose points are added together to score a receipt, followed by the
+// adjustments applied in turn to their total, registered in ruleSets under its version.
+type RuleSet struct {
+	Version     string
+	Rules       []Rule
+	Adjustments []Adjustment
+}
+
+// Name of the weekend bonus rule, which is disabled unless a promotion turns it on.
+const weekendBonusRule = "weekendBonus"
+
+// Function to return every rule of the published rules and the weekend bonus, with the constants in pointsConfig,
+// whether or not they are enabled.
+func publishedRules() []Rule {
+	return []Rule{
+		RetailerNameRule{},
+		RoundDollarRule{Points: pointsConfig.RoundDollarPoints},
+		QuarterMultipleRule{Points: pointsConfig.QuarterMultiplePoints},
+		ItemPairsRule{PointsPerPair: pointsConfig.ItemPairPoints},
+		ItemDescriptionRule{Multiplier: pointsConfig.DescriptionMultiplier},
+		OddDayRule{Points: pointsConfig.OddDayPoints},
+		AfternoonRule{Points: pointsConfig.AfternoonPoints, Start: pointsConfig.AfternoonStart, End: pointsConfig.AfternoonEnd},
+		WeekendBonusRule{Points: pointsConfig.WeekendBonusPoints},
+	}
+}
+
+// Function to list the names of every rule that can be enabled or disabled, in the order they are applied.
+func ruleNames() []string {
+	rules := publishedRules()
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.Name()
+	}
+	return names
+}
+
+// Function to return the rule set matching the published rules, with the constants in pointsConfig.
+// Disabled rules, the weekend bonus unless turned on, are left out, so breakdowns don't list them.
+func v1RuleSet() RuleSet {
+	set := RuleSet{Version: ruleVersionV1}
+	for _, rule := range publishedRules() {
+		if !pointsConfig.DisabledRules[rule.Name()] {
+			set.Rules = append(set.Rules, rule)
+		}
+	}
+	if len(pointsConfig.RetailerMultipliers) > 0 {
+		set.Adjustments = append(set.Adjustments, RetailerMultiplierAdjustment{Multipliers: pointsConfig.RetailerMultipliers})
+	}
+	if pointsConfig.PointsCap != nil || pointsConfig.PointsFloor != nil {
+		set.Adjustments = append(set.Adjustments, PointsLimitAdjustment{Cap: pointsConfig.PointsCap, Floor: pointsConfig.PointsFloor})
+	}
+	return set
+}
+
+// Function to score a receipt by adding up the points of every rule in the set.
+func (s RuleSet) Score(receipt *Receipt) (int, error) {
+	contributions, err := s.Breakdown(receipt)
+	if err != nil {
+		return 0, err
+	}
+	points := 0
+	for _, contribution := range contributions {
+		points += contribution.Points
+	}
+	return points, nil
+}
+
+// Function to score a receipt rule by rule, returning what every rule in the set contributed, in order,
+// including rules that scored nothing, followed by what each adjustment changed. The contributions add up
+// to the receipt's score.
+func (s RuleSet) Breakdown(receipt *Receipt) ([]PointsContribution, error) {
+	var contributions []PointsContribution
+	points := 0
+	for _, rule := range s.Rules {
+		parts, err := rule.Apply(receipt)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			points += part.Points
+		}
+		contributions = append(contributions, parts...)
+	}
+
+	//Each adjustment sees the points as the rules and the adjustments before it left them.
+	for _, adjustment := range s.Adjustments {
+		parts, err := adjustment.Adjust(receipt, points)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			points += part.Points
+		}
+		contributions = append(contributions, parts...)
+	}
+	return contributions, nil
+}
+
+// Function to build a single contribution under a rule's or adjustment's name, explained by the given reason
+// formatted from the values it was scored with, followed by the points it led to.
+func contribution(rule interface{ Name() string }, points int, format string, args ...interface{}) []PointsContribution {
+	explanation := fmt.Sprintf(format, args...) + " → " + countOf(points, "point")
+	return []PointsContribution{{Rule: rule.Name(), Points: points, Explanation: explanation}}
+}
+
+// Function to write a count followed by a noun, adding an s to the noun unless the count is one.
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Type for the rule awarding one point for every alphanumeric character in the retailer name.
+type RetailerNameRule struct{}
+
+// Function to return the name of the retailer name rule.
+func (RetailerNameRule) Name() string { return "retailerName" }
+
+// Function to count the characters, not bytes, left in the retailer name once everything but letters and digits is removed.
+func (r RetailerNameRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	//Trim all non-alphanumeric characters from retailer string and trim all whitespace.
+	var length = strings.TrimSpace(nonAlphanumericRegex.ReplaceAllString(receipt.Retailer, ""))
+	length = strings.Replace(length, " ", "", -1)
+
+	characters := utf8.RuneCountInString(length)
+	return contribution(r, characters, "retailer '%s' has %s", receipt.Retailer, countOf(characters, "alphanumeric character")), nil
+}
+
+// Type for the rule awarding Points, 50 by default, when the total is a round dollar amount with no cents.
+type RoundDollarRule struct {
+	Points int
+}
+
+// Function to return the name of the round dollar rule.
+func (RoundDollarRule) Name() string { return "roundDollarTotal" }
+
+// Function to check whether the total is a round dollar amount.
+// The total is held as the whole cents parsed from the submitted string, so the check is exact without keeping the
+// string itself, which in the comma or lenient formats, such as "9,00" or "$1,000.00", wouldn't end in ".00" anyway.
+func (r RoundDollarRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	if receipt.Total.IsRoundDollar() {
+		return contribution(r, r.Points, "total %s is a round dollar amount", receipt.Total), nil
+	}
+	return contribution(r, 0, "total %s is not a round dollar amount", receipt.Total), nil
+}
+
+// Type for the rule awarding Points, 25 by default, when the total is a multiple of 0.25.
+type QuarterMultipleRule struct {
+	Points int
+}
+
+// Function to return the name of the quarter multiple rule.
+func (QuarterMultipleRule) Name() string { return "quarterMultipleTotal" }
+
+// Function to check whether the total is a multiple of 0.25, exactly on whole cents as the round dollar check is.
+func (r QuarterMultipleRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	if receipt.Total.IsQuarterMultiple() {
+		return contribution(r, r.Points, "total %s is a multiple of 0.25", receipt.Total), nil
+	}
+	return contribution(r, 0, "total %s is not a multiple of 0.25", receipt.Total), nil
+}
+
+// Type for the rule awarding PointsPerPair, 5 by default, for every two items on the receipt.
+type ItemPairsRule struct {
+	PointsPerPair int
+}
+
+// Function to return the name of the item pairs rule.
+func (ItemPairsRule) Name() string { return "itemPairs" }
+
+// Function to count the pairs of items on the receipt.
+func (r ItemPairsRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	pairs := len(receipt.Items) / 2
+	return contribution(r, pairs*r.PointsPerPair, "%s → %s", countOf(len(receipt.Items), "item"), countOf(pairs, "pair")), nil
+}
+
+// Type for the rule awarding each item whose trimmed description length is a multiple of 3 its price times Multiplier,
+// 0.2 by default, rounded up, as scored by scoreItem.
+type ItemDescriptionRule struct {
+	Multiplier Amount
+}
+
+// Function to return the name of the item description rule.
+func (ItemDescriptionRule) Name() string { return "itemDescription" }
+
+// Function to score every item on the receipt, each as its own contribution named after its position.
+// Items that score show the rounding of their price times the multiplier, as scoreItem calculated it.
+func (r ItemDescriptionRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	contributions := make([]PointsContribution, len(receipt.Items))
+	for i, item := range receipt.Items {
+		score := scoreItem(item, r.Multiplier)
+		explanation := fmt.Sprintf("item '%s' trimmed length %d is not a multiple of 3 → 0 points", item.Description, score.Length)
+		if score.MultipleOfThree {
+			explanation = fmt.Sprintf("item '%s' trimmed length %d is a multiple of 3 → ceil(%s×%s)=%d", item.Description, score.Length, score.Price, decimalString(r.Multiplier), score.Points)
+		}
+		contributions[i] = PointsContribution{
+			Rule:        fmt.Sprintf("items[%d].description", i),
+			Points:      score.Points,
+			Explanation: explanation,
+		}
+	}
+	return contributions, nil
+}
+
+// Function to write an amount used as a multiplier without the trailing zeros of its cents, such as 0.2 for 0.20.
+func decimalString(a Amount) string {
+	s := a.String()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Type for the rule awarding Points, 6 by default, when the day in the purchase date is odd.
+type OddDayRule struct {
+	Points int
+}
+
+// Function to return the name of the odd day rule.
+func (OddDayRule) Name() string { return "oddPurchaseDay" }
+
+// Function to check whether the day of the purchase date is odd.
+// Returns an error if the purchase date cannot be parsed.
+func (r OddDayRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	purchaseDate, err := time.Parse(dateFormat, receipt.PurchaseDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid purchaseDate %q: %w", receipt.PurchaseDate, err)
+	}
+
+	if purchaseDate.Day()%2 != 0 {
+		return contribution(r, r.Points, "purchase day %d is odd", purchaseDate.Day()), nil
+	}
+	return contribution(r, 0, "purchase day %d is even", purchaseDate.Day()), nil
+}
+
+// Type for the rule awarding Points, 10 by default, when the purchase time falls inside the afternoon window,
+// from Start up to but not including End as offsets from midnight, wrapping past midnight if End is before Start.
+type AfternoonRule struct {
+	Points int
+	Start  time.Duration
+	End    time.Duration
+}
+
+// Function to return the name of the afternoon rule.
+func (AfternoonRule) Name() string { return "afternoonPurchase" }
+
+// Function to check whether the purchase time falls inside the window.
+// Returns an error if the purchase time cannot be parsed.
+func (r AfternoonRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	purchaseTime, err := time.Parse(timeFormat, receipt.PurchaseTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid purchaseTime %q: %w", receipt.PurchaseTime, err)
+	}
+
+	window := PointsConfig{AfternoonStart: r.Start, AfternoonEnd: r.End}
+	if window.inAfternoonWindow(purchaseTime) {
+		return contribution(r, r.Points, "purchase time %s is in the window from %s to %s", receipt.PurchaseTime, formatTimeOfDay(r.Start), formatTimeOfDay(r.End)), nil
+	}
+	return contribution(r, 0, "purchase time %s is not in the window from %s to %s", receipt.PurchaseTime, formatTimeOfDay(r.Start), formatTimeOfDay(r.End)), nil
+}
+
+// Type for the promotional rule awarding Points, 15 by default, when the purchase date falls on a Saturday or Sunday.
+type WeekendBonusRule struct {
+	Points int
+}
+
+// Function to return the name of the weekend bonus rule.
+func (WeekendBonusRule) Name() string { return weekendBonusRule }
+
+// Function to check whether the purchase date falls on a weekend.
+// Returns an error if the purchase date cannot be parsed.
+func (r WeekendBonusRule) Apply(receipt *Receipt) ([]PointsContribution, error) {
+	purchaseDate, err := time.Parse(dateFormat, receipt.PurchaseDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid purchaseDate %q: %w", receipt.PurchaseDate, err)
+	}
+
+	weekday := purchaseDate.Weekday()
+	if weekday == time.Saturday || weekday == time.Sunday {
+		return contribution(r, r.Points, "purchase date %s is a %s", receipt.PurchaseDate, weekday), nil
+	}
+	return contribution(r, 0, "purchase date %s is a %s, not a weekend day", receipt.PurchaseDate, weekday), nil
+}
+
+// Type for the adjustment holding a receipt's points to at most Cap and at least Floor, either nil for no limit.
+// It is applied last, so it limits the points every rule and other adjustment led to.
+type PointsLimitAdjustment struct {
+	Cap   *int
+	Floor *int
+}
+
+// Function to return the name of the points limit adjustment.
+func (PointsLimitAdjustment) Name() string { return "pointsLimit" }
+
+// Function to bring points over the cap down to it, or points under the floor up to it, as a single part.
+// Points within the limits are left as they are.
+func (a PointsLimitAdjustment) Adjust(receipt *Receipt, points int) ([]PointsContribution, error) {
+	if a.Cap != nil && points > *a.Cap {
+		return contribution(a, *a.Cap-points, "%d points is over the cap of %d", points, *a.Cap), nil
+	}
+	if a.Floor != nil && points < *a.Floor {
+		return contribution(a, *a.Floor-points, "%d points is under the floor of %d", points, *a.Floor), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Function to change the points configuration for the length of a test, restoring it afterwards.
+func withPointsConfig(t *testing.T, change func(c *PointsConfig)) {
+	t.Helper()
+
+	saved := pointsConfig
+	t.Cleanup(func() { pointsConfig = saved })
+
+	changed := defaultPointsConfig()
+	change(&changed)
+	pointsConfig = changed
+}
+
+// Function to decode one of the example receipts, failing the test on error.
+func exampleReceipt(t *testing.T, body string) *Receipt {
+	t.Helper()
+
+	receipt, err := decodeReceipt(strings.NewReader(body), decodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+// Function to report whether a breakdown contribution was made by the named rule, the description rule
+// contributing once per item.
+func contributedBy(contribution PointsContribution, rule string) bool {
+	if rule == (ItemDescriptionRule{}).Name() {
+		return strings.HasPrefix(contribution.Rule, "items[") && strings.HasSuffix(contribution.Rule, "].description")
+	}
+	return contribution.Rule == rule
+}
+
+func TestDisablingARuleDropsExactlyItsContribution(t *testing.T) {
+	for _, body := range []string{targetReceipt, cornerReceipt} {
+		receipt := exampleReceipt(t, body)
+		full, err := defaultRuleSet().Breakdown(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, contribution := range full {
+			total += contribution.Points
+		}
+
+		for _, name := range ruleNames() {
+			if name == weekendBonusRule {
+				continue
+			}
+			t.Run(receipt.Retailer+"/"+name, func(t *testing.T) {
+				withPointsConfig(t, func(c *PointsConfig) { c.DisabledRules[name] = true })
+
+				want := total
+				for _, contribution := range full {
+					if contributedBy(contribution, name) {
+						want -= contribution.Points
+					}
+				}
+				breakdown, err := defaultRuleSet().Breakdown(receipt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := 0
+				for _, contribution := range breakdown {
+					if contributedBy(contribution, name) {
+						t.Errorf("breakdown lists %s", contribution.Rule)
+					}
+					got += contribution.Points
+				}
+				if got != want {
+					t.Errorf("scored %d, want %d", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestItemScoresAreEmptyWithTheDescriptionRuleDisabled(t *testing.T) {
+	withPointsConfig(t, func(c *PointsConfig) { c.DisabledRules["itemDescription"] = true })
+	ts := newTestServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	resp := ts.do(t, "GET", "/receipts/"+id+"/items", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET items: got %d, want 200", resp.StatusCode)
+	}
+	var response ItemScoresResponse
+	decodeBody(t, resp, &response)
+	if len(response.Items) != 0 || response.Points != 0 {
+		t.Fatalf("items with the description rule disabled: got %+v, want none", response)
+	}
+	if got := ts.points(t, id); got != 22 {
+		t.Fatalf("points with the description rule disabled: got %d, want 22", got)
+	}
+}
+
+func TestRulesListsTheDisabledRules(t *testing.T) {
+	withPointsConfig(t, func(c *PointsConfig) { c.DisabledRules["oddPurchaseDay"] = true })
+	ts := newTestServer(t, testConfig())
+
+	resp := ts.do(t, "GET", "/rules", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /rules: got %d, want 200", resp.StatusCode)
+	}
+	var response RulesResponse
+	decodeBody(t, resp, &response)
+	for _, name := range response.Rules {
+		if name == "oddPurchaseDay" || name == weekendBonusRule {
+			t.Errorf("disabled rule %s listed as active", name)
+		}
+	}
+	if !equalIDs(response.Disabled, []string{"oddPurchaseDay", weekendBonusRule}) {
+		t.Errorf("disabled rules: got %v, want [oddPurchaseDay weekendBonus]", response.Disabled)
+	}
+}
+
+// Function to total the points of a single rule applied to a receipt, failing the test on error.
+func rulePoints(t *testing.T, rule Rule, receipt *Receipt) int {
+	t.Helper()
+
+	parts, err := rule.Apply(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := 0
+	for _, part := range parts {
+		points += part.Points
+	}
+	return points
+}
+
+func TestRetailerNameCountsCharactersNotBytes(t *testing.T) {
+	for _, test := range []struct {
+		retailer string
+		points   int
+	}{
+		{"Target", 6},
+		{"M&M Corner Market", 14},
+		{"Müller", 6},
+		{"Café René", 8},
+		{"Ærøskøbing Købmand", 17},
+		{"東京ストア", 5},
+		{"北京 Store 88", 9},
+	} {
+		if got := rulePoints(t, RetailerNameRule{}, &Receipt{Retailer: test.retailer}); got != test.points {
+			t.Errorf("%q: got %d points, want %d", test.retailer, got, test.points)
+		}
+	}
+}
+
+// Function to parse an amount, failing the test on error.
+func amount(t *testing.T, s string) Amount {
+	t.Helper()
+
+	a, err := parseAmount(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestTotalRules(t *testing.T) {
+	for _, test := range []struct {
+		total       string
+		roundDollar int
+		quarter     int
+	}{
+		{"9.00", 50, 25},
+		{"0.00", 50, 25},
+		{"100.00", 50, 25},
+		{"9.25", 0, 25},
+		{"9.50", 0, 25},
+		{"9.75", 0, 25},
+		{"9.01", 0, 0},
+		{"9.10", 0, 0},
+		{"9.99", 0, 0},
+		{"35.35", 0, 0},
+	} {
+		receipt := &Receipt{Total: amountPtr(amount(t, test.total))}
+		if got := rulePoints(t, RoundDollarRule{Points: 50}, receipt); got != test.roundDollar {
+			t.Errorf("round dollar %s: got %d points, want %d", test.total, got, test.roundDollar)
+		}
+		if got := rulePoints(t, QuarterMultipleRule{Points: 25}, receipt); got != test.quarter {
+			t.Errorf("quarter multiple %s: got %d points, want %d", test.total, got, test.quarter)
+		}
+	}
+}
+
+func TestItemPairsRule(t *testing.T) {
+	for items, points := range []int{0, 0, 5, 5, 10, 10, 15} {
+		receipt := &Receipt{Items: make([]Item, items)}
+		if got := rulePoints(t, ItemPairsRule{PointsPerPair: 5}, receipt); got != points {
+			t.Errorf("%d items: got %d points, want %d", items, got, points)
+		}
+	}
+}
+
+func TestItemDescriptionRule(t *testing.T) {
+	rule := ItemDescriptionRule{Multiplier: pointsConfig.DescriptionMultiplier}
+	for _, test := range []struct {
+		description string
+		points      int
+	}{
+		{"ab", 0},
+		{"abc", 2},
+		{"abcd", 0},
+		{"abcdef", 2},
+		{"  abc  ", 2},
+		{" ab ", 0},
+		{"a b", 2},
+		{"Mountain Dew 12PK", 0},
+		{"Emils Cheese Pizza", 2},
+	} {
+		price := amount(t, "10.00")
+		receipt := &Receipt{Items: []Item{{Description: test.description, Price: &price}}}
+		if got := rulePoints(t, rule, receipt); got != test.points {
+			t.Errorf("%q at 10.00: got %d points, want %d", test.description, got, test.points)
+		}
+	}
+}
+
+func TestOddDayRule(t *testing.T) {
+	for _, test := range []struct {
+		date   string
+		points int
+	}{
+		{"2022-01-01", 6},
+		{"2022-01-02", 0},
+		{"2022-01-31", 6},
+		{"2022-02-28", 0},
+		{"2024-02-29", 6},
+		{"2022-03-20", 0},
+	} {
+		if got := rulePoints(t, OddDayRule{Points: 6}, &Receipt{PurchaseDate: test.date}); got != test.points {
+			t.Errorf("%s: got %d points, want %d", test.date, got, test.points)
+		}
+	}
+	if _, err := (OddDayRule{Points: 6}).Apply(&Receipt{PurchaseDate: "2022-02-30"}); err == nil {
+		t.Error("2022-02-30: scored, want an error")
+	}
+}
+
+func TestWeekendBonusRule(t *testing.T) {
+	for _, test := range []struct {
+		date    string
+		enabled bool
+		points  int
+	}{
+		{"2022-01-01", true, 15},
+		{"2022-01-02", true, 15},
+		{"2022-01-07", true, 0},
+		{"2022-01-01", false, 0},
+		{"2022-01-02", false, 0},
+		{"2022-01-07", false, 0},
+	} {
+		withPointsConfig(t, func(c *PointsConfig) { c.DisabledRules[weekendBonusRule] = !test.enabled })
+
+		receipt := exampleReceipt(t, cornerReceipt)
+		receipt.PurchaseDate = test.date
+		contributions, err := defaultRuleSet().Breakdown(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, listed := 0, false
+		for _, contribution := range contributions {
+			if contributedBy(contribution, weekendBonusRule) {
+				got += contribution.Points
+				listed = true
+			}
+		}
+		if got != test.points || listed != test.enabled {
+			t.Errorf("%s with the bonus enabled %v: got %d points, listed %v, want %d", test.date, test.enabled, got, listed, test.points)
+		}
+	}
+}
+
+func TestAfternoonWindowBoundaries(t *testing.T) {
+	//The default window keeps the published rule's "after 2:00pm and before 4:00pm", starting at 14:01.
+	rule := AfternoonRule{Points: 10, Start: pointsConfig.AfternoonStart, End: pointsConfig.AfternoonEnd}
+	for _, test := range []struct {
+		time   string
+		points int
+	}{
+		{"13:59", 0},
+		{"14:00", 0},
+		{"14:01", 10},
+		{"15:59", 10},
+		{"16:00", 0},
+		{"16:01", 0},
+	} {
+		if got := rulePoints(t, rule, &Receipt{PurchaseTime: test.time}); got != test.points {
+			t.Errorf("%s: got %d points, want %d", test.time, got, test.points)
+		}
+	}
+}
+
+func TestAfternoonWindowIsConfigurable(t *testing.T) {
+	withPointsConfig(t, func(c *PointsConfig) {
+		c.AfternoonStart = 12 * time.Hour
+		c.AfternoonEnd = 13*time.Hour + 30*time.Minute
+	})
+
+	for _, test := range []struct {
+		time   string
+		points int
+	}{
+		{"11:59", 0},
+		{"12:00", 10},
+		{"13:01", 10},
+		{"13:30", 0},
+		{"14:33", 0},
+	} {
+		receipt := exampleReceipt(t, targetReceipt)
+		receipt.PurchaseTime = test.time
+		contributions, err := defaultRuleSet().Breakdown(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		for _, contribution := range contributions {
+			if contributedBy(contribution, "afternoonPurchase") {
+				got += contribution.Points
+			}
+		}
+		if got != test.points {
+			t.Errorf("%s: got %d points, want %d", test.time, got, test.points)
+		}
+	}
+}
+
+func TestAfternoonWindowWrapsPastMidnight(t *testing.T) {
+	withPointsConfig(t, func(c *PointsConfig) {
+		c.AfternoonStart = 22 * time.Hour
+		c.AfternoonEnd = 2 * time.Hour
+	})
+	rule := AfternoonRule{Points: 10, Start: pointsConfig.AfternoonStart, End: pointsConfig.AfternoonEnd}
+	if err := pointsConfig.Validate(); err != nil {
+		t.Fatalf("window from 22:00 to 02:00: %v", err)
+	}
+
+	for _, test := range []struct {
+		time   string
+		points int
+	}{
+		{"21:59", 0},
+		{"22:00", 10},
+		{"23:30", 10},
+		{"00:00", 10},
+		{"01:30", 10},
+		{"01:59", 10},
+		{"02:00", 0},
+		{"14:33", 0},
+	} {
+		if got := rulePoints(t, rule, &Receipt{PurchaseTime: test.time}); got != test.points {
+			t.Errorf("%s: got %d points, want %d", test.time, got, test.points)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Struct for a rules config file as read from YAML or JSON, such as
+//
+//	roundDollarPoints: 50
+//	descriptionMultiplier: "0.2"
+//	afternoonStart: "14:01"
+//	afternoonEnd: "16:00"
+//	rules:
+//	  itemDescription:
+//	    enabled: false
+//	retailerMultipliers:
+//	  - retailer: M&M Corner Market
+//	    multiplier: "2"
+//	    from: "2022-03-01"
+//	    to: "2022-03-31"
+//
+// Settings left out keep the values of the published rules.
+type pointsConfigFile struct {
+	RoundDollarPoints     *int    `yaml:"roundDollarPoints"`
+	QuarterMultiplePoints *int    `yaml:"quarterMultiplePoints"`
+	ItemPairPoints        *int    `yaml:"itemPairPoints"`
+	DescriptionMultiplier *string `yaml:"descriptionMultiplier"`
+	OddDayPoints          *int    `yaml:"oddDayPoints"`
+	AfternoonPoints       *int    `yaml:"afternoonPoints"`
+	WeekendBonus          *bool   `yaml:"weekendBonus"`
+	WeekendBonusPoints    *int    `yaml:"weekendBonusPoints"`
+	PointsCap             *int    `yaml:"pointsCap"`
+	PointsFloor           *int    `yaml:"pointsFloor"`
+	AfternoonStart        *string `yaml:"afternoonStart"`
+	AfternoonEnd          *string `yaml:"afternoonEnd"`
+
+	//Rules turned on or off by name.
+	Rules map[string]struct {
+		Enabled *bool `yaml:"enabled"`
+	} `yaml:"rules"`
+
+	RetailerMultipliers []struct {
+		Retailer   string `yaml:"retailer"`
+		Multiplier string `yaml:"multiplier"`
+		From       string `yaml:"from"`
+		To         string `yaml:"to"`
+	} `yaml:"retailerMultipliers"`
+}
+
+// Function to read the points configuration from a rules config file in YAML or JSON, which as a subset of YAML
+// is read by the same decoder. Unknown settings are rejected, so a misspelt one isn't silently left at its default.
+func loadPointsConfig(path string) (PointsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PointsConfig{}, fmt.Errorf("invalid -rules-config: %w", err)
+	}
+
+	var file pointsConfigFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return PointsConfig{}, fmt.Errorf("invalid -rules-config %s: %w", path, err)
+	}
+
+	config, err := file.pointsConfig()
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		return PointsConfig{}, fmt.Errorf("invalid -rules-config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Function to apply the settings given in a rules config file to the published rules.
+func (f pointsConfigFile) pointsConfig() (PointsConfig, error) {
+	config := defaultPointsConfig()
+	for _, setting := range []struct {
+		value  *int
+		target *int
+	}{
+		{f.RoundDollarPoints, &config.RoundDollarPoints},
+		{f.QuarterMultiplePoints, &config.QuarterMultiplePoints},
+		{f.ItemPairPoints, &config.ItemPairPoints},
+		{f.OddDayPoints, &config.OddDayPoints},
+		{f.AfternoonPoints, &config.AfternoonPoints},
+		{f.WeekendBonusPoints, &config.WeekendBonusPoints},
+	} {
+		if setting.value != nil {
+			*setting.target = *setting.value
+		}
+	}
+
+	if f.WeekendBonus != nil {
+		config.DisabledRules[weekendBonusRule] = !*f.WeekendBonus
+	}
+	for name, rule := range f.Rules {
+		if rule.Enabled != nil {
+			config.DisabledRules[ruleName(name)] = !*rule.Enabled
+		}
+	}
+	config.PointsCap = f.PointsCap
+	config.PointsFloor = f.PointsFloor
+
+	if f.DescriptionMultiplier != nil {
+		multiplier, err := parseAmount(strings.TrimSpace(*f.DescriptionMultiplier))
+		if err != nil {
+			return PointsConfig{}, fmt.Errorf("invalid descriptionMultiplier %q: expected a decimal number with at most 2 decimal places", *f.DescriptionMultiplier)
+		}
+		config.DescriptionMultiplier = multiplier
+	}
+
+	for _, setting := range []struct {
+		name   string
+		value  *string
+		target *time.Duration
+	}{
+		{"afternoonStart", f.AfternoonStart, &config.AfternoonStart},
+		{"afternoonEnd", f.AfternoonEnd, &config.AfternoonEnd},
+	} {
+		if setting.value == nil {
+			continue
+		}
+		offset, err := parseTimeOfDay(*setting.value)
+		if err != nil {
+			return PointsConfig{}, fmt.Errorf("invalid %s %q: expected a time as HH:MM", setting.name, *setting.value)
+		}
+		*setting.target = offset
+	}
+
+	for _, promotion := range f.RetailerMultipliers {
+		multiplier, err := parseAmount(strings.TrimSpace(promotion.Multiplier))
+		if err != nil {
+			return PointsConfig{}, fmt.Errorf("invalid retailer multiplier for %q: multiplier %q is not a decimal number with at most 2 decimal places", promotion.Retailer, promotion.Multiplier)
+		}
+		config.RetailerMultipliers = append(config.RetailerMultipliers, RetailerMultiplier{
+			Retailer:   promotion.Retailer,
+			Multiplier: multiplier,
+			From:       promotion.From,
+			To:         promotion.To,
+		})
+	}
+	return config, nil
+}
+
+// Function to apply the environment variables that override the points configuration: WEEKEND_BONUS turns the
+// weekend bonus on or off, whatever the rules config says, WEEKEND_BONUS_POINTS sets what it is worth, and
+// RULES_DISABLE disables the rules named in a comma separated list, such as itemDescription,oddDay.
+func (c *PointsConfig) applyEnv() error {
+	if value := os.Getenv("WEEKEND_BONUS"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid WEEKEND_BONUS %q: expected true or false", value)
+		}
+		c.DisabledRules[weekendBonusRule] = !enabled
+	}
+	if value := os.Getenv("WEEKEND_BONUS_POINTS"); value != "" {
+		points, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid WEEKEND_BONUS_POINTS %q: expected a whole number", value)
+		}
+		c.WeekendBonusPoints = points
+	}
+	for _, name := range strings.Split(os.Getenv("RULES_DISABLE"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			c.DisabledRules[ruleName(name)] = true
+		}
+	}
+	return c.Validate()
+}
+
+// Short names rules can be turned on or off by, besides the names they are listed under.
+var ruleAliases = map[string]string{
+	"oddDay": "oddPurchaseDay",
+}
+
+// Function to return the name a rule is listed under, given it or one of its short names.
+func ruleName(name string) string {
+	if listed, ok := ruleAliases[name]; ok {
+		return listed
+	}
+	return name
+}
+
+// Function to parse a time of day given as HH:MM into its offset from midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse(timeFormat, value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Function to check that the points configuration holds usable values: no negative points or multipliers,
+// an afternoon window that isn't empty, retailer promotions with real date ranges, a floor no higher than the cap,
+// and only known rules enabled or disabled.
+func (c PointsConfig) Validate() error {
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"roundDollarPoints", c.RoundDollarPoints},
+		{"quarterMultiplePoints", c.QuarterMultiplePoints},
+		{"itemPairPoints", c.ItemPairPoints},
+		{"oddDayPoints", c.OddDayPoints},
+		{"afternoonPoints", c.AfternoonPoints},
+		{"weekendBonusPoints", c.WeekendBonusPoints},
+	} {
+		if setting.value < 0 {
+			return fmt.Errorf("invalid %s %d: must not be negative", setting.name, setting.value)
+		}
+	}
+	if c.DescriptionMultiplier < 0 {
+		return fmt.Errorf("invalid descriptionMultiplier %s: must not be negative", c.DescriptionMultiplier)
+	}
+	for _, offset := range []time.Duration{c.AfternoonStart, c.AfternoonEnd} {
+		if offset < 0 || offset >= 24*time.Hour {
+			return fmt.Errorf("invalid afternoon window %s to %s: times must be from 00:00 to 23:59", formatTimeOfDay(c.AfternoonStart), formatTimeOfDay(c.AfternoonEnd))
+		}
+	}
+	if c.AfternoonEnd == c.AfternoonStart {
+		return fmt.Errorf("invalid afternoon window %s to %s: the start and end must differ", formatTimeOfDay(c.AfternoonStart), formatTimeOfDay(c.AfternoonEnd))
+	}
+	for _, promotion := range c.RetailerMultipliers {
+		if err := promotion.validate(); err != nil {
+			return err
+		}
+	}
+	known := make(map[string]bool)
+	for _, name := range ruleNames() {
+		known[name] = true
+	}
+	for name := range c.DisabledRules {
+		if !known[name] {
+			return fmt.Errorf("unknown rule %q: expected one of %s", name, strings.Join(ruleNames(), ", "))
+		}
+	}
+	if c.PointsCap != nil && *c.PointsCap < 0 {
+		return fmt.Errorf("invalid pointsCap %d: must not be negative", *c.PointsCap)
+	}
+	if c.PointsCap != nil && c.PointsFloor != nil && *c.PointsFloor > *c.PointsCap {
+		return fmt.Errorf("invalid pointsFloor %d: must not be above pointsCap %d", *c.PointsFloor, *c.PointsCap)
+	}
+	return nil
+}
+
+// Function to format an offset from midnight as a time of day, HH:MM.
+func formatTimeOfDay(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Function to write a rules config file for a test, returning its path.
+func writeRulesConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRulesConfigChangesTheScore(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+	}{
+		{"rules.yaml", "roundDollarPoints: 100\n"},
+		{"rules.json", `{"roundDollarPoints": 100}`},
+	} {
+		loaded, err := loadPointsConfig(writeRulesConfig(t, test.name, test.content))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		withPointsConfig(t, func(c *PointsConfig) { *c = loaded })
+
+		//Doubling the round dollar points takes the corner receipt's 50 for its round total to 100.
+		ts := newTestServer(t, testConfig())
+		if got := ts.points(t, ts.submit(t, cornerReceipt)); got != 159 {
+			t.Errorf("%s: corner receipt got %d points, want 159", test.name, got)
+		}
+		if got := ts.points(t, ts.submit(t, targetReceipt)); got != 28 {
+			t.Errorf("%s: target receipt got %d points, want 28 as it has no round total", test.name, got)
+		}
+	}
+}
+
+func TestMalformedRulesConfigFailsToLoad(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		reason  string
+	}{
+		{"roundDollarPoints: [100\n", ""},
+		{"roundDollarPoints: fifty\n", "cannot unmarshal"},
+		{"roundDolarPoints: 100\n", "roundDolarPoints"},
+		{"roundDollarPoints: -5\n", "must not be negative"},
+		{"afternoonStart: 2pm\n", "invalid afternoonStart"},
+		{"descriptionMultiplier: \"0.125\"\n", "invalid descriptionMultiplier"},
+		{"rules:\n  noSuchRule:\n    enabled: false\n", "unknown rule"},
+	} {
+		path := writeRulesConfig(t, "rules.yaml", test.content)
+		_, err := loadPointsConfig(path)
+		if err == nil {
+			t.Errorf("%q: loaded, want startup to fail", test.content)
+			continue
+		}
+		if !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%q: got %v, want the file and %q named", test.content, err, test.reason)
+		}
+	}
+
+	if _, err := loadPointsConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("missing file: loaded, want startup to fail")
+	}
+}
+
+func TestRulesDisabledByTheEnvironment(t *testing.T) {
+	for _, test := range []struct {
+		env      string
+		disabled []string
+	}{
+		{"itemDescription,oddDay", []string{"itemDescription", "oddPurchaseDay"}},
+		{" itemDescription , oddPurchaseDay ,", []string{"itemDescription", "oddPurchaseDay"}},
+		{"afternoonPurchase", []string{"afternoonPurchase"}},
+	} {
+		t.Setenv("RULES_DISABLE", test.env)
+		config := defaultPointsConfig()
+		if err := config.applyEnv(); err != nil {
+			t.Fatalf("RULES_DISABLE=%s: %v", test.env, err)
+		}
+		for _, name := range test.disabled {
+			if !config.DisabledRules[name] {
+				t.Errorf("RULES_DISABLE=%s: %s is still enabled", test.env, name)
+			}
+		}
+		if config.DisabledRules["oddDay"] {
+			t.Errorf("RULES_DISABLE=%s: disabled oddDay rather than the rule it names", test.env)
+		}
+	}
+
+	//The corner receipt's afternoon purchase earned 10 of its 109 points.
+	t.Setenv("RULES_DISABLE", "afternoonPurchase")
+	withPointsConfig(t, func(c *PointsConfig) {
+		if err := c.applyEnv(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if got, err := defaultRuleSet().Score(exampleReceipt(t, cornerReceipt)); err != nil || got != 99 {
+		t.Errorf("corner receipt: got %d, %v, want 99 with the afternoon rule disabled", got, err)
+	}
+
+	t.Setenv("RULES_DISABLE", "itemDescription,noSuchRule")
+	config := defaultPointsConfig()
+	if err := config.applyEnv(); err == nil || !strings.Contains(err.Error(), `unknown rule "noSuchRule"`) {
+		t.Errorf("RULES_DISABLE naming an unknown rule: got %v, want startup to fail", err)
+	}
+}
+
+func TestRulesConfigTurnsRulesOffByTheirShortNames(t *testing.T) {
+	config, err := loadPointsConfig(writeRulesConfig(t, "rules.yaml", "rules:\n  oddDay:\n    enabled: false\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.DisabledRules["oddPurchaseDay"] {
+		t.Errorf("disabled rules: got %v, want oddPurchaseDay", config.DisabledRules)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Versions of the rule sets receipts can be scored with.
+const (
+	ruleVersionV1 = "v1"
+	ruleVersionV2 = "v2"
+)
+
+// Rule sets receipts can be scored with, by version. Each is built when used, so it takes the constants
+// in pointsConfig as loaded at startup.
+var ruleSets = map[string]func() RuleSet{
+	ruleVersionV1: v1RuleSet,
+	ruleVersionV2: v2RuleSet,
+}
+
+// Version of the rule set submitted receipts are scored with, and that is used when a request names none.
+var defaultRuleVersion = ruleVersionV1
+
+// Function to return the experimental rule set being trialled, the published rules with each item whose
+// trimmed description length is a multiple of 3 earning a quarter of its price rather than a fifth.
+func v2RuleSet() RuleSet {
+	set := v1RuleSet()
+	set.Version = ruleVersionV2
+	rules := make([]Rule, len(set.Rules))
+	for i, rule := range set.Rules {
+		if _, ok := rule.(ItemDescriptionRule); ok {
+			rule = ItemDescriptionRule{Multiplier: 25}
+		}
+		rules[i] = rule
+	}
+	set.Rules = rules
+	return set
+}
+
+// Function to return the rule set receipts are scored with when a request names none.
+func defaultRuleSet() RuleSet {
+	return ruleSets[defaultRuleVersion]()
+}
+
+// Function to return the rule set registered under a version, or the default rule set for an empty version.
+// Returns an error naming the known versions if none is registered under it.
+func lookupRuleSet(version string) (RuleSet, error) {
+	if version == "" {
+		return defaultRuleSet(), nil
+	}
+	build, ok := ruleSets[version]
+	if !ok {
+		return RuleSet{}, fmt.Errorf("unknown ruleVersion %q: expected one of %s", version, strings.Join(ruleVersions(), ", "))
+	}
+	return build(), nil
+}
+
+// Function to list the versions of every registered rule set in order.
+func ruleVersions() []string {
+	versions := make([]string, 0, len(ruleSets))
+	for version := range ruleSets {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Struct for returning the rules a rule set scores receipts with given as JSON, in the order they are applied.
+// Disabled lists the rules turned off by the rules config or RULES_DISABLE, which score nothing.
+type RulesResponse struct {
+	RuleVersion string   `json:"ruleVersion"`
+	Rules       []string `json:"rules"`
+	Adjustments []string `json:"adjustments"`
+	Disabled    []string `json:"disabled"`
+}
+
+// Function to handle requests for the rules receipts are scored with by default, or by the rule set the
+// ruleVersion parameter names, as resolved at startup.
+func (s *Server) rulesHandler(w http.ResponseWriter, r *http.Request) {
+	set, err := lookupRuleSet(r.URL.Query().Get("ruleVersion"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	response := RulesResponse{RuleVersion: set.Version, Rules: []string{}, Adjustments: []string{}, Disabled: []string{}}
+	for _, rule := range set.Rules {
+		response.Rules = append(response.Rules, rule.Name())
+	}
+	for _, adjustment := range set.Adjustments {
+		response.Adjustments = append(response.Adjustments, adjustment.Name())
+	}
+	for _, name := range ruleNames() {
+		if pointsConfig.DisabledRules[name] {
+			response.Disabled = append(response.Disabled, name)
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Function to get the points of a stored receipt on the server under test, with the version they were scored with.
+func (ts *testServer) pointsResponse(t *testing.T, id string) PointsResponse {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts/"+id+"/points", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET points of %s: got %d, want 200: %s", id, resp.StatusCode, readBody(t, resp))
+	}
+	var response PointsResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestPointsGiveTheRuleVersionTheReceiptWasScoredWith(t *testing.T) {
+	saved := defaultRuleVersion
+	t.Cleanup(func() { defaultRuleVersion = saved })
+	ts := newTestServer(t, testConfig())
+
+	//The pizza earns a quarter of 12.25 under v2, rounded up to 4 points rather than 3.
+	scored := map[string]string{}
+	for _, version := range []string{ruleVersionV1, ruleVersionV2} {
+		defaultRuleVersion = version
+		scored[version] = ts.submit(t, targetReceipt)
+	}
+
+	//Switching the default back keeps each receipt's stored points and version.
+	defaultRuleVersion = ruleVersionV1
+	for version, want := range map[string]int{ruleVersionV1: 28, ruleVersionV2: 29} {
+		got := ts.pointsResponse(t, scored[version])
+		if got != (PointsResponse{Points: want, RuleVersion: version}) {
+			t.Errorf("points of the receipt scored under %s: got %+v, want %d under %s", version, got, want, version)
+		}
+	}
+}
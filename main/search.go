@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Fields of a receipt a search can match against.
+const (
+	searchItems    = "items"
+	searchRetailer = "retailer"
+)
+
+// Struct for a search of the stored receipts: the text to find, ignoring case, and the field to find it in.
+type SearchQuery struct {
+	Text  string
+	Field string
+}
+
+// Function to report whether a receipt contains the query text in the searched field.
+func (q SearchQuery) match(receipt *Receipt) bool {
+	text := strings.ToLower(q.Text)
+	if q.Field == searchRetailer {
+		return strings.Contains(strings.ToLower(receipt.Retailer), text)
+	}
+	for _, item := range receipt.Items {
+		if strings.Contains(strings.ToLower(item.Description), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interface for stores that can search their receipts themselves, such as with an SQL query.
+// Search returns the ids of up to limit matching receipts with an id after the given one, in id order.
+// Stores without it are searched by reading every receipt.
+type ReceiptSearcher interface {
+	Search(ctx context.Context, query SearchQuery, after string, limit int) ([]string, error)
+}
+
+// Struct for a ReceiptSearcher that reads every stored receipt and matches it in turn.
+type scanSearch struct {
+	store ReceiptStore
+}
+
+// Error used to stop reading receipts once a search has found enough.
+var errSearchFull = errors.New("search full")
+
+// Function to search the stored receipts by reading each one in id order.
+func (s scanSearch) Search(ctx context.Context, query SearchQuery, after string, limit int) ([]string, error) {
+	ids := []string{}
+	err := s.store.Each(ctx, after, func(id string, receipt *Receipt) error {
+		if !query.match(receipt) {
+			return nil
+		}
+		ids = append(ids, id)
+		if len(ids) == limit {
+			return errSearchFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSearchFull) {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Function to escape the LIKE wildcards in text so it is matched literally, with \ as the escape character.
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+// Function to handle requests searching the stored receipts a page at a time.
+// The q parameter is found anywhere in an item description, ignoring case, or in the retailer name with
+// field=retailer. Matching receipts are returned as in a listing, in id order, with a cursor to the next page.
+func (s *Server) searchReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	search := SearchQuery{Text: strings.TrimSpace(query.Get("q")), Field: query.Get("field")}
+	if search.Text == "" {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, "a search needs the text to find as q")
+		return
+	}
+	switch search.Field {
+	case "":
+		search.Field = searchItems
+	case searchItems, searchRetailer:
+	default:
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("invalid field %q: expected %s or %s", search.Field, searchItems, searchRetailer))
+		return
+	}
+
+	limit, err := parseListLimit(query)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	//Results are in id order, so a cursor is the id the previous page ended at.
+	after := ""
+	cursor, err := decodeCursor(query.Get("cursor"), "id", "asc")
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+	if cursor != nil {
+		after = cursor.ID
+	}
+
+	//Ask for one more than the page holds to know whether there is another page.
+	searcher := ReceiptSearcher(scanSearch{store: s.store})
+	if store, ok := s.store.(ReceiptSearcher); ok {
+		searcher = store
+	}
+	ids, err := searcher.Search(r.Context(), search, after, limit+1)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	response := ReceiptListResponse{Receipts: []ReceiptSummary{}}
+	if len(ids) > limit {
+		ids = ids[:limit]
+		response.NextCursor = encodeCursor(listCursor{Sort: "id", Order: "asc", ID: ids[len(ids)-1]})
+	}
+	err = eachByID(r.Context(), s.store, ids, func(id string, receipt *Receipt) error {
+		summary, err := receiptSummary(id, receipt)
+		if err != nil {
+			return err
+		}
+		summary.Links = s.receiptLinks(r, id)
+		response.Receipts = append(response.Receipts, summary)
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Function to return a receipt from the given retailer holding one item with the given description.
+func itemReceipt(retailer string, description string) string {
+	name, _ := json.Marshal(retailer)
+	item, _ := json.Marshal(description)
+	return `{"retailer":` + string(name) + `,"purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":` + string(item) + `,"price":"2.25"}],"total":"2.25"}`
+}
+
+// Function to search the server under test, following nextCursor through every page, and return the ids found in order.
+func (ts *testServer) searchAll(t *testing.T, query url.Values) []string {
+	t.Helper()
+
+	query = maps.Clone(query)
+	ids := []string{}
+	for pages := 0; ; pages++ {
+		resp := ts.do(t, "GET", "/receipts/search?"+query.Encode(), "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /receipts/search?%s: got %d, want 200: %s", query.Encode(), resp.StatusCode, readBody(t, resp))
+		}
+		var response ReceiptListResponse
+		decodeBody(t, resp, &response)
+		if pages > 10 {
+			t.Fatalf("search %s is still paging after %d pages", query.Encode(), pages)
+		}
+		for _, summary := range response.Receipts {
+			ids = append(ids, summary.ID)
+		}
+		if response.NextCursor == "" {
+			return ids
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+}
+
+func TestSearchFindsItemsAndRetailersIgnoringCase(t *testing.T) {
+	memory := newTestServer(t, testConfig())
+	sqlite := newTestServerWithStore(t, testConfig(), openTestSQLiteStore(t, filepath.Join(t.TempDir(), "receipts.db")))
+
+	for _, ts := range []*testServer{memory, sqlite} {
+		ids := map[string]string{
+			"pepsi":  ts.submit(t, itemReceipt("Walgreens", "Pepsi 12PK")),
+			"dew":    ts.submit(t, itemReceipt("Target", "Mountain Dew 12PK")),
+			"gator":  ts.submit(t, itemReceipt("Target", "Gatorade")),
+			"corner": ts.submit(t, cornerReceipt),
+		}
+		sorted := func(names ...string) []string {
+			var want []string
+			for _, name := range names {
+				want = append(want, ids[name])
+			}
+			slices.Sort(want)
+			return want
+		}
+
+		for _, test := range []struct {
+			query url.Values
+			want  []string
+		}{
+			{url.Values{"q": {"12pk"}}, sorted("pepsi", "dew")},
+			{url.Values{"q": {"  GATORADE "}}, sorted("gator", "corner")},
+			{url.Values{"q": {"target"}}, sorted()},
+			{url.Values{"q": {"target"}, "field": {"retailer"}}, sorted("dew", "gator")},
+			{url.Values{"q": {"&m c"}, "field": {"retailer"}}, sorted("corner")},
+			{url.Values{"q": {"12pk"}, "field": {"items"}, "limit": {"1"}}, sorted("pepsi", "dew")},
+			{url.Values{"q": {"e"}, "limit": {"1"}}, sorted("pepsi", "dew", "gator", "corner")},
+			{url.Values{"q": {"12%"}}, sorted()},
+			{url.Values{"q": {"Dew_12"}}, sorted()},
+		} {
+			if got := ts.searchAll(t, test.query); !slices.Equal(got, test.want) {
+				t.Errorf("search %s: got %v, want %v", test.query.Encode(), got, test.want)
+			}
+		}
+	}
+}
+
+func TestSearchRejectsInvalidParameters(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ts.submit(t, cornerReceipt)
+
+	for _, query := range []string{
+		"",
+		"q=",
+		"q=++",
+		"q=gatorade&field=total",
+		"q=gatorade&limit=0",
+		"q=gatorade&limit=x",
+		"q=gatorade&cursor=not-a-cursor",
+		"q=gatorade&cursor=" + encodeCursor(listCursor{Sort: "points", Order: "desc", ID: newReceiptID()}),
+	} {
+		expectProblem(t, ts.do(t, "GET", "/receipts/search?"+query, ""), http.StatusBadRequest, codeInvalidParameter)
+	}
+}
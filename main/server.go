@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Struct for the state shared by the HTTP handlers.
+type Server struct {
+	config Config
+	store  ReceiptStore
+	clock  Clock
+
+	//Index from receipt content hash to the id it was stored under, used when duplicates are detected.
+	hashes hashIndex
+
+	//Idempotency keys seen recently on receipt submissions.
+	idempotency *idempotencyKeys
+
+	//Held while a stored receipt is read, changed, and saved again.
+	locks receiptLocks
+
+	//Aggregate statistics over the stored receipts.
+	stats StatsProvider
+
+	//Passes processed receipts to the clients streaming /events.
+	events *eventHub
+
+	//Receipts accepted to be scored in the background, and the workers scoring them.
+	async *asyncScorer
+
+	//Open websocket sessions, closed on shutdown.
+	sockets socketSet
+
+	//Notifies webhook targets of processed receipts, nil when none are configured.
+	webhooks *webhookNotifier
+
+	//Checks that must pass for /readyz to report the server ready.
+	readiness readinessChecks
+
+	//Router built by Handler, whose named routes links to receipts are generated from.
+	router *mux.Router
+}
+
+// Function to create a server that stores receipts in the given store.
+func NewServer(cfg Config, store ReceiptStore) *Server {
+	s := &Server{
+		config: cfg,
+		store:  store,
+		clock:  systemClock{},
+
+		idempotency: newIdempotencyKeys(cfg.IdempotencyWindow),
+		events:      newEventHub(),
+	}
+
+	//Stores that keep their own statistics answer for them, the rest are read in full.
+	s.stats = scanStats{store: store}
+	if provider, ok := store.(StatsProvider); ok {
+		s.stats = provider
+	}
+
+	s.async = newAsyncScorer(cfg.AsyncWorkers, cfg.AsyncQueueSize, s.scoreAccepted)
+
+	if len(cfg.WebhookURLs) > 0 {
+		s.webhooks = newWebhookNotifier(cfg.WebhookURLs, cfg.WebhookSecret, cfg.WebhookTimeout)
+	}
+
+	//Receipts the store evicts or expires are dropped from the duplicate index.
+	if reporter, ok := store.(removalReporter); ok {
+		reporter.reportRemovals(func(id string) { s.hashes.removedByStore(id) }, func(ids []string) { s.hashes.removedByStore(ids...) })
+	}
+
+	//Receipts stored before the server started are found as duplicates too. Should the store not be read,
+	//they are stored again under new ids when resubmitted, rather than the server not starting.
+	if cfg.Dedupe {
+		if err := s.seedDuplicateIndex(context.Background()); err != nil {
+			log.Printf("indexing stored receipts for duplicate detection: %v", err)
+		}
+	}
+
+	//Stores with a backing service are only ready while it answers.
+	if p, ok := store.(pinger); ok {
+		s.AddReadinessCheck("store", p.Ping)
+	}
+	return s
+}
+
+// Function to build the HTTP router serving every endpoint.
+func (s *Server) Handler() http.Handler {
+
+	//Implement a new HTTP request router r.
+	r := mux.NewRouter()
+	s.router = r
+
+	//Report unknown routes and unsupported methods as problem responses, and answer OPTIONS on known routes.
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+
+	//Count and time every routed request.
+	r.Use(metricsMiddleware)
+
+	//Limit the size of every request body, except on the routes reading their bodies as a stream,
+	//which limit each line instead.
+	limitBody := maxBodyMiddleware(s.config.MaxBodyBytes)
+
+	//Serve the API under /v1, and at its original unprefixed paths for existing clients, with the same handlers.
+	//The prefix is part of each path rather than a PathPrefix subrouter, as mux loses a method mismatch found
+	//on one route of a subrouter when a later route of it matches the prefix, turning every 405 into a 404.
+	v1 := r.NewRoute().Subrouter()
+	v1.Use(apiVersionMiddleware("1"))
+	limited, streamed := v1.NewRoute().Subrouter(), v1.NewRoute().Subrouter()
+	limited.Use(limitBody)
+	s.registerV1Routes(limited, streamed, "/v1")
+	s.registerV1Routes(limited, streamed, "")
+
+	//Operational endpoints are not part of the versioned API.
+	ops := r.NewRoute().Subrouter()
+	ops.Use(limitBody)
+
+	//Serve the process counters, such as receipts evicted from the memory store.
+	ops.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+
+	//Handle Prometheus scrapes.
+	ops.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	//Handle requests for the build that is running.
+	ops.HandleFunc("/version", s.versionHandler).Methods("GET")
+
+	//Handle liveness and readiness probes.
+	ops.HandleFunc("/healthz", s.healthzHandler).Methods("GET")
+	ops.HandleFunc("/readyz", s.readyzHandler).Methods("GET")
+
+	s.readiness.routed.Store(true)
+	return r
+}
+
+// Function to register the routes of version 1 of the API under the given path prefix, on r, which limits
+// the size of request bodies, or on streamed for the uploads read a line at a time.
+// A later version registers its own routes on its own prefix, reusing these handlers where the request
+// and response are unchanged and wrapping them, or adding new ones, where they differ.
+func (s *Server) registerV1Routes(r *mux.Router, streamed *mux.Router, prefix string) {
+
+	//Write endpoints only accept JSON bodies.
+	requireJSON := requireContentType("application/json")
+
+	//Handle any new receipt request (POST) given as a JSON, as XML for clients that can't send JSON,
+	//or as protocol buffers for high-volume clients.
+	requireJSONOrXML := requireContentType("application/json", "application/xml", "text/xml")
+	requireReceipt := requireContentType("application/json", "application/xml", "text/xml", protobufMediaType)
+	r.Handle(prefix+"/receipts/process", requireReceipt(http.HandlerFunc(s.processReceiptsHandler))).Methods("POST")
+
+	//Handle any request to check a receipt without storing it, given as a JSON or XML.
+	r.Handle(prefix+"/receipts/validate", requireJSONOrXML(http.HandlerFunc(s.validateReceiptHandler))).Methods("POST")
+
+	//Handle any request to score a receipt without storing it, given as a JSON.
+	r.Handle(prefix+"/receipts/points", requireJSON(http.HandlerFunc(s.scoreReceiptHandler))).Methods("POST")
+
+	//Handle any request for the points of several stored receipts at once.
+	r.Handle(prefix+"/receipts/points/batch", requireJSON(http.HandlerFunc(s.batchPointsHandler))).Methods("POST")
+
+	//Handle any upload of receipts as CSV.
+	r.Handle(prefix+"/receipts/import.csv", requireContentType("text/csv", "multipart/form-data")(http.HandlerFunc(s.importCSVHandler))).Methods("POST")
+
+	//Handle any upload of receipts as one JSON document per line.
+	streamed.Handle(prefix+"/receipts/import.ndjson", requireContentType("application/x-ndjson")(http.HandlerFunc(s.importNDJSONHandler))).Methods("POST")
+
+	//Handle any request to export the stored receipts as CSV, routed before a receipt id could match it.
+	r.HandleFunc(prefix+"/receipts/export.csv", s.exportCSVHandler).Methods("GET")
+
+	//Handle any request to export the stored receipts as one JSON document per line.
+	r.HandleFunc(prefix+"/receipts/export.ndjson", s.exportNDJSONHandler).Methods("GET")
+
+	//Handle any request searching the stored receipts.
+	r.HandleFunc(prefix+"/receipts/search", s.searchReceiptsHandler).Methods("GET")
+
+	//Handle any request listing the stored receipts.
+	r.HandleFunc(prefix+"/receipts", s.listReceiptsHandler).Methods("GET")
+
+	//The paths above name endpoints rather than receipts, so a wrong method on one of them is a 405 for that
+	//endpoint rather than a request for a receipt with an invalid id. The whole path is checked before the
+	//path template, as mux clears a method mismatch found on an earlier route whenever any matcher of a
+	//later route succeeds, so this matcher must only succeed where the route's path does too.
+	endpoints := map[string]bool{"process": true, "points": true, "import.csv": true, "import.ndjson": true, "export.csv": true, "export.ndjson": true, "search": true, "validate": true}
+	receiptRoute := func() *mux.Route {
+		return r.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+			id, ok := strings.CutPrefix(r.URL.Path, prefix+"/receipts/")
+			return ok && id != "" && !strings.Contains(id, "/") && !endpoints[id]
+		}).Path(prefix + "/receipts/{id}")
+	}
+
+	//Handle any request for a stored receipt given a valid receipt id.
+	receiptRoute().HandlerFunc(s.getReceiptHandler).Methods("GET").Name(routeName(prefix, routeReceipt))
+
+	//Handle any request to replace a stored receipt given as a JSON.
+	receiptRoute().Handler(requireJSON(http.HandlerFunc(s.putReceiptHandler))).Methods("PUT")
+
+	//Handle any request to partially update a stored receipt given as a JSON merge patch.
+	requirePatch := requireContentType("application/merge-patch+json", "application/json")
+	receiptRoute().Handler(requirePatch(http.HandlerFunc(s.patchReceiptHandler))).Methods("PATCH")
+
+	//Handle any request to remove a stored receipt given a valid receipt id.
+	receiptRoute().HandlerFunc(s.deleteReceiptHandler).Methods("DELETE")
+
+	//Handle any new points request given a valid receipt id.
+	r.HandleFunc(prefix+"/receipts/{id}/points", s.getPointsHandler).Methods("GET").Name(routeName(prefix, routePoints))
+
+	//Handle any request for how the points of a receipt were scored given a valid receipt id.
+	r.HandleFunc(prefix+"/receipts/{id}/points/breakdown", s.getPointsBreakdownHandler).Methods("GET").Name(routeName(prefix, routeBreakdown))
+
+	//Handle any request for how each item of a receipt was scored given a valid receipt id.
+	r.HandleFunc(prefix+"/receipts/{id}/items", s.getItemScoresHandler).Methods("GET")
+
+	//Handle any request comparing how two stored receipts scored given two valid receipt ids.
+	r.HandleFunc(prefix+"/receipts/{id}/compare/{otherId}", s.compareReceiptsHandler).Methods("GET")
+
+	//Handle requests for the rules receipts are scored with.
+	r.HandleFunc(prefix+"/rules", s.rulesHandler).Methods("GET")
+
+	//Handle any request listing the receipts of a single retailer.
+	r.HandleFunc(prefix+"/retailers/{name}/receipts", s.retailerReceiptsHandler).Methods("GET")
+
+	//Admin endpoints are only served when an admin token is configured.
+	if s.config.AdminToken != "" {
+		admin := requireAdmin(s.config.AdminToken)
+		r.Handle(prefix+"/admin/export", admin(http.HandlerFunc(s.exportHandler))).Methods("GET")
+		streamed.Handle(prefix+"/admin/import", admin(http.HandlerFunc(s.importHandler))).Methods("POST")
+		r.Handle(prefix+"/admin/recalculate", admin(http.HandlerFunc(s.recalculateHandler))).Methods("POST")
+		r.Handle(prefix+"/admin/receipts", admin(http.HandlerFunc(s.purgeHandler))).Methods("DELETE")
+		r.Handle(prefix+"/admin/backup", admin(http.HandlerFunc(s.backupHandler))).Methods("GET")
+		streamed.Handle(prefix+"/admin/restore", admin(requireContentType("application/gzip")(http.HandlerFunc(s.restoreHandler)))).Methods("POST")
+	}
+
+	//Handle requests for a live stream of processed receipts.
+	r.HandleFunc(prefix+"/events", s.eventsHandler).Methods("GET")
+
+	//Handle websocket sessions submitting receipts one message at a time.
+	r.HandleFunc(prefix+"/ws", s.socketHandler).Methods("GET")
+
+	//Handle GraphQL queries and mutations.
+	r.Handle(prefix+"/graphql", requireJSON(s.graphQLHandler())).Methods("POST")
+
+	//Handle requests for aggregate statistics over the stored receipts.
+	r.HandleFunc(prefix+"/stats", s.statsHandler).Methods("GET")
+
+	//Handle requests for the retailers ranked by points.
+	r.HandleFunc(prefix+"/stats/retailers", s.retailerStatsHandler).Methods("GET")
+
+	//Handle requests for the OpenAPI document describing these endpoints.
+	r.HandleFunc(prefix+"/openapi.json", openAPIHandler).Methods("GET")
+}
+
+// Function to build middleware that identifies the version of the API that served a request in the X-API-Version header.
+func apiVersionMiddleware(version string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-API-Version", version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Function to decode, validate, score, and store a receipt submitted through an API other than the JSON
+// endpoint, such as gRPC or GraphQL, so every way in checks and scores receipts the same way.
+// Returns the new id, or every field at fault when the receipt is not valid, or an error if it could not be stored.
+func (s *Server) submitReceipt(ctx context.Context, wire *wireReceipt) (string, []FieldError, error) {
+	receipt, err := wire.receipt(s.config.decodeOptions())
+	var badAmounts *amountFormatError
+	if errors.As(err, &badAmounts) {
+		return "", badAmounts.Errors, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	errs, err := s.validateAndScore(receipt)
+	if len(errs) > 0 || err != nil {
+		return "", errs, err
+	}
+	id, _, err := s.storeNewReceipt(ctx, receipt)
+	return id, nil, err
+}
+
+// Function to store a validated and scored receipt as newly submitted now and return its id, and whether it was
+// stored rather than found to duplicate a receipt already stored. Only a stored receipt is recorded as processed.
+func (s *Server) storeNewReceipt(ctx context.Context, receipt *Receipt) (string, bool, error) {
+	now := s.clock.Now().UTC()
+	receipt.CreatedAt = &now
+
+	id, created, err := s.saveReceipt(ctx, receipt)
+	if err != nil {
+		return "", false, err
+	}
+	if created {
+		s.receiptProcessed(id, receipt)
+	}
+	return id, created, nil
+}
+
+// Function to record that a newly submitted receipt was stored, counting it and notifying event streams and any webhook targets.
+// Nothing here waits on a target, so the request that submitted the receipt is never held up.
+func (s *Server) receiptProcessed(id string, receipt *Receipt) {
+	receiptsProcessed.Inc()
+	pointsAwarded.Add(float64(*receipt.Points))
+
+	event := ReceiptEvent{
+		ID:          id,
+		Retailer:    receipt.Retailer,
+		Total:       receipt.Total,
+		Points:      *receipt.Points,
+		ProcessedAt: s.clock.Now().UTC(),
+	}
+	s.events.publish(event)
+	if s.webhooks != nil {
+		s.webhooks.notify(event)
+	}
+}
+
+// Function to store a receipt under a newly generated id, as its first revision, and return the id and true.
+// When duplicate detection is enabled and an identical receipt is already stored, its id and false are returned
+// instead, and nothing is stored.
+func (s *Server) saveReceipt(ctx context.Context, receipt *Receipt) (string, bool, error) {
+	receipt.Revision = 1
+	if !s.config.Dedupe {
+		id := newReceiptID()
+		if err := s.store.Save(ctx, id, receipt); err != nil {
+			return "", false, err
+		}
+		return id, true, nil
+	}
+
+	//Hold the index lock across the save so two identical receipts can't both be stored.
+	hash := receiptHash(receipt)
+	defer s.hashes.lock()()
+
+	//The earlier receipt may since have expired or been replaced in a store that doesn't report it, in which
+	//case this one is stored afresh.
+	if id, exists := s.hashes.lookup(hash); exists {
+		stored, err := s.store.Get(ctx, id)
+		if err == nil && receiptHash(stored) == hash {
+			return id, false, nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return "", false, err
+		}
+	}
+
+	id := newReceiptID()
+	if err := s.store.Save(ctx, id, receipt); err != nil {
+		return "", false, err
+	}
+	s.hashes.set(hash, id)
+	return id, true, nil
+}
+
+// Function to translate a store error into a problem response.
+// A missing receipt is a 404; any other failure is logged and reported as a 500.
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeProblem(w, http.StatusNotFound, codeNotFound, "Receipt not found")
+		return
+	}
+
+	log.Printf("receipt store error: %v", err)
+	writeProblem(w, http.StatusInternalServerError, codeInternal, "Error accessing receipt store")
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Receipts from the challenge's examples, worth 28 and 109 points.
+const (
+	targetReceipt = `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Mountain Dew 12PK","price":"6.49"},{"shortDescription":"Emils Cheese Pizza","price":"12.25"},{"shortDescription":"Knorr Creamy Chicken","price":"1.26"},{"shortDescription":"Doritos Nacho Cheese","price":"3.35"},{"shortDescription":"   Klarbrunn 12-PK 12 FL OZ  ","price":"12.00"}],"total":"35.35"}`
+	cornerReceipt = `{"retailer":"M&M Corner Market","purchaseDate":"2022-03-20","purchaseTime":"14:33","items":[{"shortDescription":"Gatorade","price":"2.25"},{"shortDescription":"Gatorade","price":"2.25"},{"shortDescription":"Gatorade","price":"2.25"},{"shortDescription":"Gatorade","price":"2.25"}],"total":"9.00"}`
+)
+
+func TestMain(m *testing.M) {
+	//The server logs every backup, purge, and store failure, which is noise in test output.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// Function to return the default configuration with a small memory store, for tests to adjust.
+func testConfig() Config {
+	cfg := defaultConfig()
+	cfg.AdminToken = ""
+	cfg.DatabaseURL = ""
+	cfg.WebhookSecret = ""
+	cfg.MemoryShards = 4
+	return cfg
+}
+
+// Admin token the admin endpoints of servers under test are configured with, and the header carrying it.
+const testAdminToken = "test-admin-token"
+
+var adminHeader = []string{"Authorization", "Bearer " + testAdminToken}
+
+// Function to return the test configuration with the admin endpoints enabled.
+func adminConfig() Config {
+	cfg := testConfig()
+	cfg.AdminToken = testAdminToken
+	return cfg
+}
+
+// Struct for a server under test, reached over HTTP through an httptest server.
+type testServer struct {
+	*Server
+	clock *fakeClock
+	http  *httptest.Server
+}
+
+// Function to start a server under test on a fresh memory store with the given configuration.
+// Its clock is a fake one, stopped at noon on 2024-01-01 until the test advances it.
+func newTestServer(t *testing.T, cfg Config) *testServer {
+	t.Helper()
+
+	store := newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts)
+	return newTestServerWithStore(t, cfg, store)
+}
+
+// Function to start a server under test on the given store.
+func newTestServerWithStore(t *testing.T, cfg Config, store ReceiptStore) *testServer {
+	t.Helper()
+
+	server := NewServer(cfg, store)
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	server.clock = clock
+	ts := &testServer{Server: server, clock: clock, http: httptest.NewServer(server.Handler())}
+	t.Cleanup(func() {
+		ts.http.Close()
+		server.sockets.Close()
+		server.async.Close()
+		if server.webhooks != nil {
+			server.webhooks.Close(time.Second)
+		}
+	})
+	return ts
+}
+
+// Function to make a request to the server under test, with a JSON content type when there is a body.
+func (ts *testServer) do(t *testing.T, method string, path string, body string, header ...string) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = bytes.NewBufferString(body)
+	}
+	req, err := http.NewRequest(method, ts.http.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// Function to submit a receipt to the server under test and return its id, failing unless it was created.
+func (ts *testServer) submit(t *testing.T, body string) string {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/receipts/process", body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /receipts/process: got %d, want 201: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response ReceiptResponse
+	decodeBody(t, resp, &response)
+	return response.ID
+}
+
+// Function to read the whole body of a response.
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Function to decode a JSON response body into v.
+func decodeBody(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %s %s response: %v", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+}
+
+// Function to fetch the points of a stored receipt from the server under test, failing unless they are found.
+func (ts *testServer) points(t *testing.T, id string) int {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/receipts/"+id+"/points", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET points of %s: got %d, want 200: %s", id, resp.StatusCode, readBody(t, resp))
+	}
+	var response PointsResponse
+	decodeBody(t, resp, &response)
+	return response.Points
+}
+
+func TestSubmittedReceiptsScoreTheExamplePoints(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, test := range []struct {
+		body   string
+		points int
+	}{
+		{targetReceipt, 28},
+		{cornerReceipt, 109},
+	} {
+		id := ts.submit(t, test.body)
+		if got := ts.points(t, id); got != test.points {
+			t.Errorf("points of %s: got %d, want %d", id, got, test.points)
+		}
+	}
+}
+
+func TestConcurrentSubmissionsAndLookups(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	known := ts.submit(t, targetReceipt)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				resp, err := http.Post(ts.http.URL+"/receipts/process", "application/json", strings.NewReader(cornerReceipt))
+				if err != nil {
+					errs <- err
+					return
+				}
+				var response ReceiptResponse
+				err = json.NewDecoder(resp.Body).Decode(&response)
+				resp.Body.Close()
+				if err != nil || resp.StatusCode != http.StatusCreated {
+					errs <- fmt.Errorf("POST: got %d, %v", resp.StatusCode, err)
+					return
+				}
+
+				for _, id := range []string{known, response.ID} {
+					resp, err := http.Get(ts.http.URL + "/receipts/" + id + "/points")
+					if err != nil {
+						errs <- err
+						return
+					}
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusOK {
+						errs <- fmt.Errorf("GET points of %s: got %d", id, resp.StatusCode)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if ids := storedIDs(t, ts.store); len(ids) != 1+16*20 {
+		t.Fatalf("store holds %d receipts, want %d", len(ids), 1+16*20)
+	}
+}
+
+func TestV1AndLegacyPathsGiveTheSameResponses(t *testing.T) {
+	ts := newTestServer(t, adminConfig())
+	target := ts.submit(t, targetReceipt)
+	corner := ts.submit(t, cornerReceipt)
+	receiptIDs := regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+	for _, test := range []struct {
+		method, path, body string
+		header             []string
+
+		//Requests that store a new receipt are answered with its id, which differs between the two.
+		newID bool
+	}{
+		{method: "POST", path: "/receipts/process", body: targetReceipt, newID: true},
+		{method: "POST", path: "/receipts/validate", body: cornerReceipt},
+		{method: "POST", path: "/receipts/points?breakdown=true", body: targetReceipt},
+		{method: "POST", path: "/receipts/points/batch", body: `{"ids":["` + target + `","` + corner + `"]}`},
+		{method: "GET", path: "/receipts/" + target},
+		{method: "GET", path: "/receipts/" + target + "/points"},
+		{method: "GET", path: "/receipts/" + target + "/points/breakdown"},
+		{method: "GET", path: "/receipts/" + corner + "/items"},
+		{method: "GET", path: "/receipts/" + target + "/compare/" + corner},
+		{method: "GET", path: "/receipts/not-an-id/points"},
+		{method: "GET", path: "/receipts/" + newReceiptID()},
+		{method: "PUT", path: "/receipts/" + corner, body: cornerReceipt},
+		{method: "GET", path: "/receipts?limit=1"},
+		{method: "GET", path: "/receipts/search?q=gatorade"},
+		{method: "GET", path: "/receipts/export.csv"},
+		{method: "GET", path: "/receipts/export.ndjson"},
+		{method: "GET", path: "/retailers/Target/receipts"},
+		{method: "GET", path: "/rules"},
+		{method: "GET", path: "/stats"},
+		{method: "GET", path: "/stats/retailers"},
+		{method: "GET", path: "/openapi.json"},
+		{method: "GET", path: "/admin/export", header: adminHeader},
+		{method: "GET", path: "/admin/export"},
+	} {
+		var statuses [2]int
+		var bodies [2]string
+		//Links in the bodies carry the prefix the request came in under.
+		for i, prefix := range []string{"", "/v1"} {
+			resp := ts.do(t, test.method, prefix+test.path, test.body, test.header...)
+			if version := resp.Header.Get("X-API-Version"); version != "1" {
+				t.Errorf("%s %s: got X-API-Version %q, want 1", test.method, prefix+test.path, version)
+			}
+			statuses[i] = resp.StatusCode
+			bodies[i] = resp.Header.Get("Content-Type") + "\n" + strings.ReplaceAll(readBody(t, resp), "/v1/", "/")
+			if test.newID {
+				bodies[i] = receiptIDs.ReplaceAllString(bodies[i], "ID")
+			}
+		}
+		if statuses[0] != statuses[1] || bodies[0] != bodies[1] {
+			t.Errorf("%s %s: got %d %s\nunder /v1 got %d %s", test.method, test.path, statuses[0], bodies[0], statuses[1], bodies[1])
+		}
+	}
+}
+
+func BenchmarkProcessAndPoints(b *testing.B) {
+	cfg := testConfig()
+	server := NewServer(cfg, newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts))
+	handler := server.Handler()
+	b.Cleanup(func() {
+		server.sockets.Close()
+		server.async.Close()
+	})
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(targetReceipt))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			var response ReceiptResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				b.Fatal(err)
+			}
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/receipts/"+response.ID+"/points", nil))
+			if rec.Code != http.StatusOK {
+				b.Fatalf("GET points: got %d", rec.Code)
+			}
+		}
+	})
+}
+
+func BenchmarkGetPoints(b *testing.B) {
+	cfg := testConfig()
+	store := newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts)
+	server := NewServer(cfg, store)
+	handler := server.Handler()
+	b.Cleanup(func() {
+		server.sockets.Close()
+		server.async.Close()
+	})
+
+	receipt, err := decodeReceipt(strings.NewReader(receiptWithItems(300)), decodeOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := scoreReceipt(receipt); err != nil {
+		b.Fatal(err)
+	}
+	//A receipt stored without its points is scored again on every GET, as before the points were cached.
+	uncached := *receipt
+	uncached.Points = nil
+	for _, bench := range []struct {
+		name    string
+		receipt *Receipt
+	}{
+		{"cached", receipt},
+		{"recalculated", &uncached},
+	} {
+		id := newReceiptID()
+		if err := store.Save(context.Background(), id, bench.receipt); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("GET", "/receipts/"+id+"/points", nil))
+				if rec.Code != http.StatusOK {
+					b.Fatalf("GET points: got %d", rec.Code)
+				}
+			}
+		})
+	}
+}
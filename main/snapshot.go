@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Magic word at the start of every snapshot file's header line.
+const snapshotMagic = "receipts-snapshot-v1"
+
+// Function to write every receipt in the store to a snapshot file.
+// The file starts with a header line giving the length and SHA-256 checksum of the JSON body that follows,
+// and is written to a temporary file in the same directory and renamed over the old snapshot,
+// so a crash part way through never leaves a half written snapshot in its place.
+func (s *shardedStore) writeSnapshot(path string) error {
+	body, err := json.Marshal(s.receipts())
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	header := fmt.Sprintf("%s %d %s\n", snapshotMagic, len(body), hex.EncodeToString(sum[:]))
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(header); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Function to add the receipts in a snapshot file to the store, counting them as saved when they were created.
+// A missing file leaves the store empty; a file whose header does not match its body is rejected
+// with an error and the store is left as it was.
+func (s *shardedStore) loadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	//Check the header before trusting any of the body.
+	newline := bytes.IndexByte(data, '\n')
+	if newline < 0 {
+		return fmt.Errorf("snapshot %s has no header", path)
+	}
+	var magic, checksum string
+	var length int
+	if _, err := fmt.Sscanf(string(data[:newline]), "%s %d %s", &magic, &length, &checksum); err != nil || magic != snapshotMagic {
+		return fmt.Errorf("snapshot %s has a malformed header", path)
+	}
+
+	body := data[newline+1:]
+	if len(body) != length {
+		return fmt.Errorf("snapshot %s is %d bytes long, the header says %d", path, len(body), length)
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != checksum {
+		return fmt.Errorf("snapshot %s does not match its checksum", path)
+	}
+
+	receipts := make(map[string]*Receipt)
+	if err := json.Unmarshal(body, &receipts); err != nil {
+		return fmt.Errorf("decoding snapshot %s: %w", path, err)
+	}
+
+	for id, receipt := range receipts {
+		s.restore(id, receipt)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Function to fill a sharded store with receipts, returning them by id.
+func populatedStore(t *testing.T, n int) (*shardedStore, map[string]*Receipt) {
+	t.Helper()
+
+	store := newShardedStore(4, 0, 0)
+	want := make(map[string]*Receipt)
+	for i := 0; i < n; i++ {
+		body := targetReceipt
+		if i%2 == 1 {
+			body = cornerReceipt
+		}
+		id := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		receipt := scoredReceipt(t, body)
+		if err := store.Save(context.Background(), id, receipt); err != nil {
+			t.Fatal(err)
+		}
+		want[id] = receipt
+	}
+	return store, want
+}
+
+func TestSnapshotRoundTripsAPopulatedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.snapshot")
+	store, want := populatedStore(t, 50)
+	if err := store.writeSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newShardedStore(4, 0, 0)
+	if err := loaded.loadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if ids := storedIDs(t, loaded); len(ids) != len(want) {
+		t.Fatalf("snapshot loaded %d receipts, want %d", len(ids), len(want))
+	}
+	for id, receipt := range want {
+		expectStored(t, loaded, id, receipt)
+	}
+
+	//Nothing is left behind in the directory but the snapshot itself.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("snapshot directory holds %d files, want 1", len(entries))
+	}
+}
+
+func TestMissingSnapshotStartsEmpty(t *testing.T) {
+	store := newShardedStore(4, 0, 0)
+	if err := store.loadSnapshot(filepath.Join(t.TempDir(), "missing.snapshot")); err != nil {
+		t.Fatalf("loading a missing snapshot: %v", err)
+	}
+	if ids := storedIDs(t, store); len(ids) != 0 {
+		t.Fatalf("store holds %v, want none", ids)
+	}
+}
+
+func TestDamagedSnapshotIsRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.snapshot")
+	store, _ := populatedStore(t, 10)
+	if err := store.writeSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newline := bytes.IndexByte(data, '\n')
+
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)-2] ^= 1
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", data[:len(data)/2]},
+		{"header only", data[:newline+1]},
+		{"no header", data[newline+1:]},
+		{"flipped byte", flipped},
+		{"foreign header", append([]byte("other-snapshot 2 0\n"), "{}"...)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := os.WriteFile(path, test.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			loaded := newShardedStore(4, 0, 0)
+			if err := loaded.loadSnapshot(path); err == nil {
+				t.Fatal("loading a damaged snapshot: got no error")
+			}
+			if ids := storedIDs(t, loaded); len(ids) != 0 {
+				t.Fatalf("a damaged snapshot loaded %d receipts, want none", len(ids))
+			}
+		})
+	}
+}
+
+func TestTruncatedSnapshotBootsEmptyWithAWarning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.snapshot")
+	store, _ := populatedStore(t, 10)
+	if err := store.writeSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+
+	cfg := testConfig()
+	cfg.SnapshotFile = path
+	opened, closeStore, err := openMemoryStore(cfg)
+	if err != nil {
+		t.Fatalf("opening with a truncated snapshot: %v", err)
+	}
+	if ids := storedIDs(t, opened); len(ids) != 0 {
+		t.Fatalf("store holds %d receipts, want none", len(ids))
+	}
+	if !strings.Contains(logged.String(), "warning: starting with an empty store") {
+		t.Fatalf("no warning logged, got %q", logged.String())
+	}
+
+	//Closing writes a fresh, readable snapshot over the damaged one.
+	if err := closeStore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := newShardedStore(4, 0, 0).loadSnapshot(path); err != nil {
+		t.Fatalf("snapshot written on close: %v", err)
+	}
+}
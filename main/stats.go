@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/cases"
+)
+
+// Number of retailers returned by the leaderboard when no limit is given.
+const defaultLeaderboardLimit = 10
+
+// Struct for returning aggregate statistics over every stored receipt given as JSON.
+// Every number is zero when no receipts are stored.
+type StatsResponse struct {
+	Receipts      int            `json:"receipts"`
+	TotalPoints   int            `json:"totalPoints"`
+	AveragePoints float64        `json:"averagePoints"`
+	MinPoints     int            `json:"minPoints"`
+	MaxPoints     int            `json:"maxPoints"`
+	Retailers     map[string]int `json:"retailers"`
+}
+
+// Struct for the aggregate numbers of one retailer given as JSON.
+// Name is the most common spelling among the receipts grouped together.
+type RetailerStats struct {
+	Name        string `json:"name"`
+	Receipts    int    `json:"receipts"`
+	TotalPoints int    `json:"totalPoints"`
+}
+
+// Struct for returning the retailers ranked by points given as JSON.
+type RetailerLeaderboardResponse struct {
+	Retailers []RetailerStats `json:"retailers"`
+}
+
+// Interface for computing aggregate statistics over the stored receipts.
+// A store that keeps running counters can implement it to answer without reading every receipt.
+// RetailerStats gives every retailer, ranked by total points, then by receipts, then by name.
+type StatsProvider interface {
+	Stats(ctx context.Context) (StatsResponse, error)
+	RetailerStats(ctx context.Context) ([]RetailerStats, error)
+}
+
+// Struct for a StatsProvider that reads every stored receipt on each call.
+// Each only holds a store's locks while reading a batch of receipts, so saves carry on while it runs.
+type scanStats struct {
+	store ReceiptStore
+}
+
+// Function to compute the statistics by reading every stored receipt.
+func (s scanStats) Stats(ctx context.Context) (StatsResponse, error) {
+	stats := StatsResponse{Retailers: make(map[string]int)}
+	err := s.store.Each(ctx, "", func(id string, receipt *Receipt) error {
+		points, err := storedPoints(receipt)
+		if err != nil {
+			return err
+		}
+
+		if stats.Receipts == 0 || points < stats.MinPoints {
+			stats.MinPoints = points
+		}
+		if stats.Receipts == 0 || points > stats.MaxPoints {
+			stats.MaxPoints = points
+		}
+		stats.Receipts++
+		stats.TotalPoints += points
+		stats.Retailers[receipt.Retailer]++
+		return nil
+	})
+	if err != nil {
+		return StatsResponse{}, err
+	}
+
+	if stats.Receipts > 0 {
+		stats.AveragePoints = float64(stats.TotalPoints) / float64(stats.Receipts)
+	}
+	return stats, nil
+}
+
+// Function to normalise a retailer name for grouping and matching, trimming it, collapsing runs of
+// whitespace, and folding case, so "Target ", "target", and "TARGET" are the same retailer.
+func retailerKey(name string) string {
+	return cases.Fold().String(strings.Join(strings.Fields(name), " "))
+}
+
+// Function to compute the numbers of every retailer by reading every stored receipt.
+// Retailer names are grouped by retailerKey, and each group is named by its most common spelling.
+func (s scanStats) RetailerStats(ctx context.Context) ([]RetailerStats, error) {
+	type group struct {
+		stats     RetailerStats
+		spellings map[string]int
+	}
+	groups := make(map[string]*group)
+
+	err := s.store.Each(ctx, "", func(id string, receipt *Receipt) error {
+		points, err := storedPoints(receipt)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSpace(receipt.Retailer)
+		key := retailerKey(name)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{spellings: make(map[string]int)}
+			groups[key] = g
+		}
+		g.stats.Receipts++
+		g.stats.TotalPoints += points
+		g.spellings[name]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	retailers := make([]RetailerStats, 0, len(groups))
+	for _, g := range groups {
+		//Name the group by its most common spelling, the alphabetically first on a tie.
+		for spelling, n := range g.spellings {
+			best := g.spellings[g.stats.Name]
+			if g.stats.Name == "" || n > best || (n == best && spelling < g.stats.Name) {
+				g.stats.Name = spelling
+			}
+		}
+		retailers = append(retailers, g.stats)
+	}
+
+	sort.Slice(retailers, func(i, j int) bool {
+		a, b := retailers[i], retailers[j]
+		if a.TotalPoints != b.TotalPoints {
+			return a.TotalPoints > b.TotalPoints
+		}
+		if a.Receipts != b.Receipts {
+			return a.Receipts > b.Receipts
+		}
+		return a.Name < b.Name
+	})
+	return retailers, nil
+}
+
+// Function to handle requests for aggregate statistics over every stored receipt.
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.stats.Stats(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Function to handle requests for the retailers ranked by the points their receipts scored.
+// The limit parameter gives how many retailers are returned, 10 by default.
+func (s *Server) retailerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLeaderboardLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxListLimit {
+			writeProblem(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("invalid limit %q: expected a number from 1 to %d", value, maxListLimit))
+			return
+		}
+		limit = n
+	}
+
+	retailers, err := s.stats.RetailerStats(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if len(retailers) > limit {
+		retailers = retailers[:limit]
+	}
+	writeJSON(w, http.StatusOK, RetailerLeaderboardResponse{Retailers: retailers})
+}
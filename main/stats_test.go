@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Function to fetch the statistics from the server under test.
+func (ts *testServer) stats(t *testing.T) StatsResponse {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/stats", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stats: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var stats StatsResponse
+	decodeBody(t, resp, &stats)
+	return stats
+}
+
+func TestStatsOfASeededStore(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	for _, body := range []string{targetReceipt, targetReceipt, cornerReceipt, goldenReceipts[3].body} {
+		ts.submit(t, body)
+	}
+	//A receipt stored before points were kept is scored as it is read.
+	if err := ts.store.Save(context.Background(), newReceiptID(), exampleReceipt(t, cornerReceipt)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := StatsResponse{
+		Receipts:      5,
+		TotalPoints:   28 + 28 + 109 + 15 + 109,
+		AveragePoints: 57.8,
+		MinPoints:     15,
+		MaxPoints:     109,
+		Retailers:     map[string]int{"Target": 2, "M&M Corner Market": 2, "Walgreens": 1},
+	}
+	if got := ts.stats(t); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stats: got %+v, want %+v", got, want)
+	}
+}
+
+func TestStatsOfAnEmptyStoreAreZero(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	resp := ts.do(t, "GET", "/stats", "")
+	if body := readBody(t, resp); body != `{"receipts":0,"totalPoints":0,"averagePoints":0,"minPoints":0,"maxPoints":0,"retailers":{}}`+"\n" {
+		t.Fatalf("stats of an empty store: got %s", body)
+	}
+}
+
+func TestStatsReportStoreErrors(t *testing.T) {
+	ts, store := newStubbedServer(t, testConfig())
+	ts.submit(t, targetReceipt)
+
+	store.fail(errors.New("connection refused"))
+	expectProblem(t, ts.do(t, "GET", "/stats", ""), http.StatusInternalServerError, codeInternal)
+}
+
+// Function to store a receipt from the given retailer scored with the given points straight into the store.
+func (ts *testServer) seedRetailer(t *testing.T, retailer string, points int) {
+	t.Helper()
+
+	receipt := exampleReceipt(t, targetReceipt)
+	receipt.Retailer = retailer
+	receipt.Points = &points
+	if err := ts.store.Save(context.Background(), newReceiptID(), receipt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Function to fetch the retailer ranking from the server under test with the given query.
+func (ts *testServer) retailerStats(t *testing.T, query string) []RetailerStats {
+	t.Helper()
+
+	resp := ts.do(t, "GET", "/stats/retailers"+query, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stats/retailers%s: got %d, want 200: %s", query, resp.StatusCode, readBody(t, resp))
+	}
+	var response RetailerLeaderboardResponse
+	decodeBody(t, resp, &response)
+	return response.Retailers
+}
+
+func TestRetailerStatsRankAndGroupRetailers(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	for _, seed := range []struct {
+		retailer string
+		points   int
+	}{
+		{"Target ", 10}, {"target", 20}, {"Target", 5}, {"target", 5},
+		{"Walgreens", 40},
+		{"Costco", 30}, {"Aldi", 30},
+		{"M&M Corner Market", 25}, {"m&m  corner market", 25},
+	} {
+		ts.seedRetailer(t, seed.retailer, seed.points)
+	}
+
+	//Equal totals rank by receipts, then by name, and each group is named by its most common spelling.
+	want := []RetailerStats{
+		{Name: "M&M Corner Market", Receipts: 2, TotalPoints: 50},
+		{Name: "Target", Receipts: 4, TotalPoints: 40},
+		{Name: "Walgreens", Receipts: 1, TotalPoints: 40},
+		{Name: "Aldi", Receipts: 1, TotalPoints: 30},
+		{Name: "Costco", Receipts: 1, TotalPoints: 30},
+	}
+	if got := ts.retailerStats(t, ""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ranking: got %+v, want %+v", got, want)
+	}
+	if got := ts.retailerStats(t, "?limit=2"); !reflect.DeepEqual(got, want[:2]) {
+		t.Fatalf("ranking with limit=2: got %+v, want %+v", got, want[:2])
+	}
+}
+
+func TestRetailerStatsLimit(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	if got := ts.retailerStats(t, ""); got == nil || len(got) != 0 {
+		t.Fatalf("ranking of an empty store: got %v, want an empty list", got)
+	}
+
+	for i := 1; i <= 12; i++ {
+		ts.seedRetailer(t, fmt.Sprintf("Retailer %02d", i), i)
+	}
+	got := ts.retailerStats(t, "")
+	if len(got) != defaultLeaderboardLimit || got[0].Name != "Retailer 12" || got[9].Name != "Retailer 03" {
+		t.Fatalf("ranking by default: got %+v, want the top %d", got, defaultLeaderboardLimit)
+	}
+	if got := ts.retailerStats(t, "?limit=50"); len(got) != 12 {
+		t.Fatalf("ranking with limit=50: got %d retailers, want 12", len(got))
+	}
+	for _, limit := range []string{"0", "-1", "ten", "1001"} {
+		expectProblem(t, ts.do(t, "GET", "/stats/retailers?limit="+limit, ""), http.StatusBadRequest, codeInvalidParameter)
+	}
+}
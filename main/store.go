@@ -0,0 +1,368 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Error returned by a ReceiptStore when no receipt is stored under the requested id.
+var ErrNotFound = errors.New("receipt not found")
+
+// Error returned from an Each callback to stop the iteration without a failure.
+var errStopEach = errors.New("stop iterating receipts")
+
+// Interface for storing receipts by id.
+// Get and Delete return ErrNotFound for unknown ids; any other error is a failure of the store itself.
+// Each calls fn for every stored receipt with an id after the given one in id order, or every receipt
+// if after is empty, stopping at the first error fn returns; fn returns errStopEach to stop early.
+type ReceiptStore interface {
+	Save(ctx context.Context, id string, receipt *Receipt) error
+	Get(ctx context.Context, id string) (*Receipt, error)
+	Delete(ctx context.Context, id string) error
+	Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error
+}
+
+// Interface for stores that remove receipts by themselves, by evicting or expiring them, and report the ids removed.
+// The functions are registered before the store is used; evicted may be called with the store's locks held,
+// so it must not use the store.
+type removalReporter interface {
+	reportRemovals(evicted func(id string), expired func(ids []string))
+}
+
+// Names of the receipt store backends that may be selected with -store.
+const (
+	storeMemory   = "memory"
+	storeSQLite   = "sqlite"
+	storePostgres = "postgres"
+	storeRedis    = "redis"
+	storeBolt     = "bolt"
+)
+
+// Function to open the receipt store selected by the configuration.
+// The returned close function releases the store and must be called on shutdown.
+func openStore(cfg Config) (ReceiptStore, func() error, error) {
+	switch cfg.Store {
+	case storeMemory:
+		return openMemoryStore(cfg)
+	case storeSQLite:
+		store, err := openSQLiteStore(cfg.DBPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case storePostgres:
+		store, err := openPostgresStore(context.Background(), cfg.DatabaseURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case storeRedis:
+		store, err := openRedisStore(context.Background(), cfg.RedisAddr, cfg.RedisTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case storeBolt:
+		store, err := openBoltStore(cfg.DataFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown -store %q", cfg.Store)
+	}
+}
+
+// Function to call fn for each of the given ids in turn with the receipt stored under it.
+// Receipts deleted since the ids were listed are skipped.
+func eachByID(ctx context.Context, store ReceiptStore, ids []string, fn func(id string, receipt *Receipt) error) error {
+	for _, id := range ids {
+		receipt, err := store.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(id, receipt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to open the in-memory store, loading the snapshot file and replaying the journal if they are configured.
+// The returned close function stops the janitor, saves the snapshot and closes the journal.
+func openMemoryStore(cfg Config) (ReceiptStore, func() error, error) {
+	memory := newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts)
+
+	//A snapshot that can't be read is logged and the server starts empty rather than failing to boot.
+	if cfg.SnapshotFile != "" {
+		if err := memory.loadSnapshot(cfg.SnapshotFile); err != nil {
+			log.Printf("warning: starting with an empty store: %v", err)
+		}
+	}
+
+	var store ReceiptStore = memory
+	closeJournal := func() error { return nil }
+	if cfg.JournalFile == "" {
+		//Loading doesn't evict, so a snapshot taken with a higher limit is brought within this one.
+		memory.trim()
+	} else {
+		journaled, err := openJournaledStore(memory, cfg.JournalFile, cfg.JournalSync, cfg.JournalCompactBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		store, closeJournal = journaled, journaled.Close
+	}
+
+	//Expired receipts are already hidden from Get, the janitor frees their memory.
+	stopJanitor := func() {}
+	if cfg.Retention > 0 {
+		ticker := time.NewTicker(cfg.JanitorInterval)
+		stop, done := make(chan struct{}), make(chan struct{})
+		go memory.runJanitor(ticker.C, stop, done)
+		stopJanitor = func() {
+			ticker.Stop()
+			close(stop)
+			<-done
+		}
+	}
+
+	closeStore := func() error {
+		stopJanitor()
+
+		var err error
+		if cfg.SnapshotFile != "" {
+			err = memory.writeSnapshot(cfg.SnapshotFile)
+		}
+		return errors.Join(err, closeJournal())
+	}
+	return store, closeStore, nil
+}
+
+// Counter of receipts evicted from the memory store to stay under -max-receipts, served at /debug/vars.
+var receiptsEvicted = expvar.NewInt("receipts_evicted")
+
+// Struct for a ReceiptStore that keeps receipts in memory, guarded by a read-write mutex.
+// The memory store backend is made of one or more of these, see shardedStore.
+// When ttl is set, receipts are treated as missing once they are older than ttl, measured from
+// their CreatedAt, or when they were first saved on the store's clock if they have none, and the
+// janitor removes them from the map.
+// When maxReceipts is set, saving a new receipt into a full store evicts the least recently used one.
+type memoryStore struct {
+	mu       sync.RWMutex
+	receipts map[string]*Receipt
+	created  map[string]time.Time
+
+	clock Clock
+	ttl   time.Duration
+
+	//Ids ordered from most to least recently saved or read. Reads only hold m.mu for reading,
+	//so the list has its own mutex, always taken after m.mu.
+	maxReceipts int
+	lruMu       sync.Mutex
+	lru         *list.List
+	lruElements map[string]*list.Element
+
+	//Called with m.mu held whenever an id is added to or removed from the map, so an index can follow it,
+	//and whenever a receipt is stored, replacing one or not, so an index of the receipts' contents can.
+	onAdd    func(id string)
+	onRemove func(id string)
+	onPut    func(id string, receipt *Receipt)
+
+	//Called with m.mu held whenever a receipt is evicted to make room for another, so a journal can record it.
+	onEvict func(id string)
+}
+
+// Function to create an empty in-memory receipt store.
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		receipts: make(map[string]*Receipt),
+		created:  make(map[string]time.Time),
+		clock:    systemClock{},
+
+		lru:         list.New(),
+		lruElements: make(map[string]*list.Element),
+	}
+}
+
+// Function to store a receipt under the given id, replacing any receipt already stored there.
+func (m *memoryStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.put(id, receipt)
+	return nil
+}
+
+// Function to add a receipt to the map, evicting the least recently used receipt first if the store is full.
+// Must be called with m.mu held for writing.
+func (m *memoryStore) put(id string, receipt *Receipt) {
+	if _, exists := m.receipts[id]; !exists && m.maxReceipts > 0 && len(m.receipts) >= m.maxReceipts {
+		m.evictOldest()
+	}
+	m.insert(id, receipt)
+}
+
+// Function to add a receipt to the map without making room for it, recording when it was first saved.
+// Replacing a receipt keeps the time it was first saved, so updates don't extend its retention.
+// Must be called with m.mu held for writing.
+func (m *memoryStore) insert(id string, receipt *Receipt) {
+	if _, exists := m.receipts[id]; !exists {
+		if m.onAdd != nil {
+			m.onAdd(id)
+		}
+		//Receipts carry their submission time, which the store's own clock only stands in for.
+		m.created[id] = m.clock.Now()
+		if receipt.CreatedAt != nil {
+			m.created[id] = *receipt.CreatedAt
+		}
+	}
+	m.receipts[id] = receipt
+	if m.onPut != nil {
+		m.onPut(id, receipt)
+	}
+	m.touch(id)
+}
+
+// Function to evict the least recently used receipt, returning its id, or an empty id if the store is empty.
+// Must be called with m.mu held for writing.
+func (m *memoryStore) evictOldest() string {
+	oldest := m.lru.Back()
+	if oldest == nil {
+		return ""
+	}
+	id := oldest.Value.(string)
+	m.remove(id)
+	receiptsEvicted.Add(1)
+	if m.onEvict != nil {
+		m.onEvict(id)
+	}
+	return id
+}
+
+// Function to mark a receipt as the most recently used. Must be called with m.mu held.
+func (m *memoryStore) touch(id string) {
+	if m.maxReceipts == 0 {
+		return
+	}
+
+	m.lruMu.Lock()
+	defer m.lruMu.Unlock()
+
+	if element, exists := m.lruElements[id]; exists {
+		m.lru.MoveToFront(element)
+		return
+	}
+	m.lruElements[id] = m.lru.PushFront(id)
+}
+
+// Function to remove a receipt from the map. Must be called with m.mu held for writing.
+func (m *memoryStore) remove(id string) {
+	if _, exists := m.receipts[id]; exists && m.onRemove != nil {
+		m.onRemove(id)
+	}
+	delete(m.receipts, id)
+	delete(m.created, id)
+
+	if element, exists := m.lruElements[id]; exists {
+		m.lru.Remove(element)
+		delete(m.lruElements, id)
+	}
+}
+
+// Function to report whether the receipt under the given id is older than the ttl. Must be called with m.mu held.
+func (m *memoryStore) expired(id string, now time.Time) bool {
+	return m.ttl > 0 && now.Sub(m.created[id]) >= m.ttl
+}
+
+// Function to look up a stored receipt by id.
+func (m *memoryStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	receipt, exists := m.receipts[id]
+	if !exists || m.expired(id, m.clock.Now()) {
+		return nil, ErrNotFound
+	}
+	m.touch(id)
+	return receipt, nil
+}
+
+// Function to remove a stored receipt by id.
+func (m *memoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.receipts[id]; !exists || m.expired(id, m.clock.Now()) {
+		return ErrNotFound
+	}
+	m.remove(id)
+	return nil
+}
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+// The receipts are collected under the read lock first, so fn sees the store as it was when Each was called
+// and may itself use the store.
+func (m *memoryStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	m.mu.RLock()
+	now := m.clock.Now()
+	ids := make([]string, 0, len(m.receipts))
+	for id := range m.receipts {
+		if id > after && !m.expired(id, now) {
+			ids = append(ids, id)
+		}
+	}
+	receipts := make(map[string]*Receipt, len(ids))
+	for _, id := range ids {
+		receipts[id] = m.receipts[id]
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(id, receipts[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to remove every receipt older than the ttl, returning the ids removed.
+func (m *memoryStore) removeExpired() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	var removed []string
+	for id := range m.receipts {
+		if m.expired(id, now) {
+			m.remove(id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
+
+// Function to evict the least recently used receipts until the store is within maxReceipts, returning the ids evicted.
+func (m *memoryStore) trim() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var evicted []string
+	for m.maxReceipts > 0 && len(m.receipts) > m.maxReceipts {
+		evicted = append(evicted, m.evictOldest())
+	}
+	return evicted
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Name of the bbolt bucket receipts are kept in.
+var boltReceiptsBucket = []byte("receipts")
+
+// Struct for a ReceiptStore that keeps receipts as JSON in a single bbolt file, keyed by id.
+// bbolt serialises writers and lets readers run alongside them, and every write is synced
+// to disk before Save returns. Keys are kept in byte order, so iterating the bucket is stable.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// Function to open, or create, the bbolt data file at the given path.
+// The file is locked while it is open, so a second server can't open the same file.
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening data file %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltReceiptsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+// Function to store a receipt under the given id, replacing any receipt already stored there.
+func (s *boltStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltReceiptsBucket).Put([]byte(id), data)
+	})
+}
+
+// Function to look up a stored receipt by id.
+func (s *boltStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	var receipt Receipt
+	err := s.db.View(func(tx *bolt.Tx) error {
+		//The value is only valid inside the transaction, so it is decoded here.
+		data := tx.Bucket(boltReceiptsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &receipt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// Function to remove a stored receipt by id.
+func (s *boltStore) Delete(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltReceiptsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// Number of receipts read from the data file in each read transaction while iterating.
+const boltEachBatch = 256
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+// Receipts are read in batches, each in its own read transaction, and fn is called once the
+// transaction has closed, so fn may itself write to the store without waiting on a transaction.
+func (s *boltStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	for {
+		var ids []string
+		var receipts []*Receipt
+		err := s.db.View(func(tx *bolt.Tx) error {
+			cursor := tx.Bucket(boltReceiptsBucket).Cursor()
+			key, data := cursor.Seek([]byte(after))
+			if key != nil && string(key) == after {
+				key, data = cursor.Next()
+			}
+
+			for ; key != nil && len(ids) < boltEachBatch; key, data = cursor.Next() {
+				var receipt Receipt
+				if err := json.Unmarshal(data, &receipt); err != nil {
+					return fmt.Errorf("decoding receipt %s: %w", key, err)
+				}
+				ids = append(ids, string(key))
+				receipts = append(receipts, &receipt)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(id, receipts[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(ids) < boltEachBatch {
+			return nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// Function to count the stored receipts.
+func (s *boltStore) Count(ctx context.Context) (int, error) {
+	n := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(boltReceiptsBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// Function to check that the data file is open and holds the receipts bucket.
+func (s *boltStore) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltReceiptsBucket) == nil {
+			return errors.New("receipts bucket is missing")
+		}
+		return nil
+	})
+}
+
+// Function to close the data file, releasing its lock.
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// Function to open a bbolt store at path, closing it when the test ends.
+func openTestBoltStore(t *testing.T, path string) *boltStore {
+	t.Helper()
+
+	store, err := openBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBoltStoreContract(t *testing.T) {
+	testStoreContract(t, openTestBoltStore(t, filepath.Join(t.TempDir(), "receipts.db")))
+}
+
+func TestBoltStoreKeepsThousandsOfReceiptsInOrderAcrossAReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	store := openTestBoltStore(t, path)
+
+	receipts := map[string]*Receipt{}
+	for i := 0; i < 3000; i++ {
+		id := newReceiptID()
+		receipt := scoredReceipt(t, targetReceipt)
+		receipt.Retailer = fmt.Sprintf("Retailer %d", i)
+		receipts[id] = receipt
+		if err := store.Save(context.Background(), id, receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := storedIDs(t, store)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestBoltStore(t, path)
+	after := storedIDs(t, store)
+	if len(after) != len(receipts) || !equalIDs(after, before) {
+		t.Fatalf("reopened store lists %d ids, want the %d listed before the reopen in the same order", len(after), len(before))
+	}
+	for i := 1; i < len(after); i++ {
+		if after[i-1] >= after[i] {
+			t.Fatalf("ids out of order: %s before %s", after[i-1], after[i])
+		}
+	}
+	for _, id := range after {
+		expectStored(t, store, id, receipts[id])
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Highest level of the skip list, enough for billions of ids with the one in four promotion below.
+const indexMaxLevel = 16
+
+// Struct for the ids of every stored receipt kept in sorted order in a skip list, so the store can be
+// iterated from any id without sorting the shards on every call, and ids can be added and removed in
+// O(log n) rather than by shifting a sorted slice. The index lock is only ever taken while a shard lock is
+// held or on its own, never the other way round, and is held only for the walk down the list.
+type idIndex struct {
+	mu    sync.RWMutex
+	head  indexNode
+	level int
+	count int
+}
+
+// Struct for an id in the skip list, linked to the next id at each of its levels and to the id before it,
+// nil for the first id, so the list can also be walked backwards.
+type indexNode struct {
+	id   string
+	next []*indexNode
+	prev *indexNode
+}
+
+// Function to find the last node before the given id at every level, filling update from the top level down.
+// Must be called with x.mu held.
+func (x *idIndex) before(id string, update *[indexMaxLevel]*indexNode) {
+	if x.head.next == nil {
+		x.head.next = make([]*indexNode, indexMaxLevel)
+	}
+	node := &x.head
+	for level := x.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].id < id {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+}
+
+// Function to add an id to the index.
+func (x *idIndex) add(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var update [indexMaxLevel]*indexNode
+	x.before(id, &update)
+	if x.level > 0 && update[0].next[0] != nil && update[0].next[0].id == id {
+		return
+	}
+
+	//Each level holds about a quarter of the ids of the level below it.
+	level := 1
+	for level < indexMaxLevel && rand.Intn(4) == 0 {
+		level++
+	}
+	for ; x.level < level; x.level++ {
+		update[x.level] = &x.head
+	}
+
+	node := &indexNode{id: id, next: make([]*indexNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	if update[0] != &x.head {
+		node.prev = update[0]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	}
+	x.count++
+}
+
+// Function to remove an id from the index.
+func (x *idIndex) remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var update [indexMaxLevel]*indexNode
+	x.before(id, &update)
+	if x.level == 0 || update[0].next[0] == nil || update[0].next[0].id != id {
+		return
+	}
+
+	node := update[0].next[0]
+	for i := range node.next {
+		update[i].next[i] = node.next[i]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node.prev
+	}
+	for x.level > 0 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+	x.count--
+}
+
+// Function to copy up to n of the ids after the given one, in order.
+func (x *idIndex) after(id string, n int) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if x.level == 0 {
+		return nil
+	}
+	node := &x.head
+	for level := x.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].id <= id {
+			node = node.next[level]
+		}
+	}
+
+	var ids []string
+	for node = node.next[0]; node != nil && len(ids) < n; node = node.next[0] {
+		ids = append(ids, node.id)
+	}
+	return ids
+}
+
+// Function to copy up to n of the ids before the given one, or the last n ids for an empty id, in reverse order.
+func (x *idIndex) below(id string, n int) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if x.level == 0 {
+		return nil
+	}
+	node := &x.head
+	for level := x.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && (id == "" || node.next[level].id < id) {
+			node = node.next[level]
+		}
+	}
+	if node == &x.head {
+		return nil
+	}
+
+	var ids []string
+	for ; node != nil && len(ids) < n; node = node.prev {
+		ids = append(ids, node.id)
+	}
+	return ids
+}
+
+// Function to count the ids in the index.
+func (x *idIndex) len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.count
+}
+
+// Sort keys the receipts listing can page through an index of, in the order listIndex holds them.
+var listSorts = [...]string{sortPurchaseDate, sortTotal, sortPoints, sortCreatedAt}
+
+// Struct for the ids of every stored receipt kept in the order of each key the receipts listing sorts by,
+// so a page is read by walking on from its cursor rather than sorting every receipt on every request.
+// Each index holds a receipt under its listIndexKey, the sort key followed by the id so ties are broken by
+// id, and the keys a receipt is held under are remembered so it can be moved when it is replaced.
+// Like idIndex it is only locked while a shard lock is held or on its own.
+type listIndex struct {
+	mu      sync.Mutex
+	keys    map[string][len(listSorts)]string
+	indexes [len(listSorts)]idIndex
+}
+
+// Function to hold a stored receipt in every index under its current sort keys.
+func (x *listIndex) put(id string, receipt *Receipt) {
+	var keys [len(listSorts)]string
+	for i, by := range listSorts {
+		keys[i] = listIndexKey(by, id, receipt)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.keys == nil {
+		x.keys = make(map[string][len(listSorts)]string)
+	}
+	old, exists := x.keys[id]
+	for i := range listSorts {
+		if exists && old[i] == keys[i] {
+			continue
+		}
+		if exists {
+			x.indexes[i].remove(old[i])
+		}
+		x.indexes[i].add(keys[i])
+	}
+	x.keys[id] = keys
+}
+
+// Function to remove a receipt from every index.
+func (x *listIndex) remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	keys, exists := x.keys[id]
+	if !exists {
+		return
+	}
+	for i := range listSorts {
+		x.indexes[i].remove(keys[i])
+	}
+	delete(x.keys, id)
+}
+
+// Function to copy up to n of the keys after the given one in the index of a sort key, or before it in
+// reverse order if desc is set. An empty key starts from the first, or with desc the last, receipt.
+func (x *listIndex) page(by string, desc bool, after string, n int) []string {
+	for i, sort := range listSorts {
+		if sort != by {
+			continue
+		}
+		if desc {
+			return x.indexes[i].below(after, n)
+		}
+		return x.indexes[i].after(after, n)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIDIndexKeepsIdsInOrder(t *testing.T) {
+	var index idIndex
+	want := map[string]bool{}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		id := fmt.Sprintf("%04d", random.Intn(1000))
+		if random.Intn(3) == 0 {
+			index.remove(id)
+			delete(want, id)
+		} else {
+			index.add(id)
+			want[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(want))
+	for id := range want {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if got := index.after("", len(ids)+1); !reflect.DeepEqual(got, ids) {
+		t.Fatalf("after(\"\"): got %d ids, want %d in order", len(got), len(ids))
+	}
+	if got := index.len(); got != len(ids) {
+		t.Fatalf("len: got %d, want %d", got, len(ids))
+	}
+
+	//Paging from every id in turn gives the ids after it.
+	for i, id := range ids {
+		got := index.after(id, 3)
+		end := min(i+4, len(ids))
+		if want := ids[i+1 : end]; !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+			t.Fatalf("after(%q, 3): got %v, want %v", id, got, want)
+		}
+	}
+
+	//Paging backwards from every id in turn gives the ids before it, nearest first.
+	for i, id := range ids {
+		var want []string
+		for j := i - 1; j >= 0 && j >= i-3; j-- {
+			want = append(want, ids[j])
+		}
+		if got := index.below(id, 3); !reflect.DeepEqual(got, want) {
+			t.Fatalf("below(%q, 3): got %v, want %v", id, got, want)
+		}
+	}
+	if got := index.below("", 1); len(ids) > 0 && !reflect.DeepEqual(got, ids[len(ids)-1:]) {
+		t.Fatalf("below(\"\", 1): got %v, want the last id", got)
+	}
+}
+
+func TestIDIndexAfterAnIdNotInTheIndex(t *testing.T) {
+	var index idIndex
+	for _, id := range []string{"b", "d", "f"} {
+		index.add(id)
+	}
+	index.add("d")
+
+	if got := index.after("c", 10); !reflect.DeepEqual(got, []string{"d", "f"}) {
+		t.Fatalf("after(\"c\"): got %v, want [d f]", got)
+	}
+	if got := index.after("f", 10); len(got) != 0 {
+		t.Fatalf("after(\"f\"): got %v, want none", got)
+	}
+	if got := index.len(); got != 3 {
+		t.Fatalf("len after adding an id twice: got %d, want 3", got)
+	}
+
+	for _, id := range []string{"b", "d", "f", "x"} {
+		index.remove(id)
+	}
+	if got := index.after("", 10); len(got) != 0 || index.len() != 0 {
+		t.Fatalf("emptied index: got %v and len %d, want none", got, index.len())
+	}
+}
+
+func BenchmarkIDIndexAdd(b *testing.B) {
+	var index idIndex
+	for i := 0; i < b.N; i++ {
+		index.add(newReceiptID())
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Embedded SQL migrations for the Postgres store, applied in file name order.
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// Struct for a ReceiptStore backed by a PostgreSQL database.
+// Every query takes the request context, so a cancelled request aborts its query.
+type postgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// Function to connect to the Postgres database at the given DSN and apply any pending migrations.
+func openPostgresStore(ctx context.Context, dsn string) (*postgresStore, error) {
+	if dsn == "" {
+		return nil, errors.New("the postgres store needs a DSN, set DATABASE_URL or -database-url")
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrating postgres: %w", err)
+	}
+
+	return &postgresStore{pool: pool}, nil
+}
+
+// Function to apply every embedded migration that has not been applied yet, each in its own transaction.
+// Applied migrations are recorded by file name in the schema_migrations table.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name[strings.LastIndex(name, "/")+1:], ".sql")
+		script, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			//Lock the table so replicas starting together don't apply the same migration twice.
+			if _, err := tx.Exec(ctx, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+
+			var applied bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil || applied {
+				return err
+			}
+
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Function to store a receipt and its items under the given id in a single transaction.
+// Saving an id that already exists replaces it; the upsert locks the receipt row first,
+// so concurrent saves of the same id are applied one after the other.
+func (s *postgresStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO receipts (id, retailer, total_cents, purchase_date, purchase_time, points, created_at, revision, rule_version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (id) DO UPDATE SET retailer = excluded.retailer, total_cents = excluded.total_cents,
+				purchase_date = excluded.purchase_date, purchase_time = excluded.purchase_time, points = excluded.points,
+				created_at = excluded.created_at, revision = excluded.revision, rule_version = excluded.rule_version`,
+			id, receipt.Retailer, receipt.Total.Cents(), receipt.PurchaseDate, receipt.PurchaseTime, receipt.Points, receipt.CreatedAt, receipt.Revision, receipt.RuleVersion)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM items WHERE receipt_id = $1`, id); err != nil {
+			return err
+		}
+
+		rows := make([][]interface{}, len(receipt.Items))
+		for i, item := range receipt.Items {
+			rows[i] = []interface{}{id, i, item.Description, item.Price.Cents()}
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"items"},
+			[]string{"receipt_id", "position", "short_description", "price_cents"}, pgx.CopyFromRows(rows))
+		return err
+	})
+}
+
+// Function to look up a stored receipt by id, rebuilding its items in their original order.
+func (s *postgresStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	var receipt Receipt
+	var total int64
+	err := s.pool.QueryRow(ctx,
+		`SELECT retailer, total_cents, purchase_date, purchase_time, points, created_at, revision, rule_version FROM receipts WHERE id = $1`, id,
+	).Scan(&receipt.Retailer, &total, &receipt.PurchaseDate, &receipt.PurchaseTime, &receipt.Points, &receipt.CreatedAt, &receipt.Revision, &receipt.RuleVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	receipt.Total = amountPtr(Amount(total))
+
+	//Times are read back in the local zone, submission times are served in UTC as the other stores keep them.
+	if receipt.CreatedAt != nil {
+		createdAt := receipt.CreatedAt.UTC()
+		receipt.CreatedAt = &createdAt
+	}
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT short_description, price_cents FROM items WHERE receipt_id = $1 ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipt.Items = []Item{}
+	for rows.Next() {
+		var item Item
+		var price int64
+		if err := rows.Scan(&item.Description, &price); err != nil {
+			return nil, err
+		}
+		item.Price = amountPtr(Amount(price))
+		receipt.Items = append(receipt.Items, item)
+	}
+
+	return &receipt, rows.Err()
+}
+
+// Function to remove a stored receipt by id. Its items are removed by the cascading foreign key.
+func (s *postgresStore) Delete(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM receipts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+func (s *postgresStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	rows, err := s.pool.Query(ctx, `SELECT id FROM receipts WHERE id > $1 ORDER BY id`, after)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	return eachByID(ctx, s, ids, fn)
+}
+
+// Function to find the ids of receipts containing the query text with an ILIKE query.
+func (s *postgresStore) Search(ctx context.Context, query SearchQuery, after string, limit int) ([]string, error) {
+	statement := `SELECT id FROM receipts WHERE id > $1 AND retailer ILIKE $2 ORDER BY id LIMIT $3`
+	if query.Field == searchItems {
+		statement = `SELECT id FROM receipts WHERE id > $1 AND EXISTS (
+			SELECT 1 FROM items WHERE items.receipt_id = receipts.id AND items.short_description ILIKE $2
+		) ORDER BY id LIMIT $3`
+	}
+
+	rows, err := s.pool.Query(ctx, statement, after, "%"+escapeLike(query.Text)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// Function to count the stored receipts.
+func (s *postgresStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM receipts`).Scan(&n)
+	return n, err
+}
+
+// Function to check that the database answers.
+func (s *postgresStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// Function to close every connection in the pool.
+func (s *postgresStore) Close() error {
+	s.pool.Close()
+	return nil
+}
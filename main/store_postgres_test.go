@@ -0,0 +1,86 @@
+//go:build postgres
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Function to open the Postgres store at DATABASE_URL emptied of receipts, skipping the test when it isn't set.
+// Run with go test -tags postgres and DATABASE_URL pointing at a database the tests may clear.
+func openTestPostgresStore(t *testing.T) *postgresStore {
+	t.Helper()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	store, err := openPostgresStore(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if _, err := store.pool.Exec(context.Background(), `TRUNCATE receipts CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestPostgresStoreContract(t *testing.T) {
+	testStoreContract(t, openTestPostgresStore(t))
+}
+
+func TestPostgresStoreAppliesConcurrentSavesInTurn(t *testing.T) {
+	store := openTestPostgresStore(t)
+	target, corner := scoredReceipt(t, targetReceipt), scoredReceipt(t, cornerReceipt)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		receipt := target
+		if i%2 == 1 {
+			receipt = corner
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.Save(context.Background(), "a", receipt)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//Whichever save came last, the receipt is one of them whole, never their items mixed.
+	got, err := store.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := target
+	if got.Retailer == corner.Retailer {
+		want = corner
+	}
+	expectStored(t, store, "a", want)
+}
+
+func TestPostgresStoreAbortsCancelledQueries(t *testing.T) {
+	store := openTestPostgresStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get with a cancelled context: got %v, want context.Canceled", err)
+	}
+	if err := store.Save(ctx, "a", scoredReceipt(t, targetReceipt)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Save with a cancelled context: got %v, want context.Canceled", err)
+	}
+}
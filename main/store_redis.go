@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Struct for a ReceiptStore that keeps each receipt as JSON under its own Redis key,
+// so every server pointed at the same Redis sees the same receipts.
+type redisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// Function to connect to the Redis server at the given address.
+// Receipts expire after ttl, or never if ttl is zero.
+func openRedisStore(ctx context.Context, addr string, ttl time.Duration) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to redis at %s: %w", addr, err)
+	}
+	return &redisStore{client: client, ttl: ttl}, nil
+}
+
+// Function to return the Redis key a receipt id is stored under.
+func redisReceiptKey(id string) string {
+	return "receipt:" + id
+}
+
+// Function to store a receipt under the given id, replacing any receipt already stored there.
+func (s *redisStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, redisReceiptKey(id), data, s.ttl).Err()
+}
+
+// Function to look up a stored receipt by id.
+func (s *redisStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	data, err := s.client.Get(ctx, redisReceiptKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, fmt.Errorf("decoding receipt %s: %w", id, err)
+	}
+	return &receipt, nil
+}
+
+// Function to remove a stored receipt by id.
+func (s *redisStore) Delete(ctx context.Context, id string) error {
+	removed, err := s.client.Del(ctx, redisReceiptKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+// Redis keeps no order, so every key is found with SCAN and sorted on each call,
+// and receipts saved while Each runs may or may not be seen.
+func (s *redisStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	var ids []string
+	iter := s.client.Scan(ctx, 0, redisReceiptKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		if id := strings.TrimPrefix(iter.Val(), redisReceiptKey("")); id > after {
+			ids = append(ids, id)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	sort.Strings(ids)
+
+	return eachByID(ctx, s, ids, fn)
+}
+
+// Function to count the stored receipts, scanning every receipt key.
+func (s *redisStore) Count(ctx context.Context) (int, error) {
+	n := 0
+	iter := s.client.Scan(ctx, 0, redisReceiptKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		n++
+	}
+	return n, iter.Err()
+}
+
+// Function to check that Redis answers.
+func (s *redisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Function to close the connection to Redis.
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
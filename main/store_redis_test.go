@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Function to start an in-process Redis server and open a store on it with the given TTL.
+func openTestRedisStore(t *testing.T, ttl time.Duration) (*redisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	store, err := openRedisStore(context.Background(), server.Addr(), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisStoreContract(t *testing.T) {
+	store, _ := openTestRedisStore(t, 0)
+	testStoreContract(t, store)
+}
+
+func TestRedisStoreExpiresReceiptsAfterTTL(t *testing.T) {
+	store, server := openTestRedisStore(t, time.Hour)
+	if err := store.Save(context.Background(), "a", scoredReceipt(t, targetReceipt)); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL(redisReceiptKey("a")); ttl != time.Hour {
+		t.Fatalf("TTL of the saved receipt: got %v, want 1h", ttl)
+	}
+
+	server.FastForward(time.Hour)
+	if ids := storedIDs(t, store); len(ids) != 0 {
+		t.Fatalf("store holds %v after the TTL, want nothing", ids)
+	}
+}
+
+func TestRedisStoreFailuresAre500s(t *testing.T) {
+	store, server := openTestRedisStore(t, 0)
+	ts := newTestServerWithStore(t, testConfig(), store)
+	id := ts.submit(t, targetReceipt)
+
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+newReceiptID()+"/points", ""), http.StatusNotFound, codeNotFound)
+
+	server.Close()
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id+"/points", ""), http.StatusInternalServerError, codeInternal)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Struct for a ReceiptStore that spreads receipts over several in-memory shards by a hash of their id,
+// so saves and reads of different receipts rarely wait on the same lock.
+// Retention applies per receipt as in a single memoryStore, while a limit on the number of receipts
+// is split between the shards, as evenly as it divides, so the shards together never hold more than
+// the limit. Eviction is least recently used within a shard: a receipt is evicted once its own shard is
+// full, which may be before the store as a whole is, and the receipt evicted is the least recently used
+// of its shard rather than of the store. A single shard gives exact LRU over the whole limit.
+//
+// It is the memory store backend, with 16 shards by default; see store_bench_test.go for how it
+// compares with a single lock and with syncMapStore. -memory-shards=1 gives a single lock.
+type shardedStore struct {
+	shards []*memoryStore
+	index  idIndex
+	lists  listIndex
+
+	//Called with the ids of receipts the store removed by itself, see reportRemovals.
+	onEvict  []func(id string)
+	onExpire []func(ids []string)
+}
+
+// Number of ids copied out of the index at a time while iterating.
+const indexEachBatch = 256
+
+// Function to create an empty sharded store with the given number of shards.
+// Each shard keeps receipts for ttl, zero for ever, and the shards together hold at most maxReceipts
+// receipts, zero for no limit, which must be at least the number of shards.
+func newShardedStore(shards int, ttl time.Duration, maxReceipts int) *shardedStore {
+	s := &shardedStore{shards: make([]*memoryStore, shards)}
+	for i := range s.shards {
+		shard := newMemoryStore()
+		shard.ttl = ttl
+		shard.onAdd = s.index.add
+		shard.onRemove = s.removed
+		shard.onPut = s.lists.put
+		shard.onEvict = s.evicted
+		if maxReceipts > 0 {
+			shard.maxReceipts = maxReceipts / shards
+			if i < maxReceipts%shards {
+				shard.maxReceipts++
+			}
+		}
+		s.shards[i] = shard
+	}
+	return s
+}
+
+// Function to register functions called with the ids of the receipts the store removes by itself: evicted with each
+// receipt evicted for -max-receipts, called with the shard's lock held while another receipt is saved, and expired
+// with the receipts the janitor removed, called with no lock held. Must be called before the store is used.
+func (s *shardedStore) reportRemovals(evicted func(id string), expired func(ids []string)) {
+	s.onEvict = append(s.onEvict, evicted)
+	s.onExpire = append(s.onExpire, expired)
+}
+
+// Function to remove an id removed from a shard from the indexes.
+func (s *shardedStore) removed(id string) {
+	s.index.remove(id)
+	s.lists.remove(id)
+}
+
+// Function to pass an id evicted from a shard to every function registered for evictions.
+func (s *shardedStore) evicted(id string) {
+	for _, evicted := range s.onEvict {
+		evicted(id)
+	}
+}
+
+// Function to return the shard a receipt id belongs to.
+func (s *shardedStore) shard(id string) *memoryStore {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+
+	//FNV-1a, inlined so no hash.Hash is allocated on every call.
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return s.shards[hash%uint32(len(s.shards))]
+}
+
+// Function to store a receipt under the given id, replacing any receipt already stored there.
+func (s *shardedStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	return s.shard(id).Save(ctx, id, receipt)
+}
+
+// Function to look up a stored receipt by id.
+func (s *shardedStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	return s.shard(id).Get(ctx, id)
+}
+
+// Function to remove a stored receipt by id.
+func (s *shardedStore) Delete(ctx context.Context, id string) error {
+	return s.shard(id).Delete(ctx, id)
+}
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+// Ids are copied from the index a batch at a time and each receipt is read from its shard as it is reached,
+// so receipts saved or removed while Each runs may or may not be seen, and fn may itself use the store.
+func (s *shardedStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	for {
+		ids := s.index.after(after, indexEachBatch)
+		if err := eachByID(ctx, s, ids, fn); err != nil {
+			return err
+		}
+		if len(ids) < indexEachBatch {
+			return nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// Function to call fn for stored receipts in the order of a listing sort key, see sortedLister.
+// Keys are copied from the index a batch at a time as in Each. A receipt replaced after its key was copied
+// with one sorting elsewhere is skipped, as it is reached again at its new place if that is still ahead.
+func (s *shardedStore) eachSorted(ctx context.Context, by string, desc bool, after string, fn func(id string, receipt *Receipt) error) error {
+	for {
+		keys := s.lists.page(by, desc, after, indexEachBatch)
+		for _, key := range keys {
+			id := listIndexID(key)
+			receipt, err := s.Get(ctx, id)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if listIndexKey(by, id, receipt) != key {
+				continue
+			}
+			if err := fn(id, receipt); err != nil {
+				return err
+			}
+		}
+		if len(keys) < indexEachBatch {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// Function to count the stored receipts, including expired ones the janitor has not removed yet.
+func (s *shardedStore) Count(ctx context.Context) (int, error) {
+	return s.index.len(), nil
+}
+
+// Function to copy every unexpired receipt out of the shards into a single map.
+func (s *shardedStore) receipts() map[string]*Receipt {
+	receipts := make(map[string]*Receipt)
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		now := shard.clock.Now()
+		for id, receipt := range shard.receipts {
+			if !shard.expired(id, now) {
+				receipts[id] = receipt
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return receipts
+}
+
+// Function to add a receipt loaded from a snapshot or journal, counting it as saved when it was created.
+// Nothing is evicted to make room for it, a journal records its own evictions; see trim.
+func (s *shardedStore) restore(id string, receipt *Receipt) {
+	shard := s.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.insert(id, receipt)
+}
+
+// Function to evict the least recently used receipts of every shard holding more than its share of
+// -max-receipts, as restored receipts may, returning the ids evicted.
+func (s *shardedStore) trim() []string {
+	var evicted []string
+	for _, shard := range s.shards {
+		evicted = append(evicted, shard.trim()...)
+	}
+	return evicted
+}
+
+// Function to remove a receipt whose removal was replayed from a journal.
+func (s *shardedStore) forget(id string) {
+	shard := s.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.remove(id)
+}
+
+// Function to run the janitor, removing expired receipts from every shard on each tick until the stop
+// channel is closed. The done channel is closed once the janitor has returned, after any pass it started.
+// Whether a receipt has expired is read from the store's clock, so the ticks only say when to look.
+func (s *shardedStore) runJanitor(ticks <-chan time.Time, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticks:
+			var removed []string
+			for _, shard := range s.shards {
+				removed = append(removed, shard.removeExpired()...)
+			}
+			if len(removed) > 0 {
+				log.Printf("janitor: removed %d expired receipts", len(removed))
+				for _, expired := range s.onExpire {
+					expired(removed)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Statements creating the SQLite schema. Items are kept in their own table with their position on the receipt.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS receipts (
+	id            TEXT PRIMARY KEY,
+	retailer      TEXT NOT NULL,
+	total_cents   INTEGER NOT NULL,
+	purchase_date TEXT NOT NULL,
+	purchase_time TEXT NOT NULL,
+	points        INTEGER,
+	created_at    TEXT,
+	revision      INTEGER NOT NULL DEFAULT 0,
+	rule_version  TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS items (
+	receipt_id        TEXT NOT NULL REFERENCES receipts(id),
+	position          INTEGER NOT NULL,
+	short_description TEXT NOT NULL,
+	price_cents       INTEGER NOT NULL,
+	PRIMARY KEY (receipt_id, position)
+);
+`
+
+// Struct for a ReceiptStore backed by a SQLite database file.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Function to open the SQLite database at path, creating the schema if it does not exist yet.
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	//SQLite allows a single writer, so serialize access through one connection rather than fail with busy errors.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating sqlite schema: %w", err)
+	}
+
+	//Databases created before points, submission times, revisions, and rule versions were stored lack the columns.
+	for column, definition := range map[string]string{"points": "INTEGER", "created_at": "TEXT", "revision": "INTEGER NOT NULL DEFAULT 0", "rule_version": "TEXT NOT NULL DEFAULT ''"} {
+		if err := addSQLiteColumn(db, "receipts", column, definition); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrating sqlite schema: %w", err)
+		}
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// Function to add a column to a table unless the table already has it.
+func addSQLiteColumn(db *sql.DB, table string, column string, definition string) error {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, table, column).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// Function to write a time as RFC 3339 text for a TEXT column, or NULL if it is nil.
+func sqliteTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339Nano), Valid: true}
+}
+
+// Function to store a receipt and its items under the given id in a single transaction,
+// replacing any receipt already stored there.
+func (s *sqliteStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE receipt_id = ?`, id); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO receipts (id, retailer, total_cents, purchase_date, purchase_time, points, created_at, revision, rule_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET retailer = excluded.retailer, total_cents = excluded.total_cents,
+			purchase_date = excluded.purchase_date, purchase_time = excluded.purchase_time, points = excluded.points,
+			created_at = excluded.created_at, revision = excluded.revision, rule_version = excluded.rule_version`,
+		id, receipt.Retailer, receipt.Total.Cents(), receipt.PurchaseDate, receipt.PurchaseTime, receipt.Points,
+		sqliteTime(receipt.CreatedAt), receipt.Revision, receipt.RuleVersion)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range receipt.Items {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO items (receipt_id, position, short_description, price_cents) VALUES (?, ?, ?, ?)`,
+			id, i, item.Description, item.Price.Cents())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Function to look up a stored receipt by id, rebuilding its items in their original order.
+func (s *sqliteStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	var receipt Receipt
+	var total int64
+	var createdAt sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT retailer, total_cents, purchase_date, purchase_time, points, created_at, revision, rule_version FROM receipts WHERE id = ?`, id,
+	).Scan(&receipt.Retailer, &total, &receipt.PurchaseDate, &receipt.PurchaseTime, &receipt.Points, &createdAt, &receipt.Revision, &receipt.RuleVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	receipt.Total = amountPtr(Amount(total))
+	if createdAt.Valid {
+		t, err := time.Parse(time.RFC3339Nano, createdAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("reading created_at of receipt %s: %w", id, err)
+		}
+		receipt.CreatedAt = &t
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT short_description, price_cents FROM items WHERE receipt_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipt.Items = []Item{}
+	for rows.Next() {
+		var item Item
+		var price int64
+		if err := rows.Scan(&item.Description, &price); err != nil {
+			return nil, err
+		}
+		item.Price = amountPtr(Amount(price))
+		receipt.Items = append(receipt.Items, item)
+	}
+
+	return &receipt, rows.Err()
+}
+
+// Function to remove a stored receipt and its items by id.
+func (s *sqliteStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE receipt_id = ?`, id); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM receipts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+// The ids are read before any receipt is loaded, since the store holds a single connection.
+func (s *sqliteStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM receipts WHERE id > ? ORDER BY id`, after)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return eachByID(ctx, s, ids, fn)
+}
+
+// Function to find the ids of receipts containing the query text with a LIKE query.
+// SQLite's lower only folds ASCII letters, so other letters must match in case.
+func (s *sqliteStore) Search(ctx context.Context, query SearchQuery, after string, limit int) ([]string, error) {
+	statement := `SELECT id FROM receipts WHERE id > ? AND lower(retailer) LIKE ? ESCAPE '\' ORDER BY id LIMIT ?`
+	if query.Field == searchItems {
+		statement = `SELECT id FROM receipts WHERE id > ? AND EXISTS (
+			SELECT 1 FROM items WHERE items.receipt_id = receipts.id AND lower(items.short_description) LIKE ? ESCAPE '\'
+		) ORDER BY id LIMIT ?`
+	}
+
+	rows, err := s.db.QueryContext(ctx, statement, after, "%"+escapeLike(strings.ToLower(query.Text))+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Function to count the stored receipts.
+func (s *sqliteStore) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM receipts`).Scan(&n)
+	return n, err
+}
+
+// Function to check that the database answers.
+func (s *sqliteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Function to close the database.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Function to open a SQLite store at path, closing it when the test ends.
+func openTestSQLiteStore(t *testing.T, path string) *sqliteStore {
+	t.Helper()
+
+	store, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStoreContract(t *testing.T) {
+	testStoreContract(t, openTestSQLiteStore(t, filepath.Join(t.TempDir(), "receipts.db")))
+}
+
+func TestSQLiteStoreFindsReceiptsAfterARestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.db")
+	store := openTestSQLiteStore(t, path)
+	receipt := scoredReceipt(t, targetReceipt)
+	if err := store.Save(context.Background(), "a", receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStored(t, openTestSQLiteStore(t, path), "a", receipt)
+}
+
+func TestSQLiteStoreServesTheSameJSONAsMemory(t *testing.T) {
+	memory := newTestServer(t, testConfig())
+	sqlite := newTestServerWithStore(t, testConfig(), openTestSQLiteStore(t, filepath.Join(t.TempDir(), "receipts.db")))
+
+	var bodies []string
+	for _, ts := range []*testServer{memory, sqlite} {
+		id := ts.submit(t, targetReceipt)
+		body := readBody(t, ts.do(t, "GET", "/receipts/"+id, ""))
+		bodies = append(bodies, strings.Replace(body, id, "ID", 1))
+	}
+	if bodies[0] != bodies[1] {
+		t.Fatalf("receipt from the memory store:\n%s\nfrom the SQLite store:\n%s", bodies[0], bodies[1])
+	}
+}
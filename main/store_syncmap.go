@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Struct for a ReceiptStore backed by a sync.Map.
+// Kept to compare against shardedStore in store_bench_test.go. It is the fastest on every mix measured,
+// but has no retention, size limit, snapshot, journal, or listing indexes, so it is not used by the memory
+// store backend.
+type syncMapStore struct {
+	receipts sync.Map
+}
+
+// Function to store a receipt under the given id, replacing any receipt already stored there.
+func (m *syncMapStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	m.receipts.Store(id, receipt)
+	return nil
+}
+
+// Function to look up a stored receipt by id.
+func (m *syncMapStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	receipt, exists := m.receipts.Load(id)
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return receipt.(*Receipt), nil
+}
+
+// Function to remove a stored receipt by id.
+func (m *syncMapStore) Delete(ctx context.Context, id string) error {
+	if _, exists := m.receipts.LoadAndDelete(id); !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Function to call fn for every stored receipt with an id after the given one, in id order.
+func (m *syncMapStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	receipts := make(map[string]*Receipt)
+	m.receipts.Range(func(id, receipt any) bool {
+		if id.(string) > after {
+			receipts[id.(string)] = receipt.(*Receipt)
+		}
+		return true
+	})
+
+	ids := make([]string, 0, len(receipts))
+	for id := range receipts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(id, receipts[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
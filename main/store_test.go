@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Struct for a clock that only moves when a test advances it.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Function to create a fake clock stopped at the given time.
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+// Function to return the fake clock's current time.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Function to move the fake clock forward.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Function to create a memory store with the given retention, reading time from the given clock.
+func newClockedStore(clock Clock, ttl time.Duration) *memoryStore {
+	store := newMemoryStore()
+	store.clock = clock
+	store.ttl = ttl
+	return store
+}
+
+func TestMemoryStoreExpiresReceiptsAfterTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	store := newClockedStore(clock, time.Hour)
+
+	if err := store.Save(ctx, "a", &Receipt{Retailer: "Target"}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Hour - time.Nanosecond)
+	if _, err := store.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get just before the ttl: %v", err)
+	}
+
+	clock.Advance(time.Nanosecond)
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get at the ttl: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete at the ttl: got %v, want ErrNotFound", err)
+	}
+	if removed := store.removeExpired(); len(removed) != 1 {
+		t.Fatalf("removeExpired: got %v, want one id", removed)
+	}
+	if len(store.receipts) != 0 || len(store.created) != 0 {
+		t.Fatalf("expired receipt left in the store: %d receipts, %d times", len(store.receipts), len(store.created))
+	}
+}
+
+func TestMemoryStoreReplacingKeepsFirstSaveTime(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	store := newClockedStore(clock, time.Hour)
+
+	if err := store.Save(ctx, "a", &Receipt{Retailer: "Target"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(45 * time.Minute)
+	if err := store.Save(ctx, "a", &Receipt{Retailer: "Walgreens"}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(15 * time.Minute)
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get an hour after the first save: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreMeasuresTTLFromCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	store := newClockedStore(clock, time.Hour)
+
+	created := start.Add(-50 * time.Minute)
+	if err := store.Save(ctx, "a", &Receipt{Retailer: "Target", CreatedAt: &created}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get before the ttl: %v", err)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get an hour after CreatedAt: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreWithoutTTLKeepsReceipts(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	store := newClockedStore(clock, 0)
+
+	if err := store.Save(ctx, "a", &Receipt{Retailer: "Target"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(24 * 365 * time.Hour)
+	if _, err := store.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get with no ttl: %v", err)
+	}
+	if removed := store.removeExpired(); len(removed) != 0 {
+		t.Fatalf("removeExpired with no ttl: got %v, want none", removed)
+	}
+}
+
+func TestShardedStoreNeverHoldsMoreThanMaxReceipts(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct{ shards, maxReceipts int }{{1, 10}, {4, 10}, {16, 16}, {16, 100}} {
+		store := newShardedStore(test.shards, 0, test.maxReceipts)
+
+		capacity := 0
+		for _, shard := range store.shards {
+			if shard.maxReceipts < 1 {
+				t.Fatalf("%d shards, max %d: a shard holds %d receipts", test.shards, test.maxReceipts, shard.maxReceipts)
+			}
+			capacity += shard.maxReceipts
+		}
+		if capacity != test.maxReceipts {
+			t.Fatalf("%d shards, max %d: the shards hold %d receipts together", test.shards, test.maxReceipts, capacity)
+		}
+
+		for i := 0; i < 10*test.maxReceipts; i++ {
+			if err := store.Save(ctx, newReceiptID(), &Receipt{}); err != nil {
+				t.Fatal(err)
+			}
+			if count, _ := store.Count(ctx); count > test.maxReceipts {
+				t.Fatalf("%d shards, max %d: store holds %d receipts", test.shards, test.maxReceipts, count)
+			}
+		}
+	}
+}
+
+func TestConfigRejectsMaxReceiptsBelowShards(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MemoryShards = 16
+	cfg.MaxReceipts = 15
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate: -max-receipts below -memory-shards accepted")
+	}
+
+	cfg.MaxReceipts = 16
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+// Struct for a receipt store wrapping another that can be told to fail every call with a given error.
+type stubStore struct {
+	ReceiptStore
+
+	mu  sync.Mutex
+	err error
+}
+
+// Function to make every later call to the store fail with err, or behave normally again if err is nil.
+func (s *stubStore) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Function to return the error the store was told to fail with.
+func (s *stubStore) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Function to save a receipt unless the store was told to fail.
+func (s *stubStore) Save(ctx context.Context, id string, receipt *Receipt) error {
+	if err := s.failure(); err != nil {
+		return err
+	}
+	return s.ReceiptStore.Save(ctx, id, receipt)
+}
+
+// Function to get a receipt unless the store was told to fail.
+func (s *stubStore) Get(ctx context.Context, id string) (*Receipt, error) {
+	if err := s.failure(); err != nil {
+		return nil, err
+	}
+	return s.ReceiptStore.Get(ctx, id)
+}
+
+// Function to delete a receipt unless the store was told to fail.
+func (s *stubStore) Delete(ctx context.Context, id string) error {
+	if err := s.failure(); err != nil {
+		return err
+	}
+	return s.ReceiptStore.Delete(ctx, id)
+}
+
+// Function to iterate over the receipts unless the store was told to fail.
+func (s *stubStore) Each(ctx context.Context, after string, fn func(id string, receipt *Receipt) error) error {
+	if err := s.failure(); err != nil {
+		return err
+	}
+	return s.ReceiptStore.Each(ctx, after, fn)
+}
+
+// Function to start a server under test on a memory store that can be told to fail.
+func newStubbedServer(t *testing.T, cfg Config) (*testServer, *stubStore) {
+	t.Helper()
+
+	store := &stubStore{ReceiptStore: newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts)}
+	return newTestServerWithStore(t, cfg, store), store
+}
+
+func TestStoreErrorsAreTranslated(t *testing.T) {
+	ts, store := newStubbedServer(t, testConfig())
+	id := ts.submit(t, targetReceipt)
+
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+newReceiptID()+"/points", ""), http.StatusNotFound, codeNotFound)
+
+	store.fail(errors.New("connection refused"))
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id+"/points", ""), http.StatusInternalServerError, codeInternal)
+	expectProblem(t, ts.do(t, "POST", "/receipts/process", cornerReceipt), http.StatusInternalServerError, codeInternal)
+	expectProblem(t, ts.do(t, "DELETE", "/receipts/"+id, ""), http.StatusInternalServerError, codeInternal)
+
+	store.fail(nil)
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points once the store recovers: got %d, want 28", got)
+	}
+}
+
+// Function to return an example receipt as it is stored once scored, with every stored field set.
+func scoredReceipt(t *testing.T, body string) *Receipt {
+	t.Helper()
+
+	receipt := exampleReceipt(t, body)
+	if err := scoreReceipt(receipt); err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	receipt.CreatedAt = &createdAt
+	receipt.Revision = 1
+	return receipt
+}
+
+// Function to fail the test unless a stored receipt reads back the same as JSON.
+func expectStored(t *testing.T, store ReceiptStore, id string, want *Receipt) {
+	t.Helper()
+
+	got, err := store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Get %s: %v", id, err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("Get %s: got %s, want %s", id, gotJSON, wantJSON)
+	}
+}
+
+// Function to check that a store keeps, replaces, lists, and removes receipts as ReceiptStore describes.
+func testStoreContract(t *testing.T, store ReceiptStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an unknown id: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete of an unknown id: got %v, want ErrNotFound", err)
+	}
+
+	target, corner := scoredReceipt(t, targetReceipt), scoredReceipt(t, cornerReceipt)
+	for _, id := range []string{"c", "a", "b"} {
+		if err := store.Save(ctx, id, target); err != nil {
+			t.Fatalf("Save %s: %v", id, err)
+		}
+	}
+	expectStored(t, store, "a", target)
+
+	replaced := *corner
+	replaced.Revision = 2
+	if err := store.Save(ctx, "b", &replaced); err != nil {
+		t.Fatal(err)
+	}
+	expectStored(t, store, "b", &replaced)
+
+	if ids := storedIDs(t, store); !equalIDs(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("Each: got %v, want [a b c]", ids)
+	}
+	var after []string
+	err := store.Each(ctx, "a", func(id string, receipt *Receipt) error {
+		after = append(after, id)
+		return errStopEach
+	})
+	if err != nil && !errors.Is(err, errStopEach) {
+		t.Fatal(err)
+	}
+	if !equalIDs(after, []string{"b"}) {
+		t.Fatalf("Each after a, stopped at the first: got %v, want [b]", after)
+	}
+
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a deleted id: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoresContract(t *testing.T) {
+	testStoreContract(t, newMemoryStore())
+	testStoreContract(t, newShardedStore(4, 0, 0))
+}
+
+// Function to start a server under test whose memory store keeps receipts for ttl, measured on the server's clock.
+func newRetainingServer(t *testing.T, ttl time.Duration) (*testServer, *shardedStore) {
+	t.Helper()
+
+	cfg := testConfig()
+	cfg.Retention = ttl
+	store := newShardedStore(cfg.MemoryShards, cfg.Retention, cfg.MaxReceipts)
+	ts := newTestServerWithStore(t, cfg, store)
+	for _, shard := range store.shards {
+		shard.clock = ts.clock
+	}
+	return ts, store
+}
+
+func TestExpiredReceiptIsNotFound(t *testing.T) {
+	ts, _ := newRetainingServer(t, 72*time.Hour)
+	id := ts.submit(t, targetReceipt)
+
+	ts.clock.Advance(72*time.Hour - time.Second)
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points just before the retention: got %d, want 28", got)
+	}
+
+	ts.clock.Advance(time.Second)
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id+"/points", ""), http.StatusNotFound, codeNotFound)
+	expectProblem(t, ts.do(t, "GET", "/receipts/"+id, ""), http.StatusNotFound, codeNotFound)
+}
+
+func TestJanitorRemovesExpiredReceiptsAndStops(t *testing.T) {
+	ts, store := newRetainingServer(t, time.Hour)
+	expired := ts.submit(t, targetReceipt)
+	ts.clock.Advance(30 * time.Minute)
+	kept := ts.submit(t, cornerReceipt)
+	ts.clock.Advance(30 * time.Minute)
+
+	var removed []string
+	store.reportRemovals(func(string) {}, func(ids []string) { removed = append(removed, ids...) })
+
+	//Stopping the janitor waits for the pass the tick started, so it has finished, and reported, once done is closed.
+	ticks, stop, done := make(chan time.Time), make(chan struct{}), make(chan struct{})
+	go store.runJanitor(ticks, stop, done)
+	ticks <- ts.clock.Now()
+	close(stop)
+	<-done
+
+	if !equalIDs(removed, []string{expired}) {
+		t.Fatalf("janitor reported %v, want [%s]", removed, expired)
+	}
+	if ids := storedIDs(t, store); !equalIDs(ids, []string{kept}) {
+		t.Fatalf("store holds %v, want [%s]", ids, kept)
+	}
+}
+
+func TestLeastRecentlyReadReceiptsAreEvicted(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemoryShards = 1
+	cfg.MaxReceipts = 3
+	ts := newTestServer(t, cfg)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		ids = append(ids, ts.submit(t, targetReceipt))
+	}
+
+	//Reading the oldest receipt makes the second the least recently used.
+	if got := ts.points(t, ids[0]); got != 28 {
+		t.Fatalf("points: got %d, want 28", got)
+	}
+	before := receiptsEvicted.Value()
+	ids = append(ids, ts.submit(t, cornerReceipt), ts.submit(t, cornerReceipt))
+
+	for _, id := range []string{ids[1], ids[2]} {
+		expectProblem(t, ts.do(t, "GET", "/receipts/"+id+"/points", ""), http.StatusNotFound, codeNotFound)
+	}
+	for _, id := range []string{ids[0], ids[3], ids[4]} {
+		if resp := ts.do(t, "GET", "/receipts/"+id+"/points", ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: got %d, want 200", id, resp.StatusCode)
+		}
+	}
+	if evicted := receiptsEvicted.Value() - before; evicted != 2 {
+		t.Fatalf("evictions counted: got %d, want 2", evicted)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Struct for a validation failure on a single receipt field given as JSON.
+type FieldError struct {
+	Field   string `json:"field" xml:"field"`
+	Code    string `json:"code" xml:"code"`
+	Message string `json:"message" xml:"message"`
+}
+
+// Codes describing why a receipt field failed validation.
+const (
+	fieldRequired = "required"
+	fieldInvalid  = "invalid"
+	fieldTooLong  = "too_long"
+	fieldTooMany  = "too_many"
+	fieldNegative = "negative"
+	fieldMismatch = "mismatch"
+	fieldFuture   = "future"
+)
+
+// Regular expression for a 24-hour purchase time with two digit hours and minutes, from 00:00 to 23:59.
+var purchaseTimeRegex = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// Function to check that a retailer name matches the allowed pattern.
+func validateRetailer(value string) error {
+	if !retailerRegex.MatchString(value) {
+		return fmt.Errorf("invalid retailer %q: expected a name matching %s", value, retailerRegex)
+	}
+	return nil
+}
+
+// Function to check that the description of the item at index i matches the allowed pattern.
+func validateDescription(i int, value string) error {
+	if !descriptionRegex.MatchString(value) {
+		return fmt.Errorf("invalid items[%d].shortDescription %q: expected a description matching %s", i, value, descriptionRegex)
+	}
+	return nil
+}
+
+// Function to check that a purchase date is a real calendar date in YYYY-MM-DD form.
+// The error echoes the value back along with the reason it was rejected, e.g. day out of range.
+func validatePurchaseDate(value string) error {
+	if _, err := time.Parse(dateFormat, value); err != nil {
+		var parseErr *time.ParseError
+		if errors.As(err, &parseErr) && parseErr.Message != "" {
+			return fmt.Errorf("invalid purchaseDate %q%s", value, parseErr.Message)
+		}
+		return fmt.Errorf("invalid purchaseDate %q: expected a date as YYYY-MM-DD", value)
+	}
+	return nil
+}
+
+// Function to check that a purchase time is a 24-hour time in HH:MM form.
+// Seconds are not accepted.
+func validatePurchaseTime(value string) error {
+	if !purchaseTimeRegex.MatchString(value) {
+		return fmt.Errorf("invalid purchaseTime %q: expected 24-hour time as HH:MM between 00:00 and 23:59", value)
+	}
+	return nil
+}
+
+// Function to validate a receipt against the server configuration.
+// Every problem found is returned, ordered by field in struct order and then by item index,
+// or nil if the receipt is valid. A total of "0.00" is present, only an absent total is missing,
+// and zero totals and item prices are accepted so fully discounted receipts can still be submitted.
+func (receipt *Receipt) Validate(cfg Config, now time.Time) []FieldError {
+	var errs []FieldError
+	add := func(field string, code string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	//Long retailer names are rejected before matching them against the pattern.
+	switch {
+	case strings.TrimSpace(receipt.Retailer) == "":
+		add("retailer", fieldRequired, "retailer is required")
+	case utf8.RuneCountInString(receipt.Retailer) > cfg.MaxRetailerLength:
+		add("retailer", fieldTooLong, "retailer is longer than %d characters", cfg.MaxRetailerLength)
+	default:
+		if err := validateRetailer(receipt.Retailer); err != nil {
+			add("retailer", fieldInvalid, "%s", err)
+		}
+	}
+
+	//Receipts with more items than the server allows are rejected without any per-item work.
+	tooManyItems := len(receipt.Items) > cfg.MaxItems
+
+	switch {
+	case receipt.Total == nil:
+		add("total", fieldRequired, "total is required")
+	case *receipt.Total < 0:
+		add("total", fieldNegative, "total must not be negative")
+	case !cfg.SkipTotalCheck && !tooManyItems:
+		if err := receipt.checkTotal(cfg.TotalTolerance); err != nil {
+			add("total", fieldMismatch, "%s", err)
+		}
+	}
+
+	//The purchase date and time must parse so the receipt can always be scored.
+	dateErr := validatePurchaseDate(receipt.PurchaseDate)
+	timeErr := validatePurchaseTime(receipt.PurchaseTime)
+
+	switch {
+	case receipt.PurchaseDate == "":
+		add("purchaseDate", fieldRequired, "purchaseDate is required")
+	case dateErr != nil:
+		add("purchaseDate", fieldInvalid, "%s", dateErr)
+	case timeErr == nil:
+		if err := receipt.checkNotFuture(now, cfg.FutureSkew); err != nil {
+			add("purchaseDate", fieldFuture, "%s", err)
+		}
+	}
+
+	switch {
+	case receipt.PurchaseTime == "":
+		add("purchaseTime", fieldRequired, "purchaseTime is required")
+	case timeErr != nil:
+		add("purchaseTime", fieldInvalid, "%s", timeErr)
+	}
+
+	//A receipt needs at least one item, whether the array was omitted or sent empty.
+	switch {
+	case len(receipt.Items) == 0:
+		add("items", fieldRequired, "receipt must contain at least one item")
+	case tooManyItems:
+		add("items", fieldTooMany, "receipt has %d items, the limit is %d", len(receipt.Items), cfg.MaxItems)
+		return errs
+	}
+
+	//Every item requires a description and a non-negative price.
+	for i, item := range receipt.Items {
+		field := fmt.Sprintf("items[%d].shortDescription", i)
+		switch {
+		case strings.TrimSpace(item.Description) == "":
+			add(field, fieldRequired, "%s must not be blank", field)
+		case utf8.RuneCountInString(item.Description) > cfg.MaxDescriptionLength:
+			add(field, fieldTooLong, "%s is longer than %d characters", field, cfg.MaxDescriptionLength)
+		default:
+			if err := validateDescription(i, item.Description); err != nil {
+				add(field, fieldInvalid, "%s", err)
+			}
+		}
+
+		field = fmt.Sprintf("items[%d].price", i)
+		switch {
+		case item.Price == nil:
+			add(field, fieldRequired, "%s is required", field)
+		case *item.Price < 0:
+			add(field, fieldNegative, "%s must not be negative", field)
+		}
+	}
+
+	return errs
+}
+
+// Function to check that the receipt total matches the sum of its item prices within the given tolerance.
+// Receipts with a missing item price are not checked, since the price is reported as missing instead.
+// Returns an error describing both values on a mismatch.
+func (receipt *Receipt) checkTotal(tolerance Amount) error {
+	var sum Amount
+	for _, item := range receipt.Items {
+		if item.Price == nil {
+			return nil
+		}
+		sum += *item.Price
+	}
+
+	diff := *receipt.Total - sum
+	if diff < 0 {
+		diff = -diff
+	}
+
+	if diff > tolerance {
+		return fmt.Errorf("receipt total %s does not match sum of item prices %s", receipt.Total, sum)
+	}
+
+	return nil
+}
+
+// Function to check that the receipt was not purchased further in the future than the allowed skew.
+func (receipt *Receipt) checkNotFuture(now time.Time, skew time.Duration) error {
+	purchasedAt, err := time.ParseInLocation(dateFormat+" "+timeFormat, receipt.PurchaseDate+" "+receipt.PurchaseTime, now.Location())
+	if err != nil {
+		return err
+	}
+
+	if purchasedAt.After(now.Add(skew)) {
+		return fmt.Errorf("purchase date %s %s is in the future", receipt.PurchaseDate, receipt.PurchaseTime)
+	}
+
+	return nil
+}
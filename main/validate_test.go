@@ -0,0 +1,491 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Time receipts are validated against in tests, the noon on 2024-01-01 that servers under test start their clocks at.
+var validationNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Function to decode a receipt body and validate it under the test configuration.
+func validate(t *testing.T, body string) []FieldError {
+	t.Helper()
+
+	return exampleReceipt(t, body).Validate(testConfig(), validationNow)
+}
+
+// Function to list the fields named by validation errors, in the order they were reported.
+func errorFields(errs []FieldError) []string {
+	fields := make([]string, len(errs))
+	for i, e := range errs {
+		fields[i] = e.Field
+	}
+	return fields
+}
+
+// Function to submit a receipt expected to fail validation to the server under test, returning the errors given.
+func (ts *testServer) reject(t *testing.T, body string) []FieldError {
+	t.Helper()
+
+	problem := expectProblem(t, ts.do(t, "POST", "/receipts/process", body), http.StatusUnprocessableEntity, codeValidationFailed)
+	return problem.Errors
+}
+
+func TestValidateReportsEveryMissingField(t *testing.T) {
+	errs := validate(t, `{}`)
+	want := []string{"retailer", "total", "purchaseDate", "purchaseTime", "items"}
+	if !equalIDs(errorFields(errs), want) {
+		t.Fatalf("fields reported for an empty receipt: got %v, want %v", errorFields(errs), want)
+	}
+	for _, e := range errs {
+		if e.Code != fieldRequired {
+			t.Errorf("%s: got code %s, want %s", e.Field, e.Code, fieldRequired)
+		}
+	}
+
+	if errs := validate(t, targetReceipt); len(errs) != 0 {
+		t.Fatalf("example receipt rejected: %v", errs)
+	}
+}
+
+func TestValidateRequiresItemDescriptions(t *testing.T) {
+	for _, description := range []string{"", "   "} {
+		errs := validate(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"`+description+`","price":"1.00"}],"total":"1.00"}`)
+		if len(errs) != 1 || errs[0].Field != "items[0].shortDescription" || errs[0].Code != fieldRequired {
+			t.Errorf("description %q: got %v, want items[0].shortDescription required", description, errs)
+		}
+	}
+}
+
+func TestValidateTellsAZeroTotalFromAMissingOne(t *testing.T) {
+	if errs := validate(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Free sample","price":"0.00"}],"total":"0.00"}`); len(errs) != 0 {
+		t.Fatalf("zero total rejected: %v", errs)
+	}
+
+	errs := validate(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Free sample","price":"0.00"}]}`)
+	if len(errs) != 1 || errs[0].Field != "total" || errs[0].Code != fieldRequired {
+		t.Fatalf("missing total: got %v, want total required", errs)
+	}
+}
+
+func TestEmptyReceiptIsRejectedWithItsMissingFields(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	errs := ts.reject(t, `{}`)
+	want := []string{"retailer", "total", "purchaseDate", "purchaseTime", "items"}
+	if !equalIDs(errorFields(errs), want) {
+		t.Fatalf("fields reported: got %v, want %v", errorFields(errs), want)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("an invalid receipt was stored: %v", ids)
+	}
+}
+
+func TestValidateRejectsImpossibleDatesAndTimes(t *testing.T) {
+	errs := validate(t, `{"retailer":"Target","purchaseDate":"2024-13-45","purchaseTime":"25:99","items":[{"shortDescription":"Gatorade","price":"1.00"}],"total":"1.00"}`)
+	if !equalIDs(errorFields(errs), []string{"purchaseDate", "purchaseTime"}) {
+		t.Fatalf("fields reported: got %v, want [purchaseDate purchaseTime]", errorFields(errs))
+	}
+	for _, e := range errs {
+		if e.Code != fieldInvalid {
+			t.Errorf("%s: got code %s, want %s", e.Field, e.Code, fieldInvalid)
+		}
+	}
+}
+
+func TestUnparseableDatesNeverReachTheStore(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	bad := `{"retailer":"Target","purchaseDate":"2024-13-45","purchaseTime":"banana","items":[{"shortDescription":"Gatorade","price":"1.00"}],"total":"1.00"}`
+
+	ts.reject(t, bad)
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("an unparseable receipt was stored: %v", ids)
+	}
+
+	id := ts.submit(t, targetReceipt)
+	if resp := ts.do(t, "PUT", "/receipts/"+id, bad); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("PUT an unparseable receipt: got %d, want 422", resp.StatusCode)
+	}
+	if got := ts.points(t, id); got != 28 {
+		t.Fatalf("points after a rejected replacement: got %d, want 28", got)
+	}
+}
+
+func TestValidateChecksTheTotalAgainstTheItems(t *testing.T) {
+	oneItem := func(price, total string) string {
+		return `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"` + price + `"}],"total":"` + total + `"}`
+	}
+	cornerTotal := func(total string) string {
+		return strings.Replace(cornerReceipt, `"total":"9.00"`, `"total":"`+total+`"`, 1)
+	}
+
+	for _, test := range []struct {
+		name     string
+		body     string
+		mismatch bool
+	}{
+		{"one item", oneItem("2.25", "2.25"), false},
+		{"one item a cent over", oneItem("2.25", "2.26"), true},
+		{"one item a cent under", oneItem("2.25", "2.24"), true},
+		{"many items", targetReceipt, false},
+		{"many items a cent over", cornerTotal("9.01"), true},
+		{"many items a cent under", cornerTotal("8.99"), true},
+		{"far over", oneItem("1.00", "100.00"), true},
+	} {
+		errs := validate(t, test.body)
+		mismatch := len(errs) == 1 && errs[0].Field == "total" && errs[0].Code == fieldMismatch
+		if mismatch != test.mismatch || (!test.mismatch && len(errs) != 0) {
+			t.Errorf("%s: got %v, want a mismatch %v", test.name, errs, test.mismatch)
+		}
+		if mismatch && !strings.Contains(errs[0].Message, "does not match sum of item prices") {
+			t.Errorf("%s: message %q does not give both values", test.name, errs[0].Message)
+		}
+	}
+
+	//A tolerance lets totals off by up to that much through, and the check can be turned off altogether.
+	body := cornerTotal("9.01")
+	cfg := testConfig()
+	cfg.TotalTolerance = 1
+	if errs := exampleReceipt(t, body).Validate(cfg, validationNow); len(errs) != 0 {
+		t.Errorf("a cent out with a tolerance of a cent: got %v", errs)
+	}
+	cfg.TotalTolerance = 0
+	cfg.SkipTotalCheck = true
+	if errs := exampleReceipt(t, oneItem("1.00", "100.00")).Validate(cfg, validationNow); len(errs) != 0 {
+		t.Errorf("mismatched total with the check skipped: got %v", errs)
+	}
+}
+
+func TestMismatchedTotalIsRejected(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	errs := ts.reject(t, strings.Replace(targetReceipt, `"total":"35.35"`, `"total":"100.00"`, 1))
+	if len(errs) != 1 || errs[0].Field != "total" || errs[0].Code != fieldMismatch {
+		t.Fatalf("errors: got %v, want a total mismatch", errs)
+	}
+}
+
+func TestReceiptsMustHaveItems(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, body := range []string{
+		`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","total":"0.00"}`,
+		`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":null,"total":"0.00"}`,
+		`{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[],"total":"0.00"}`,
+	} {
+		errs := ts.reject(t, body)
+		if len(errs) != 1 || errs[0].Field != "items" || errs[0].Code != fieldRequired {
+			t.Errorf("%s: got %v, want items required", body, errs)
+		}
+	}
+
+	id := ts.submit(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"2.25"}],"total":"2.25"}`)
+	resp := ts.do(t, "GET", "/receipts/"+id, "")
+	var document ReceiptDocument
+	decodeBody(t, resp, &document)
+	if len(document.Items) != 1 || document.Items[0].Description != "Gatorade" {
+		t.Fatalf("single item receipt read back with items %+v", document.Items)
+	}
+}
+
+func TestNegativeAmountsAreRejectedBeforeStoring(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	errs := ts.reject(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"2.00"},{"shortDescription":"Free sample","price":"0.00"},{"shortDescription":"Refund","price":"-7.00"}],"total":"-5.00"}`)
+	want := []string{"total", "items[2].price"}
+	if !equalIDs(errorFields(errs), want) {
+		t.Fatalf("fields reported: got %v, want %v", errorFields(errs), want)
+	}
+	for _, e := range errs {
+		if e.Code != fieldNegative {
+			t.Errorf("%s: got code %s, want %s", e.Field, e.Code, fieldNegative)
+		}
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("a rejected receipt was stored: %v", ids)
+	}
+
+	//Zero priced items and a zero total are legal, for fully discounted receipts.
+	ts.submit(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Free sample","price":"0.00"}],"total":"0.00"}`)
+}
+
+func TestFuturePurchasesAreRejectedPastTheSkew(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	dated := func(date, time string) string {
+		return `{"retailer":"Target","purchaseDate":"` + date + `","purchaseTime":"` + time + `","items":[{"shortDescription":"Gatorade","price":"2.25"}],"total":"2.25"}`
+	}
+
+	//The server clock stands at noon on 2024-01-01 and the default skew is 24 hours.
+	ts.submit(t, dated("2024-01-01", "12:00"))
+	ts.submit(t, dated("2024-01-01", "23:59"))
+	ts.submit(t, dated("2024-01-02", "12:00"))
+	for _, body := range []string{dated("2024-01-02", "12:01"), dated("2099-01-01", "00:00")} {
+		errs := ts.reject(t, body)
+		if len(errs) != 1 || errs[0].Field != "purchaseDate" || errs[0].Code != fieldFuture {
+			t.Errorf("%s: got %v, want purchaseDate in the future", body, errs)
+		}
+	}
+
+	//Moving the clock on lets the same receipt through.
+	ts.clock.Advance(time.Minute)
+	ts.submit(t, dated("2024-01-02", "12:01"))
+}
+
+func TestValidatePurchaseTimeGrammar(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		valid bool
+	}{
+		{"00:00", true},
+		{"23:59", true},
+		{"13:01", true},
+		{"24:00", false},
+		{"14:5", false},
+		{"2:5", false},
+		{"25:61", false},
+		{"14:60", false},
+		{"14:00:00", false},
+		{"ab:cd", false},
+		{" 14:00", false},
+	} {
+		err := validatePurchaseTime(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: got %v, want valid %v", test.value, err, test.valid)
+		}
+		if err != nil && !strings.Contains(err.Error(), "HH:MM between 00:00 and 23:59") {
+			t.Errorf("%q: message %q does not give the accepted form", test.value, err)
+		}
+	}
+}
+
+// Function to build a receipt body with the given number of items.
+func receiptWithItems(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = `{"shortDescription":"Gatorade","price":"1.00"}`
+	}
+	return `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[` + strings.Join(items, ",") + `],"total":"` + strconv.Itoa(n) + `.00"}`
+}
+
+func TestTooManyItemsAreRejectedWithTheLimit(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	ts.submit(t, receiptWithItems(ts.config.MaxItems))
+	errs := ts.reject(t, receiptWithItems(ts.config.MaxItems+1))
+	if len(errs) != 1 || errs[0].Field != "items" || errs[0].Code != fieldTooMany || !strings.Contains(errs[0].Message, "the limit is 1000") {
+		t.Fatalf("errors: got %v, want items too_many stating the limit", errs)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 1 {
+		t.Fatalf("store holds %v, want only the receipt at the limit", ids)
+	}
+}
+
+func BenchmarkValidateTooManyItems(b *testing.B) {
+	price := Amount(100)
+	receipt := &Receipt{Retailer: "Target", Total: &price, PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Items: make([]Item, 500000)}
+	for i := range receipt.Items {
+		receipt.Items[i] = Item{Description: "Gatorade", Price: &price}
+	}
+	cfg := testConfig()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if errs := receipt.Validate(cfg, validationNow); len(errs) != 1 {
+			b.Fatalf("errors: got %v, want items too_many", errs)
+		}
+	}
+}
+
+func TestValidatePurchaseDateIsACalendarDate(t *testing.T) {
+	for _, test := range []struct {
+		date   string
+		reason string
+	}{
+		{"2024-02-29", ""},
+		{"2000-02-29", ""},
+		{"2023-02-29", "day out of range"},
+		{"1900-02-29", "day out of range"},
+		{"2024-02-30", "day out of range"},
+		{"2024-01-32", "day out of range"},
+		{"2024-00-10", "month out of range"},
+		{"2024-13-01", "month out of range"},
+		{"2024-1-01", "expected a date as YYYY-MM-DD"},
+	} {
+		err := validatePurchaseDate(test.date)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.date, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.reason) || !strings.Contains(err.Error(), strconv.Quote(test.date)) {
+			t.Errorf("%s: got %v, want an error echoing the date with %q", test.date, err, test.reason)
+		}
+	}
+}
+
+func TestValidateRetailerPattern(t *testing.T) {
+	for _, test := range []struct {
+		retailer string
+		valid    bool
+	}{
+		{"M&M Corner Market", true},
+		{"Walgreens-Boots", true},
+		{"Target\tExpress", true},
+		{"Café René", true},
+		{"Pizza 🍕 Palace", false},
+		{"Target!", false},
+		{"Bell\x07", false},
+	} {
+		err := validateRetailer(test.retailer)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: got %v, want valid %v", test.retailer, err, test.valid)
+		}
+		if err != nil && !strings.Contains(err.Error(), retailerRegex.String()) {
+			t.Errorf("%q: message %q does not give the pattern", test.retailer, err)
+		}
+	}
+}
+
+func TestBlankDescriptionsEarnNothingAndAreNeverStored(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	errs := ts.reject(t, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"1.00"},{"shortDescription":"   ","price":"10.00"},{"shortDescription":"Pepsi*","price":"1.00"}],"total":"12.00"}`)
+	if !equalIDs(errorFields(errs), []string{"items[1].shortDescription", "items[2].shortDescription"}) {
+		t.Fatalf("fields reported: got %v, want items 1 and 2", errorFields(errs))
+	}
+	if errs[0].Code != fieldRequired || errs[1].Code != fieldInvalid {
+		t.Fatalf("codes: got %s and %s, want %s and %s", errs[0].Code, errs[1].Code, fieldRequired, fieldInvalid)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("a receipt with a blank description was stored: %v", ids)
+	}
+
+	//A trimmed length of 0 is not a multiple of 3, so a blank description scores nothing even if one got through.
+	price := Amount(1000)
+	if score := scoreItem(Item{Description: "   ", Price: &price}, pointsConfig.DescriptionMultiplier); score.Points != 0 {
+		t.Fatalf("blank description scored %d points, want 0", score.Points)
+	}
+}
+
+func TestLongFieldsAreRejectedWithTheirLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBodyBytes = 8 << 20
+	ts := newTestServer(t, cfg)
+	body := func(retailer, description string) string {
+		return `{"retailer":"` + retailer + `","purchaseDate":"2022-01-01","purchaseTime":"13:01","items":[{"shortDescription":"` + description + `","price":"1.00"}],"total":"1.00"}`
+	}
+
+	ts.submit(t, body(strings.Repeat("é", cfg.MaxRetailerLength), strings.Repeat("a", cfg.MaxDescriptionLength)))
+	errs := ts.reject(t, body(strings.Repeat("é", cfg.MaxRetailerLength+1), strings.Repeat("a", cfg.MaxDescriptionLength+1)))
+	if !equalIDs(errorFields(errs), []string{"retailer", "items[0].shortDescription"}) {
+		t.Fatalf("fields reported: got %v, want the retailer and the description", errorFields(errs))
+	}
+	if errs[0].Code != fieldTooLong || !strings.Contains(errs[0].Message, "256") || errs[1].Code != fieldTooLong || !strings.Contains(errs[1].Message, "512") {
+		t.Fatalf("errors: got %v, want both too long, stating the limits", errs)
+	}
+
+	//A pathological retailer is turned away on its length, without being matched against the pattern.
+	errs = ts.reject(t, body(strings.Repeat("&-", 2<<20)+"!", "Gatorade"))
+	if len(errs) != 1 || errs[0].Code != fieldTooLong {
+		t.Fatalf("errors for a 4 MB retailer: got %v, want it too long", errs)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 1 {
+		t.Fatalf("store holds %v, want only the receipt at the limits", ids)
+	}
+}
+
+func TestConfigRejectsLimitsBelowOne(t *testing.T) {
+	for _, test := range []struct {
+		flag string
+		set  func(cfg *Config, limit int)
+	}{
+		{"-max-body-bytes", func(cfg *Config, limit int) { cfg.MaxBodyBytes = int64(limit) }},
+		{"-max-restore-bytes", func(cfg *Config, limit int) { cfg.MaxRestoreBytes = int64(limit) }},
+		{"-max-items", func(cfg *Config, limit int) { cfg.MaxItems = limit }},
+		{"-max-retailer-length", func(cfg *Config, limit int) { cfg.MaxRetailerLength = limit }},
+		{"-max-description-length", func(cfg *Config, limit int) { cfg.MaxDescriptionLength = limit }},
+	} {
+		for _, limit := range []int{0, -1} {
+			cfg := testConfig()
+			test.set(&cfg, limit)
+			if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), test.flag) {
+				t.Errorf("%s %d: got %v, want it rejected", test.flag, limit, err)
+			}
+		}
+
+		cfg := testConfig()
+		test.set(&cfg, 1)
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%s 1: %v", test.flag, err)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblemInOrder(t *testing.T) {
+	errs := validate(t, `{"retailer":"","purchaseDate":"2022-02-30","purchaseTime":"13:01","items":[{"shortDescription":"Gatorade","price":"1.00"},{"shortDescription":"Pepsi","price":"1.00"},{"shortDescription":"Dasani","price":"1.00"},{"shortDescription":"","price":"-1.00"}],"total":"2.00"}`)
+	want := []FieldError{
+		{Field: "retailer", Code: fieldRequired},
+		{Field: "purchaseDate", Code: fieldInvalid},
+		{Field: "items[3].shortDescription", Code: fieldRequired},
+		{Field: "items[3].price", Code: fieldNegative},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors: got %v, want %d", errs, len(want))
+	}
+	for i := range want {
+		if errs[i].Field != want[i].Field || errs[i].Code != want[i].Code || errs[i].Message == "" {
+			t.Errorf("error %d: got %+v, want %s %s", i, errs[i], want[i].Field, want[i].Code)
+		}
+	}
+}
+
+// Function to check a receipt with the validate endpoint of the server under test, returning the answer.
+func (ts *testServer) check(t *testing.T, body string, header ...string) ValidationResponse {
+	t.Helper()
+
+	resp := ts.do(t, "POST", "/receipts/validate", body, header...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /receipts/validate: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var response ValidationResponse
+	decodeBody(t, resp, &response)
+	return response
+}
+
+func TestValidateEndpointGivesTheErrorsSubmittingWould(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	for _, body := range []string{
+		`{}`,
+		strings.Replace(targetReceipt, `"13:01"`, `"25:00"`, 1),
+		strings.Replace(targetReceipt, `"35.35"`, `"35.36"`, 1),
+		strings.Replace(targetReceipt, `"1.26"`, `"1.2x"`, 1),
+		strings.Replace(targetReceipt, `"Target"`, `"Target!"`, 1),
+		strings.Replace(targetReceipt, `"2022-01-01"`, `"2030-01-01"`, 1),
+		`{"retailer":"","purchaseDate":"2022-02-30","purchaseTime":"13:01","items":[{"shortDescription":"","price":"-1.00"}],"total":"2.00"}`,
+	} {
+		submitted := ts.reject(t, body)
+		checked := ts.check(t, body)
+		if checked.Valid || !reflect.DeepEqual(checked.Errors, submitted) {
+			t.Errorf("validate %s:\ngot %+v\nsubmitting gave %+v", body, checked, submitted)
+		}
+	}
+
+	if got := ts.check(t, targetReceipt); !got.Valid || len(got.Errors) != 0 {
+		t.Fatalf("validate a valid receipt: got %+v", got)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("store holds %v after the validations, want nothing", ids)
+	}
+
+	//Bodies that can't be parsed get the same problem from both.
+	for _, path := range []string{"/receipts/process", "/receipts/validate"} {
+		expectProblem(t, ts.do(t, "POST", path, `{"retailer":`), http.StatusBadRequest, codeInvalidJSON)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/buildinfo"
+)
+
+// Struct for returning which build is running and the store it serves receipts from given as JSON.
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Store     string `json:"store"`
+}
+
+// Function to handle requests for the build that is running, as set when it was linked, and its store backend.
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	writeJSON(w, http.StatusOK, VersionResponse{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildDate: info.Date,
+		GoVersion: info.GoVersion,
+		Store:     s.config.Store,
+	})
+}
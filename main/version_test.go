@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/HaysBr18/receipt-processor-challenge/main/buildinfo"
+)
+
+func TestVersionGivesTheLinkedBuildAndStore(t *testing.T) {
+	saved := []string{buildinfo.Version, buildinfo.Commit, buildinfo.Date}
+	t.Cleanup(func() { buildinfo.Version, buildinfo.Commit, buildinfo.Date = saved[0], saved[1], saved[2] })
+	buildinfo.Version, buildinfo.Commit, buildinfo.Date = "v1.4.0", "0123abc", "2024-01-01T12:00:00Z"
+
+	ts := newTestServer(t, testConfig())
+	resp := ts.do(t, "GET", "/version", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-API-Version") != "" {
+		t.Fatalf("GET /version: got %d with X-API-Version %q, want 200 outside the versioned API", resp.StatusCode, resp.Header.Get("X-API-Version"))
+	}
+	var got VersionResponse
+	decodeBody(t, resp, &got)
+	want := VersionResponse{Version: "v1.4.0", Commit: "0123abc", BuildDate: "2024-01-01T12:00:00Z", GoVersion: runtime.Version(), Store: storeMemory}
+	if got != want {
+		t.Fatalf("GET /version: got %+v, want %+v", got, want)
+	}
+
+	expectProblem(t, ts.do(t, "GET", "/v1/version", ""), http.StatusNotFound, codeNotFound)
+}
+
+func TestVersionOfAnUnlinkedBuildIsDev(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	var got VersionResponse
+	decodeBody(t, ts.do(t, "GET", "/version", ""), &got)
+	if got.Version != "dev" || got.Commit != "dev" || got.BuildDate != "dev" || got.GoVersion == "" {
+		t.Fatalf("GET /version: got %+v, want dev for what wasn't linked", got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header carrying the HMAC-SHA256 of a webhook body keyed with the shared secret, as sha256=<hex>.
+const webhookSignatureHeader = "X-Receipt-Signature"
+
+// Number of notifications waiting for each webhook target before new ones are dropped.
+const webhookQueueSize = 256
+
+// Struct for the notification sent to webhook targets when a receipt is processed, given as JSON.
+type ReceiptEvent struct {
+	ID          string    `json:"id"`
+	Retailer    string    `json:"retailer"`
+	Total       *Amount   `json:"total"`
+	Points      int       `json:"points"`
+	ProcessedAt time.Time `json:"processedAt"`
+}
+
+// Type for a flag that may be given more than once, or as a comma separated list, collecting every value.
+type stringList []string
+
+// Function to format the values for the flag's usage text.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Function to add the comma separated values given for the flag.
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// Struct for delivering receipt notifications to webhook targets.
+// Each target has its own queue and delivery goroutine, so a slow or failing target only delays itself,
+// and notifications are dropped rather than waited for when a target's queue is full.
+type webhookNotifier struct {
+	secret []byte
+	client *http.Client
+	queues []chan []byte
+	wg     sync.WaitGroup
+}
+
+// Function to start delivering notifications to the given targets, each request giving up after timeout.
+func newWebhookNotifier(targets []string, secret string, timeout time.Duration) *webhookNotifier {
+	n := &webhookNotifier{
+		secret: []byte(secret),
+		client: &http.Client{Timeout: timeout},
+	}
+	for _, target := range targets {
+		queue := make(chan []byte, webhookQueueSize)
+		n.queues = append(n.queues, queue)
+		n.wg.Add(1)
+		go n.deliver(target, queue)
+	}
+	return n
+}
+
+// Function to queue a notification for every target without waiting for any delivery.
+func (n *webhookNotifier) notify(event ReceiptEvent) {
+	//Leave characters such as & in retailer names as they were submitted.
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		log.Printf("webhook: encoding event for %s: %v", event.ID, err)
+		return
+	}
+	body := buffer.Bytes()
+
+	for _, queue := range n.queues {
+		select {
+		case queue <- body:
+		default:
+			log.Printf("webhook: queue full, dropping event for %s", event.ID)
+		}
+	}
+}
+
+// Function to deliver every notification queued for a target in turn, until the queue is closed.
+// Failed deliveries are logged and not retried.
+func (n *webhookNotifier) deliver(target string, queue <-chan []byte) {
+	defer n.wg.Done()
+
+	for body := range queue {
+		if err := n.post(target, body); err != nil {
+			log.Printf("webhook: delivering to %s: %v", target, err)
+		}
+	}
+}
+
+// Function to post a signed notification to a target.
+func (n *webhookNotifier) post(target string, body []byte) error {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write(body)
+
+	request, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("target answered %s", response.Status)
+	}
+	return nil
+}
+
+// Function to stop accepting notifications and wait, at most for the given time, for those queued to be delivered.
+func (n *webhookNotifier) Close(wait time.Duration) {
+	for _, queue := range n.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait):
+		log.Printf("webhook: gave up waiting for queued deliveries")
+	}
+}
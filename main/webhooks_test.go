@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Struct for a notification received by a webhook target under test.
+type receivedWebhook struct {
+	body      []byte
+	signature string
+}
+
+// Function to start a webhook target that passes every notification it receives to the returned channel,
+// first waiting for release to be closed if it is not nil.
+func newWebhookTarget(t *testing.T, release <-chan struct{}) (*httptest.Server, <-chan receivedWebhook) {
+	t.Helper()
+
+	received := make(chan receivedWebhook, 16)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if release != nil {
+			<-release
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{body: body, signature: r.Header.Get(webhookSignatureHeader)}
+	}))
+	t.Cleanup(target.Close)
+	return target, received
+}
+
+// Function to wait for a notification to arrive at a webhook target under test.
+func nextWebhook(t *testing.T, received <-chan receivedWebhook) receivedWebhook {
+	t.Helper()
+
+	select {
+	case webhook := <-received:
+		return webhook
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook notification arrived")
+		return receivedWebhook{}
+	}
+}
+
+// Function to return the test configuration notifying the given webhook targets.
+func webhookConfig(targets ...string) Config {
+	cfg := testConfig()
+	cfg.WebhookURLs = targets
+	cfg.WebhookSecret = "webhook-secret"
+	return cfg
+}
+
+func TestWebhookNotifiesTargetsOfProcessedReceipts(t *testing.T) {
+	first, firstReceived := newWebhookTarget(t, nil)
+	second, secondReceived := newWebhookTarget(t, nil)
+	ts := newTestServer(t, webhookConfig(first.URL, second.URL))
+
+	id := ts.submit(t, cornerReceipt)
+	for _, received := range []<-chan receivedWebhook{firstReceived, secondReceived} {
+		webhook := nextWebhook(t, received)
+
+		mac := hmac.New(sha256.New, []byte("webhook-secret"))
+		mac.Write(webhook.body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); webhook.signature != want {
+			t.Errorf("signature: got %q, want %q", webhook.signature, want)
+		}
+
+		var event map[string]any
+		if err := json.Unmarshal(webhook.body, &event); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{"id": id, "retailer": "M&M Corner Market", "total": "9.00", "points": float64(109), "processedAt": "2024-01-01T12:00:00Z"}
+		if len(event) != len(want) {
+			t.Errorf("event: got %v, want %v", event, want)
+		}
+		for field, value := range want {
+			if event[field] != value {
+				t.Errorf("event %s: got %v, want %v", field, event[field], value)
+			}
+		}
+	}
+}
+
+func TestWebhookSlowTargetDoesNotDelayTheResponse(t *testing.T) {
+	release := make(chan struct{})
+	target, received := newWebhookTarget(t, release)
+	ts := newTestServer(t, webhookConfig(target.URL))
+	defer close(release)
+
+	start := time.Now()
+	ts.submit(t, targetReceipt)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("submission took %s while the webhook target was stuck", elapsed)
+	}
+	select {
+	case <-received:
+		t.Fatal("the stuck target received a notification")
+	default:
+	}
+}
+
+func TestWebhookNotSentForADuplicate(t *testing.T) {
+	target, received := newWebhookTarget(t, nil)
+	cfg := webhookConfig(target.URL)
+	cfg.Dedupe = true
+	ts := newTestServer(t, cfg)
+
+	first := ts.do(t, "POST", "/receipts/process", targetReceipt)
+	if first.StatusCode != http.StatusCreated {
+		t.Fatalf("first submission: got %d, want 201", first.StatusCode)
+	}
+	nextWebhook(t, received)
+	processed := counterValue(t, receiptsProcessed)
+
+	ts.do(t, "POST", "/receipts/process", targetReceipt)
+	select {
+	case webhook := <-received:
+		t.Fatalf("duplicate notified: %s", webhook.body)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if got := counterValue(t, receiptsProcessed); got != processed {
+		t.Fatalf("receipts processed: got %v after a duplicate, want %v", got, processed)
+	}
+}
+
+// Function to read the value of a Prometheus counter.
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+
+	var metric dto.Metric
+	if err := counter.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Timings of websocket sessions: how long a write may take, how long the connection may go without a
+// message or a pong before it is dropped, and how often it is pinged, well inside the pong wait.
+const (
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = socketPongWait * 9 / 10
+)
+
+// Struct for a message sent by a websocket client, a receipt as submitted to /receipts/process along
+// with an id of the client's choosing that the reply carries back.
+type SocketRequest struct {
+	RequestID string          `json:"requestId"`
+	Receipt   json.RawMessage `json:"receipt"`
+}
+
+// Struct for the reply to a websocket message given as JSON: the id and points of the stored receipt,
+// or why it wasn't stored.
+type SocketReply struct {
+	RequestID string       `json:"requestId"`
+	ID        string       `json:"id,omitempty"`
+	Points    *int         `json:"points,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Struct for the open websocket connections, so they can be closed on shutdown.
+// The HTTP server doesn't track connections once they are taken over by a websocket.
+type socketSet struct {
+	mu     sync.Mutex
+	conns  map[*websocket.Conn]struct{}
+	closed bool
+}
+
+// Function to add a connection, returning false if the server is already shutting down.
+func (set *socketSet) add(conn *websocket.Conn) bool {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if set.closed {
+		return false
+	}
+	if set.conns == nil {
+		set.conns = make(map[*websocket.Conn]struct{})
+	}
+	set.conns[conn] = struct{}{}
+	return true
+}
+
+// Function to remove a connection once its session has ended.
+func (set *socketSet) remove(conn *websocket.Conn) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	delete(set.conns, conn)
+}
+
+// Function to tell every open connection the server is going away and close it, ending their sessions.
+func (set *socketSet) Close() {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	set.closed = true
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn := range set.conns {
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+		conn.Close()
+	}
+}
+
+// Function to handle websocket sessions in which a client submits receipts one message at a time.
+// Each message is a SocketRequest and is checked, scored, and stored like a receipt submitted to /receipts/process,
+// then answered with a SocketReply carrying the same requestId, in the order the messages arrived.
+// Messages are limited to -max-body-bytes. The connection is pinged while open and dropped if the client
+// stops answering, and a message that isn't a SocketRequest gets an error reply without ending the session.
+func (s *Server) socketHandler(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//The upgrader has already written the error response.
+		return
+	}
+	defer conn.Close()
+
+	if !s.sockets.add(conn) {
+		return
+	}
+	defer s.sockets.remove(conn)
+
+	conn.SetReadLimit(s.config.MaxBodyBytes)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	//Ping from a goroutine of its own, control messages may be written alongside the replies.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(socketPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, websocket.ErrReadLimit) {
+				log.Printf("websocket session ended: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(socketPongWait))
+
+		reply := s.socketReply(r, data)
+		conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+// Function to answer a single websocket message.
+func (s *Server) socketReply(r *http.Request, data []byte) SocketReply {
+	var request SocketRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return SocketReply{Error: "Error parsing JSON: " + err.Error()}
+	}
+	if len(request.Receipt) == 0 {
+		return SocketReply{RequestID: request.RequestID, Error: "message has no receipt"}
+	}
+
+	submitted := s.submitJSON(r.Context(), request.Receipt)
+	reply := SocketReply{RequestID: request.RequestID, ID: submitted.ID, Error: submitted.Error, Errors: submitted.Errors}
+	if submitted.ID != "" {
+		reply.Points = &submitted.Points
+	}
+	return reply
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Function to count the open connections of a socket set.
+func (set *socketSet) len() int {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	return len(set.conns)
+}
+
+// Function to open a websocket session with the server under test, closed when the test ends.
+func (ts *testServer) dialSocket(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.http.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing /ws: %v", err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// Function to send a message on a websocket session and read the reply to it.
+func sendSocket(t *testing.T, conn *websocket.Conn, message string) SocketReply {
+	t.Helper()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatalf("sending %s: %v", message, err)
+	}
+	var reply SocketReply
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatalf("reading the reply to %s: %v", message, err)
+	}
+	return reply
+}
+
+func TestSocketRepliesToEachMessageAndKeepsTheSession(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	conn := ts.dialSocket(t)
+
+	reply := sendSocket(t, conn, `{"requestId":"a","receipt":`+targetReceipt+`}`)
+	if reply.RequestID != "a" || reply.ID == "" || reply.Points == nil || *reply.Points != 28 {
+		t.Fatalf("reply to a receipt: got %+v, want its id and 28 points", reply)
+	}
+	if got := ts.points(t, reply.ID); got != 28 {
+		t.Fatalf("points of the receipt submitted over the socket: got %d, want 28", got)
+	}
+
+	invalid := strings.Replace(cornerReceipt, `"9.00"`, `"9.01"`, 1)
+	reply = sendSocket(t, conn, `{"requestId":"b","receipt":`+invalid+`}`)
+	if reply.RequestID != "b" || reply.ID != "" || reply.Points != nil || len(reply.Errors) != 1 || reply.Errors[0].Field != "total" {
+		t.Fatalf("reply to an invalid receipt: got %+v, want total invalid", reply)
+	}
+
+	for _, message := range []string{`not json`, `{"requestId":"c"}`} {
+		if reply := sendSocket(t, conn, message); reply.ID != "" || reply.Error == "" {
+			t.Fatalf("reply to %s: got %+v, want an error", message, reply)
+		}
+	}
+
+	//The session carries on after the errors.
+	reply = sendSocket(t, conn, `{"requestId":"d","receipt":`+cornerReceipt+`}`)
+	if reply.RequestID != "d" || reply.Points == nil || *reply.Points != 109 {
+		t.Fatalf("reply after the errors: got %+v, want 109 points", reply)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 2 {
+		t.Fatalf("store holds %v, want the 2 valid receipts", ids)
+	}
+}
+
+func TestSocketClosesOnAMessageOverTheLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBodyBytes = int64(len(targetReceipt))
+	ts := newTestServer(t, cfg)
+	conn := ts.dialSocket(t)
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"requestId":"a","receipt":`+targetReceipt+`}`)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("reading after a message over the limit: got %v, want a close for a message too big", err)
+	}
+	if ids := storedIDs(t, ts.store); len(ids) != 0 {
+		t.Fatalf("store holds %v, want nothing", ids)
+	}
+}
+
+func TestSocketsAreToldWhenTheServerShutsDown(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	conn := ts.dialSocket(t)
+	sendSocket(t, conn, `{"requestId":"a","receipt":`+targetReceipt+`}`)
+	if n := ts.sockets.len(); n != 1 {
+		t.Fatalf("open sockets: got %d, want 1", n)
+	}
+
+	ts.sockets.Close()
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("reading after shutdown: got %v, want a going away close", err)
+	}
+
+	//Sessions started once the server is shutting down end straight away.
+	late := ts.dialSocket(t)
+	if _, _, err := late.ReadMessage(); err == nil {
+		t.Fatal("session opened during shutdown is still open")
+	}
+}
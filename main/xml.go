@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Media types accepted for XML receipt bodies and XML responses.
+var xmlMediaTypes = []string{"application/xml", "text/xml"}
+
+// Struct for a receipt as it arrives in an XML body, with element names mirroring the JSON field names
+// and items nested as <items><item>...</item></items>. Amounts are kept as text until they are parsed.
+type xmlReceipt struct {
+	XMLName      xml.Name  `xml:"receipt"`
+	Retailer     string    `xml:"retailer"`
+	Total        *string   `xml:"total"`
+	PurchaseDate string    `xml:"purchaseDate"`
+	PurchaseTime string    `xml:"purchaseTime"`
+	Items        []xmlItem `xml:"items>item"`
+}
+
+// Struct for a receipt item as it arrives in an XML body.
+type xmlItem struct {
+	Description string  `xml:"shortDescription"`
+	Price       *string `xml:"price"`
+}
+
+// Function to decode a single receipt from an XML body.
+// Amounts are read like JSON string amounts, so they produce the same *amountFormatError when malformed.
+func decodeXMLReceipt(body io.Reader, opts decodeOptions) (*Receipt, error) {
+	var doc xmlReceipt
+	if err := xml.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	wire := wireReceipt{
+		Retailer:     doc.Retailer,
+		Total:        xmlAmount(doc.Total),
+		PurchaseDate: doc.PurchaseDate,
+		PurchaseTime: doc.PurchaseTime,
+		Items:        make([]wireItem, len(doc.Items)),
+	}
+	for i, item := range doc.Items {
+		wire.Items[i] = wireItem{Description: item.Description, Price: xmlAmount(item.Price)}
+	}
+	return wire.receipt(opts)
+}
+
+// Function to convert an XML amount element into a raw JSON string amount, nil when the element is absent.
+func xmlAmount(text *string) []byte {
+	if text == nil {
+		return nil
+	}
+	return textAmount(strings.TrimSpace(*text))
+}
+
+// Function to report whether a request body is given as XML.
+func isXMLRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && isXMLMediaType(mediaType)
+}
+
+// Function to report whether a media type is one of the XML media types.
+func isXMLMediaType(mediaType string) bool {
+	for _, t := range xmlMediaTypes {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Formats a response body can be written in.
+const (
+	formatJSON     = "json"
+	formatXML      = "xml"
+	formatProtobuf = "protobuf"
+)
+
+// Function to return the response format the client's Accept header prefers: XML, protocol buffers, or JSON.
+// JSON is the default, so another format is only chosen when it is given a higher quality than JSON itself.
+func responseFormat(r *http.Request) string {
+	xmlQuality, protobufQuality, jsonQuality := 0.0, 0.0, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		switch {
+		case isXMLMediaType(mediaType):
+			xmlQuality = max(xmlQuality, quality)
+		case strings.EqualFold(mediaType, protobufMediaType):
+			protobufQuality = max(protobufQuality, quality)
+		case strings.EqualFold(mediaType, "application/json"):
+			jsonQuality = max(jsonQuality, quality)
+		}
+	}
+
+	switch {
+	case protobufQuality > jsonQuality && protobufQuality >= xmlQuality:
+		return formatProtobuf
+	case xmlQuality > jsonQuality:
+		return formatXML
+	}
+	return formatJSON
+}
+
+// Function to write a response body in the format the client prefers, XML, protocol buffers, or by default JSON.
+// Bodies with no protocol buffer form are written as JSON to clients preferring protocol buffers.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	switch responseFormat(r) {
+	case formatXML:
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		io.WriteString(w, xml.Header)
+		xml.NewEncoder(w).Encode(v)
+	case formatProtobuf:
+		if message, ok := v.(protoResponse); ok {
+			writeProtobuf(w, status, message.protoMessage())
+			return
+		}
+		writeJSON(w, status, v)
+	default:
+		writeJSON(w, status, v)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The challenge's Target receipt given as XML, worth 28 points.
+const targetReceiptXML = `<receipt>
+	<retailer>Target</retailer>
+	<purchaseDate>2022-01-01</purchaseDate>
+	<purchaseTime>13:01</purchaseTime>
+	<items>
+		<item><shortDescription>Mountain Dew 12PK</shortDescription><price>6.49</price></item>
+		<item><shortDescription>Emils Cheese Pizza</shortDescription><price>12.25</price></item>
+		<item><shortDescription>Knorr Creamy Chicken</shortDescription><price>1.26</price></item>
+		<item><shortDescription>Doritos Nacho Cheese</shortDescription><price>3.35</price></item>
+		<item><shortDescription>   Klarbrunn 12-PK 12 FL OZ  </shortDescription><price>12.00</price></item>
+	</items>
+	<total>35.35</total>
+</receipt>`
+
+// Headers of requests sending and asking for XML.
+var xmlHeaders = []string{"Content-Type", "application/xml", "Accept", "application/xml"}
+
+// Function to decode an XML response body into v, failing unless it is given as XML.
+func decodeXMLBody(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/xml" {
+		t.Fatalf("%s %s: got Content-Type %q, want application/xml", resp.Request.Method, resp.Request.URL.Path, contentType)
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %s %s response: %v", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+}
+
+func TestXMLReceiptIsScoredAndAnsweredInXML(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	resp := ts.do(t, "POST", "/receipts/process", targetReceiptXML, xmlHeaders...)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST XML: got %d, want 201: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var created ReceiptResponse
+	decodeXMLBody(t, resp, &created)
+	if created.ID == "" {
+		t.Fatal("POST XML: no id in the response")
+	}
+
+	resp = ts.do(t, "GET", "/receipts/"+created.ID+"/points", "", "Accept", "application/xml")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET points as XML: got %d, want 200: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var points PointsResponse
+	decodeXMLBody(t, resp, &points)
+	if points.Points != 28 || points.RuleVersion != ruleVersionV1 {
+		t.Fatalf("points as XML: got %+v, want 28 under %s", points, ruleVersionV1)
+	}
+
+	//The receipt is stored as if it had been submitted as JSON.
+	asJSON := ts.submit(t, targetReceipt)
+	if got, want := ts.stored(t, created.ID), ts.stored(t, asJSON); !reflect.DeepEqual(receiptJSON(t, got), receiptJSON(t, want)) {
+		t.Fatalf("receipt submitted as XML stored as %+v, as JSON as %+v", got, want)
+	}
+}
+
+func TestXMLMalformedAmountGivesTheSameErrorsAsJSON(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	fromJSON := ts.reject(t, strings.Replace(targetReceipt, `"1.26"`, `"1.2x"`, 1))
+	resp := ts.do(t, "POST", "/receipts/process", strings.Replace(targetReceiptXML, "<price>1.26</price>", "<price>1.2x</price>", 1), "Content-Type", "application/xml")
+	fromXML := expectProblem(t, resp, http.StatusUnprocessableEntity, codeValidationFailed).Errors
+	if len(fromJSON) != 1 || !reflect.DeepEqual(fromXML, fromJSON) {
+		t.Fatalf("errors for a malformed price: got %+v as XML, %+v as JSON", fromXML, fromJSON)
+	}
+
+	expectProblem(t, ts.do(t, "POST", "/receipts/process", "<receipt><retailer>", "Content-Type", "application/xml"), http.StatusBadRequest, codeInvalidXML)
+}
+
+func TestResponseFormatFollowsAcceptQualities(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		want   string
+	}{
+		{"", formatJSON},
+		{"*/*", formatJSON},
+		{"application/json", formatJSON},
+		{"application/xml", formatXML},
+		{"text/xml", formatXML},
+		{"application/json;q=0.9, application/xml", formatXML},
+		{"application/xml;q=0.5, application/json", formatJSON},
+		{"text/xml;q=0.8, application/json;q=0.2", formatXML},
+		{"application/xml;q=0.5, application/json;q=0.5", formatJSON},
+		{"application/xml;q=high, application/json;q=0.1", formatJSON},
+		{protobufMediaType + ", application/xml", formatProtobuf},
+		{protobufMediaType + ";q=0.5, application/xml", formatXML},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.accept)
+		if got := responseFormat(r); got != test.want {
+			t.Errorf("Accept %q: got %s, want %s", test.accept, got, test.want)
+		}
+	}
+}